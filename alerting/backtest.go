@@ -0,0 +1,136 @@
+package alerting
+
+import (
+	"fmt"
+	"time"
+
+	"stock-alerts/expr"
+	"stock-alerts/indicators"
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// MaxBacktestFires bounds the fires listed in a backtest result
+const MaxBacktestFires = 1000
+
+// BacktestRule is a rule to replay: a stock threshold, a position rule or an
+// expression, named by the kind of alert it raises
+type BacktestRule struct {
+	Kind       models.AlertKind // THRESHOLD, TRAILING_STOP, STOP_LOSS, TAKE_PROFIT or EXPRESSION
+	Threshold  decimal.Decimal  // THRESHOLD
+	Unit       models.RuleUnit  // position rules, PERCENT by default
+	Value      decimal.Decimal  // position rules
+	AvgCost    decimal.Decimal  // STOP_LOSS and TAKE_PROFIT, and the starting high of TRAILING_STOP
+	Expression string           // EXPRESSION
+}
+
+// BacktestFire is a price at which the rule would have fired
+type BacktestFire struct {
+	Time    time.Time
+	Price   decimal.Decimal
+	Message string
+}
+
+// BacktestResult summarises a replay
+type BacktestResult struct {
+	Prices    int     // prices replayed
+	Fires     int     // alerts the rule would have raised
+	HeldPct   float64 // share of the prices at which the condition held
+	FirstFire *time.Time
+	LastFire  *time.Time
+	FireTimes []BacktestFire // the first MaxBacktestFires fires
+	Truncated bool           // FireTimes stops short of Fires
+}
+
+// evaluator applies one price to a rule, returning whether the condition
+// holds and whether the rule fires
+type evaluator func(price decimal.Decimal) (holds, fire bool, message string)
+
+// newEvaluator checks a rule and builds its evaluator from the functions the
+// alert consumer uses
+func newEvaluator(symbol string, rule BacktestRule) (evaluator, error) {
+	switch rule.Kind {
+	case models.AlertThreshold:
+		if !rule.Threshold.IsPositive() {
+			return nil, fmt.Errorf("threshold must be positive")
+		}
+		return func(price decimal.Decimal) (bool, bool, string) {
+			reached := ThresholdReached(price, rule.Threshold)
+			return reached, reached, fmt.Sprintf("%s at %s reached the threshold %s", symbol, price.StringFixed(2), rule.Threshold.StringFixed(2))
+		}, nil
+
+	case models.AlertKind(models.RuleTrailingStop), models.AlertKind(models.RuleStopLoss), models.AlertKind(models.RuleTakeProfit):
+		stop := models.PositionAlertRule{Symbol: symbol, Type: models.PositionRuleType(rule.Kind), Unit: rule.Unit, Value: rule.Value, HighWater: rule.AvgCost}
+		if stop.Unit == "" {
+			stop.Unit = models.UnitPercent
+		}
+		if stop.Unit != models.UnitPercent && stop.Unit != models.UnitAmount {
+			return nil, fmt.Errorf("unit must be PERCENT or AMOUNT")
+		}
+		if !stop.Value.IsPositive() {
+			return nil, fmt.Errorf("value must be positive")
+		}
+		if stop.Type != models.RuleTrailingStop && !rule.AvgCost.IsPositive() {
+			return nil, fmt.Errorf("avg cost must be positive for %s", rule.Kind)
+		}
+		return func(price decimal.Decimal) (bool, bool, string) {
+			result := EvaluateStop(&stop, rule.AvgCost, price)
+			return result.Holds, result.Fire, StopMessage(stop, price, result)
+		}, nil
+
+	case models.AlertExpression:
+		program, err := expr.Compile(rule.Expression)
+		if err != nil {
+			return nil, err
+		}
+		condition := models.ExpressionRule{Symbol: symbol, Expression: rule.Expression}
+		window := indicators.NewWindow(program.Window())
+		return func(price decimal.Decimal) (bool, bool, string) {
+			window.Push(price.InexactFloat64())
+			result, err := EvaluateCondition(&condition, program, window.Prices())
+			if err != nil {
+				return false, false, "" // the consumer skips such prices too
+			}
+			return result.Holds, result.Fire, ConditionMessage(condition, price.InexactFloat64())
+		}, nil
+	}
+	return nil, fmt.Errorf("kind must be one of THRESHOLD, TRAILING_STOP, STOP_LOSS, TAKE_PROFIT, EXPRESSION")
+}
+
+// Backtest replays a symbol's prices, oldest first, through a rule as the
+// alert consumer would evaluate it, without storing anything. It fails only on an invalid
+// rule; an expression that does not compile returns its *expr.Error.
+func Backtest(symbol string, rule BacktestRule, prices []models.StockPriceRecord) (*BacktestResult, error) {
+	evaluate, err := newEvaluator(symbol, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BacktestResult{Prices: len(prices), FireTimes: []BacktestFire{}}
+	held := 0
+	for _, record := range prices {
+		holds, fire, message := evaluate(record.Price)
+		if holds {
+			held++
+		}
+		if !fire {
+			continue
+		}
+		result.Fires++
+		at := record.Timestamp
+		if result.FirstFire == nil {
+			result.FirstFire = &at
+		}
+		result.LastFire = &at
+		if len(result.FireTimes) < MaxBacktestFires {
+			result.FireTimes = append(result.FireTimes, BacktestFire{Time: at, Price: record.Price, Message: message})
+		} else {
+			result.Truncated = true
+		}
+	}
+	if len(prices) > 0 {
+		result.HeldPct = float64(held) / float64(len(prices)) * 100
+	}
+	return result, nil
+}
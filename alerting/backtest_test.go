@@ -0,0 +1,73 @@
+package alerting
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"stock-alerts/expr"
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+func series(prices ...float64) []models.StockPriceRecord {
+	start := time.Date(2025, 3, 3, 14, 30, 0, 0, time.UTC)
+	records := make([]models.StockPriceRecord, len(prices))
+	for i, price := range prices {
+		records[i] = models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromFloat(price), Timestamp: start.Add(time.Duration(i) * time.Minute)}
+	}
+	return records
+}
+
+func TestBacktestThreshold(t *testing.T) {
+	result, err := Backtest("AAPL", BacktestRule{Kind: models.AlertThreshold, Threshold: decimal.NewFromInt(150)}, series(140, 150, 155, 145))
+	if err != nil {
+		t.Fatalf("Backtest failed: %v", err)
+	}
+	// Like the consumer, a threshold rule fires on every price at or above it
+	if result.Prices != 4 || result.Fires != 2 || result.HeldPct != 50 {
+		t.Errorf("Expected 2 fires over 4 prices, got %+v", result)
+	}
+	if !result.FirstFire.Equal(series(0, 0)[1].Timestamp) || !result.FireTimes[1].Price.Equal(decimal.NewFromInt(155)) {
+		t.Errorf("Unexpected fire times: %+v", result.FireTimes)
+	}
+}
+
+func TestBacktestStopsAndExpressions(t *testing.T) {
+	prices := series(100, 110, 98, 97, 112, 95)
+
+	result, _ := Backtest("AAPL", BacktestRule{Kind: "TRAILING_STOP", Value: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(100)}, prices)
+	if result.Fires != 2 || !result.FireTimes[0].Price.Equal(decimal.NewFromInt(98)) || !result.FireTimes[1].Price.Equal(decimal.NewFromInt(95)) {
+		t.Errorf("Expected the trailing stop to fire at 98 and, after a new high, at 95, got %+v", result)
+	}
+
+	result, _ = Backtest("AAPL", BacktestRule{Kind: "STOP_LOSS", Unit: models.UnitAmount, Value: decimal.NewFromInt(3), AvgCost: decimal.NewFromInt(100)}, prices)
+	if result.Fires != 2 {
+		t.Errorf("Expected the stop-loss to fire, re-arm and fire again, got %+v", result)
+	}
+
+	result, _ = Backtest("AAPL", BacktestRule{Kind: models.AlertExpression, Expression: "price < prev * 0.95"}, prices)
+	if result.Fires != 2 || !result.FireTimes[0].Price.Equal(decimal.NewFromInt(98)) || !result.FireTimes[1].Price.Equal(decimal.NewFromInt(95)) {
+		t.Errorf("Expected the expression to fire at 98 and 95, got %+v", result)
+	}
+}
+
+func TestBacktestInvalidRules(t *testing.T) {
+	for _, rule := range []BacktestRule{
+		{Kind: "VOLUME"},
+		{Kind: models.AlertThreshold},
+		{Kind: "STOP_LOSS", Value: decimal.NewFromInt(5)},
+		{Kind: "TAKE_PROFIT", Unit: "SHARES", Value: decimal.NewFromInt(5), AvgCost: decimal.NewFromInt(10)},
+	} {
+		if _, err := Backtest("AAPL", rule, nil); err == nil {
+			t.Errorf("Expected %+v to be rejected", rule)
+		}
+	}
+
+	_, err := Backtest("AAPL", BacktestRule{Kind: models.AlertExpression, Expression: "price >"}, nil)
+	var exprErr *expr.Error
+	if !errors.As(err, &exprErr) {
+		t.Errorf("Expected an expression error, got %v", err)
+	}
+}
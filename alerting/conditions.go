@@ -0,0 +1,50 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+
+	"stock-alerts/expr"
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// ThresholdReached reports whether a price sets off a stock threshold rule.
+// Threshold rules fire on every price at or above the threshold, compared
+// exactly, so a price equal to the threshold always fires.
+func ThresholdReached(price, threshold decimal.Decimal) bool {
+	return price.GreaterThanOrEqual(threshold)
+}
+
+// ConditionResult is the outcome of a price for an expression rule
+type ConditionResult struct {
+	Holds        bool // the condition is true
+	Fire         bool // the condition has just started to hold
+	StateChanged bool // Triggered changed and should be stored
+}
+
+// EvaluateCondition applies a symbol's latest prices, oldest first, to an
+// expression rule and updates its trigger state in place. A rule without
+// enough price history yet neither holds nor changes state.
+func EvaluateCondition(rule *models.ExpressionRule, program *expr.Program, prices []float64) (ConditionResult, error) {
+	holds, err := program.Eval(prices)
+	if errors.Is(err, expr.ErrNotReady) {
+		return ConditionResult{}, nil
+	}
+	if err != nil {
+		return ConditionResult{}, err
+	}
+	result := ConditionResult{
+		Holds:        holds,
+		Fire:         holds && !rule.Triggered,
+		StateChanged: holds != rule.Triggered,
+	}
+	rule.Triggered = holds
+	return result, nil
+}
+
+// ConditionMessage describes a fired expression rule
+func ConditionMessage(rule models.ExpressionRule, price float64) string {
+	return fmt.Sprintf("%s at %.2f: %s", rule.Symbol, price, rule.Expression)
+}
@@ -0,0 +1,58 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+
+	"stock-alerts/models"
+)
+
+// snoozeKey identifies the rule behind an alert. A rule only raises alerts of
+// one kind, so the kind tells which table the rule ID is from.
+type snoozeKey struct {
+	kind   models.AlertKind
+	ruleID uint
+}
+
+// Snoozes tracks the rules whose alerts are snoozed and until when
+type Snoozes struct {
+	mu    sync.RWMutex
+	until map[snoozeKey]time.Time
+}
+
+// NewSnoozes returns an empty set of snoozes
+func NewSnoozes() *Snoozes {
+	return &Snoozes{until: map[snoozeKey]time.Time{}}
+}
+
+// Replace swaps the snoozes for those of the given snoozed alerts
+func (s *Snoozes) Replace(alerts []models.Alert) {
+	until := map[snoozeKey]time.Time{}
+	for _, alert := range alerts {
+		if alert.Status != models.AlertSnoozed || alert.RuleID == nil || alert.SnoozedUntil == nil {
+			continue
+		}
+		key := snoozeKey{alert.Kind, *alert.RuleID}
+		if alert.SnoozedUntil.After(until[key]) {
+			until[key] = *alert.SnoozedUntil
+		}
+	}
+	s.mu.Lock()
+	s.until = until
+	s.mu.Unlock()
+}
+
+// Suppressed reports whether a rule's alerts are snoozed at the given time
+func (s *Snoozes) Suppressed(kind models.AlertKind, ruleID uint, at time.Time) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	until, ok := s.until[snoozeKey{kind, ruleID}]
+	return ok && at.Before(until)
+}
+
+// Len returns the number of snoozed rules
+func (s *Snoozes) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.until)
+}
@@ -0,0 +1,35 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"stock-alerts/models"
+)
+
+func TestSnoozes(t *testing.T) {
+	now := time.Date(2025, 3, 3, 14, 30, 0, 0, time.UTC)
+	ruleID := uint(3)
+	soon, later := now.Add(time.Hour), now.Add(2*time.Hour)
+
+	snoozes := NewSnoozes()
+	snoozes.Replace([]models.Alert{
+		{Kind: models.AlertThreshold, RuleID: &ruleID, Status: models.AlertSnoozed, SnoozedUntil: &soon},
+		{Kind: models.AlertThreshold, RuleID: &ruleID, Status: models.AlertSnoozed, SnoozedUntil: &later},
+		{Kind: models.AlertExpression, RuleID: &ruleID, Status: models.AlertResolved, SnoozedUntil: &later},
+		{Kind: models.AlertExpression, Status: models.AlertSnoozed, SnoozedUntil: &later},
+	})
+
+	if snoozes.Len() != 1 {
+		t.Fatalf("Expected one snoozed rule, got %d", snoozes.Len())
+	}
+	if !snoozes.Suppressed(models.AlertThreshold, ruleID, soon) {
+		t.Errorf("Expected the latest snooze to win")
+	}
+	if snoozes.Suppressed(models.AlertThreshold, ruleID, later) {
+		t.Errorf("Expected the snooze to end at its until time")
+	}
+	if snoozes.Suppressed(models.AlertExpression, ruleID, now) {
+		t.Errorf("Expected a rule of another kind not to be suppressed")
+	}
+}
@@ -0,0 +1,77 @@
+// Package alerting holds the rule evaluation shared by the alert consumer and
+// anything that replays prices through the same rules.
+package alerting
+
+import (
+	"fmt"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// StopResult is the outcome of a price for a position alert rule
+type StopResult struct {
+	Level        decimal.Decimal // price at which the rule holds
+	Holds        bool            // the price is at or beyond the level
+	Fire         bool            // the rule has just started to hold
+	StateChanged bool            // HighWater or Triggered changed and should be stored
+}
+
+// offset turns a rule's Value into a price distance from base
+func offset(rule models.PositionAlertRule, base decimal.Decimal) decimal.Decimal {
+	if rule.Unit == models.UnitAmount {
+		return rule.Value
+	}
+	return base.Mul(rule.Value).Div(decimal.NewFromInt(100))
+}
+
+// StopLevel returns the price at which a rule holds for the given average cost
+func StopLevel(rule models.PositionAlertRule, avgCost decimal.Decimal) decimal.Decimal {
+	switch rule.Type {
+	case models.RuleTrailingStop:
+		return rule.HighWater.Sub(offset(rule, rule.HighWater))
+	case models.RuleStopLoss:
+		return avgCost.Sub(offset(rule, avgCost))
+	case models.RuleTakeProfit:
+		return avgCost.Add(offset(rule, avgCost))
+	}
+	return decimal.Zero
+}
+
+// EvaluateStop applies a price to a position alert rule, raising its
+// high-water mark and updating its trigger state in place
+func EvaluateStop(rule *models.PositionAlertRule, avgCost, price decimal.Decimal) StopResult {
+	var result StopResult
+	if rule.Type == models.RuleTrailingStop && price.GreaterThan(rule.HighWater) {
+		rule.HighWater = price
+		result.StateChanged = true
+	}
+
+	result.Level = StopLevel(*rule, avgCost)
+	if rule.Type == models.RuleTakeProfit {
+		result.Holds = price.GreaterThanOrEqual(result.Level)
+	} else {
+		result.Holds = price.LessThanOrEqual(result.Level)
+	}
+
+	result.Fire = result.Holds && !rule.Triggered
+	if rule.Triggered != result.Holds {
+		rule.Triggered = result.Holds
+		result.StateChanged = true
+	}
+	return result
+}
+
+// StopMessage describes a fired position alert rule
+func StopMessage(rule models.PositionAlertRule, price decimal.Decimal, result StopResult) string {
+	switch rule.Type {
+	case models.RuleTrailingStop:
+		return fmt.Sprintf("Trailing stop on %s: %s fell to the stop at %s (high %s)", rule.Symbol, price.StringFixed(2), result.Level.StringFixed(2), rule.HighWater.StringFixed(2))
+	case models.RuleStopLoss:
+		return fmt.Sprintf("Stop-loss on %s: %s fell to the stop at %s", rule.Symbol, price.StringFixed(2), result.Level.StringFixed(2))
+	case models.RuleTakeProfit:
+		return fmt.Sprintf("Take-profit on %s: %s reached the target at %s", rule.Symbol, price.StringFixed(2), result.Level.StringFixed(2))
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package alerting
+
+import (
+	"testing"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestTrailingStop(t *testing.T) {
+	rule := models.PositionAlertRule{Symbol: "AAPL", Type: models.RuleTrailingStop, Unit: models.UnitPercent, Value: decimal.NewFromInt(10), HighWater: decimal.NewFromInt(100)}
+
+	result := EvaluateStop(&rule, decimal.NewFromInt(100), decimal.NewFromInt(150))
+	if !rule.HighWater.Equal(decimal.NewFromInt(150)) || !result.StateChanged || result.Holds {
+		t.Errorf("Expected the high water to rise to 150, got %+v %+v", rule, result)
+	}
+	if !result.Level.Equal(decimal.NewFromInt(135)) {
+		t.Errorf("Expected a stop at 135, got %s", result.Level)
+	}
+
+	result = EvaluateStop(&rule, decimal.NewFromInt(100), decimal.NewFromInt(140))
+	if result.Fire || result.StateChanged {
+		t.Errorf("Expected no change at 140, got %+v", result)
+	}
+
+	result = EvaluateStop(&rule, decimal.NewFromInt(100), decimal.NewFromInt(135))
+	if !result.Fire || !rule.Triggered || !result.StateChanged {
+		t.Errorf("Expected the stop to fire at 135, got %+v", result)
+	}
+
+	result = EvaluateStop(&rule, decimal.NewFromInt(100), decimal.NewFromInt(130))
+	if result.Fire || !result.Holds {
+		t.Errorf("Expected the stop to fire only once, got %+v", result)
+	}
+}
+
+func TestTrailingStopAmount(t *testing.T) {
+	rule := models.PositionAlertRule{Type: models.RuleTrailingStop, Unit: models.UnitAmount, Value: decimal.NewFromInt(5), HighWater: decimal.NewFromInt(50)}
+	EvaluateStop(&rule, decimal.NewFromInt(40), decimal.NewFromInt(60))
+	if result := EvaluateStop(&rule, decimal.NewFromInt(40), decimal.NewFromInt(55)); !result.Fire || !result.Level.Equal(decimal.NewFromInt(55)) {
+		t.Errorf("Expected the stop to fire at 55, got %+v", result)
+	}
+}
+
+func TestStopLossAndTakeProfit(t *testing.T) {
+	stopLoss := models.PositionAlertRule{Type: models.RuleStopLoss, Unit: models.UnitPercent, Value: decimal.NewFromInt(20)}
+	if result := EvaluateStop(&stopLoss, decimal.NewFromInt(100), decimal.NewFromInt(81)); result.Holds {
+		t.Errorf("Expected no stop-loss at 81, got %+v", result)
+	}
+	if result := EvaluateStop(&stopLoss, decimal.NewFromInt(100), decimal.NewFromInt(80)); !result.Fire {
+		t.Errorf("Expected the stop-loss to fire at 80, got %+v", result)
+	}
+	if !stopLoss.HighWater.IsZero() {
+		t.Errorf("Expected a stop-loss to leave the high water alone, got %s", stopLoss.HighWater)
+	}
+
+	takeProfit := models.PositionAlertRule{Type: models.RuleTakeProfit, Unit: models.UnitAmount, Value: decimal.NewFromInt(25)}
+	if result := EvaluateStop(&takeProfit, decimal.NewFromInt(100), decimal.NewFromInt(125)); !result.Fire {
+		t.Errorf("Expected the take-profit to fire at 125, got %+v", result)
+	}
+
+	// Falling back below the target re-arms the rule
+	if result := EvaluateStop(&takeProfit, decimal.NewFromInt(100), decimal.NewFromInt(120)); result.Holds || takeProfit.Triggered {
+		t.Errorf("Expected the take-profit to re-arm at 120, got %+v", result)
+	}
+	if result := EvaluateStop(&takeProfit, decimal.NewFromInt(100), decimal.NewFromInt(130)); !result.Fire {
+		t.Errorf("Expected the take-profit to fire again at 130, got %+v", result)
+	}
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"expvar"
 	"log"
+	"stock-alerts/corporate"
 	"stock-alerts/db"
+	"stock-alerts/repository"
 	"stock-alerts/routes"
 	"stock-alerts/services"
+	"stock-alerts/symbols"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -18,19 +23,35 @@ func main() {
 	}
 
 	// Connect DB
-	db.ConnectDatabase()
+	database, err := db.ConnectDatabase()
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	repos := repository.NewGormRepositories(database)
+
+	// Load the bundled symbol listing on first start
+	catalog := symbols.NewCatalog(repos.Symbols, symbols.AlphaVantageFromEnv())
+	if err := catalog.Seed(); err != nil {
+		log.Fatal("❌ Failed to seed the symbol catalog: ", err)
+	}
 
 	// Init Kafka Producer (for publishing stock data)
 	services.InitKafkaProducer()
 
 	// Start background stock fetcher (produces to Kafka)
-	services.StartFetcher()
+	services.NewFetcher(repos).Start()
+
+	// Apply splits and renames as their effective dates begin
+	corporate.NewApplier(repos, services.RulePublisher{}).Start(15 * time.Minute)
 
 	// Setup router
 	r := gin.Default()
 
 	// Register routes
-	routes.RegisterRoutes(r)
+	routes.RegisterRoutes(r, routes.NewHandler(repos, services.RulePublisher{}, catalog))
+
+	// Counters such as price_quality, as JSON
+	r.GET("/debug/vars", gin.WrapH(expvar.Handler()))
 
 	log.Println("🚀 API service starting on port 8080")
 	// Start server
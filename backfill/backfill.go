@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"stock-alerts/calendar"
+	"stock-alerts/events"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+	"stock-alerts/timeseries"
+)
+
+// pricePublisher republishes history to the stock prices topic
+type pricePublisher interface {
+	PublishPrices(prices []events.StockPrice) error
+}
+
+// backfiller writes a source's bars to the bar tables. Bars are upserted by
+// symbol and bucket, so running a range again overwrites it with the same
+// bars instead of adding to it.
+type backfiller struct {
+	source    source
+	bars      repository.BarRepo
+	publisher pricePublisher // nil unless replaying
+}
+
+// run backfills one symbol's bars of the given intervals in [from, to). A
+// daily series is stored as 1d bars; an intraday one as 1m bars, rolled up
+// into 1h bars, and into 1d bars too when no daily series is fetched.
+func (b *backfiller) run(symbol string, intervals []models.BarInterval, from, to time.Time) error {
+	daily := false
+	for _, interval := range intervals {
+		daily = daily || interval == models.Interval1d
+	}
+	// The finest series replays; a coarser one would repeat its prices
+	finest := finestOf(intervals)
+
+	var replay []models.PriceBar
+	for _, interval := range intervals {
+		bars, err := b.source.Bars(symbol, interval, from, to)
+		if err != nil {
+			return err
+		}
+		if err := b.bars.Upsert(interval, bars); err != nil {
+			return err
+		}
+		log.Printf("📥 Stored %d %s bars of %s\n", len(bars), interval, symbol)
+
+		if interval == models.Interval1m {
+			if err := b.rollup(symbol, models.Interval1m, models.Interval1h, from, to); err != nil {
+				return err
+			}
+			if !daily {
+				if err := b.rollup(symbol, models.Interval1h, models.Interval1d, from, to); err != nil {
+					return err
+				}
+			}
+		}
+		if interval == finest {
+			replay = bars
+		}
+	}
+
+	if b.publisher == nil || len(replay) == 0 {
+		return nil
+	}
+	if err := b.publisher.PublishPrices(replayPrices(replay, finest)); err != nil {
+		return fmt.Errorf("replay of %s failed: %w", symbol, err)
+	}
+	log.Printf("🔁 Replayed %d prices of %s\n", len(replay), symbol)
+	return nil
+}
+
+// rollup merges the stored bars of source in [from, to) into target bars,
+// which then hold live and backfilled prices alike
+func (b *backfiller) rollup(symbol string, source, target models.BarInterval, from, to time.Time) error {
+	bars, err := b.bars.List(source, symbol, timeseries.BucketOf(from, target), to)
+	if err != nil {
+		return err
+	}
+	return b.bars.Upsert(target, timeseries.Merge(bars, target))
+}
+
+// finestOf returns the finest of the intervals
+func finestOf(intervals []models.BarInterval) models.BarInterval {
+	finest := intervals[0]
+	for _, interval := range intervals[1:] {
+		if interval.Duration() < finest.Duration() {
+			finest = interval
+		}
+	}
+	return finest
+}
+
+// replayPrices turns bars into price events at the time each bar's close
+// was the price: the end of its minute or hour, or the session close of a
+// daily bar, so the analytics consumer files them under the right date
+func replayPrices(bars []models.PriceBar, interval models.BarInterval) []events.StockPrice {
+	prices := make([]events.StockPrice, 0, len(bars))
+	for _, bar := range bars {
+		at := bar.Bucket.Add(interval.Duration() - time.Second)
+		if interval == models.Interval1d {
+			exchange := calendar.ForSymbol(bar.Symbol)
+			at = time.Date(bar.Bucket.Year(), bar.Bucket.Month(), bar.Bucket.Day(), 12, 0, 0, 0, exchange.Location)
+			if session, ok := exchange.SessionOn(at); ok {
+				at = session.Close.Add(-time.Second)
+			}
+		}
+		prices = append(prices, events.StockPrice{Symbol: bar.Symbol, Price: bar.Close, Time: at, Replay: true})
+	}
+	return prices
+}
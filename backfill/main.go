@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"stock-alerts/db"
+	"stock-alerts/events"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/joho/godotenv"
+	"github.com/segmentio/kafka-go"
+)
+
+const usage = `usage: backfill [flags] [SYMBOL...]
+
+Stores the daily and intraday bars of the symbols, or of every watched
+symbol with -watched, in the price history.
+
+flags:`
+
+func main() {
+	from := flag.String("from", "", "first date to backfill, YYYY-MM-DD (required)")
+	to := flag.String("to", "", "last date to backfill, YYYY-MM-DD (default today)")
+	series := flag.String("series", "daily", "daily, intraday (1-minute bars) or both")
+	archivePath := flag.String("csv", "", "read bars from this CSV archive instead of the provider")
+	watched := flag.Bool("watched", false, "backfill every symbol with a stock rule or position")
+	replay := flag.Bool("replay", false, "republish the bars to Kafka for the analytics consumer")
+	pause := flag.Duration("pause", 12*time.Second, "wait between provider requests")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Load environment variables from .env file
+	err := godotenv.Load()
+	if err != nil {
+		log.Println("Warning: .env file not found, using system environment variables")
+	}
+
+	start, end, err := dateRange(*from, *to, time.Now())
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	intervals, err := seriesIntervals(*series)
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	if !*watched && flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	database, err := db.ConnectDatabase()
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	repos := repository.NewGormRepositories(database)
+
+	symbols := flag.Args()
+	if *watched {
+		if symbols, err = watchedSymbols(repos); err != nil {
+			log.Fatal("❌ ", err)
+		}
+	}
+
+	b := &backfiller{bars: repos.Bars}
+	if *archivePath != "" {
+		b.source = archive{path: *archivePath}
+	} else {
+		apiKey := os.Getenv("ALPHA_VANTAGE_API_KEY")
+		if apiKey == "" {
+			log.Fatal("❌ ALPHA_VANTAGE_API_KEY environment variable not set")
+		}
+		b.source = newAlphaVantage(apiKey, *pause)
+	}
+	if *replay {
+		broker := os.Getenv("KAFKA_BROKER")
+		if broker == "" {
+			broker = "127.0.0.1:9093" // fallback for local development
+		}
+		writer := &kafka.Writer{
+			Addr:     kafka.TCP(broker),
+			Topic:    events.TopicStockPrices,
+			Balancer: &kafka.Hash{}, // keep the prices of one symbol in order
+		}
+		defer writer.Close()
+		b.publisher = kafkaPricePublisher{writer}
+	}
+
+	log.Printf("⏪ Backfilling %d symbols from %s to %s\n", len(symbols), start.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02"))
+	failed := 0
+	for _, symbol := range symbols {
+		if err := b.run(strings.ToUpper(symbol), intervals, start, end); err != nil {
+			log.Printf("❌ Backfill of %s failed: %v\n", symbol, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("❌ %d of %d symbols failed", failed, len(symbols))
+	}
+	log.Println("✅ Backfill complete")
+}
+
+// dateRange parses the -from and -to dates into [start, end) at midnight UTC
+func dateRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	if from == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("-from is required")
+	}
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("-from must be a YYYY-MM-DD date")
+	}
+	last := now.UTC().Truncate(24 * time.Hour)
+	if to != "" {
+		if last, err = time.Parse("2006-01-02", to); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("-to must be a YYYY-MM-DD date")
+		}
+	}
+	if last.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("-to must not be before -from")
+	}
+	return start, last.AddDate(0, 0, 1), nil
+}
+
+// seriesIntervals maps -series to the bar intervals fetched
+func seriesIntervals(series string) ([]models.BarInterval, error) {
+	switch series {
+	case "daily":
+		return []models.BarInterval{models.Interval1d}, nil
+	case "intraday":
+		return []models.BarInterval{models.Interval1m}, nil
+	case "both":
+		return []models.BarInterval{models.Interval1d, models.Interval1m}, nil
+	}
+	return nil, fmt.Errorf("-series must be daily, intraday or both")
+}
+
+// watchedSymbols lists the symbols of every stock rule and position, sorted
+func watchedSymbols(repos repository.Repositories) ([]string, error) {
+	stocks, err := repos.Stocks.List()
+	if err != nil {
+		return nil, err
+	}
+	positions, err := repos.Positions.List()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, stock := range stocks {
+		seen[stock.StockSymbol] = true
+	}
+	for _, position := range positions {
+		seen[position.Symbol] = true
+	}
+	symbols := make([]string, 0, len(seen))
+	for symbol := range seen {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols, nil
+}
+
+// kafkaPricePublisher writes replayed prices to the stock prices topic
+type kafkaPricePublisher struct {
+	writer *kafka.Writer
+}
+
+// replayBatch is the number of prices per Kafka write
+const replayBatch = 500
+
+func (p kafkaPricePublisher) PublishPrices(prices []events.StockPrice) error {
+	for len(prices) > 0 {
+		n := min(len(prices), replayBatch)
+		messages := make([]kafka.Message, 0, n)
+		for _, price := range prices[:n] {
+			data, _ := json.Marshal(price)
+			messages = append(messages, kafka.Message{Key: []byte(price.Symbol), Value: data})
+		}
+		if err := p.writer.WriteMessages(context.Background(), messages...); err != nil {
+			return err
+		}
+		prices = prices[n:]
+	}
+	return nil
+}
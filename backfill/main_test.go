@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-alerts/calendar"
+	"stock-alerts/events"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/shopspring/decimal"
+)
+
+type fakePublisher struct {
+	prices []events.StockPrice
+}
+
+func (f *fakePublisher) PublishPrices(prices []events.StockPrice) error {
+	f.prices = append(f.prices, prices...)
+	return nil
+}
+
+const archiveCSV = `symbol,interval,time,open,high,low,close
+AAPL,1m,2025-03-03T14:30:00Z,100,101,99.5,100.5
+AAPL,1m,2025-03-03T14:31:00Z,100.5,102,100,101.25
+AAPL,1m,2025-03-03T15:00:00Z,101,101,98,98.5
+MSFT,1m,2025-03-03T14:30:00Z,400,401,399,400
+AAPL,1m,2025-03-04T14:30:00Z,97,97,96,96.5
+AAPL,1d,2025-03-03,100,102,98,98.5
+`
+
+func writeArchive(t *testing.T) archive {
+	path := filepath.Join(t.TempDir(), "bars.csv")
+	if err := os.WriteFile(path, []byte(archiveCSV), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return archive{path: path}
+}
+
+// Test that backfilling a range twice leaves the same bars, rolled up with
+// the live bars already stored
+func TestBackfillIsIdempotent(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	live := models.PriceBar{Symbol: "AAPL", Bucket: time.Date(2025, 3, 3, 14, 45, 0, 0, time.UTC),
+		Open: decimal.NewFromInt(103), High: decimal.NewFromInt(104), Low: decimal.NewFromInt(103), Close: decimal.NewFromInt(103), Count: 3}
+	repos.Bars.Upsert(models.Interval1m, []models.PriceBar{live})
+
+	b := &backfiller{source: writeArchive(t), bars: repos.Bars}
+	from, to := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err := b.run("AAPL", []models.BarInterval{models.Interval1m}, from, to); err != nil {
+			t.Fatalf("Backfill failed: %v", err)
+		}
+	}
+
+	minutes, _ := repos.Bars.List(models.Interval1m, "AAPL", from, to)
+	if len(minutes) != 4 {
+		t.Errorf("Expected 3 backfilled minutes and the live one, got %+v", minutes)
+	}
+	hours, _ := repos.Bars.List(models.Interval1h, "AAPL", from, to)
+	if len(hours) != 2 || !hours[0].High.Equal(decimal.NewFromInt(104)) || !hours[0].Close.Equal(decimal.NewFromInt(103)) || hours[0].Count != 5 {
+		t.Errorf("Expected the 14:00 hour to merge backfilled and live minutes, got %+v", hours)
+	}
+	days, _ := repos.Bars.List(models.Interval1d, "AAPL", from, to)
+	if len(days) != 1 || !days[0].Low.Equal(decimal.NewFromInt(98)) || !days[0].Close.Equal(decimal.RequireFromString("98.5")) {
+		t.Errorf("Expected a day rolled up from the hours, got %+v", days)
+	}
+	if bars, _ := repos.Bars.List(models.Interval1m, "MSFT", from, to); len(bars) != 0 {
+		t.Errorf("Expected only AAPL to be backfilled, got %+v", bars)
+	}
+}
+
+// Test that a replay republishes the finest series, flagged, at the time of
+// each close
+func TestBackfillReplay(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	publisher := &fakePublisher{}
+	b := &backfiller{source: writeArchive(t), bars: repos.Bars, publisher: publisher}
+	from, to := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC)
+	if err := b.run("AAPL", []models.BarInterval{models.Interval1d, models.Interval1m}, from, to); err != nil {
+		t.Fatalf("Backfill failed: %v", err)
+	}
+
+	if len(publisher.prices) != 4 {
+		t.Fatalf("Expected the 4 minutes to be replayed, got %+v", publisher.prices)
+	}
+	first := publisher.prices[0]
+	if !first.Replay || !first.Price.Equal(decimal.RequireFromString("100.5")) || !first.Time.Equal(time.Date(2025, 3, 3, 14, 30, 59, 0, time.UTC)) {
+		t.Errorf("Expected the first minute's close at the end of the minute, got %+v", first)
+	}
+	// The provider's daily bar stays; it is not rolled up from the minutes
+	if days, _ := repos.Bars.List(models.Interval1d, "AAPL", from, to); len(days) != 1 || !days[0].High.Equal(decimal.NewFromInt(102)) {
+		t.Errorf("Expected the daily bar from the archive, got %+v", days)
+	}
+
+	daily := replayPrices([]models.PriceBar{{Symbol: "AAPL", Bucket: from, Close: decimal.NewFromInt(1)}}, models.Interval1d)
+	if date := calendar.NYSE.TradingDate(daily[0].Time); !date.Equal(from) || daily[0].Time.In(calendar.NYSE.Location).Hour() != 15 {
+		t.Errorf("Expected a daily close just before the session close on its date, got %v", daily[0].Time)
+	}
+}
+
+func TestAlphaVantageSeries(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		queries = append(queries, q.Get("function")+" "+q.Get("symbol")+q.Get("market")+q.Get("month"))
+		switch q.Get("function") {
+		case "TIME_SERIES_INTRADAY":
+			w.Write([]byte(`{"Meta Data": {"1. Information": "Intraday (1min)", "6. Time Zone": "US/Eastern"},
+				"Time Series (1min)": {
+					"2025-03-03 09:31:00": {"1. open": "100.10", "2. high": "100.20", "3. low": "100.00", "4. close": "100.15", "5. volume": "1200"},
+					"2025-02-28 15:59:00": {"1. open": "99", "2. high": "99", "3. low": "99", "4. close": "99", "5. volume": "10"}
+				}}`))
+		case "DIGITAL_CURRENCY_DAILY":
+			w.Write([]byte(`{"Meta Data": {"7. Time Zone": "UTC"},
+				"Time Series (Digital Currency Daily)": {
+					"2025-03-02": {"1. open": "86000.1", "2. high": "95000", "3. low": "85000", "4. close": "94200.55", "5. volume": "12.5"}
+				}}`))
+		default:
+			w.Write([]byte(`{"Information": "rate limit reached"}`))
+		}
+	}))
+	defer server.Close()
+
+	provider := &alphaVantage{apiKey: "test", base: server.URL, client: server.Client()}
+	from, to := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	bars, err := provider.Bars("AAPL", models.Interval1m, from, to)
+	if err != nil {
+		t.Fatalf("Bars failed: %v", err)
+	}
+	// 09:31 in New York is 14:31 UTC; February is outside the range
+	if len(bars) != 1 || !bars[0].Bucket.Equal(time.Date(2025, 3, 3, 14, 31, 0, 0, time.UTC)) || !bars[0].Close.Equal(decimal.RequireFromString("100.15")) {
+		t.Errorf("Expected the March minute in UTC, got %+v", bars)
+	}
+
+	bars, err = provider.Bars("BTCUSD", models.Interval1d, from, to)
+	if err != nil || len(bars) != 1 || bars[0].Symbol != "BTCUSD" || !bars[0].Bucket.Equal(time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the crypto daily bar, got %+v (%v)", bars, err)
+	}
+	if got := strings.Join(queries, ","); got != "TIME_SERIES_INTRADAY AAPL2025-03,DIGITAL_CURRENCY_DAILY BTCUSD" {
+		t.Errorf("Unexpected queries %s", got)
+	}
+
+	if _, err := provider.Bars("EURUSD", models.Interval1d, from, to); err == nil || !strings.Contains(err.Error(), "rate limit reached") {
+		t.Errorf("Expected the provider's refusal, got %v", err)
+	}
+}
+
+func TestDateRangeAndSeries(t *testing.T) {
+	now := time.Date(2025, 3, 14, 15, 0, 0, 0, time.UTC)
+	start, end, err := dateRange("2025-03-01", "", now)
+	if err != nil || !start.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected March 1st up to and including today, got %v to %v (%v)", start, end, err)
+	}
+	for _, tt := range [][2]string{{"", ""}, {"March", ""}, {"2025-03-10", "2025-03-01"}} {
+		if _, _, err := dateRange(tt[0], tt[1], now); err == nil {
+			t.Errorf("Expected an error for %q to %q", tt[0], tt[1])
+		}
+	}
+	if _, err := seriesIntervals("weekly"); err == nil {
+		t.Errorf("Expected an error for an unknown series")
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"stock-alerts/instruments"
+	"stock-alerts/models"
+	"stock-alerts/timeseries"
+
+	"github.com/shopspring/decimal"
+)
+
+// source loads a symbol's bars of one interval with buckets in [from, to),
+// ordered by bucket. Daily bars are bucketed at midnight UTC of their date.
+type source interface {
+	Bars(symbol string, interval models.BarInterval, from, to time.Time) ([]models.PriceBar, error)
+}
+
+// ----------------- Alpha Vantage -----------------
+
+// alphaVantage reads the provider's daily and 1-minute series. Each kind of
+// instrument has its own functions; intraday equities are fetched a month at
+// a time, while the FX and crypto intraday series only cover recent days.
+type alphaVantage struct {
+	apiKey string
+	base   string
+	client *http.Client
+	pause  time.Duration // between requests, to stay within the rate limit
+	last   time.Time
+}
+
+func newAlphaVantage(apiKey string, pause time.Duration) *alphaVantage {
+	return &alphaVantage{
+		apiKey: apiKey,
+		base:   "https://www.alphavantage.co/query",
+		client: &http.Client{Timeout: 30 * time.Second},
+		pause:  pause,
+	}
+}
+
+// seriesQueries returns the queries of a symbol's series in [from, to)
+func seriesQueries(symbol string, interval models.BarInterval, from, to time.Time) ([]url.Values, error) {
+	if interval != models.Interval1d && interval != models.Interval1m {
+		return nil, fmt.Errorf("the provider has no %s series", interval)
+	}
+	typ := instruments.Classify(symbol)
+	base, quote, _ := instruments.Split(symbol)
+	var query url.Values
+	switch {
+	case typ == models.InstrumentFX && interval == models.Interval1d:
+		query = url.Values{"function": {"FX_DAILY"}, "from_symbol": {base}, "to_symbol": {quote}, "outputsize": {"full"}}
+	case typ == models.InstrumentFX:
+		query = url.Values{"function": {"FX_INTRADAY"}, "from_symbol": {base}, "to_symbol": {quote}, "interval": {"1min"}, "outputsize": {"full"}}
+	case typ == models.InstrumentCrypto && interval == models.Interval1d:
+		query = url.Values{"function": {"DIGITAL_CURRENCY_DAILY"}, "symbol": {base}, "market": {quote}}
+	case typ == models.InstrumentCrypto:
+		query = url.Values{"function": {"CRYPTO_INTRADAY"}, "symbol": {base}, "market": {quote}, "interval": {"1min"}, "outputsize": {"full"}}
+	case interval == models.Interval1d:
+		query = url.Values{"function": {"TIME_SERIES_DAILY"}, "symbol": {symbol}, "outputsize": {"full"}}
+	default:
+		queries := []url.Values{}
+		for month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC); month.Before(to); month = month.AddDate(0, 1, 0) {
+			queries = append(queries, url.Values{"function": {"TIME_SERIES_INTRADAY"}, "symbol": {symbol}, "interval": {"1min"},
+				"month": {month.Format("2006-01")}, "outputsize": {"full"}, "extended_hours": {"false"}})
+		}
+		return queries, nil
+	}
+	return []url.Values{query}, nil
+}
+
+func (a *alphaVantage) Bars(symbol string, interval models.BarInterval, from, to time.Time) ([]models.PriceBar, error) {
+	queries, err := seriesQueries(symbol, interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+	bars := []models.PriceBar{}
+	for _, query := range queries {
+		query.Set("apikey", a.apiKey)
+		series, err := a.get(query)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", symbol, query.Get("function"), err)
+		}
+		found, err := series.bars(symbol, interval, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", symbol, query.Get("function"), err)
+		}
+		bars = append(bars, found...)
+	}
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Bucket.Before(bars[j].Bucket) })
+	return bars, nil
+}
+
+// get runs one query, waiting out the pause since the previous one
+func (a *alphaVantage) get(query url.Values) (*seriesResponse, error) {
+	if wait := a.pause - time.Since(a.last); wait > 0 {
+		time.Sleep(wait)
+	}
+	defer func() { a.last = time.Now() }()
+
+	resp, err := a.client.Get(a.base + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("provider returned %s", resp.Status)
+	}
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+	return parseSeries(body)
+}
+
+// seriesResponse is a time series of any of the functions: the entries by
+// date or time, and the zone the times are in
+type seriesResponse struct {
+	entries  map[string]map[string]string
+	location *time.Location
+}
+
+// parseSeries finds the series and its time zone; the functions name them
+// differently ("Time Series (Daily)", "Time Series FX (1min)", "6. Time Zone")
+func parseSeries(body map[string]json.RawMessage) (*seriesResponse, error) {
+	series := &seriesResponse{location: time.UTC}
+	for key, raw := range body {
+		switch {
+		case strings.HasPrefix(key, "Time Series"):
+			if err := json.Unmarshal(raw, &series.entries); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal %s: %v", key, err)
+			}
+		case key == "Meta Data":
+			var meta map[string]string
+			json.Unmarshal(raw, &meta)
+			for name, value := range meta {
+				if strings.HasSuffix(name, "Time Zone") {
+					loc, err := time.LoadLocation(value)
+					if err != nil {
+						return nil, fmt.Errorf("unknown time zone %q", value)
+					}
+					series.location = loc
+				}
+			}
+		}
+	}
+	if series.entries == nil {
+		for _, key := range []string{"Error Message", "Note", "Information"} {
+			var message string
+			if json.Unmarshal(body[key], &message) == nil && message != "" {
+				return nil, fmt.Errorf("request refused: %s", message)
+			}
+		}
+		return nil, fmt.Errorf("no time series in response")
+	}
+	return series, nil
+}
+
+// bars converts the entries in [from, to) to bars
+func (s *seriesResponse) bars(symbol string, interval models.BarInterval, from, to time.Time) ([]models.PriceBar, error) {
+	bars := []models.PriceBar{}
+	for stamp, values := range s.entries {
+		bucket, err := parseStamp(stamp, interval, s.location)
+		if err != nil {
+			return nil, err
+		}
+		if bucket.Before(from) || !bucket.Before(to) {
+			continue
+		}
+		bar := models.PriceBar{Symbol: symbol, Bucket: bucket, Count: 1}
+		for _, field := range []struct {
+			name   string
+			target *decimal.Decimal
+		}{{"open", &bar.Open}, {"high", &bar.High}, {"low", &bar.Low}, {"close", &bar.Close}} {
+			value, ok := valueOf(values, field.name)
+			if !ok {
+				return nil, fmt.Errorf("%s has no %s price", stamp, field.name)
+			}
+			if *field.target, err = decimal.NewFromString(value); err != nil {
+				return nil, fmt.Errorf("failed to parse %s price '%s': %v", field.name, value, err)
+			}
+		}
+		bars = append(bars, bar)
+	}
+	return bars, nil
+}
+
+// valueOf finds a price by name in the numbered keys of an entry ("1. open")
+func valueOf(values map[string]string, name string) (string, bool) {
+	for key, value := range values {
+		if strings.HasSuffix(key, ". "+name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// parseStamp returns the bucket of a series date or time: midnight UTC of a
+// date for daily bars, the UTC minute for intraday ones
+func parseStamp(stamp string, interval models.BarInterval, loc *time.Location) (time.Time, error) {
+	if interval == models.Interval1d {
+		date, err := time.Parse("2006-01-02", stamp)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", stamp)
+		}
+		return date, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", stamp, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", stamp)
+	}
+	return timeseries.BucketOf(t, interval), nil
+}
+
+// ----------------- CSV Archive -----------------
+
+// archive reads bars from a CSV file with a symbol,interval,time,open,high,low,close
+// header row. Times are RFC 3339, or YYYY-MM-DD for daily bars.
+type archive struct {
+	path string
+}
+
+func (a archive) Bars(symbol string, interval models.BarInterval, from, to time.Time) ([]models.PriceBar, error) {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readArchive(f, symbol, interval, from, to)
+}
+
+func readArchive(r io.Reader, symbol string, interval models.BarInterval, from, to time.Time) ([]models.PriceBar, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 7
+	if _, err := reader.Read(); err != nil {
+		return nil, fmt.Errorf("failed to read archive header: %w", err)
+	}
+	bars := []models.PriceBar{}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if !strings.EqualFold(row[0], symbol) || models.BarInterval(row[1]) != interval {
+			continue
+		}
+		bucket, err := time.Parse(time.RFC3339, row[2])
+		if err != nil {
+			if bucket, err = time.Parse("2006-01-02", row[2]); err != nil {
+				return nil, fmt.Errorf("archive line %d: invalid time %q", line, row[2])
+			}
+		}
+		bucket = timeseries.BucketOf(bucket, interval)
+		if bucket.Before(from) || !bucket.Before(to) {
+			continue
+		}
+		bar := models.PriceBar{Symbol: strings.ToUpper(symbol), Bucket: bucket, Count: 1}
+		for i, target := range []*decimal.Decimal{&bar.Open, &bar.High, &bar.Low, &bar.Close} {
+			if *target, err = decimal.NewFromString(row[3+i]); err != nil {
+				return nil, fmt.Errorf("archive line %d: invalid price %q", line, row[3+i])
+			}
+		}
+		bars = append(bars, bar)
+	}
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Bucket.Before(bars[j].Bucket) })
+	return bars, nil
+}
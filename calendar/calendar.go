@@ -0,0 +1,158 @@
+// Package calendar knows when exchanges trade: their timezone, regular
+// hours, holidays and early closes.
+package calendar
+
+import (
+	"sync"
+	"time"
+)
+
+// day is a calendar date without a time or zone
+type day struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+func dayOf(t time.Time) day {
+	y, m, d := t.Date()
+	return day{y, m, d}
+}
+
+// year lists the days an exchange deviates from its regular hours
+type year struct {
+	holidays    map[day]string
+	earlyCloses map[day]time.Duration // close, after local midnight
+}
+
+// Exchange is a trading venue and its calendar
+type Exchange struct {
+	Code     string
+	Name     string
+	Location *time.Location
+	Open     time.Duration // regular open, after local midnight; negative when sessions open the evening before
+	Close    time.Duration // regular close, after local midnight
+	Weekends bool          // trades on Saturdays and Sundays too
+
+	rules func(y int) year
+	mu    sync.Mutex
+	years map[int]year
+}
+
+// Session is one trading day of an exchange
+type Session struct {
+	Date       time.Time // the trading date, at midnight UTC
+	Open       time.Time
+	Close      time.Time
+	EarlyClose bool
+}
+
+// year returns the exceptions of a year, computing them once
+func (e *Exchange) year(y int) year {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.years == nil {
+		e.years = map[int]year{}
+	}
+	if cal, ok := e.years[y]; ok {
+		return cal
+	}
+	cal := e.rules(y)
+	e.years[y] = cal
+	return cal
+}
+
+// Holiday returns the name of the holiday on the exchange's local date of t
+func (e *Exchange) Holiday(t time.Time) (string, bool) {
+	d := dayOf(t.In(e.Location))
+	name, ok := e.year(d.year).holidays[d]
+	return name, ok
+}
+
+// SessionOn returns the session on the exchange's local date of t; false on
+// weekends and holidays
+func (e *Exchange) SessionOn(t time.Time) (Session, bool) {
+	d := dayOf(t.In(e.Location))
+	midnight := time.Date(d.year, d.month, d.day, 0, 0, 0, 0, e.Location)
+	if wd := midnight.Weekday(); !e.Weekends && (wd == time.Saturday || wd == time.Sunday) {
+		return Session{}, false
+	}
+	cal := e.year(d.year)
+	if _, ok := cal.holidays[d]; ok {
+		return Session{}, false
+	}
+	session := Session{
+		Date:  time.Date(d.year, d.month, d.day, 0, 0, 0, 0, time.UTC),
+		Open:  at(midnight, e.Open),
+		Close: at(midnight, e.Close),
+	}
+	if close, ok := cal.earlyCloses[d]; ok {
+		session.Close = at(midnight, close)
+		session.EarlyClose = true
+	}
+	return session, true
+}
+
+// at returns the wall-clock time offset after midnight, which stays right
+// on the days clocks change
+func at(midnight time.Time, offset time.Duration) time.Time {
+	return time.Date(midnight.Year(), midnight.Month(), midnight.Day(),
+		int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, midnight.Location())
+}
+
+// sessionAt returns the session in progress at t, which is the next local
+// date's when sessions open the evening before
+func (e *Exchange) sessionAt(t time.Time) (Session, bool) {
+	local := t.In(e.Location)
+	for _, d := range []time.Time{local, local.AddDate(0, 0, 1)} {
+		if session, ok := e.SessionOn(d); ok && !t.Before(session.Open) && t.Before(session.Close) {
+			return session, true
+		}
+	}
+	return Session{}, false
+}
+
+// IsOpen reports whether the exchange is trading at t
+func (e *Exchange) IsOpen(t time.Time) bool {
+	_, ok := e.sessionAt(t)
+	return ok
+}
+
+// NextOpen returns the start of the first session opening after t
+func (e *Exchange) NextOpen(t time.Time) time.Time {
+	local := t.In(e.Location)
+	for i := 0; i < 370; i++ {
+		if session, ok := e.SessionOn(local.AddDate(0, 0, i)); ok && session.Open.After(t) {
+			return session.Open
+		}
+	}
+	return time.Time{}
+}
+
+// TradingDate returns the trading date a tick at t belongs to, at midnight
+// UTC: that of the session in progress, else the exchange's local date, or
+// the last trading day before it when the exchange is closed that day
+func (e *Exchange) TradingDate(t time.Time) time.Time {
+	if session, ok := e.sessionAt(t); ok {
+		return session.Date
+	}
+	local := t.In(e.Location)
+	for i := 0; i < 370; i++ {
+		if session, ok := e.SessionOn(local.AddDate(0, 0, -i)); ok {
+			return session.Date
+		}
+	}
+	d := dayOf(local)
+	return time.Date(d.year, d.month, d.day, 0, 0, 0, 0, time.UTC)
+}
+
+// Sessions returns the sessions whose trading date falls in [from, to)
+func (e *Exchange) Sessions(from, to time.Time) []Session {
+	sessions := []Session{}
+	for d := from.In(e.Location); d.Before(to); d = d.AddDate(0, 0, 1) {
+		if session, ok := e.SessionOn(d); ok {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
@@ -0,0 +1,170 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+}
+
+func TestUSHolidays(t *testing.T) {
+	holidays := []time.Time{
+		date(2025, 1, 1), date(2025, 1, 20), date(2025, 2, 17), date(2025, 4, 18), date(2025, 5, 26),
+		date(2025, 6, 19), date(2025, 7, 4), date(2025, 9, 1), date(2025, 11, 27), date(2025, 12, 25),
+		date(2022, 6, 20), // Juneteenth on a Sunday
+		date(2026, 7, 3),  // Independence Day on a Saturday
+	}
+	for _, d := range holidays {
+		if _, ok := NYSE.SessionOn(d); ok {
+			t.Errorf("Expected %s to be a NYSE holiday", d.Format("2006-01-02"))
+		}
+	}
+	for _, d := range []time.Time{date(2021, 12, 31), date(2021, 6, 18), date(2025, 4, 21)} {
+		if _, ok := NYSE.SessionOn(d); !ok {
+			t.Errorf("Expected %s to be a NYSE trading day", d.Format("2006-01-02"))
+		}
+	}
+	if name, ok := NYSE.Holiday(date(2025, 4, 18)); !ok || name != "Good Friday" {
+		t.Errorf("Expected Good Friday, got %q", name)
+	}
+
+	for _, d := range []time.Time{date(2025, 7, 3), date(2025, 11, 28), date(2025, 12, 24)} {
+		session, ok := NYSE.SessionOn(d)
+		if !ok || !session.EarlyClose || session.Close.In(NYSE.Location).Hour() != 13 {
+			t.Errorf("Expected a 13:00 close on %s, got %+v", d.Format("2006-01-02"), session)
+		}
+	}
+	if session, _ := NYSE.SessionOn(date(2023, 7, 3)); !session.EarlyClose {
+		t.Errorf("Expected an early close on Monday July 3rd 2023")
+	}
+}
+
+func TestUKHolidays(t *testing.T) {
+	for _, d := range []time.Time{date(2025, 4, 18), date(2025, 4, 21), date(2025, 5, 5), date(2025, 5, 26),
+		date(2025, 8, 25), date(2025, 12, 25), date(2025, 12, 26), date(2021, 12, 27), date(2021, 12, 28), date(2022, 1, 3)} {
+		if _, ok := LSE.SessionOn(d); ok {
+			t.Errorf("Expected %s to be an LSE holiday", d.Format("2006-01-02"))
+		}
+	}
+	session, ok := LSE.SessionOn(date(2025, 12, 31))
+	if !ok || !session.EarlyClose || session.Close.In(LSE.Location).Format("15:04") != "12:30" {
+		t.Errorf("Expected a 12:30 close on New Year's Eve, got %+v", session)
+	}
+}
+
+func TestSessionsFollowDaylightSaving(t *testing.T) {
+	before, _ := NYSE.SessionOn(date(2025, 3, 7))
+	after, _ := NYSE.SessionOn(date(2025, 3, 10))
+	if before.Open.UTC().Hour() != 14 || after.Open.UTC().Hour() != 13 {
+		t.Errorf("Expected the open to move from 14:30 to 13:30 UTC, got %v and %v", before.Open.UTC(), after.Open.UTC())
+	}
+	if !before.Date.Equal(time.Date(2025, 3, 7, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the trading date at midnight UTC, got %v", before.Date)
+	}
+}
+
+func TestIsOpenAndNextOpen(t *testing.T) {
+	tests := []struct {
+		at   time.Time
+		open bool
+		next time.Time
+	}{
+		// Friday 10:00 New York
+		{time.Date(2025, 3, 14, 14, 0, 0, 0, time.UTC), true, time.Date(2025, 3, 17, 13, 30, 0, 0, time.UTC)},
+		// Friday 16:00 New York, the close itself
+		{time.Date(2025, 3, 14, 20, 0, 0, 0, time.UTC), false, time.Date(2025, 3, 17, 13, 30, 0, 0, time.UTC)},
+		// Saturday
+		{time.Date(2025, 3, 15, 15, 0, 0, 0, time.UTC), false, time.Date(2025, 3, 17, 13, 30, 0, 0, time.UTC)},
+		// Thursday before Good Friday after the close
+		{time.Date(2025, 4, 17, 21, 0, 0, 0, time.UTC), false, time.Date(2025, 4, 21, 13, 30, 0, 0, time.UTC)},
+		// Day after Thanksgiving, past the early close
+		{time.Date(2025, 11, 28, 18, 30, 0, 0, time.UTC), false, time.Date(2025, 12, 1, 14, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := NYSE.IsOpen(tt.at); got != tt.open {
+			t.Errorf("Expected IsOpen(%v) to be %v, got %v", tt.at, tt.open, got)
+		}
+		if got := NYSE.NextOpen(tt.at); !got.Equal(tt.next) {
+			t.Errorf("Expected NextOpen(%v) to be %v, got %v", tt.at, tt.next, got.UTC())
+		}
+	}
+}
+
+func TestTradingDate(t *testing.T) {
+	tests := []struct {
+		at   time.Time
+		want time.Time
+	}{
+		// 20:00 on December 31st in New York is already January 1st in UTC
+		{time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC), time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)},
+		// After-hours Friday and the weekend belong to Friday
+		{time.Date(2025, 3, 15, 1, 0, 0, 0, time.UTC), time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 3, 16, 15, 0, 0, 0, time.UTC), time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)},
+		// Pre-market belongs to the day's own session
+		{time.Date(2025, 3, 17, 11, 0, 0, 0, time.UTC), time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := NYSE.TradingDate(tt.at); !got.Equal(tt.want) {
+			t.Errorf("Expected TradingDate(%v) to be %v, got %v", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestForSymbol(t *testing.T) {
+	if ForSymbol("AAPL") != NYSE || ForSymbol("TSCO.LON") != LSE {
+		t.Errorf("Expected AAPL on the default exchange and TSCO.LON in London")
+	}
+	if ForSymbol("EURUSD") != FX || ForSymbol("BTCUSD") != Crypto {
+		t.Errorf("Expected EURUSD on the FX calendar and BTCUSD on the crypto one")
+	}
+	if e, ok := Lookup("xnas"); !ok || e != Nasdaq {
+		t.Errorf("Expected to look up Nasdaq by code")
+	}
+	if sessions := NYSE.Sessions(date(2025, 12, 22), date(2025, 12, 29)); len(sessions) != 4 {
+		t.Errorf("Expected 4 sessions in Christmas week, got %d", len(sessions))
+	}
+}
+
+func TestFXTradesSundayToFriday(t *testing.T) {
+	tests := []struct {
+		at   time.Time
+		open bool
+		date time.Time
+	}{
+		// 16:00 on Sunday in New York, before the week opens
+		{time.Date(2025, 3, 16, 20, 0, 0, 0, time.UTC), false, time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)},
+		// 18:00 on Sunday is Monday's session
+		{time.Date(2025, 3, 16, 22, 0, 0, 0, time.UTC), true, time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC)},
+		// 18:00 on Tuesday is already Wednesday's, and US holidays trade
+		{time.Date(2025, 7, 1, 22, 0, 0, 0, time.UTC), true, time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 7, 4, 15, 0, 0, 0, time.UTC), true, time.Date(2025, 7, 4, 0, 0, 0, 0, time.UTC)},
+		// 18:00 on Friday, after the week closes
+		{time.Date(2025, 3, 14, 22, 0, 0, 0, time.UTC), false, time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := FX.IsOpen(tt.at); got != tt.open {
+			t.Errorf("Expected IsOpen(%v) to be %v, got %v", tt.at, tt.open, got)
+		}
+		if got := FX.TradingDate(tt.at); !got.Equal(tt.date) {
+			t.Errorf("Expected TradingDate(%v) to be %v, got %v", tt.at, tt.date, got)
+		}
+	}
+	if next := FX.NextOpen(time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC)); !next.Equal(time.Date(2025, 3, 16, 21, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the week to open at 17:00 New York time on Sunday, got %v", next)
+	}
+}
+
+func TestCryptoNeverCloses(t *testing.T) {
+	saturday := time.Date(2025, 3, 15, 23, 59, 0, 0, time.UTC)
+	if !Crypto.IsOpen(saturday) || !Crypto.IsOpen(time.Date(2025, 12, 25, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected crypto to trade on weekends and holidays")
+	}
+	if got := Crypto.TradingDate(saturday); !got.Equal(time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected crypto days to run by UTC, got %v", got)
+	}
+	if sessions := Crypto.Sessions(date(2025, 3, 10), date(2025, 3, 17)); len(sessions) != 7 {
+		t.Errorf("Expected 7 sessions a week, got %d", len(sessions))
+	}
+}
@@ -0,0 +1,81 @@
+package calendar
+
+import (
+	"strings"
+	"time"
+	_ "time/tzdata" // exchange timezones must load whatever the image ships
+
+	"stock-alerts/instruments"
+	"stock-alerts/models"
+)
+
+func mustLoad(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// The supported exchanges
+var (
+	NYSE = &Exchange{Code: "XNYS", Name: "New York Stock Exchange", Location: mustLoad("America/New_York"),
+		Open: 9*time.Hour + 30*time.Minute, Close: 16 * time.Hour, rules: usEquities}
+	Nasdaq = &Exchange{Code: "XNAS", Name: "Nasdaq", Location: mustLoad("America/New_York"),
+		Open: 9*time.Hour + 30*time.Minute, Close: 16 * time.Hour, rules: usEquities}
+	NYSEArca = &Exchange{Code: "ARCX", Name: "NYSE Arca", Location: mustLoad("America/New_York"),
+		Open: 9*time.Hour + 30*time.Minute, Close: 16 * time.Hour, rules: usEquities}
+	LSE = &Exchange{Code: "XLON", Name: "London Stock Exchange", Location: mustLoad("Europe/London"),
+		Open: 8 * time.Hour, Close: 16*time.Hour + 30*time.Minute, rules: ukEquities}
+
+	// FX trades from 17:00 on Sunday to 17:00 on Friday in New York, each
+	// day's session opening at 17:00 the evening before
+	FX = &Exchange{Code: "FX", Name: "Foreign exchange", Location: mustLoad("America/New_York"),
+		Open: -7 * time.Hour, Close: 17 * time.Hour, rules: noHolidays}
+	// Crypto trades around the clock, its days running by UTC
+	Crypto = &Exchange{Code: "CRYPTO", Name: "Crypto", Location: time.UTC,
+		Open: 0, Close: 24 * time.Hour, Weekends: true, rules: noHolidays}
+)
+
+// exchanges are the known exchanges by MIC code
+var exchanges = map[string]*Exchange{
+	NYSE.Code:     NYSE,
+	Nasdaq.Code:   Nasdaq,
+	NYSEArca.Code: NYSEArca,
+	LSE.Code:      LSE,
+	FX.Code:       FX,
+	Crypto.Code:   Crypto,
+}
+
+// Default is the exchange of symbols without an exchange suffix
+var Default = NYSE
+
+// Lookup returns an exchange by its MIC code, such as XNYS
+func Lookup(code string) (*Exchange, bool) {
+	e, ok := exchanges[strings.ToUpper(code)]
+	return e, ok
+}
+
+// suffixes map the symbol suffixes of the price feed to exchanges
+var suffixes = map[string]*Exchange{
+	".LON": LSE,
+	".L":   LSE,
+}
+
+// ForSymbol returns the exchange a symbol trades on, from its suffix; FX and
+// crypto pairs trade on their own calendars
+func ForSymbol(symbol string) *Exchange {
+	upper := strings.ToUpper(symbol)
+	for suffix, e := range suffixes {
+		if strings.HasSuffix(upper, suffix) {
+			return e
+		}
+	}
+	switch instruments.Classify(upper) {
+	case models.InstrumentFX:
+		return FX
+	case models.InstrumentCrypto:
+		return Crypto
+	}
+	return Default
+}
@@ -0,0 +1,132 @@
+package calendar
+
+import "time"
+
+// easter returns Easter Sunday of a year (anonymous Gregorian algorithm)
+func easter(y int) day {
+	a := y % 19
+	b, c := y/100, y%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	dd := (h+l-7*m+114)%31 + 1
+	return day{y, time.Month(month), dd}
+}
+
+// shift moves a date by n days
+func shift(d day, n int) day {
+	return dayOf(time.Date(d.year, d.month, d.day+n, 0, 0, 0, 0, time.UTC))
+}
+
+func weekday(d day) time.Weekday {
+	return time.Date(d.year, d.month, d.day, 0, 0, 0, 0, time.UTC).Weekday()
+}
+
+// nthWeekday returns the nth given weekday of a month; n < 0 counts from the end
+func nthWeekday(y int, m time.Month, wd time.Weekday, n int) day {
+	if n > 0 {
+		first := day{y, m, 1}
+		offset := (int(wd) - int(weekday(first)) + 7) % 7
+		return shift(first, offset+7*(n-1))
+	}
+	last := shift(day{y, m + 1, 1}, -1) // time.Date carries December into January
+	offset := (int(weekday(last)) - int(wd) + 7) % 7
+	return shift(last, -offset-7*(-n-1))
+}
+
+// observedUS moves a Saturday holiday to Friday and a Sunday one to Monday
+func observedUS(d day) day {
+	switch weekday(d) {
+	case time.Saturday:
+		return shift(d, -1)
+	case time.Sunday:
+		return shift(d, 1)
+	}
+	return d
+}
+
+// isWeekday reports whether d falls Monday to Friday
+func isWeekday(d day) bool {
+	wd := weekday(d)
+	return wd != time.Saturday && wd != time.Sunday
+}
+
+// usEquities are the NYSE and Nasdaq holidays and 13:00 early closes
+func usEquities(y int) year {
+	cal := year{holidays: map[day]string{}, earlyCloses: map[day]time.Duration{}}
+
+	// New Year's Day on a Saturday is not made up on the Friday before
+	if newYear := (day{y, time.January, 1}); weekday(newYear) != time.Saturday {
+		cal.holidays[observedUS(newYear)] = "New Year's Day"
+	}
+	cal.holidays[nthWeekday(y, time.January, time.Monday, 3)] = "Martin Luther King Jr. Day"
+	cal.holidays[nthWeekday(y, time.February, time.Monday, 3)] = "Washington's Birthday"
+	cal.holidays[shift(easter(y), -2)] = "Good Friday"
+	cal.holidays[nthWeekday(y, time.May, time.Monday, -1)] = "Memorial Day"
+	if y >= 2022 {
+		cal.holidays[observedUS(day{y, time.June, 19})] = "Juneteenth"
+	}
+	cal.holidays[observedUS(day{y, time.July, 4})] = "Independence Day"
+	cal.holidays[nthWeekday(y, time.September, time.Monday, 1)] = "Labor Day"
+	thanksgiving := nthWeekday(y, time.November, time.Thursday, 4)
+	cal.holidays[thanksgiving] = "Thanksgiving Day"
+	cal.holidays[observedUS(day{y, time.December, 25})] = "Christmas Day"
+
+	early := 13 * time.Hour
+	for _, d := range []day{{y, time.July, 3}, {y, time.December, 24}} {
+		// Only Monday to Thursday; on a Friday the day itself is the holiday
+		if wd := weekday(d); wd >= time.Monday && wd <= time.Thursday {
+			cal.earlyCloses[d] = early
+		}
+	}
+	cal.earlyCloses[shift(thanksgiving, 1)] = early
+	return cal
+}
+
+// ukEquities are the London Stock Exchange holidays and 12:30 early closes
+func ukEquities(y int) year {
+	cal := year{holidays: map[day]string{}, earlyCloses: map[day]time.Duration{}}
+
+	newYear := day{y, time.January, 1}
+	for !isWeekday(newYear) {
+		newYear = shift(newYear, 1)
+	}
+	cal.holidays[newYear] = "New Year's Day"
+	cal.holidays[shift(easter(y), -2)] = "Good Friday"
+	cal.holidays[shift(easter(y), 1)] = "Easter Monday"
+	cal.holidays[nthWeekday(y, time.May, time.Monday, 1)] = "Early May Bank Holiday"
+	cal.holidays[nthWeekday(y, time.May, time.Monday, -1)] = "Spring Bank Holiday"
+	cal.holidays[nthWeekday(y, time.August, time.Monday, -1)] = "Summer Bank Holiday"
+
+	// Christmas and Boxing Day falling on a weekend move to the next free weekdays
+	christmas, boxing := day{y, time.December, 25}, day{y, time.December, 26}
+	for !isWeekday(christmas) {
+		christmas = shift(christmas, 1)
+	}
+	if !isWeekday(boxing) || boxing == christmas {
+		boxing = shift(christmas, 1)
+		for !isWeekday(boxing) {
+			boxing = shift(boxing, 1)
+		}
+	}
+	cal.holidays[christmas] = "Christmas Day"
+	cal.holidays[boxing] = "Boxing Day"
+
+	early := 12*time.Hour + 30*time.Minute
+	for _, d := range []day{{y, time.December, 24}, {y, time.December, 31}} {
+		if isWeekday(d) {
+			cal.earlyCloses[d] = early
+		}
+	}
+	return cal
+}
+
+// noHolidays is the calendar of markets that trade through public holidays
+func noHolidays(y int) year {
+	return year{}
+}
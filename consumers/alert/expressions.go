@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"stock-alerts/alerting"
+	"stock-alerts/expr"
+	"stock-alerts/indicators"
+	"stock-alerts/models"
+)
+
+// expressionRule is an expression rule with its compiled condition
+type expressionRule struct {
+	rule    models.ExpressionRule
+	program *expr.Program
+}
+
+// expressionBook keeps the compiled expression rules by symbol, along with
+// the recent prices of those symbols. Prices are only kept for symbols with
+// rules, so a rule needing n prices starts evaluating n ticks after it is
+// loaded.
+type expressionBook struct {
+	mu       sync.Mutex
+	bySymbol map[string][]*expressionRule
+	prices   map[string]*indicators.Window
+}
+
+func newExpressionBook() *expressionBook {
+	return &expressionBook{bySymbol: map[string][]*expressionRule{}, prices: map[string]*indicators.Window{}}
+}
+
+// Replace swaps the rules for freshly loaded ones, keeping the trigger state
+// of rules already in memory and the prices seen so far
+func (b *expressionBook) Replace(rules []models.ExpressionRule) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := map[uint]*expressionRule{}
+	for _, list := range b.bySymbol {
+		for _, r := range list {
+			current[r.rule.ID] = r
+		}
+	}
+
+	bySymbol := map[string][]*expressionRule{}
+	windows := map[string]int{}
+	for _, rule := range rules {
+		program, err := expr.Compile(rule.Expression)
+		if err != nil {
+			log.Printf("⚠️  Skipping expression rule %d: %v\n", rule.ID, err)
+			continue
+		}
+		if old, ok := current[rule.ID]; ok {
+			rule.Triggered = old.rule.Triggered
+		}
+		bySymbol[rule.Symbol] = append(bySymbol[rule.Symbol], &expressionRule{rule: rule, program: program})
+		windows[rule.Symbol] = max(windows[rule.Symbol], program.Window())
+	}
+
+	prices := map[string]*indicators.Window{}
+	for symbol, size := range windows {
+		window := indicators.NewWindow(size)
+		if old, ok := b.prices[symbol]; ok {
+			for _, price := range old.Prices() {
+				window.Push(price)
+			}
+		}
+		prices[symbol] = window
+	}
+	b.bySymbol, b.prices = bySymbol, prices
+}
+
+// Reset drops the rules and prices of a symbol, so the next Replace takes
+// their state from the database and starts a new window
+func (b *expressionBook) Reset(symbol string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.bySymbol, symbol)
+	delete(b.prices, symbol)
+}
+
+// Len returns the number of rules in the book
+func (b *expressionBook) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, list := range b.bySymbol {
+		n += len(list)
+	}
+	return n
+}
+
+// processExpressions evaluates the expression rules on the event's symbol,
+// alerting when a condition starts to hold
+func (p *alertProcessor) processExpressions(e StockEvent) {
+	p.expressions.mu.Lock()
+	defer p.expressions.mu.Unlock()
+	window, ok := p.expressions.prices[e.Symbol]
+	if !ok {
+		return
+	}
+	window.Push(e.Price.InexactFloat64())
+	prices := window.Prices()
+
+	for _, r := range p.expressions.bySymbol[e.Symbol] {
+		result, err := alerting.EvaluateCondition(&r.rule, r.program, prices)
+		if err != nil {
+			log.Printf("❌ Expression rule %d failed on %s: %v\n", r.rule.ID, e.Symbol, err)
+			continue
+		}
+		if result.StateChanged {
+			if err := p.expressionRules.UpdateTriggered(r.rule.ID, r.rule.Triggered); err != nil {
+				log.Printf("❌ Failed to store state of expression rule %d: %v\n", r.rule.ID, err)
+			}
+		}
+		if !result.Fire || p.snoozes.Suppressed(models.AlertExpression, r.rule.ID, e.Time) {
+			continue
+		}
+
+		ruleID := r.rule.ID
+		alert := models.Alert{
+			UserID:      r.rule.UserID,
+			Kind:        models.AlertExpression,
+			RuleID:      &ruleID,
+			StockSymbol: e.Symbol,
+			Price:       e.Price,
+			Message:     alerting.ConditionMessage(r.rule, e.Price.InexactFloat64()),
+			Timestamp:   e.Time,
+		}
+		if err := p.alerts.Create(&alert); err != nil {
+			log.Printf("❌ Failed to store alert for %s: %v\n", e.Symbol, err)
+			continue
+		}
+		log.Printf("🚨 %s\n", alert.Message)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"stock-alerts/alerting"
+	"stock-alerts/events"
+
+	"github.com/shopspring/decimal"
+)
+
+// rule is an alert threshold on one stock of a user's portfolio
+type rule struct {
+	StockID   uint
+	UserID    uint
+	Symbol    string
+	Threshold decimal.Decimal
+}
+
+// ruleIndex keeps the alert rules in memory, keyed by symbol and sorted by
+// threshold, so a price event is evaluated without touching the database
+type ruleIndex struct {
+	mu       sync.RWMutex
+	bySymbol map[string][]rule
+}
+
+func newRuleIndex() *ruleIndex {
+	return &ruleIndex{bySymbol: map[string][]rule{}}
+}
+
+// Replace swaps the whole index for the given rules
+func (idx *ruleIndex) Replace(rules []rule) {
+	bySymbol := map[string][]rule{}
+	for _, r := range rules {
+		bySymbol[r.Symbol] = append(bySymbol[r.Symbol], r)
+	}
+	for _, list := range bySymbol {
+		sortRules(list)
+	}
+
+	idx.mu.Lock()
+	idx.bySymbol = bySymbol
+	idx.mu.Unlock()
+}
+
+// Apply updates the index with a single rule change
+func (idx *ruleIndex) Apply(change events.RuleChange) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// The symbol of a stock may have changed, so drop it everywhere
+	for symbol, list := range idx.bySymbol {
+		kept := list[:0]
+		for _, r := range list {
+			if r.StockID != change.StockID {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) == 0 {
+			delete(idx.bySymbol, symbol)
+		} else {
+			idx.bySymbol[symbol] = kept
+		}
+	}
+
+	if change.Op != events.OpUpsert {
+		return
+	}
+	list := append(idx.bySymbol[change.Symbol], rule{
+		StockID:   change.StockID,
+		UserID:    change.UserID,
+		Symbol:    change.Symbol,
+		Threshold: change.Threshold,
+	})
+	sortRules(list)
+	idx.bySymbol[change.Symbol] = list
+}
+
+// Triggered returns the rules on symbol whose threshold the price has reached
+func (idx *ruleIndex) Triggered(symbol string, price decimal.Decimal) []rule {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	list := idx.bySymbol[symbol]
+	n := sort.Search(len(list), func(i int) bool { return !alerting.ThresholdReached(price, list[i].Threshold) })
+	return append([]rule{}, list[:n]...)
+}
+
+// Len returns the number of rules in the index
+func (idx *ruleIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	n := 0
+	for _, list := range idx.bySymbol {
+		n += len(list)
+	}
+	return n
+}
+
+func sortRules(rules []rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if !rules[i].Threshold.Equal(rules[j].Threshold) {
+			return rules[i].Threshold.LessThan(rules[j].Threshold)
+		}
+		return rules[i].StockID < rules[j].StockID
+	})
+}
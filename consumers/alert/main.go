@@ -7,18 +7,17 @@ import (
 	"os"
 	"time"
 
+	"stock-alerts/alerting"
 	"stock-alerts/db"
+	"stock-alerts/events"
 	"stock-alerts/models"
+	"stock-alerts/repository"
 
 	"github.com/joho/godotenv"
 	"github.com/segmentio/kafka-go"
 )
 
-type StockEvent struct {
-	Symbol string    `json:"symbol"`
-	Price  float64   `json:"price"`
-	Time   time.Time `json:"time"`
-}
+type StockEvent = events.StockPrice
 
 func main() {
 	// Load environment variables from .env file
@@ -28,7 +27,14 @@ func main() {
 	}
 
 	// Connect DB
-	db.ConnectDatabase()
+	database, err := db.ConnectDatabase()
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	processor := newAlertProcessor(repository.NewGormRepositories(database))
+	if err := processor.resync(); err != nil {
+		log.Fatal("❌ Failed to load alert rules: ", err)
+	}
 
 	log.Println("🔔 Alert Consumer starting...")
 
@@ -38,10 +44,15 @@ func main() {
 		broker = "127.0.0.1:9093" // fallback for local development
 	}
 
+	// Keep the rule index current between full resyncs
+	go processor.followRuleChanges(broker)
+	go processor.followSignals(broker)
+	go processor.resyncEvery(resyncIntervalFromEnv())
+
 	// Start consuming messages for alerts
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  []string{broker},
-		Topic:    "stock_prices",
+		Topic:    events.TopicStockPrices,
 		GroupID:  "stock-alerts-consumer",
 		MinBytes: 10e3, // 10KB
 		MaxBytes: 10e6, // 10MB
@@ -49,12 +60,16 @@ func main() {
 
 	defer r.Close()
 
+	var backoff events.Backoff
 	for {
 		m, err := r.ReadMessage(context.Background())
 		if err != nil {
-			log.Println("❌ Kafka read error:", err)
+			delay := backoff.Next()
+			log.Printf("❌ Kafka read error, retrying in %s: %v\n", delay, err)
+			time.Sleep(delay)
 			continue
 		}
+		backoff.Reset()
 
 		var event StockEvent
 		if err := json.Unmarshal(m.Value, &event); err != nil {
@@ -62,30 +77,191 @@ func main() {
 			continue
 		}
 
-		processAlertEvent(event)
+		processor.processAlertEvent(event)
+	}
+}
+
+// resyncIntervalFromEnv reads ALERT_RULE_RESYNC, defaulting to 5 minutes
+func resyncIntervalFromEnv() time.Duration {
+	interval := 5 * time.Minute
+	if v := os.Getenv("ALERT_RULE_RESYNC"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Printf("⚠️  Ignoring invalid ALERT_RULE_RESYNC %q\n", v)
+		} else {
+			interval = d
+		}
 	}
+	return interval
+}
+
+// alertProcessor turns price events into alerts for the matching rules
+type alertProcessor struct {
+	stocks          repository.StockRepo
+	portfolios      repository.PortfolioRepo
+	positions       repository.PositionRepo
+	positionRules   repository.PositionRuleRepo
+	alerts          repository.AlertRepo
+	signalRules     repository.SignalRuleRepo
+	expressionRules repository.ExpressionRuleRepo
+	rules           *ruleIndex
+	stops           *stopBook
+	signals         *signalBook
+	expressions     *expressionBook
+	snoozes         *alerting.Snoozes
 }
 
-func processAlertEvent(e StockEvent) {
-	var stocks []models.Stock
-	db.DB.Where("stock_symbol = ?", e.Symbol).Find(&stocks)
+func newAlertProcessor(repos repository.Repositories) *alertProcessor {
+	return &alertProcessor{
+		stocks:          repos.Stocks,
+		portfolios:      repos.Portfolios,
+		positions:       repos.Positions,
+		positionRules:   repos.PositionRules,
+		alerts:          repos.Alerts,
+		signalRules:     repos.SignalRules,
+		expressionRules: repos.ExpressionRules,
+		rules:           newRuleIndex(),
+		stops:           newStopBook(),
+		signals:         newSignalBook(),
+		expressions:     newExpressionBook(),
+		snoozes:         alerting.NewSnoozes(),
+	}
+}
 
+// resync reloads every rule from the database into memory
+func (p *alertProcessor) resync() error {
+	portfolios, err := p.portfolios.List()
+	if err != nil {
+		return err
+	}
+	owners := make(map[uint]uint, len(portfolios))
+	for _, portfolio := range portfolios {
+		owners[portfolio.ID] = portfolio.UserID
+	}
+
+	stocks, err := p.stocks.List()
+	if err != nil {
+		return err
+	}
+	rules := make([]rule, 0, len(stocks))
 	for _, stock := range stocks {
-		if e.Price >= stock.ThresholdPrice {
-			alert := models.Alert{
-				UserID:      getUserIDFromPortfolio(stock.PortfolioID),
-				StockSymbol: e.Symbol,
-				Price:       e.Price,
-				Timestamp:   e.Time,
-			}
-			db.DB.Create(&alert)
-			log.Printf("🚨 Alert created for %s at %.2f\n", e.Symbol, e.Price)
+		rules = append(rules, rule{
+			StockID:   stock.ID,
+			UserID:    owners[stock.PortfolioID],
+			Symbol:    stock.StockSymbol,
+			Threshold: stock.ThresholdPrice,
+		})
+	}
+	p.rules.Replace(rules)
+
+	signalRules, err := p.signalRules.List()
+	if err != nil {
+		return err
+	}
+	p.signals.Replace(signalRules)
+
+	expressionRules, err := p.expressionRules.List()
+	if err != nil {
+		return err
+	}
+	p.expressions.Replace(expressionRules)
+
+	snoozed, err := p.alerts.ListSnoozed(time.Now())
+	if err != nil {
+		return err
+	}
+	p.snoozes.Replace(snoozed)
+	return p.loadStops(owners)
+}
+
+// resyncEvery reloads the index at the given period, catching any change
+// event that was missed
+func (p *alertProcessor) resyncEvery(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := p.resync(); err != nil {
+			log.Println("❌ Alert rule resync failed:", err)
+			continue
 		}
+		log.Printf("🔄 Alert rules resynced: %d rules, %d position rules, %d signal rules, %d expression rules\n",
+			p.rules.Len(), p.stops.Len(), p.signals.Len(), p.expressions.Len())
+	}
+}
+
+// reload resyncs every rule after dropping the in-memory state of the
+// symbols the change resets
+func (p *alertProcessor) reload(change events.RuleChange) {
+	for _, symbol := range change.Reset {
+		p.stops.Reset(symbol)
+		p.expressions.Reset(symbol)
+	}
+	if err := p.resync(); err != nil {
+		log.Println("❌ Alert rule resync failed:", err)
 	}
 }
 
-func getUserIDFromPortfolio(portfolioID uint) uint {
-	var portfolio models.Portfolio
-	db.DB.First(&portfolio, portfolioID)
-	return portfolio.UserID
+// followRuleChanges applies the rule changes published by the API. Every
+// instance needs every change, so each one reads with its own consumer group
+// and starts at the newest message; the full resync covers anything older.
+func (p *alertProcessor) followRuleChanges(broker string) {
+	hostname, _ := os.Hostname()
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     []string{broker},
+		Topic:       events.TopicRuleChanges,
+		GroupID:     "stock-alerts-rules-" + hostname,
+		StartOffset: kafka.LastOffset,
+	})
+	defer r.Close()
+
+	var backoff events.Backoff
+	for {
+		m, err := r.ReadMessage(context.Background())
+		if err != nil {
+			delay := backoff.Next()
+			log.Printf("❌ Kafka rule change read error, retrying in %s: %v\n", delay, err)
+			time.Sleep(delay)
+			continue
+		}
+		backoff.Reset()
+
+		var change events.RuleChange
+		if err := json.Unmarshal(m.Value, &change); err != nil {
+			log.Println("❌ JSON parse error:", err)
+			continue
+		}
+
+		if change.Op == events.OpReload {
+			p.reload(change)
+			continue
+		}
+		p.rules.Apply(change)
+		log.Printf("📝 Rule change applied: %s stock %d (%s)\n", change.Op, change.StockID, change.Symbol)
+	}
+}
+
+func (p *alertProcessor) processAlertEvent(e StockEvent) {
+	if e.Replay {
+		return // history is not a live price to alert on
+	}
+	for _, r := range p.rules.Triggered(e.Symbol, e.Price) {
+		if p.snoozes.Suppressed(models.AlertThreshold, r.StockID, e.Time) {
+			continue
+		}
+		stockID := r.StockID
+		alert := models.Alert{
+			UserID:      r.UserID,
+			RuleID:      &stockID,
+			StockSymbol: e.Symbol,
+			Price:       e.Price,
+			Timestamp:   e.Time,
+		}
+		if err := p.alerts.Create(&alert); err != nil {
+			log.Printf("❌ Failed to store alert for %s: %v\n", e.Symbol, err)
+			continue
+		}
+		log.Printf("🚨 Alert created for %s at %s\n", e.Symbol, e.Price.StringFixed(2))
+	}
+	p.processStops(e)
+	p.processExpressions(e)
 }
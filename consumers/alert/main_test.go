@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"stock-alerts/events"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestProcessAlertEvent(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	portfolio := models.Portfolio{UserID: 42}
+	repos.Portfolios.Create(&portfolio)
+	repos.Stocks.Create(&models.Stock{PortfolioID: portfolio.ID, StockSymbol: "AAPL", ThresholdPrice: decimal.NewFromInt(150)})
+	repos.Stocks.Create(&models.Stock{PortfolioID: portfolio.ID, StockSymbol: "AAPL", ThresholdPrice: decimal.NewFromInt(200)})
+	repos.Stocks.Create(&models.Stock{PortfolioID: portfolio.ID, StockSymbol: "TSLA", ThresholdPrice: decimal.NewFromInt(100)})
+
+	processor := newAlertProcessor(repos)
+	if err := processor.resync(); err != nil {
+		t.Fatalf("Expected resync to succeed, got %v", err)
+	}
+	processor.processAlertEvent(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(155), Time: time.Now()})
+
+	alerts, _ := repos.Alerts.ListByUser(42)
+	if len(alerts) != 1 {
+		t.Fatalf("Expected 1 alert, got %d", len(alerts))
+	}
+	if alerts[0].StockSymbol != "AAPL" || !alerts[0].Price.Equal(decimal.NewFromInt(155)) {
+		t.Errorf("Unexpected alert: %+v", alerts[0])
+	}
+}
+
+// Test that replayed history raises no alerts
+func TestReplayedPricesDoNotAlert(t *testing.T) {
+	processor := newAlertProcessor(repository.NewMemoryRepositories())
+	processor.rules.Apply(events.RuleChange{Op: events.OpUpsert, StockID: 1, UserID: 7, Symbol: "AAPL", Threshold: decimal.NewFromInt(150)})
+
+	processor.processAlertEvent(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(160), Time: time.Now(), Replay: true})
+	if alerts, _ := processor.alerts.ListByUser(7); len(alerts) != 0 {
+		t.Errorf("Expected no alerts from a replay, got %+v", alerts)
+	}
+}
+
+// Test a price equal to the threshold fires however it is written
+func TestThresholdComparedExactly(t *testing.T) {
+	processor := newAlertProcessor(repository.NewMemoryRepositories())
+	var change events.RuleChange
+	json.Unmarshal([]byte(`{"op": "upsert", "stock_id": 1, "user_id": 7, "symbol": "AAPL", "threshold": 0.3}`), &change)
+	processor.rules.Apply(change)
+
+	for _, body := range []string{
+		`{"symbol": "AAPL", "price": 0.29999999999999999, "time": "2025-03-03T15:00:00Z"}`,
+		`{"symbol": "AAPL", "price": 0.30, "time": "2025-03-03T15:00:00Z"}`,
+		`{"symbol": "AAPL", "price": "0.3000", "time": "2025-03-03T15:00:00Z"}`,
+	} {
+		var e StockEvent
+		if err := json.Unmarshal([]byte(body), &e); err != nil {
+			t.Fatalf("Failed to decode %s: %v", body, err)
+		}
+		processor.processAlertEvent(e)
+	}
+
+	alerts, _ := processor.alerts.ListByUser(7)
+	if len(alerts) != 2 || !alerts[0].Price.Equal(decimal.RequireFromString("0.3")) {
+		t.Errorf("Expected the two prices at the threshold to fire, got %+v", alerts)
+	}
+}
+
+func TestRuleIndex(t *testing.T) {
+	idx := newRuleIndex()
+	idx.Replace([]rule{
+		{StockID: 1, UserID: 1, Symbol: "AAPL", Threshold: decimal.NewFromInt(200)},
+		{StockID: 2, UserID: 2, Symbol: "AAPL", Threshold: decimal.NewFromInt(150)},
+		{StockID: 3, UserID: 1, Symbol: "TSLA", Threshold: decimal.NewFromInt(100)},
+	})
+
+	triggered := idx.Triggered("AAPL", decimal.NewFromInt(180))
+	if len(triggered) != 1 || triggered[0].StockID != 2 {
+		t.Errorf("Expected only stock 2 to trigger at 180, got %+v", triggered)
+	}
+	if n := len(idx.Triggered("AAPL", decimal.NewFromInt(200))); n != 2 {
+		t.Errorf("Expected the threshold itself to trigger, got %d rules", n)
+	}
+	if n := len(idx.Triggered("MSFT", decimal.NewFromInt(1000))); n != 0 {
+		t.Errorf("Expected no rules for an unknown symbol, got %d", n)
+	}
+
+	// A change moves stock 3 to AAPL below the other rules
+	idx.Apply(events.RuleChange{Op: events.OpUpsert, StockID: 3, UserID: 1, Symbol: "AAPL", Threshold: decimal.NewFromInt(120)})
+	triggered = idx.Triggered("AAPL", decimal.NewFromInt(160))
+	if len(triggered) != 2 || triggered[0].StockID != 3 || triggered[1].StockID != 2 {
+		t.Errorf("Expected stocks 3 and 2 in threshold order, got %+v", triggered)
+	}
+	if n := len(idx.Triggered("TSLA", decimal.NewFromInt(1000))); n != 0 {
+		t.Errorf("Expected the moved rule to leave TSLA, got %d rules", n)
+	}
+
+	idx.Apply(events.RuleChange{Op: events.OpDelete, StockID: 2})
+	if idx.Len() != 2 {
+		t.Errorf("Expected 2 rules after delete, got %d", idx.Len())
+	}
+}
+
+func TestProcessAlertEventAfterRuleChange(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	processor := newAlertProcessor(repos)
+	processor.rules.Apply(events.RuleChange{Op: events.OpUpsert, StockID: 7, UserID: 9, Symbol: "NVDA", Threshold: decimal.NewFromInt(500)})
+
+	processor.processAlertEvent(StockEvent{Symbol: "NVDA", Price: decimal.NewFromInt(510), Time: time.Now()})
+
+	alerts, _ := repos.Alerts.ListByUser(9)
+	if len(alerts) != 1 {
+		t.Errorf("Expected the published rule to trigger without a resync, got %d alerts", len(alerts))
+	}
+}
+
+func TestProcessStops(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	portfolio := models.Portfolio{UserID: 5}
+	repos.Portfolios.Create(&portfolio)
+	repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "AAPL", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(100)})
+	trailing := models.PositionAlertRule{PortfolioID: portfolio.ID, Symbol: "AAPL", Type: models.RuleTrailingStop, Value: decimal.NewFromInt(10), HighWater: decimal.NewFromInt(100)}
+	repos.PositionRules.Create(&trailing)
+	// A rule on a closed position is ignored
+	repos.PositionRules.Create(&models.PositionAlertRule{PortfolioID: portfolio.ID, Symbol: "TSLA", Type: models.RuleStopLoss, Value: decimal.NewFromInt(5)})
+
+	processor := newAlertProcessor(repos)
+	if err := processor.resync(); err != nil {
+		t.Fatalf("Expected resync to succeed, got %v", err)
+	}
+	if processor.stops.Len() != 1 {
+		t.Fatalf("Expected 1 position rule, got %d", processor.stops.Len())
+	}
+
+	now := time.Now()
+	for _, price := range []float64{120, 110, 107, 105} {
+		processor.processAlertEvent(StockEvent{Symbol: "AAPL", Price: decimal.NewFromFloat(price), Time: now})
+	}
+
+	alerts, _ := repos.Alerts.ListByUser(5)
+	if len(alerts) != 1 {
+		t.Fatalf("Expected the trailing stop to fire once, got %d alerts", len(alerts))
+	}
+	if alerts[0].Kind != models.AlertKind(models.RuleTrailingStop) || !alerts[0].Price.Equal(decimal.NewFromInt(107)) {
+		t.Errorf("Unexpected alert: %+v", alerts[0])
+	}
+
+	stored, _ := repos.PositionRules.ListByPortfolio(portfolio.ID)
+	for _, rule := range stored {
+		if rule.ID == trailing.ID && (!rule.HighWater.Equal(decimal.NewFromInt(120)) || !rule.Triggered) {
+			t.Errorf("Expected high water 120 and triggered to be stored, got %+v", rule)
+		}
+	}
+
+	// A resync keeps the state, so the stop does not fire again
+	if err := processor.resync(); err != nil {
+		t.Fatalf("Expected resync to succeed, got %v", err)
+	}
+	processor.processAlertEvent(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(104), Time: now})
+	if alerts, _ := repos.Alerts.ListByUser(5); len(alerts) != 1 {
+		t.Errorf("Expected no new alert after a resync, got %d alerts", len(alerts))
+	}
+}
+
+func TestProcessSignalEvent(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	repos.SignalRules.Create(&models.SignalRule{UserID: 3, Symbol: "AAPL", Type: models.SignalChange, To: models.SignalBullish})
+	repos.SignalRules.Create(&models.SignalRule{UserID: 4, Symbol: "AAPL", Type: models.SignalGoldenCross})
+	repos.SignalRules.Create(&models.SignalRule{UserID: 4, Symbol: "TSLA", Type: models.SignalChange})
+
+	processor := newAlertProcessor(repos)
+	if err := processor.resync(); err != nil {
+		t.Fatalf("Expected resync to succeed, got %v", err)
+	}
+	now := time.Now()
+	processor.processSignalEvent(events.SignalEvent{Symbol: "AAPL", Type: string(models.SignalChange), From: models.SignalNeutral, To: models.SignalBearish, Time: now})
+	processor.processSignalEvent(events.SignalEvent{Symbol: "AAPL", Type: string(models.SignalChange), From: models.SignalNeutral, To: models.SignalBullish, Price: decimal.NewFromInt(101), Time: now})
+	processor.processSignalEvent(events.SignalEvent{Symbol: "AAPL", Type: string(models.SignalGoldenCross), Price: decimal.NewFromInt(101), Value: 100.5, Time: now})
+
+	alerts, _ := repos.Alerts.ListByUser(3)
+	if len(alerts) != 1 || alerts[0].Kind != models.AlertKind(models.SignalChange) || !alerts[0].Price.Equal(decimal.NewFromInt(101)) {
+		t.Errorf("Expected one alert on the transition to BULLISH, got %+v", alerts)
+	}
+	alerts, _ = repos.Alerts.ListByUser(4)
+	if len(alerts) != 1 || alerts[0].Kind != models.AlertKind(models.SignalGoldenCross) {
+		t.Errorf("Expected one golden cross alert, got %+v", alerts)
+	}
+}
+
+func TestProcessExpressions(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	rule := models.ExpressionRule{UserID: 8, Symbol: "AAPL", Expression: "price > sma(3) * 1.05"}
+	repos.ExpressionRules.Create(&rule)
+	repos.ExpressionRules.Create(&models.ExpressionRule{UserID: 8, Symbol: "AAPL", Expression: "price >"})
+
+	processor := newAlertProcessor(repos)
+	if err := processor.resync(); err != nil {
+		t.Fatalf("Expected resync to succeed, got %v", err)
+	}
+	if processor.expressions.Len() != 1 {
+		t.Fatalf("Expected the invalid rule to be skipped, got %d rules", processor.expressions.Len())
+	}
+
+	now := time.Now()
+	for _, price := range []float64{100, 100, 120, 125, 100} {
+		processor.processAlertEvent(StockEvent{Symbol: "AAPL", Price: decimal.NewFromFloat(price), Time: now})
+		if price == 125 {
+			// A resync between ticks keeps both the prices and the trigger state
+			processor.resync()
+		}
+	}
+
+	alerts, _ := repos.Alerts.ListByUser(8)
+	if len(alerts) != 1 {
+		t.Fatalf("Expected the expression to fire once, got %d alerts", len(alerts))
+	}
+	if alerts[0].Kind != models.AlertExpression || !alerts[0].Price.Equal(decimal.NewFromInt(120)) {
+		t.Errorf("Unexpected alert: %+v", alerts[0])
+	}
+	rules, _ := repos.ExpressionRules.ListByUser(8)
+	if rules[0].Triggered {
+		t.Errorf("Expected the rule to re-arm once the condition cleared, got %+v", rules[0])
+	}
+}
+
+func TestSnoozedRulesAreSuppressed(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	portfolio := models.Portfolio{UserID: 9}
+	repos.Portfolios.Create(&portfolio)
+	stock := models.Stock{PortfolioID: portfolio.ID, StockSymbol: "AAPL", ThresholdPrice: decimal.NewFromInt(150)}
+	repos.Stocks.Create(&stock)
+
+	processor := newAlertProcessor(repos)
+	processor.resync()
+	now := time.Now()
+	processor.processAlertEvent(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(151), Time: now})
+
+	alerts, _ := repos.Alerts.ListByUser(9)
+	if len(alerts) != 1 || alerts[0].RuleID == nil || *alerts[0].RuleID != stock.ID {
+		t.Fatalf("Expected one alert pointing at its rule, got %+v", alerts)
+	}
+	until := now.Add(time.Hour)
+	repos.Alerts.SetStatus([]uint{alerts[0].ID}, models.AlertSnoozed, &until, now)
+	processor.resync()
+
+	processor.processAlertEvent(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(152), Time: now.Add(time.Minute)})
+	if alerts, _ := repos.Alerts.ListByUser(9); len(alerts) != 1 {
+		t.Errorf("Expected the snoozed rule to stay quiet, got %d alerts", len(alerts))
+	}
+	processor.processAlertEvent(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(153), Time: until.Add(time.Minute)})
+	if alerts, _ := repos.Alerts.ListByUser(9); len(alerts) != 2 {
+		t.Errorf("Expected the rule to fire again after the snooze, got %d alerts", len(alerts))
+	}
+}
+
+func TestSplitResetsStopsAndPrices(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	portfolio := models.Portfolio{UserID: 6}
+	repos.Portfolios.Create(&portfolio)
+	repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "AAPL", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(100)})
+	trailing := models.PositionAlertRule{PortfolioID: portfolio.ID, Symbol: "AAPL", Type: models.RuleTrailingStop, Value: decimal.NewFromInt(10), HighWater: decimal.NewFromInt(100)}
+	repos.PositionRules.Create(&trailing)
+	repos.ExpressionRules.Create(&models.ExpressionRule{UserID: 6, Symbol: "AAPL", Expression: "price < sma(3) * 0.8"})
+
+	processor := newAlertProcessor(repos)
+	if err := processor.resync(); err != nil {
+		t.Fatalf("Expected resync to succeed, got %v", err)
+	}
+	now := time.Now()
+	for range 3 {
+		processor.processAlertEvent(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(120), Time: now})
+	}
+
+	// A 4-for-1 split divides the stored high water to 30; the reload must not
+	// bring back the 120 held in memory, nor compare 30.5 with pre-split prices
+	split := models.CorporateAction{Type: models.ActionSplit, Symbol: "AAPL", Ratio: decimal.NewFromInt(4), EffectiveDate: now}
+	repos.Actions.Create(&split)
+	if _, err := repos.Actions.ApplySplit(split, now, now); err != nil {
+		t.Fatalf("ApplySplit failed: %v", err)
+	}
+	processor.reload(events.RuleChange{Op: events.OpReload, Reset: []string{"AAPL"}})
+	processor.processAlertEvent(StockEvent{Symbol: "AAPL", Price: decimal.RequireFromString("30.5"), Time: now.Add(time.Minute)})
+
+	if alerts, _ := repos.Alerts.ListByUser(6); len(alerts) != 0 {
+		t.Errorf("Expected no alert on the first post-split tick, got %+v", alerts)
+	}
+	rules, _ := repos.PositionRules.ListByPortfolio(portfolio.ID)
+	if len(rules) != 1 || !rules[0].HighWater.Equal(decimal.RequireFromString("30.5")) || rules[0].Triggered {
+		t.Errorf("Expected the split-adjusted high water raised to 30.5, got %+v", rules)
+	}
+}
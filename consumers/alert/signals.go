@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"stock-alerts/events"
+	"stock-alerts/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// signalBook keeps the users' subscriptions to indicator events, keyed by symbol
+type signalBook struct {
+	mu       sync.RWMutex
+	bySymbol map[string][]models.SignalRule
+}
+
+func newSignalBook() *signalBook {
+	return &signalBook{bySymbol: map[string][]models.SignalRule{}}
+}
+
+// Replace swaps the whole book for the given rules
+func (b *signalBook) Replace(rules []models.SignalRule) {
+	bySymbol := map[string][]models.SignalRule{}
+	for _, r := range rules {
+		bySymbol[r.Symbol] = append(bySymbol[r.Symbol], r)
+	}
+	b.mu.Lock()
+	b.bySymbol = bySymbol
+	b.mu.Unlock()
+}
+
+// Matching returns the rules an event sets off
+func (b *signalBook) Matching(e events.SignalEvent) []models.SignalRule {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var matched []models.SignalRule
+	for _, r := range b.bySymbol[e.Symbol] {
+		if string(r.Type) != e.Type {
+			continue
+		}
+		if (r.From != "" && r.From != e.From) || (r.To != "" && r.To != e.To) {
+			continue
+		}
+		matched = append(matched, r)
+	}
+	return matched
+}
+
+// Len returns the number of rules in the book
+func (b *signalBook) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	n := 0
+	for _, list := range b.bySymbol {
+		n += len(list)
+	}
+	return n
+}
+
+// followSignals turns the indicator events of the analytics consumer into alerts
+func (p *alertProcessor) followSignals(broker string) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{broker},
+		Topic:   events.TopicSignals,
+		GroupID: "stock-alerts-signals",
+	})
+	defer r.Close()
+
+	var backoff events.Backoff
+	for {
+		m, err := r.ReadMessage(context.Background())
+		if err != nil {
+			delay := backoff.Next()
+			log.Printf("❌ Kafka signal read error, retrying in %s: %v\n", delay, err)
+			time.Sleep(delay)
+			continue
+		}
+		backoff.Reset()
+
+		var event events.SignalEvent
+		if err := json.Unmarshal(m.Value, &event); err != nil {
+			log.Println("❌ JSON parse error:", err)
+			continue
+		}
+
+		p.processSignalEvent(event)
+	}
+}
+
+func (p *alertProcessor) processSignalEvent(e events.SignalEvent) {
+	for _, r := range p.signals.Matching(e) {
+		if p.snoozes.Suppressed(models.AlertKind(e.Type), r.ID, e.Time) {
+			continue
+		}
+		ruleID := r.ID
+		alert := models.Alert{
+			UserID:      r.UserID,
+			Kind:        models.AlertKind(e.Type),
+			RuleID:      &ruleID,
+			StockSymbol: e.Symbol,
+			Price:       e.Price,
+			Message:     signalMessage(e),
+			Timestamp:   e.Time,
+		}
+		if err := p.alerts.Create(&alert); err != nil {
+			log.Printf("❌ Failed to store signal alert for %s: %v\n", e.Symbol, err)
+			continue
+		}
+		log.Printf("🚨 %s\n", alert.Message)
+	}
+}
+
+// signalMessage describes an indicator event
+func signalMessage(e events.SignalEvent) string {
+	switch models.SignalType(e.Type) {
+	case models.SignalChange:
+		return fmt.Sprintf("%s signal changed from %s to %s at %s", e.Symbol, e.From, e.To, e.Price.StringFixed(2))
+	case models.SignalGoldenCross:
+		return fmt.Sprintf("%s golden cross: the 5-tick average rose above the 20-tick average at %.2f", e.Symbol, e.Value)
+	case models.SignalDeathCross:
+		return fmt.Sprintf("%s death cross: the 5-tick average fell below the 20-tick average at %.2f", e.Symbol, e.Value)
+	case models.SignalRSIOverbought:
+		return fmt.Sprintf("%s is overbought: RSI %.1f at %s", e.Symbol, e.Value, e.Price.StringFixed(2))
+	case models.SignalRSIOversold:
+		return fmt.Sprintf("%s is oversold: RSI %.1f at %s", e.Symbol, e.Value, e.Price.StringFixed(2))
+	case models.SignalBollingerUpper:
+		return fmt.Sprintf("%s broke above its upper Bollinger band %.2f at %s", e.Symbol, e.Value, e.Price.StringFixed(2))
+	case models.SignalBollingerLower:
+		return fmt.Sprintf("%s broke below its lower Bollinger band %.2f at %s", e.Symbol, e.Value, e.Price.StringFixed(2))
+	}
+	return fmt.Sprintf("%s %s at %s", e.Symbol, e.Type, e.Price.StringFixed(2))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"stock-alerts/alerting"
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// stopRule is a position alert rule with what it needs from the position
+type stopRule struct {
+	rule    models.PositionAlertRule
+	userID  uint
+	avgCost decimal.Decimal
+}
+
+// stopBook keeps the stop-loss, take-profit and trailing-stop rules of open
+// positions in memory, keyed by symbol
+type stopBook struct {
+	mu       sync.Mutex
+	bySymbol map[string][]*stopRule
+}
+
+func newStopBook() *stopBook {
+	return &stopBook{bySymbol: map[string][]*stopRule{}}
+}
+
+// Replace swaps the rules for freshly loaded ones. A rule already in memory
+// keeps its high-water mark and trigger state, which may be newer than the
+// stored ones.
+func (b *stopBook) Replace(rules []*stopRule) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := map[uint]*stopRule{}
+	for _, list := range b.bySymbol {
+		for _, r := range list {
+			current[r.rule.ID] = r
+		}
+	}
+
+	bySymbol := map[string][]*stopRule{}
+	for _, r := range rules {
+		if old, ok := current[r.rule.ID]; ok {
+			r.rule.HighWater = decimal.Max(r.rule.HighWater, old.rule.HighWater)
+			r.rule.Triggered = old.rule.Triggered
+		}
+		bySymbol[r.rule.Symbol] = append(bySymbol[r.rule.Symbol], r)
+	}
+	b.bySymbol = bySymbol
+}
+
+// Reset drops the rules of a symbol, so the next Replace takes their state
+// from the database
+func (b *stopBook) Reset(symbol string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.bySymbol, symbol)
+}
+
+// Len returns the number of rules in the book
+func (b *stopBook) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, list := range b.bySymbol {
+		n += len(list)
+	}
+	return n
+}
+
+// loadStops builds the stop rules of the positions that are still open
+func (p *alertProcessor) loadStops(owners map[uint]uint) error {
+	rules, err := p.positionRules.List()
+	if err != nil {
+		return err
+	}
+	positions, err := p.positions.List()
+	if err != nil {
+		return err
+	}
+	type key struct {
+		portfolioID uint
+		symbol      string
+	}
+	costs := map[key]decimal.Decimal{}
+	for _, position := range positions {
+		costs[key{position.PortfolioID, position.Symbol}] = position.AvgCost
+	}
+
+	stops := make([]*stopRule, 0, len(rules))
+	for _, rule := range rules {
+		avgCost, ok := costs[key{rule.PortfolioID, rule.Symbol}]
+		if !ok {
+			continue // the position was closed
+		}
+		stops = append(stops, &stopRule{rule: rule, userID: owners[rule.PortfolioID], avgCost: avgCost})
+	}
+	p.stops.Replace(stops)
+	return nil
+}
+
+// processStops evaluates the position alert rules on the event's symbol,
+// storing their state whenever it changes
+func (p *alertProcessor) processStops(e StockEvent) {
+	p.stops.mu.Lock()
+	defer p.stops.mu.Unlock()
+	for _, s := range p.stops.bySymbol[e.Symbol] {
+		result := alerting.EvaluateStop(&s.rule, s.avgCost, e.Price)
+		if result.StateChanged {
+			if err := p.positionRules.UpdateState(s.rule.ID, s.rule.HighWater, s.rule.Triggered); err != nil {
+				log.Printf("❌ Failed to store state of rule %d: %v\n", s.rule.ID, err)
+			}
+		}
+		kind := models.AlertKind(s.rule.Type)
+		if !result.Fire || p.snoozes.Suppressed(kind, s.rule.ID, e.Time) {
+			continue
+		}
+
+		portfolioID, ruleID := s.rule.PortfolioID, s.rule.ID
+		alert := models.Alert{
+			UserID:      s.userID,
+			Kind:        kind,
+			RuleID:      &ruleID,
+			PortfolioID: &portfolioID,
+			StockSymbol: e.Symbol,
+			Price:       e.Price,
+			Message:     alerting.StopMessage(s.rule, e.Price, result),
+			Timestamp:   e.Time,
+		}
+		if err := p.alerts.Create(&alert); err != nil {
+			log.Printf("❌ Failed to store alert for %s: %v\n", e.Symbol, err)
+			continue
+		}
+		log.Printf("🚨 %s\n", alert.Message)
+	}
+}
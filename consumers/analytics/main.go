@@ -3,42 +3,35 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"time"
 
+	"stock-alerts/calendar"
 	"stock-alerts/db"
+	"stock-alerts/events"
+	"stock-alerts/models"
+	"stock-alerts/repository"
 
 	"github.com/joho/godotenv"
 	"github.com/segmentio/kafka-go"
+	"github.com/shopspring/decimal"
 )
 
-// StockAnalytics represents aggregated stock analytics
-type StockAnalytics struct {
-	ID           uint      `gorm:"primaryKey"`
-	Symbol       string    `gorm:"size:10;uniqueIndex:idx_symbol_date"`
-	Date         time.Time `gorm:"uniqueIndex:idx_symbol_date"`
-	MinPrice     float64
-	MaxPrice     float64
-	AvgPrice     float64
-	TotalVolume  int64
-	PriceChanges int // number of price updates in a day
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-}
-
-type StockEvent struct {
-	Symbol string    `json:"symbol"`
-	Price  float64   `json:"price"`
-	Time   time.Time `json:"time"`
-}
+type StockEvent = events.StockPrice
 
-// TableName overrides the default table name
-func (StockAnalytics) TableName() string {
-	return "stock_analytics"
-}
+// groupID is the consumer group of the live consumer, which a rebuild moves
+// past the prices it replayed
+const groupID = "analytics-consumer-group"
 
 func main() {
+	rebuild := flag.String("rebuild", "", "recompute the analytics from \"history\" (stock_price_records) or \"kafka\" (the prices topic), then exit")
+	from := flag.String("from", "", "with -rebuild, first date to recompute, YYYY-MM-DD (default the oldest price's)")
+	flag.Parse()
+
 	// Load environment variables from .env file
 	err := godotenv.Load("../../.env")
 	if err != nil {
@@ -46,14 +39,13 @@ func main() {
 	}
 
 	// Connect DB
-	db.ConnectDatabase()
-
-	// Ensure the table exists
-	if err := db.DB.AutoMigrate(&StockAnalytics{}); err != nil {
-		log.Printf("⚠️  AutoMigrate stock_analytics table failed: %v\n", err)
+	database, err := db.ConnectDatabase()
+	if err != nil {
+		log.Fatal("❌ ", err)
 	}
 
-	log.Println("📊 Analytics Consumer starting...")
+	repos := repository.NewGormRepositories(database)
+	analytics := repos.Analytics
 
 	// Get Kafka broker from environment variable
 	broker := os.Getenv("KAFKA_BROKER")
@@ -61,23 +53,46 @@ func main() {
 		broker = "127.0.0.1:9093" // fallback for local development
 	}
 
+	if *rebuild != "" {
+		if err := runRebuild(*rebuild, *from, repos, broker); err != nil {
+			log.Fatal("❌ Rebuild failed: ", err)
+		}
+		return
+	}
+
+	aggregator := newAggregator(analytics)
+
+	log.Println("📊 Analytics Consumer starting...")
+
+	signalWriter := &kafka.Writer{
+		Addr:     kafka.TCP(broker),
+		Topic:    events.TopicSignals,
+		Balancer: &kafka.Hash{}, // keep the events of one symbol in order
+	}
+	defer signalWriter.Close()
+	signals := newSignalTracker(analytics, kafkaSignalPublisher{signalWriter})
+
 	// Start consuming messages for analytics
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  []string{broker},
-		Topic:    "stock_prices",
-		GroupID:  "analytics-consumer-group",
+		Topic:    events.TopicStockPrices,
+		GroupID:  groupID,
 		MinBytes: 10e3, // 10KB
 		MaxBytes: 10e6, // 10MB
 	})
 
 	defer r.Close()
 
+	var backoff events.Backoff
 	for {
 		m, err := r.ReadMessage(context.Background())
 		if err != nil {
-			log.Println("❌ Kafka read error:", err)
+			delay := backoff.Next()
+			log.Printf("❌ Kafka read error, retrying in %s: %v\n", delay, err)
+			time.Sleep(delay)
 			continue
 		}
+		backoff.Reset()
 
 		var event StockEvent
 		if err := json.Unmarshal(m.Value, &event); err != nil {
@@ -85,57 +100,136 @@ func main() {
 			continue
 		}
 
-		updateAnalytics(event)
+		aggregator.updateAnalytics(event)
+		signals.handle(event)
 	}
 }
 
-func updateAnalytics(event StockEvent) {
-	// Get date for grouping (without time component)
-	date := time.Date(event.Time.Year(), event.Time.Month(), event.Time.Day(), 0, 0, 0, 0, event.Time.Location())
+// runRebuild recomputes the analytics from the given source and moves the
+// live consumer's group to the offsets the topic had when it started, so the
+// consumer goes on with the first price the rebuild did not count. The live
+// consumer must be stopped meanwhile.
+func runRebuild(mode, fromDate string, repos repository.Repositories, broker string) error {
+	var from time.Time
+	if fromDate != "" {
+		var err error
+		if from, err = time.Parse("2006-01-02", fromDate); err != nil {
+			return fmt.Errorf("-from must be a YYYY-MM-DD date")
+		}
+	}
+	if mode != "history" && mode != "kafka" {
+		return fmt.Errorf("-rebuild must be history or kafka")
+	}
 
-	var analytics StockAnalytics
+	client := &kafka.Client{Addr: kafka.TCP(broker), Timeout: 10 * time.Second}
+	offsets, err := topicOffsets(client, events.TopicStockPrices)
+	if err != nil {
+		return fmt.Errorf("failed to read the offsets of %s: %w", events.TopicStockPrices, err)
+	}
+	var source priceSource = historySource{prices: repos.Prices, to: time.Now()}
+	if mode == "kafka" {
+		source = &kafkaSource{broker: broker, topic: events.TopicStockPrices, partitions: offsets}
+	}
+
+	r := &rebuilder{source: source, shadow: repos.AnalyticsShadow, from: from, interval: 10 * time.Second}
+	if err := r.run(); err != nil {
+		return err
+	}
+	if err := commitOffsets(client, groupID, events.TopicStockPrices, offsets); err != nil {
+		return fmt.Errorf("analytics swapped in, but moving %s failed: %w", groupID, err)
+	}
+	log.Printf("⏩ Moved %s to the end of the rebuilt prices\n", groupID)
+	return nil
+}
+
+// kafkaSignalPublisher writes indicator events to the signals topic
+type kafkaSignalPublisher struct {
+	writer *kafka.Writer
+}
+
+func (p kafkaSignalPublisher) PublishSignal(event events.SignalEvent) {
+	data, _ := json.Marshal(event)
+	err := p.writer.WriteMessages(context.Background(),
+		kafka.Message{Key: []byte(event.Symbol), Value: data},
+	)
+	if err != nil {
+		log.Println("❌ Kafka signal write failed:", err)
+	}
+}
+
+// aggregator folds price events into the daily analytics rows
+type aggregator struct {
+	analytics repository.AnalyticsRepo
+	quiet     bool // no log line per price, for rebuilds
+}
+
+func newAggregator(analytics repository.AnalyticsRepo) *aggregator {
+	return &aggregator{analytics: analytics}
+}
+
+func (a *aggregator) updateAnalytics(event StockEvent) {
+	// Group by the exchange's trading date, whatever zone the producer used
+	date := calendar.ForSymbol(event.Symbol).TradingDate(event.Time)
 
 	// Find or create analytics record for this symbol and date
-	result := db.DB.Where("symbol = ? AND date = ?", event.Symbol, date).First(&analytics)
+	analytics, err := a.analytics.FindDaily(event.Symbol, date)
 
-	if result.Error != nil {
+	if errors.Is(err, repository.ErrNotFound) {
 		// Create new analytics record
-		analytics = StockAnalytics{
+		analytics = &models.DailyAnalytics{
 			Symbol:       event.Symbol,
 			Date:         date,
 			MinPrice:     event.Price,
 			MaxPrice:     event.Price,
 			AvgPrice:     event.Price,
+			PriceSum:     event.Price,
 			TotalVolume:  1,
 			PriceChanges: 1,
+			LastTick:     event.Time,
 		}
 
-		if err := db.DB.Create(&analytics).Error; err != nil {
+		if err := a.analytics.SaveDaily(analytics); err != nil {
 			log.Printf("❌ Failed to create analytics for %s: %v\n", event.Symbol, err)
 			return
 		}
-		log.Printf("📊 Created analytics record for %s on %s\n", event.Symbol, date.Format("2006-01-02"))
-	} else {
-		// Update existing analytics record
-		newAvg := (analytics.AvgPrice*float64(analytics.PriceChanges) + event.Price) / float64(analytics.PriceChanges+1)
-
-		updates := map[string]interface{}{
-			"avg_price":     newAvg,
-			"price_changes": analytics.PriceChanges + 1,
+		if !a.quiet {
+			log.Printf("📊 Created analytics record for %s on %s\n", event.Symbol, date.Format("2006-01-02"))
 		}
-
-		if event.Price < analytics.MinPrice {
-			updates["min_price"] = event.Price
+	} else if err != nil {
+		log.Printf("❌ Failed to load analytics for %s: %v\n", event.Symbol, err)
+	} else if event.Replay && !event.Time.After(analytics.LastTick) {
+		return // replayed history the day already counts
+	} else {
+		// Update existing analytics record. The sum is exact, so the average
+		// is the same after thousands of updates as if computed in one go.
+		if analytics.PriceSum.IsZero() {
+			// rows written before PriceSum was kept
+			analytics.PriceSum = analytics.AvgPrice.Mul(decimal.NewFromInt(int64(analytics.PriceChanges)))
 		}
-		if event.Price > analytics.MaxPrice {
-			updates["max_price"] = event.Price
+		analytics.PriceSum = analytics.PriceSum.Add(event.Price)
+		analytics.PriceChanges++
+		analytics.AvgPrice = averageOf(analytics.PriceSum, analytics.PriceChanges)
+		analytics.MinPrice = decimal.Min(analytics.MinPrice, event.Price)
+		analytics.MaxPrice = decimal.Max(analytics.MaxPrice, event.Price)
+		if event.Time.After(analytics.LastTick) {
+			analytics.LastTick = event.Time
 		}
 
-		if err := db.DB.Model(&analytics).Updates(updates).Error; err != nil {
+		if err := a.analytics.SaveDaily(analytics); err != nil {
 			log.Printf("❌ Failed to update analytics for %s: %v\n", event.Symbol, err)
 			return
 		}
-		log.Printf("📊 Updated analytics for %s: price=%.2f, avg=%.2f, changes=%d\n",
-			event.Symbol, event.Price, newAvg, analytics.PriceChanges+1)
+		if !a.quiet {
+			log.Printf("📊 Updated analytics for %s: price=%s, avg=%s, changes=%d\n",
+				event.Symbol, event.Price.StringFixed(2), analytics.AvgPrice.StringFixed(2), analytics.PriceChanges)
+		}
 	}
 }
+
+// avgPlaces is the number of decimal places averages are rounded to
+const avgPlaces = 8
+
+// averageOf divides a sum of prices by their count, rounded to avgPlaces
+func averageOf(sum decimal.Decimal, count int) decimal.Decimal {
+	return sum.DivRound(decimal.NewFromInt(int64(count)), avgPlaces)
+}
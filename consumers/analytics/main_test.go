@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"stock-alerts/repository"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestDailyAnalyticsUseTradingDate(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	aggregator := newAggregator(repos.Analytics)
+	tokyo := time.FixedZone("JST", 9*3600)
+
+	// Friday's session seen from UTC, from Tokyo (already Saturday there)
+	// and after hours, then a Saturday tick
+	aggregator.updateAnalytics(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(100), Time: time.Date(2025, 3, 14, 15, 0, 0, 0, time.UTC)})
+	aggregator.updateAnalytics(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(104), Time: time.Date(2025, 3, 15, 4, 0, 0, 0, tokyo)})
+	aggregator.updateAnalytics(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(98), Time: time.Date(2025, 3, 15, 14, 0, 0, 0, tokyo)})
+
+	daily, err := repos.Analytics.FindDaily("AAPL", time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Expected Friday's analytics, got %v", err)
+	}
+	if daily.PriceChanges != 3 || !daily.MinPrice.Equal(decimal.NewFromInt(98)) || !daily.MaxPrice.Equal(decimal.NewFromInt(104)) {
+		t.Errorf("Expected every tick in Friday's bucket, got %+v", daily)
+	}
+}
+
+func TestDailyAverageDoesNotDrift(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	aggregator := newAggregator(repos.Analytics)
+	at := time.Date(2025, 3, 14, 15, 0, 0, 0, time.UTC)
+
+	// 0.1 and 0.2 have no exact float64 form; 5000 of each average 0.15
+	for i := 0; i < 10000; i++ {
+		price := decimal.RequireFromString("0.1")
+		if i%2 == 1 {
+			price = decimal.RequireFromString("0.2")
+		}
+		aggregator.updateAnalytics(StockEvent{Symbol: "AAPL", Price: price, Time: at})
+	}
+
+	daily, err := repos.Analytics.FindDaily("AAPL", time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Expected the day's analytics, got %v", err)
+	}
+	if !daily.AvgPrice.Equal(decimal.RequireFromString("0.15")) || !daily.PriceSum.Equal(decimal.NewFromInt(1500)) {
+		t.Errorf("Expected an average of exactly 0.15, got %s (sum %s)", daily.AvgPrice, daily.PriceSum)
+	}
+}
+
+// Test that replayed history counts once, and not where live prices came first
+func TestReplayIsCountedOnce(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	aggregator := newAggregator(repos.Analytics)
+	day := time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) time.Time { return time.Date(2025, 3, 14, hour, 0, 0, 0, time.UTC) }
+
+	for i := 0; i < 2; i++ {
+		aggregator.updateAnalytics(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(100), Time: at(14), Replay: true})
+		aggregator.updateAnalytics(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(102), Time: at(15), Replay: true})
+		aggregator.updateAnalytics(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(101), Time: at(16), Replay: true})
+	}
+	daily, _ := repos.Analytics.FindDaily("AAPL", day)
+	if daily.PriceChanges != 3 || !daily.AvgPrice.Equal(decimal.NewFromInt(101)) {
+		t.Errorf("Expected the replayed day to count 3 prices once, got %+v", daily)
+	}
+
+	aggregator.updateAnalytics(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(99), Time: at(19)})
+	aggregator.updateAnalytics(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(90), Time: at(18), Replay: true})
+	daily, _ = repos.Analytics.FindDaily("AAPL", day)
+	if daily.PriceChanges != 4 || !daily.MinPrice.Equal(decimal.NewFromInt(99)) || !daily.LastTick.Equal(at(19)) {
+		t.Errorf("Expected the live price counted and the older replayed one skipped, got %+v", daily)
+	}
+}
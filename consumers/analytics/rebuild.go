@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"stock-alerts/events"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// priceSource is the price history a rebuild replays
+type priceSource interface {
+	// Oldest returns the time of the oldest price, ErrNotFound if there is none
+	Oldest() (time.Time, error)
+	// Replay passes the prices from about `from` on to handle, in time order
+	// for each symbol, advancing the progress as it goes
+	Replay(from time.Time, handle func(StockEvent), p *progress) error
+}
+
+// rebuilder recomputes the analytics from a price source with the live
+// aggregator and signal tracker, so rows written by older code get the
+// current math. The days from `from` on are recomputed in memory, written to
+// the shadow tables next to the rows kept from before, and swapped in at
+// once; readers see either the old analytics or the new ones.
+type rebuilder struct {
+	source   priceSource
+	shadow   repository.AnalyticsShadowRepo
+	from     time.Time     // first date recomputed; zero for the oldest price's
+	interval time.Duration // between progress reports
+}
+
+func (r *rebuilder) run() error {
+	from := r.from
+	if from.IsZero() {
+		oldest, err := r.source.Oldest()
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("no prices to rebuild from")
+		}
+		if err != nil {
+			return err
+		}
+		from = oldest.UTC().Truncate(24 * time.Hour)
+	}
+	log.Printf("🔄 Rebuilding analytics from %s; earlier days are kept as they are\n", from.Format("2006-01-02"))
+
+	rebuilt := newProjection(from)
+	aggregator := &aggregator{analytics: rebuilt, quiet: true}
+	signals := newSignalTracker(rebuilt, discardSignals{})
+	signals.quiet = true
+
+	// A day earlier warms up the indicators and catches prices whose trading
+	// date is ahead of their UTC date
+	p := &progress{interval: r.interval}
+	err := r.source.Replay(from.AddDate(0, 0, -1), func(event StockEvent) {
+		aggregator.updateAnalytics(event)
+		signals.handle(event)
+	}, p)
+	if err != nil {
+		return err
+	}
+	p.report()
+
+	daily, changes := rebuilt.rows()
+	if err := r.shadow.Reset(from); err != nil {
+		return fmt.Errorf("failed to prepare the shadow tables: %w", err)
+	}
+	if err := r.shadow.Insert(daily, changes); err != nil {
+		return fmt.Errorf("failed to write the shadow tables: %w", err)
+	}
+	if err := r.shadow.Swap(); err != nil {
+		return fmt.Errorf("failed to swap in the rebuilt analytics: %w", err)
+	}
+	log.Printf("✅ Rebuilt %d daily rows and %d signal changes\n", len(daily), len(changes))
+	return nil
+}
+
+// discardSignals drops the indicator events of a rebuild; they were sent
+// when the prices were live
+type discardSignals struct{}
+
+func (discardSignals) PublishSignal(events.SignalEvent) {}
+
+// ----------------- Projection -----------------
+
+// projection is the AnalyticsRepo a rebuild computes into. It keeps the rows
+// in memory and drops the ones dated before `from`, which the rebuild keeps
+// from the live tables instead.
+type projection struct {
+	from    time.Time
+	daily   map[dailyKey]*models.DailyAnalytics
+	signals []models.StockAnalytics
+}
+
+type dailyKey struct {
+	symbol string
+	date   time.Time
+}
+
+func newProjection(from time.Time) *projection {
+	return &projection{from: from, daily: map[dailyKey]*models.DailyAnalytics{}}
+}
+
+func (p *projection) FindDaily(symbol string, date time.Time) (*models.DailyAnalytics, error) {
+	row, ok := p.daily[dailyKey{symbol, date}]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	copied := *row
+	return &copied, nil
+}
+
+func (p *projection) SaveDaily(analytics *models.DailyAnalytics) error {
+	if analytics.Date.Before(p.from) {
+		return nil
+	}
+	copied := *analytics
+	p.daily[dailyKey{analytics.Symbol, analytics.Date}] = &copied
+	return nil
+}
+
+func (p *projection) SaveSignal(signal *models.StockAnalytics) error {
+	if !signal.GeneratedAt.Before(p.from) {
+		p.signals = append(p.signals, *signal)
+	}
+	return nil
+}
+
+func (p *projection) ListSignals(symbols []string, from, to time.Time) ([]models.StockAnalytics, error) {
+	wanted := map[string]bool{}
+	for _, symbol := range symbols {
+		wanted[symbol] = true
+	}
+	signals := []models.StockAnalytics{}
+	for _, signal := range p.signals {
+		if wanted[signal.Symbol] && !signal.GeneratedAt.Before(from) && signal.GeneratedAt.Before(to) {
+			signals = append(signals, signal)
+		}
+	}
+	sort.SliceStable(signals, func(i, j int) bool { return signals[i].GeneratedAt.Before(signals[j].GeneratedAt) })
+	return signals, nil
+}
+
+// rows returns the daily rows by date and symbol, and the signal changes by time
+func (p *projection) rows() ([]models.DailyAnalytics, []models.StockAnalytics) {
+	daily := make([]models.DailyAnalytics, 0, len(p.daily))
+	for _, row := range p.daily {
+		daily = append(daily, *row)
+	}
+	sort.Slice(daily, func(i, j int) bool {
+		if !daily[i].Date.Equal(daily[j].Date) {
+			return daily[i].Date.Before(daily[j].Date)
+		}
+		return daily[i].Symbol < daily[j].Symbol
+	})
+	signals := append([]models.StockAnalytics{}, p.signals...)
+	sort.SliceStable(signals, func(i, j int) bool { return signals[i].GeneratedAt.Before(signals[j].GeneratedAt) })
+	return daily, signals
+}
+
+// ----------------- Progress -----------------
+
+// progress logs how far a rebuild got, at most once per interval. Sources
+// count in their own units: days of history or Kafka messages.
+type progress struct {
+	unit     string
+	total    int64
+	done     int64
+	prices   int64
+	interval time.Duration
+	logged   time.Time
+}
+
+func (p *progress) advance(units, prices int64) {
+	p.done += units
+	p.prices += prices
+	if time.Since(p.logged) >= p.interval {
+		p.report()
+	}
+}
+
+func (p *progress) report() {
+	p.logged = time.Now()
+	percent := int64(100)
+	if p.total > 0 {
+		percent = min(100, p.done*100/p.total)
+	}
+	log.Printf("🔄 Rebuild %d%%: %d of %d %s, %d prices\n", percent, p.done, p.total, p.unit, p.prices)
+}
+
+// ----------------- Sources -----------------
+
+// historySource replays the ticks stored by the persistence consumer up to
+// `to`, a day at a time. Prices replayed by the backfill command are not
+// stored there, so a rebuild from history leaves them out.
+type historySource struct {
+	prices repository.PriceRepo
+	to     time.Time
+}
+
+func (h historySource) Oldest() (time.Time, error) {
+	return h.prices.Oldest()
+}
+
+func (h historySource) Replay(from time.Time, handle func(StockEvent), p *progress) error {
+	oldest, err := h.prices.Oldest()
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	start := from.UTC().Truncate(24 * time.Hour)
+	if oldest.After(start) {
+		start = oldest.UTC().Truncate(24 * time.Hour)
+	}
+	p.unit = "days"
+	p.total = int64((h.to.Sub(start) + 24*time.Hour - 1) / (24 * time.Hour))
+
+	for day := start; day.Before(h.to); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1)
+		if end.After(h.to) {
+			end = h.to
+		}
+		records, err := h.prices.ListBetween(day, end)
+		if err != nil {
+			return fmt.Errorf("failed to read the prices of %s: %w", day.Format("2006-01-02"), err)
+		}
+		for _, record := range records {
+			handle(StockEvent{Symbol: record.Symbol, Price: record.Price, Time: record.Timestamp})
+		}
+		p.advance(1, int64(len(records)))
+	}
+	return nil
+}
+
+// partitionRange is the span of a partition's offsets, [First, Last)
+type partitionRange struct {
+	Partition   int
+	First, Last int64
+}
+
+// kafkaSource replays the prices topic from the oldest message each partition
+// still holds up to the offsets it had when the rebuild started. The fetcher
+// keys prices by symbol, but older messages were spread over the partitions,
+// so the partitions are read side by side and merged by event time.
+type kafkaSource struct {
+	broker     string
+	topic      string
+	partitions []partitionRange
+}
+
+// open returns a reader positioned at the first message of a partition
+func (k *kafkaSource) open(part partitionRange) (*kafka.Reader, error) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{k.broker},
+		Topic:     k.topic,
+		Partition: part.Partition,
+		MinBytes:  10e3, // 10KB
+		MaxBytes:  10e6, // 10MB
+	})
+	if err := r.SetOffset(part.First); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// cursors opens a cursor on every partition that holds messages
+func (k *kafkaSource) cursors() ([]*cursor, func(), error) {
+	cursors, readers := []*cursor{}, []*kafka.Reader{}
+	closeAll := func() {
+		for _, r := range readers {
+			r.Close()
+		}
+	}
+	for _, part := range k.partitions {
+		if part.First >= part.Last {
+			continue
+		}
+		r, err := k.open(part)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("failed to read partition %d: %w", part.Partition, err)
+		}
+		readers = append(readers, r)
+		cursors = append(cursors, &cursor{r: r, next: part.First, last: part.Last})
+	}
+	return cursors, closeAll, nil
+}
+
+func (k *kafkaSource) Oldest() (time.Time, error) {
+	cursors, closeAll, err := k.cursors()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer closeAll()
+	var oldest time.Time
+	for _, c := range cursors {
+		if err := c.advance(&progress{interval: time.Hour}); err != nil {
+			return time.Time{}, err
+		}
+		if c.head != nil && (oldest.IsZero() || c.head.Time.Before(oldest)) {
+			oldest = c.head.Time
+		}
+	}
+	if oldest.IsZero() {
+		return time.Time{}, repository.ErrNotFound
+	}
+	return oldest, nil
+}
+
+func (k *kafkaSource) Replay(_ time.Time, handle func(StockEvent), p *progress) error {
+	p.unit = "messages"
+	for _, part := range k.partitions {
+		p.total += part.Last - part.First
+	}
+	cursors, closeAll, err := k.cursors()
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+	return merge(cursors, handle, p)
+}
+
+// cursor reads one partition up to an offset, holding its next price
+type cursor struct {
+	r interface {
+		ReadMessage(context.Context) (kafka.Message, error)
+	}
+	next int64       // offset of the next message to read
+	last int64       // offset to stop at
+	head *StockEvent // the next price, nil once the partition is done
+}
+
+// advance reads the partition's next price into head. Messages that are not
+// prices are logged, counted and skipped.
+func (c *cursor) advance(p *progress) error {
+	c.head = nil
+	for c.next < c.last {
+		m, err := c.r.ReadMessage(context.Background())
+		if err != nil {
+			return err
+		}
+		c.next = m.Offset + 1
+		var event StockEvent
+		if err := json.Unmarshal(m.Value, &event); err != nil {
+			log.Println("❌ JSON parse error:", err)
+			p.advance(1, 0)
+			continue
+		}
+		c.head = &event
+		return nil
+	}
+	return nil
+}
+
+// merge passes the prices of the cursors to handle oldest first; prices of
+// the same time go in partition order
+func merge(cursors []*cursor, handle func(StockEvent), p *progress) error {
+	for _, c := range cursors {
+		if err := c.advance(p); err != nil {
+			return err
+		}
+	}
+	for {
+		var oldest *cursor
+		for _, c := range cursors {
+			if c.head != nil && (oldest == nil || c.head.Time.Before(oldest.head.Time)) {
+				oldest = c
+			}
+		}
+		if oldest == nil {
+			return nil
+		}
+		handle(*oldest.head)
+		p.advance(1, 1)
+		if err := oldest.advance(p); err != nil {
+			return err
+		}
+	}
+}
+
+// ----------------- Offsets -----------------
+
+// topicOffsets lists the first and last offsets of every partition of a topic
+func topicOffsets(client *kafka.Client, topic string) ([]partitionRange, error) {
+	ctx := context.Background()
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata.Topics) != 1 || metadata.Topics[0].Error != nil {
+		return nil, fmt.Errorf("topic %s not found", topic)
+	}
+	requests := []kafka.OffsetRequest{}
+	for _, partition := range metadata.Topics[0].Partitions {
+		requests = append(requests, kafka.FirstOffsetOf(partition.ID), kafka.LastOffsetOf(partition.ID))
+	}
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return nil, err
+	}
+	ranges := []partitionRange{}
+	for _, partition := range offsets.Topics[topic] {
+		if partition.Error != nil {
+			return nil, fmt.Errorf("partition %d: %w", partition.Partition, partition.Error)
+		}
+		ranges = append(ranges, partitionRange{Partition: partition.Partition, First: partition.FirstOffset, Last: partition.LastOffset})
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Partition < ranges[j].Partition })
+	return ranges, nil
+}
+
+// commitOffsets moves a consumer group to the end of each range. Kafka only
+// accepts this while none of the group's consumers is running.
+func commitOffsets(client *kafka.Client, group, topic string, ranges []partitionRange) error {
+	commits := []kafka.OffsetCommit{}
+	for _, part := range ranges {
+		commits = append(commits, kafka.OffsetCommit{Partition: part.Partition, Offset: part.Last})
+	}
+	resp, err := client.OffsetCommit(context.Background(), &kafka.OffsetCommitRequest{
+		GroupID:      group,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return err
+	}
+	for _, partition := range resp.Topics[topic] {
+		if partition.Error != nil {
+			return fmt.Errorf("partition %d: %w", partition.Partition, partition.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/shopspring/decimal"
+)
+
+// Test that a rebuild from history recomputes the days the ticks cover and
+// keeps the older ones
+func TestRebuildFromHistory(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	// Rows computed with older math; the ticks of the 10th were dropped by retention
+	for d := 10; d <= 12; d++ {
+		repos.Analytics.SaveDaily(&models.DailyAnalytics{Symbol: "AAPL", Date: day(d), AvgPrice: decimal.NewFromInt(1), PriceChanges: 1})
+	}
+	repos.Analytics.SaveSignal(&models.StockAnalytics{Symbol: "AAPL", Signal: models.SignalBearish, GeneratedAt: day(11).Add(15 * time.Hour)})
+
+	ticks := []models.StockPriceRecord{}
+	for i := 0; i < 25; i++ {
+		ticks = append(ticks, models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(int64(100 + i)),
+			Timestamp: day(11).Add(14*time.Hour + time.Duration(i)*time.Minute)})
+	}
+	ticks = append(ticks, models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(130), Timestamp: day(12).Add(15 * time.Hour)})
+	repos.Prices.CreateBatch(ticks)
+
+	r := &rebuilder{source: historySource{prices: repos.Prices, to: day(13)}, shadow: repos.AnalyticsShadow}
+	if err := r.run(); err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+
+	if kept, _ := repos.Analytics.FindDaily("AAPL", day(10)); kept == nil || !kept.AvgPrice.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("Expected the day without ticks to be kept, got %+v", kept)
+	}
+	rebuilt, err := repos.Analytics.FindDaily("AAPL", day(11))
+	if err != nil || rebuilt.PriceChanges != 25 || !rebuilt.AvgPrice.Equal(decimal.NewFromInt(112)) || !rebuilt.MaxPrice.Equal(decimal.NewFromInt(124)) {
+		t.Errorf("Expected the 11th recomputed from its 25 ticks, got %+v (%v)", rebuilt, err)
+	}
+	if rebuilt, _ := repos.Analytics.FindDaily("AAPL", day(12)); rebuilt == nil || rebuilt.PriceChanges != 1 || !rebuilt.AvgPrice.Equal(decimal.NewFromInt(130)) {
+		t.Errorf("Expected the 12th recomputed from its tick, got %+v", rebuilt)
+	}
+
+	signals, _ := repos.Analytics.ListSignals([]string{"AAPL"}, day(1), day(31))
+	if len(signals) != 1 || signals[0].Signal != models.SignalBullish || !signals[0].GeneratedAt.Equal(ticks[19].Timestamp) {
+		t.Errorf("Expected the stale signal replaced by the rebuilt one, got %+v", signals)
+	}
+}
+
+// Test that an explicit start keeps the days before it, while the day before
+// still warms up the indicators
+func TestRebuildFromDate(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	repos.Analytics.SaveDaily(&models.DailyAnalytics{Symbol: "AAPL", Date: day(11), AvgPrice: decimal.NewFromInt(1), PriceChanges: 1})
+
+	ticks := []models.StockPriceRecord{}
+	for i := 0; i < 20; i++ {
+		ticks = append(ticks, models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(100), Timestamp: day(11).Add(14*time.Hour + time.Duration(i)*time.Minute)})
+	}
+	ticks = append(ticks, models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(200), Timestamp: day(12).Add(15 * time.Hour)})
+	repos.Prices.CreateBatch(ticks)
+
+	r := &rebuilder{source: historySource{prices: repos.Prices, to: day(13)}, shadow: repos.AnalyticsShadow, from: day(12)}
+	if err := r.run(); err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	if kept, _ := repos.Analytics.FindDaily("AAPL", day(11)); kept == nil || kept.PriceChanges != 1 {
+		t.Errorf("Expected the 11th to be kept, got %+v", kept)
+	}
+	signals, _ := repos.Analytics.ListSignals([]string{"AAPL"}, day(1), day(31))
+	if len(signals) != 1 || signals[0].Signal != models.SignalBullish || !signals[0].GeneratedAt.Equal(day(12).Add(15*time.Hour)) {
+		t.Errorf("Expected only the change on the 12th, got %+v", signals)
+	}
+
+	empty := &rebuilder{source: historySource{prices: repository.NewMemoryRepositories().Prices, to: day(13)}, shadow: repos.AnalyticsShadow}
+	if err := empty.run(); err == nil || !strings.Contains(err.Error(), "no prices") {
+		t.Errorf("Expected an error without prices, got %v", err)
+	}
+}
+
+// fakePartition serves a partition's messages from memory
+type fakePartition struct {
+	messages []kafka.Message
+}
+
+func (f *fakePartition) ReadMessage(context.Context) (kafka.Message, error) {
+	m := f.messages[0]
+	f.messages = f.messages[1:]
+	return m, nil
+}
+
+// Test that prices of one symbol spread over partitions are replayed in time
+// order, up to each partition's last offset
+func TestMergePartitionsByTime(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2025, 3, 11, 14, minute, 0, 0, time.UTC) }
+	partition := func(values ...string) *fakePartition {
+		f := &fakePartition{}
+		for i, value := range values {
+			f.messages = append(f.messages, kafka.Message{Offset: int64(i), Value: []byte(value)})
+		}
+		return f
+	}
+	price := func(minute int) string {
+		data, _ := json.Marshal(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(int64(minute)), Time: at(minute)})
+		return string(data)
+	}
+	cursors := []*cursor{
+		{r: partition(price(1), price(4), price(5)), last: 3},
+		{r: partition(price(2), "not json", price(3), price(9)), last: 3}, // 9 arrived after the rebuild began
+	}
+
+	var minutes []int
+	p := &progress{interval: time.Hour}
+	err := merge(cursors, func(e StockEvent) { minutes = append(minutes, e.Time.Minute()) }, p)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if fmt.Sprint(minutes) != "[1 2 3 4 5]" {
+		t.Errorf("Expected the prices in time order, got %v", minutes)
+	}
+	if p.done != 6 || p.prices != 5 {
+		t.Errorf("Expected 6 messages and 5 prices counted, got %d and %d", p.done, p.prices)
+	}
+}
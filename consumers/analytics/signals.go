@@ -0,0 +1,191 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"stock-alerts/events"
+	"stock-alerts/indicators"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/shopspring/decimal"
+)
+
+// Indicator settings
+const (
+	shortAverage   = 5
+	longAverage    = 20
+	rsiPeriod      = 14
+	rsiOverbought  = 70
+	rsiOversold    = 30
+	bollingerWidth = 2 // standard deviations either side of the long average
+
+	// neutralBand is how close, relative to Avg20, the averages must be for
+	// the signal to be NEUTRAL
+	neutralBand = 0.001
+)
+
+// signalPublisher sends indicator events to the alert consumer
+type signalPublisher interface {
+	PublishSignal(event events.SignalEvent)
+}
+
+// symbolSignals is the indicator state of one symbol
+type symbolSignals struct {
+	prices *indicators.Window
+	exact  []decimal.Decimal // the last longAverage prices, for the stored averages
+	primed bool
+	signal string
+	cross  int // sign of Avg5 - Avg20
+	rsi    int // 1 overbought, -1 oversold, 0 in between
+	band   int // 1 above the upper band, -1 below the lower one, 0 inside
+	last   time.Time
+}
+
+// signalTracker computes indicators over the last prices of each symbol and
+// publishes an event when one of them changes state. Indicators need
+// longAverage ticks of a symbol before the first state is recorded, and that
+// first state publishes nothing, so a restart does not repeat events.
+// Replayed history feeds the indicators and the stored signals but publishes
+// nothing, and is skipped once newer prices of the symbol were seen.
+type signalTracker struct {
+	analytics repository.AnalyticsRepo
+	publisher signalPublisher
+	symbols   map[string]*symbolSignals
+	quiet     bool // no log line per signal change, for rebuilds
+}
+
+func newSignalTracker(analytics repository.AnalyticsRepo, publisher signalPublisher) *signalTracker {
+	return &signalTracker{analytics: analytics, publisher: publisher, symbols: map[string]*symbolSignals{}}
+}
+
+// exactAverage is the average of the last n prices in decimal, which the
+// indicators compute in float64 for the signals themselves
+func exactAverage(prices []decimal.Decimal, n int) decimal.Decimal {
+	sum := decimal.Zero
+	for _, price := range prices[len(prices)-n:] {
+		sum = sum.Add(price)
+	}
+	return averageOf(sum, n)
+}
+
+// sign returns the side of zero x is on, keeping the previous side at zero
+func sign(x float64, previous int) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return previous
+}
+
+func (t *signalTracker) handle(e StockEvent) {
+	st, ok := t.symbols[e.Symbol]
+	if !ok {
+		st = &symbolSignals{prices: indicators.NewWindow(longAverage + 1)}
+		t.symbols[e.Symbol] = st
+	}
+	if e.Replay && !e.Time.After(st.last) {
+		return
+	}
+	if e.Time.After(st.last) {
+		st.last = e.Time
+	}
+	live := !e.Replay
+	st.prices.Push(e.Price.InexactFloat64())
+	prices := st.prices.Prices()
+	st.exact = append(st.exact, e.Price)
+	if len(st.exact) > longAverage {
+		st.exact = st.exact[1:]
+	}
+
+	avg5, _ := indicators.SMA(prices, shortAverage)
+	avg20, ok := indicators.SMA(prices, longAverage)
+	if !ok {
+		return
+	}
+	rsi, _ := indicators.RSI(prices, rsiPeriod)
+	band, _ := indicators.Bollinger(prices, longAverage, bollingerWidth)
+
+	diff := avg5 - avg20
+	signal := models.SignalNeutral
+	if math.Abs(diff) > avg20*neutralBand {
+		signal = models.SignalBearish
+		if diff > 0 {
+			signal = models.SignalBullish
+		}
+	}
+	cross := sign(diff, st.cross)
+	rsiZone := 0
+	if rsi >= rsiOverbought {
+		rsiZone = 1
+	} else if rsi <= rsiOversold {
+		rsiZone = -1
+	}
+	bandZone := 0
+	if price := e.Price.InexactFloat64(); price > band.Upper {
+		bandZone = 1
+	} else if price < band.Lower {
+		bandZone = -1
+	}
+
+	publish := func(signalType models.SignalType, value float64) {
+		t.publisher.PublishSignal(events.SignalEvent{
+			Symbol: e.Symbol,
+			Type:   string(signalType),
+			Price:  e.Price,
+			Value:  value,
+			Time:   e.Time,
+		})
+	}
+
+	if signal != st.signal {
+		stored := models.StockAnalytics{
+			Symbol:      e.Symbol,
+			Avg5:        exactAverage(st.exact, shortAverage),
+			Avg20:       exactAverage(st.exact, longAverage),
+			Signal:      signal,
+			GeneratedAt: e.Time,
+		}
+		if err := t.analytics.SaveSignal(&stored); err != nil {
+			log.Printf("❌ Failed to store signal for %s: %v\n", e.Symbol, err)
+		}
+		if st.primed && live {
+			t.publisher.PublishSignal(events.SignalEvent{
+				Symbol: e.Symbol,
+				Type:   string(models.SignalChange),
+				From:   st.signal,
+				To:     signal,
+				Price:  e.Price,
+				Value:  avg5,
+				Time:   e.Time,
+			})
+			if !t.quiet {
+				log.Printf("📈 %s signal %s → %s\n", e.Symbol, st.signal, signal)
+			}
+		}
+	}
+	if st.primed && live {
+		if cross == 1 && st.cross == -1 {
+			publish(models.SignalGoldenCross, avg5)
+		} else if cross == -1 && st.cross == 1 {
+			publish(models.SignalDeathCross, avg5)
+		}
+		if rsiZone != st.rsi && rsiZone == 1 {
+			publish(models.SignalRSIOverbought, rsi)
+		} else if rsiZone != st.rsi && rsiZone == -1 {
+			publish(models.SignalRSIOversold, rsi)
+		}
+		if bandZone != st.band && bandZone == 1 {
+			publish(models.SignalBollingerUpper, band.Upper)
+		} else if bandZone != st.band && bandZone == -1 {
+			publish(models.SignalBollingerLower, band.Lower)
+		}
+	}
+
+	st.primed = true
+	st.signal, st.cross, st.rsi, st.band = signal, cross, rsiZone, bandZone
+}
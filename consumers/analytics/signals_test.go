@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"stock-alerts/events"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/shopspring/decimal"
+)
+
+// recordingPublisher keeps the events the tracker publishes
+type recordingPublisher struct {
+	events []events.SignalEvent
+}
+
+func (p *recordingPublisher) PublishSignal(event events.SignalEvent) {
+	p.events = append(p.events, event)
+}
+
+func (p *recordingPublisher) types() map[string]int {
+	types := map[string]int{}
+	for _, e := range p.events {
+		types[e.Type]++
+	}
+	return types
+}
+
+func TestSignalTracker(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	publisher := &recordingPublisher{}
+	tracker := newSignalTracker(repos.Analytics, publisher)
+	now := time.Now()
+
+	// A falling series primes the tracker without publishing anything
+	for i := 0; i < longAverage; i++ {
+		tracker.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromFloat(120 - float64(i)), Time: now})
+	}
+	if len(publisher.events) != 0 {
+		t.Fatalf("Expected the first state to publish nothing, got %+v", publisher.events)
+	}
+	if st := tracker.symbols["AAPL"]; st.signal != models.SignalBearish || st.rsi != -1 {
+		t.Errorf("Expected a bearish, oversold state, got %+v", st)
+	}
+
+	// A sharp rally turns every indicator around
+	for i := 1; i <= 10; i++ {
+		tracker.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromFloat(101 + 3*float64(i)), Time: now})
+	}
+	types := publisher.types()
+	for _, expected := range []models.SignalType{models.SignalChange, models.SignalGoldenCross, models.SignalRSIOverbought, models.SignalBollingerUpper} {
+		if types[string(expected)] == 0 {
+			t.Errorf("Expected a %s event, got %v", expected, types)
+		}
+	}
+	if types[string(models.SignalGoldenCross)] != 1 || types[string(models.SignalDeathCross)] != 0 {
+		t.Errorf("Expected exactly one golden cross, got %v", types)
+	}
+
+	last := models.SignalBearish
+	for _, e := range publisher.events {
+		if e.Type != string(models.SignalChange) {
+			continue
+		}
+		if e.From != last {
+			t.Errorf("Expected a transition from %s, got %+v", last, e)
+		}
+		last = e.To
+	}
+	if last != models.SignalBullish {
+		t.Errorf("Expected the signal to end BULLISH, got %s", last)
+	}
+}
+
+// Test that replayed history primes the indicators and stores signal changes
+// without publishing events the alert consumer would turn into alerts
+func TestReplayPublishesNothing(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	publisher := &recordingPublisher{}
+	tracker := newSignalTracker(repos.Analytics, publisher)
+	start := time.Date(2025, 3, 3, 15, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2*longAverage; i++ {
+		price := 120 - float64(i)
+		if i >= longAverage {
+			price = 100 + 3*float64(i-longAverage)
+		}
+		tracker.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromFloat(price), Time: start.Add(time.Duration(i) * time.Minute), Replay: true})
+	}
+	if len(publisher.events) != 0 {
+		t.Errorf("Expected no events from replayed prices, got %+v", publisher.events)
+	}
+	signals, _ := repos.Analytics.ListSignals([]string{"AAPL"}, start, start.Add(time.Hour))
+	if len(signals) < 2 || signals[0].Signal != models.SignalBearish || signals[len(signals)-1].Signal != models.SignalBullish {
+		t.Errorf("Expected the replayed signal changes to be stored, got %+v", signals)
+	}
+
+	// History older than what the indicators have seen is left out
+	tracker.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(1), Time: start, Replay: true})
+	if exact := tracker.symbols["AAPL"].exact; !exact[len(exact)-1].Equal(decimal.NewFromInt(157)) {
+		t.Errorf("Expected an out of order replayed price to be skipped, got %v", exact[len(exact)-1])
+	}
+}
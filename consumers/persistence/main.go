@@ -3,34 +3,25 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"stock-alerts/db"
+	"stock-alerts/events"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+	"stock-alerts/timeseries"
 
 	"github.com/joho/godotenv"
 	"github.com/segmentio/kafka-go"
 )
 
-// StockPriceRecord represents the stock price data to be persisted
-type StockPriceRecord struct {
-	ID        uint   `gorm:"primaryKey"`
-	Symbol    string `gorm:"size:10;index"`
-	Price     float64
-	Timestamp time.Time
-}
-
-type StockEvent struct {
-	Symbol string    `json:"symbol"`
-	Price  float64   `json:"price"`
-	Time   time.Time `json:"time"`
-}
-
-// TableName overrides the default table name
-func (StockPriceRecord) TableName() string {
-	return "stock_price_records"
-}
+type StockEvent = events.StockPrice
 
 func main() {
 	// Load environment variables from .env file
@@ -40,13 +31,17 @@ func main() {
 	}
 
 	// Connect DB
-	db.ConnectDatabase()
-
-	// Ensure the table exists
-	if err := db.DB.AutoMigrate(&StockPriceRecord{}); err != nil {
-		log.Printf("⚠️  AutoMigrate stock_price_records table failed: %v\n", err)
+	database, err := db.ConnectDatabase()
+	if err != nil {
+		log.Fatal("❌ ", err)
 	}
 
+	repos := repository.NewGormRepositories(database)
+	persister := newPersister(repos.Prices, batchConfigFromEnv())
+
+	// Keep partitions, rollups and retention of the price history up to date
+	timeseries.NewMaintainer(repos.Prices, repos.Bars, timeseries.ConfigFromEnv()).Start(time.Minute)
+
 	log.Println("💾 Persistence Consumer starting...")
 
 	// Get Kafka broker from environment variable
@@ -66,30 +61,161 @@ func main() {
 
 	defer r.Close()
 
-	for {
-		m, err := r.ReadMessage(context.Background())
-		if err != nil {
-			log.Println("❌ Kafka read error:", err)
-			continue
+	// Stop on SIGINT or SIGTERM, storing the buffered prices first
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	persister.run(ctx, r)
+	log.Println("👋 Persistence Consumer stopped")
+}
+
+// batchConfig controls when buffered events are written
+type batchConfig struct {
+	Size     int           // flush once this many events are buffered
+	Interval time.Duration // flush at least this often while events are buffered
+}
+
+// batchConfigFromEnv reads PERSIST_BATCH_SIZE and PERSIST_FLUSH_INTERVAL (a Go duration)
+func batchConfigFromEnv() batchConfig {
+	cfg := batchConfig{Size: 500, Interval: time.Second}
+	if v := os.Getenv("PERSIST_BATCH_SIZE"); v != "" {
+		if size, err := strconv.Atoi(v); err == nil && size > 0 {
+			cfg.Size = size
+		} else {
+			log.Printf("⚠️  Ignoring invalid PERSIST_BATCH_SIZE %q\n", v)
+		}
+	}
+	if v := os.Getenv("PERSIST_FLUSH_INTERVAL"); v != "" {
+		if interval, err := time.ParseDuration(v); err == nil && interval > 0 {
+			cfg.Interval = interval
+		} else {
+			log.Printf("⚠️  Ignoring invalid PERSIST_FLUSH_INTERVAL %q\n", v)
 		}
+	}
+	return cfg
+}
+
+// messageReader is the part of *kafka.Reader the persister uses
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// persister buffers price events and writes them to the price history in
+// multi-row inserts. Kafka offsets are committed only after the rows that
+// carried them are stored, so a crash replays the batch instead of losing it.
+type persister struct {
+	prices repository.PriceRepo
+	cfg    batchConfig
+
+	records  []models.StockPriceRecord
+	messages []kafka.Message // every fetched message, including unparseable ones
+	deadline time.Time       // when the current batch must be flushed
+}
+
+func newPersister(prices repository.PriceRepo, cfg batchConfig) *persister {
+	return &persister{prices: prices, cfg: cfg}
+}
+
+// How long the last batch may take to store on shutdown
+const shutdownGrace = 10 * time.Second
 
-		var event StockEvent
-		if err := json.Unmarshal(m.Value, &event); err != nil {
-			log.Println("❌ JSON parse error:", err)
-			continue
+// run consumes until the context is cancelled and then stores the buffered
+// prices. Read errors are retried with backoff, flushing the pending batch
+// when it is due meanwhile.
+func (p *persister) run(ctx context.Context, r messageReader) {
+	var backoff events.Backoff
+	for {
+		m, err := p.fetch(ctx, r)
+		switch {
+		case ctx.Err() != nil:
+		case err == nil:
+			p.add(m)
+			backoff.Reset()
+		case !errors.Is(err, context.DeadlineExceeded):
+			delay := backoff.Next()
+			log.Printf("❌ Kafka read error, retrying in %s: %v\n", delay, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+		}
+		if ctx.Err() != nil {
+			break
 		}
 
-		// Create stock price record
-		rec := StockPriceRecord{
-			Symbol:    event.Symbol,
-			Price:     event.Price,
-			Timestamp: event.Time,
+		if len(p.messages) >= p.cfg.Size || (len(p.messages) > 0 && !time.Now().Before(p.deadline)) {
+			p.flush(ctx, r)
 		}
+	}
+
+	if len(p.messages) > 0 {
+		// ctx has ended, so the last batch gets a context of its own
+		final, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+		defer cancel()
+		p.flush(final, r)
+	}
+}
+
+// fetch waits for the next message, but no longer than the pending batch may wait
+func (p *persister) fetch(ctx context.Context, r messageReader) (kafka.Message, error) {
+	if len(p.messages) == 0 {
+		return r.FetchMessage(ctx)
+	}
+	ctx, cancel := context.WithDeadline(ctx, p.deadline)
+	defer cancel()
+	return r.FetchMessage(ctx)
+}
+
+// add buffers a message and its price record
+func (p *persister) add(m kafka.Message) {
+	if len(p.messages) == 0 {
+		p.deadline = time.Now().Add(p.cfg.Interval)
+	}
+	p.messages = append(p.messages, m)
+
+	var event StockEvent
+	if err := json.Unmarshal(m.Value, &event); err != nil {
+		log.Println("❌ JSON parse error:", err)
+		return
+	}
+	if event.Replay {
+		return // the backfill command stored it already
+	}
+
+	// Create stock price record
+	p.records = append(p.records, models.StockPriceRecord{
+		Symbol:    event.Symbol,
+		Price:     event.Price,
+		Timestamp: event.Time,
+	})
+}
 
-		if res := db.DB.Create(&rec); res.Error != nil {
-			log.Printf("❌ Failed to store price for %s: %v\n", rec.Symbol, res.Error)
-			continue
+// flush writes the buffered records in one transaction and then commits the
+// offsets. Failed writes are retried with backoff until they succeed or the
+// context ends, because skipping them would lose data.
+func (p *persister) flush(ctx context.Context, r messageReader) {
+	var backoff events.Backoff
+	for {
+		err := p.prices.CreateBatch(p.records)
+		if err == nil {
+			break
+		}
+		delay := backoff.Next()
+		log.Printf("❌ Failed to store batch of %d prices, retrying in %s: %v\n", len(p.records), delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
 		}
-		log.Printf("✅ Stored stock price: %s -> %.2f at %s\n", rec.Symbol, rec.Price, rec.Timestamp.Format(time.RFC3339))
 	}
+
+	if err := r.CommitMessages(ctx, p.messages...); err != nil {
+		// The rows are stored; a redelivered batch duplicates them, which the
+		// rollups tolerate better than lost ticks
+		log.Println("❌ Kafka commit failed:", err)
+	}
+	log.Printf("✅ Stored batch of %d stock prices\n", len(p.records))
+
+	p.records = p.records[:0]
+	p.messages = p.messages[:0]
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/shopspring/decimal"
+)
+
+// fakeReader hands out queued messages, then fails with err when set, and
+// otherwise blocks until the context ends
+type fakeReader struct {
+	queue     []kafka.Message
+	committed []kafka.Message
+	onCommit  func()
+	err       error
+	fetches   int
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.fetches++
+	if len(r.queue) == 0 && r.err != nil {
+		return kafka.Message{}, r.err
+	}
+	if len(r.queue) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	m := r.queue[0]
+	r.queue = r.queue[1:]
+	return m, nil
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.committed = append(r.committed, msgs...)
+	if r.onCommit != nil {
+		r.onCommit()
+	}
+	return nil
+}
+
+// failingPrices fails the first CreateBatch calls before delegating
+type failingPrices struct {
+	repository.PriceRepo
+	failures int
+	calls    int
+}
+
+func (p *failingPrices) CreateBatch(records []models.StockPriceRecord) error {
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("database unavailable")
+	}
+	return p.PriceRepo.CreateBatch(records)
+}
+
+func message(offset int64, symbol string, price float64) kafka.Message {
+	data, _ := json.Marshal(StockEvent{Symbol: symbol, Price: decimal.NewFromFloat(price), Time: time.Now()})
+	return kafka.Message{Offset: offset, Value: data}
+}
+
+func TestPersisterFlushesOnSize(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	reader := &fakeReader{queue: []kafka.Message{
+		message(1, "AAPL", 100),
+		{Offset: 2, Value: []byte("not json")},
+		message(3, "TSLA", 200),
+		message(4, "AAPL", 101),
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader.onCommit = cancel
+	p := newPersister(repos.Prices, batchConfig{Size: 3, Interval: time.Hour})
+	p.run(ctx, reader)
+
+	records, _ := repos.Prices.ListBetween(time.Time{}, time.Now().Add(time.Hour))
+	if len(records) != 2 {
+		t.Errorf("Expected 2 stored prices in the first batch, got %d", len(records))
+	}
+	// The unparseable message is committed with the batch so it is not redelivered forever
+	if len(reader.committed) != 3 {
+		t.Errorf("Expected 3 committed offsets, got %d", len(reader.committed))
+	}
+}
+
+func TestPersisterFlushesOnInterval(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	reader := &fakeReader{queue: []kafka.Message{message(1, "AAPL", 100)}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reader.onCommit = cancel
+	p := newPersister(repos.Prices, batchConfig{Size: 100, Interval: 10 * time.Millisecond})
+	p.run(ctx, reader)
+
+	if len(reader.committed) != 1 {
+		t.Fatalf("Expected the partial batch to be flushed on the interval, got %d commits", len(reader.committed))
+	}
+}
+
+func TestPersisterCommitsOnlyAfterStore(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	prices := &failingPrices{PriceRepo: repos.Prices, failures: 2}
+	reader := &fakeReader{queue: []kafka.Message{message(1, "AAPL", 100)}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reader.onCommit = func() {
+		if prices.calls != 3 {
+			t.Errorf("Expected commit after the third attempt, got it after %d", prices.calls)
+		}
+		cancel()
+	}
+	p := newPersister(prices, batchConfig{Size: 1, Interval: time.Hour})
+	p.run(ctx, reader)
+
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected 1 committed offset, got %d", len(reader.committed))
+	}
+}
+
+func TestPersisterSkipsReplayedPrices(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	replayed, _ := json.Marshal(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(90), Time: time.Now(), Replay: true})
+	reader := &fakeReader{queue: []kafka.Message{message(1, "AAPL", 100), {Offset: 2, Value: replayed}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader.onCommit = cancel
+	p := newPersister(repos.Prices, batchConfig{Size: 2, Interval: time.Hour})
+	p.run(ctx, reader)
+
+	records, _ := repos.Prices.ListBetween(time.Time{}, time.Now().Add(time.Hour))
+	if len(records) != 1 || len(reader.committed) != 2 {
+		t.Errorf("Expected only the live price stored and both committed, got %+v and %d commits", records, len(reader.committed))
+	}
+}
+
+// Test that read errors are retried with backoff while the pending batch is
+// still flushed when due
+func TestPersisterBacksOffOnReadErrors(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	reader := &fakeReader{queue: []kafka.Message{message(1, "AAPL", 100)}, err: errors.New("broker unavailable")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 350*time.Millisecond)
+	defer cancel()
+	p := newPersister(repos.Prices, batchConfig{Size: 100, Interval: 50 * time.Millisecond})
+	p.run(ctx, reader)
+
+	// One message, then retries after 100ms and 200ms
+	if reader.fetches > 4 {
+		t.Errorf("Expected the failing reads to back off, got %d fetches", reader.fetches)
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected the pending batch flushed between retries, got %d commits", len(reader.committed))
+	}
+}
+
+// Test that the buffered prices are stored and committed when the context ends
+func TestPersisterFlushesOnShutdown(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	reader := &fakeReader{queue: []kafka.Message{message(1, "AAPL", 100), message(2, "TSLA", 200)}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p := newPersister(repos.Prices, batchConfig{Size: 100, Interval: time.Hour})
+	p.run(ctx, reader)
+
+	records, _ := repos.Prices.ListBetween(time.Time{}, time.Now().Add(time.Hour))
+	if len(records) != 2 || len(reader.committed) != 2 {
+		t.Errorf("Expected the buffered prices stored and committed, got %d and %d commits", len(records), len(reader.committed))
+	}
+}
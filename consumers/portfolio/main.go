@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"stock-alerts/db"
+	"stock-alerts/events"
+	"stock-alerts/repository"
+
+	"github.com/joho/godotenv"
+	"github.com/segmentio/kafka-go"
+)
+
+type StockEvent = events.StockPrice
+
+func main() {
+	// Load environment variables from .env file
+	err := godotenv.Load("../../.env")
+	if err != nil {
+		log.Println("Warning: .env file not found, using system environment variables")
+	}
+
+	// Connect DB
+	database, err := db.ConnectDatabase()
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	m := newMonitor(repository.NewGormRepositories(database))
+	if err := m.resync(time.Now()); err != nil {
+		log.Fatal("❌ Failed to load portfolio alert rules: ", err)
+	}
+	go m.resyncEvery(resyncIntervalFromEnv())
+
+	log.Println("📊 Portfolio Alert Consumer starting...")
+
+	// Get Kafka broker from environment variable
+	broker := os.Getenv("KAFKA_BROKER")
+	if broker == "" {
+		broker = "127.0.0.1:9093" // fallback for local development
+	}
+	go m.followRuleChanges(broker)
+
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  []string{broker},
+		Topic:    events.TopicStockPrices,
+		GroupID:  "portfolio-alerts-consumer",
+		MinBytes: 10e3, // 10KB
+		MaxBytes: 10e6, // 10MB
+	})
+
+	defer r.Close()
+
+	var backoff events.Backoff
+	for {
+		msg, err := r.ReadMessage(context.Background())
+		if err != nil {
+			delay := backoff.Next()
+			log.Printf("❌ Kafka read error, retrying in %s: %v\n", delay, err)
+			time.Sleep(delay)
+			continue
+		}
+		backoff.Reset()
+
+		var event StockEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			log.Println("❌ JSON parse error:", err)
+			continue
+		}
+
+		m.handle(event)
+	}
+}
+
+// resyncIntervalFromEnv reads PORTFOLIO_RESYNC, defaulting to 1 minute
+func resyncIntervalFromEnv() time.Duration {
+	interval := time.Minute
+	if v := os.Getenv("PORTFOLIO_RESYNC"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Printf("⚠️  Ignoring invalid PORTFOLIO_RESYNC %q\n", v)
+		} else {
+			interval = d
+		}
+	}
+	return interval
+}
+
+// resyncEvery picks up new rules, portfolios and position changes at the given period
+func (m *monitor) resyncEvery(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := m.resync(time.Now()); err != nil {
+			log.Println("❌ Portfolio resync failed:", err)
+		}
+	}
+}
+
+// followRuleChanges resyncs when the API publishes a reload, so new portfolio
+// rules and holdings apply without waiting for the next period. Like the alert
+// consumer, every instance reads with its own group from the newest message.
+func (m *monitor) followRuleChanges(broker string) {
+	hostname, _ := os.Hostname()
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     []string{broker},
+		Topic:       events.TopicRuleChanges,
+		GroupID:     "portfolio-alerts-rules-" + hostname,
+		StartOffset: kafka.LastOffset,
+	})
+	defer r.Close()
+
+	var backoff events.Backoff
+	for {
+		msg, err := r.ReadMessage(context.Background())
+		if err != nil {
+			delay := backoff.Next()
+			log.Printf("❌ Kafka rule change read error, retrying in %s: %v\n", delay, err)
+			time.Sleep(delay)
+			continue
+		}
+		backoff.Reset()
+
+		var change events.RuleChange
+		if err := json.Unmarshal(msg.Value, &change); err != nil {
+			log.Println("❌ JSON parse error:", err)
+			continue
+		}
+		if change.Op != events.OpReload {
+			continue
+		}
+		if err := m.resync(time.Now()); err != nil {
+			log.Println("❌ Portfolio resync failed:", err)
+		} else {
+			log.Println("🔄 Portfolio rules reloaded")
+		}
+	}
+}
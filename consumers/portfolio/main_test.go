@@ -0,0 +1,183 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/shopspring/decimal"
+)
+
+// setupMonitor holds 10 AAPL and 10 MSFT, both last priced at 100
+func setupMonitor(t *testing.T, rules ...models.PortfolioAlertRule) (*monitor, repository.Repositories, time.Time) {
+	repos := repository.NewMemoryRepositories()
+	portfolio := models.Portfolio{UserID: 42, Name: "Trading"}
+	repos.Portfolios.Create(&portfolio)
+	repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "AAPL", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(90)})
+	repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "MSFT", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(90)})
+	for _, rule := range rules {
+		rule.PortfolioID = portfolio.ID
+		repos.PortfolioRules.Create(&rule)
+	}
+
+	now := time.Date(2025, 3, 4, 15, 0, 0, 0, time.UTC)
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(100), Timestamp: now.Add(-time.Minute)})
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "MSFT", Price: decimal.NewFromInt(100), Timestamp: now.Add(-time.Minute)})
+
+	m := newMonitor(repos)
+	if err := m.resync(now); err != nil {
+		t.Fatalf("resync failed: %v", err)
+	}
+	return m, repos, now
+}
+
+func alertsOf(repos repository.Repositories) []models.Alert {
+	alerts, _ := repos.Alerts.ListByUser(42)
+	return alerts
+}
+
+func TestValueRuleFiresOnCrossing(t *testing.T) {
+	m, repos, now := setupMonitor(t, models.PortfolioAlertRule{Type: models.RuleValueAbove, Threshold: decimal.NewFromInt(2100)})
+
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(105), Time: now}) // 2050, primes the rule
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(111), Time: now}) // 2110, crosses
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(112), Time: now}) // still above
+
+	alerts := alertsOf(repos)
+	if len(alerts) != 1 {
+		t.Fatalf("Expected 1 alert while above the level, got %d", len(alerts))
+	}
+	if alerts[0].Kind != models.AlertKind(models.RuleValueAbove) || !alerts[0].Price.Equal(decimal.NewFromInt(2110)) || alerts[0].PortfolioID == nil {
+		t.Errorf("Unexpected alert: %+v", alerts[0])
+	}
+
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(100), Time: now}) // back below, re-arms
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(120), Time: now})
+	if n := len(alertsOf(repos)); n != 2 {
+		t.Errorf("Expected a second alert after re-crossing, got %d", n)
+	}
+}
+
+func TestDrawdownAndWeightRules(t *testing.T) {
+	m, repos, now := setupMonitor(t,
+		models.PortfolioAlertRule{Type: models.RuleDrawdown, Threshold: decimal.NewFromInt(10)},
+		models.PortfolioAlertRule{Type: models.RulePositionWeight, Threshold: decimal.NewFromInt(60)},
+	)
+
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(100), Time: now}) // 2000, primes
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(150), Time: now}) // peak 2500, AAPL 60%
+	m.handle(StockEvent{Symbol: "MSFT", Price: decimal.NewFromInt(70), Time: now})  // 2200, 12% drawdown, AAPL 68%
+
+	kinds := map[models.AlertKind]int{}
+	for _, alert := range alertsOf(repos) {
+		kinds[alert.Kind]++
+		if alert.Kind == models.AlertKind(models.RulePositionWeight) && alert.StockSymbol != "AAPL" {
+			t.Errorf("Expected the weight alert on AAPL, got %+v", alert)
+		}
+	}
+	if kinds[models.AlertKind(models.RuleDrawdown)] != 1 || kinds[models.AlertKind(models.RulePositionWeight)] != 1 {
+		t.Errorf("Expected one drawdown and one weight alert, got %v", kinds)
+	}
+
+	rules, _ := repos.PortfolioRules.List()
+	if !rules[0].Peak.Equal(decimal.NewFromInt(2500)) {
+		t.Errorf("Expected the peak to be stored, got %s", rules[0].Peak)
+	}
+}
+
+func TestDailyChangeRule(t *testing.T) {
+	m, repos, now := setupMonitor(t, models.PortfolioAlertRule{Type: models.RuleDailyChange, Threshold: decimal.NewFromInt(5)})
+	yesterday := now.AddDate(0, 0, -1)
+	repos.Bars.Upsert(models.Interval1d, []models.PriceBar{
+		{Symbol: "AAPL", Bucket: yesterday.Truncate(24 * time.Hour), Close: decimal.NewFromInt(100)},
+		{Symbol: "MSFT", Bucket: yesterday.Truncate(24 * time.Hour), Close: decimal.NewFromInt(100)},
+	})
+	// Pretend the consumer starts today so the previous close comes from the bars
+	m.states = map[uint]*portfolioState{}
+	m.resync(now)
+
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(101), Time: now}) // +0.5%, primes
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(95), Time: now})  // -2.5%
+	m.handle(StockEvent{Symbol: "MSFT", Price: decimal.NewFromInt(80), Time: now})  // -12.5%
+	if n := len(alertsOf(repos)); n != 1 {
+		t.Fatalf("Expected 1 daily change alert, got %d", n)
+	}
+
+	// The next day measures from the last value of today
+	m.handle(StockEvent{Symbol: "MSFT", Price: decimal.NewFromInt(80), Time: now.Add(12 * time.Hour)})
+	if n := len(alertsOf(repos)); n != 1 {
+		t.Errorf("Expected no alert on a flat new day, got %d", n)
+	}
+}
+
+func TestUnpricedPortfolioIsNotEvaluated(t *testing.T) {
+	m, repos, now := setupMonitor(t, models.PortfolioAlertRule{Type: models.RuleValueBelow, Threshold: decimal.NewFromInt(1500)})
+	portfolios, _ := repos.Portfolios.List()
+	repos.Positions.Upsert(&models.Position{PortfolioID: portfolios[0].ID, Symbol: "NVDA", Quantity: decimal.NewFromInt(1)})
+	m.resync(now)
+
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(10), Time: now})
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(1), Time: now})
+	if n := len(alertsOf(repos)); n != 0 {
+		t.Errorf("Expected no alerts while NVDA has no price, got %d", n)
+	}
+}
+
+func TestRulesUseBaseCurrency(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	user := models.User{Name: "Jane", Email: "jane@example.com", BaseCurrency: "EUR"}
+	repos.Users.Create(&user)
+	portfolio := models.Portfolio{UserID: user.ID, Name: "Trading"}
+	repos.Portfolios.Create(&portfolio)
+	repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "AAPL", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(90), Currency: "USD"})
+	repos.PortfolioRules.Create(&models.PortfolioAlertRule{PortfolioID: portfolio.ID, Type: models.RuleValueAbove, Threshold: decimal.NewFromInt(1000)})
+
+	now := time.Date(2025, 3, 4, 15, 0, 0, 0, time.UTC)
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(100), Timestamp: now.Add(-time.Minute)})
+	m := newMonitor(repos)
+	if err := m.resync(now); err != nil {
+		t.Fatalf("resync failed: %v", err)
+	}
+
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(105), Time: now}) // no USDEUR rate yet
+	if st := m.states[portfolio.ID]; !st.lastValue.IsZero() {
+		t.Errorf("Expected no value without a rate, got %s", st.lastValue)
+	}
+	m.handle(StockEvent{Symbol: "USDEUR", Price: decimal.NewFromFloat(0.9), Time: now})  // 945 EUR, primes the rule
+	m.handle(StockEvent{Symbol: "USDEUR", Price: decimal.NewFromFloat(0.96), Time: now}) // 1008 EUR, crosses on the rate alone
+
+	alerts, _ := repos.Alerts.ListByUser(user.ID)
+	if len(alerts) != 1 || !alerts[0].Price.Round(2).Equal(decimal.NewFromInt(1008)) {
+		t.Fatalf("Expected one alert at 1008 EUR, got %+v", alerts)
+	}
+}
+
+// Test that a drawdown peak is measured again after a base currency change
+func TestDrawdownPeakResetsOnBaseChange(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	portfolio := models.Portfolio{UserID: user.ID, Name: "Trading"}
+	repos.Portfolios.Create(&portfolio)
+	repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "AAPL", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(90), Currency: "USD"})
+	repos.PortfolioRules.Create(&models.PortfolioAlertRule{PortfolioID: portfolio.ID, Type: models.RuleDrawdown, Threshold: decimal.NewFromInt(10)})
+
+	now := time.Date(2025, 3, 4, 15, 0, 0, 0, time.UTC)
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(100), Timestamp: now.Add(-time.Minute)})
+	m := newMonitor(repos)
+	m.resync(now)
+	m.handle(StockEvent{Symbol: "AAPL", Price: decimal.NewFromInt(150), Time: now}) // peak 1500 USD
+
+	repos.Users.SetBaseCurrency(user.ID, "JPY")
+	m.resync(now)
+	m.handle(StockEvent{Symbol: "USDJPY", Price: decimal.NewFromInt(150), Time: now}) // 225000 JPY
+
+	if peak := m.states[portfolio.ID].rules[0].rule.Peak; !peak.Equal(decimal.NewFromInt(225000)) {
+		t.Errorf("Expected the peak measured in JPY, got %s", peak)
+	}
+	if rules, _ := repos.PortfolioRules.List(); !rules[0].Peak.Equal(decimal.NewFromInt(225000)) {
+		t.Errorf("Expected the JPY peak to be stored, got %s", rules[0].Peak)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"stock-alerts/alerting"
+	"stock-alerts/fx"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+	"stock-alerts/timeseries"
+	"stock-alerts/valuation"
+
+	"github.com/shopspring/decimal"
+)
+
+// ruleState is a portfolio alert rule plus whether its condition currently
+// holds, per key: "" for whole-portfolio rules, the symbol for weight rules.
+// Alerts fire when a condition starts to hold, not on every event while it does.
+type ruleState struct {
+	rule      models.PortfolioAlertRule
+	primed    bool
+	triggered map[string]bool
+}
+
+// portfolioState is the live valuation of one portfolio with alert rules, in
+// its owner's base currency
+type portfolioState struct {
+	portfolio models.Portfolio
+	base      string
+	positions []models.Position
+	rules     []*ruleState
+	day       time.Time       // UTC day of prevClose
+	prevClose decimal.Decimal // value at the close of the day before `day`
+	lastValue decimal.Decimal
+}
+
+// monitor keeps live valuations of the portfolios that have alert rules and
+// evaluates those rules on every price event
+type monitor struct {
+	users      repository.UserRepo
+	portfolios repository.PortfolioRepo
+	positions  repository.PositionRepo
+	rules      repository.PortfolioRuleRepo
+	alerts     repository.AlertRepo
+	prices     repository.PriceRepo
+	bars       repository.BarRepo
+
+	mu       sync.Mutex
+	snoozes  *alerting.Snoozes
+	latest   map[string]models.StockPriceRecord
+	states   map[uint]*portfolioState
+	bySymbol map[string][]uint
+}
+
+func newMonitor(repos repository.Repositories) *monitor {
+	return &monitor{
+		users:      repos.Users,
+		portfolios: repos.Portfolios,
+		positions:  repos.Positions,
+		rules:      repos.PortfolioRules,
+		alerts:     repos.Alerts,
+		prices:     repos.Prices,
+		bars:       repos.Bars,
+		snoozes:    alerting.NewSnoozes(),
+		latest:     map[string]models.StockPriceRecord{},
+		states:     map[uint]*portfolioState{},
+		bySymbol:   map[string][]uint{},
+	}
+}
+
+// resync reloads portfolios, positions, rules and base currencies, keeping the trigger state
+// of rules that still exist
+func (m *monitor) resync(now time.Time) error {
+	rules, err := m.rules.List()
+	if err != nil {
+		return err
+	}
+	portfolios, err := m.portfolios.List()
+	if err != nil {
+		return err
+	}
+	positions, err := m.positions.List()
+	if err != nil {
+		return err
+	}
+	users, err := m.users.List()
+	if err != nil {
+		return err
+	}
+	snoozed, err := m.alerts.ListSnoozed(now)
+	if err != nil {
+		return err
+	}
+	m.snoozes.Replace(snoozed)
+
+	byID := map[uint]models.Portfolio{}
+	for _, p := range portfolios {
+		byID[p.ID] = p
+	}
+	bases := map[uint]string{}
+	for _, u := range users {
+		bases[u.ID] = u.Base()
+	}
+	holdings := map[uint][]models.Position{}
+	for _, p := range positions {
+		holdings[p.PortfolioID] = append(holdings[p.PortfolioID], p)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := map[uint]*ruleState{}
+	for _, st := range m.states {
+		for _, rs := range st.rules {
+			previous[rs.rule.ID] = rs
+		}
+	}
+
+	states := map[uint]*portfolioState{}
+	rebased := map[uint]bool{}
+	bySymbol := map[string][]uint{}
+	symbols := map[string]bool{}
+	for _, rule := range rules {
+		portfolio, ok := byID[rule.PortfolioID]
+		if !ok {
+			continue
+		}
+		st, ok := states[portfolio.ID]
+		if !ok {
+			st = &portfolioState{portfolio: portfolio, base: bases[portfolio.UserID], positions: holdings[portfolio.ID]}
+			if st.base == "" {
+				st.base = models.DefaultCurrency
+			}
+			if old, ok := m.states[portfolio.ID]; ok && old.base == st.base {
+				st.day, st.prevClose, st.lastValue = old.day, old.prevClose, old.lastValue
+			} else if ok {
+				rebased[portfolio.ID] = true
+			}
+			states[portfolio.ID] = st
+			currencies := make([]string, len(st.positions))
+			for i, p := range st.positions {
+				bySymbol[p.Symbol] = append(bySymbol[p.Symbol], portfolio.ID)
+				symbols[p.Symbol] = true
+				currencies[i] = p.Currency
+			}
+			// A rate move changes the value as much as a price move
+			for _, pair := range fx.Pairs(currencies, st.base) {
+				bySymbol[pair] = append(bySymbol[pair], portfolio.ID)
+				symbols[pair] = true
+			}
+		}
+
+		rs := &ruleState{rule: rule, triggered: map[string]bool{}}
+		if old, ok := previous[rule.ID]; ok {
+			rs.primed, rs.triggered = old.primed, old.triggered
+			rs.rule.Peak = decimal.Max(rule.Peak, old.rule.Peak)
+		}
+		// A peak in the old base currency says nothing about values in the new one
+		if rebased[portfolio.ID] && !rs.rule.Peak.IsZero() {
+			rs.rule.Peak = decimal.Zero
+			if err := m.rules.UpdatePeak(rule.ID, decimal.Zero); err != nil {
+				log.Printf("❌ Failed to reset peak of rule %d: %v\n", rule.ID, err)
+			}
+		}
+		st.rules = append(st.rules, rs)
+	}
+
+	// Seed the prices and rates of symbols not seen on the stream yet
+	missing := []string{}
+	for symbol := range symbols {
+		if _, ok := m.latest[symbol]; !ok {
+			missing = append(missing, symbol)
+		}
+	}
+	seeded, err := m.prices.Latest(missing)
+	if err != nil {
+		return err
+	}
+	for symbol, record := range seeded {
+		m.latest[symbol] = record
+	}
+
+	m.states, m.bySymbol = states, bySymbol
+
+	today := timeseries.BucketOf(now, models.Interval1d)
+	for _, st := range m.states {
+		if !st.day.Equal(today) {
+			if err := m.loadPrevClose(st, today); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadPrevClose values a portfolio at the last daily bars of its symbols and
+// FX pairs before `day`, falling back to the latest price for those without one
+func (m *monitor) loadPrevClose(st *portfolioState, day time.Time) error {
+	bars, err := m.bars.ListBetween(models.Interval1d, day.AddDate(0, 0, -7), day)
+	if err != nil {
+		return err
+	}
+	closes := map[string]models.StockPriceRecord{}
+	for _, bar := range bars {
+		closes[bar.Symbol] = models.StockPriceRecord{Symbol: bar.Symbol, Price: bar.Close, Timestamp: bar.Bucket}
+	}
+	for symbol, record := range m.latest {
+		if _, ok := closes[symbol]; !ok {
+			closes[symbol] = record
+		}
+	}
+	v := valuation.Value(st.portfolio.ID, st.positions, closes)
+	v.Convert(st.base, fx.FromPrices(closes))
+	if len(v.Unpriced) == 0 && v.Converted() {
+		st.prevClose = v.Base.MarketValue
+	}
+	st.day = day
+	return nil
+}
+
+// handle applies a price event and evaluates the rules of every portfolio
+// holding the symbol; replayed history is ignored
+func (m *monitor) handle(e StockEvent) {
+	if e.Replay {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latest[e.Symbol] = models.StockPriceRecord{Symbol: e.Symbol, Price: e.Price, Timestamp: e.Time}
+	for _, id := range m.bySymbol[e.Symbol] {
+		m.evaluate(m.states[id], e.Time)
+	}
+}
+
+// evaluate values a portfolio and fires the rules whose condition starts to
+// hold; callers must hold the lock
+func (m *monitor) evaluate(st *portfolioState, at time.Time) {
+	v := valuation.Value(st.portfolio.ID, st.positions, m.latest)
+	v.Convert(st.base, fx.FromPrices(m.latest))
+	if len(v.Unpriced) > 0 || !v.Converted() || len(v.Positions) == 0 {
+		return // a partial value would set off value and drawdown rules
+	}
+	value := v.Base.MarketValue
+
+	day := timeseries.BucketOf(at, models.Interval1d)
+	if day.After(st.day) {
+		if st.lastValue.IsPositive() {
+			st.prevClose = st.lastValue
+		}
+		st.day = day
+		for _, rs := range st.rules {
+			if rs.rule.Type == models.RuleDailyChange {
+				rs.triggered = map[string]bool{}
+			}
+		}
+	}
+	st.lastValue = value
+
+	for _, rs := range st.rules {
+		rule := rs.rule
+		switch rule.Type {
+		case models.RuleValueAbove:
+			m.check(st, rs, "", value.GreaterThanOrEqual(rule.Threshold), value, at,
+				fmt.Sprintf("value %s %s rose to %s or above", value.StringFixed(2), st.base, rule.Threshold.StringFixed(2)))
+		case models.RuleValueBelow:
+			m.check(st, rs, "", value.LessThanOrEqual(rule.Threshold), value, at,
+				fmt.Sprintf("value %s %s fell to %s or below", value.StringFixed(2), st.base, rule.Threshold.StringFixed(2)))
+		case models.RuleDailyChange:
+			if !st.prevClose.IsPositive() {
+				continue
+			}
+			change := valuation.Percent(value.Sub(st.prevClose), st.prevClose)
+			sign := "+"
+			if change.IsNegative() {
+				sign = ""
+			}
+			m.check(st, rs, "", change.Abs().GreaterThanOrEqual(rule.Threshold), change, at,
+				fmt.Sprintf("value moved %s%s%% since the previous close", sign, change.StringFixed(2)))
+		case models.RuleDrawdown:
+			if value.GreaterThan(rs.rule.Peak) {
+				rs.rule.Peak = value
+				if err := m.rules.UpdatePeak(rule.ID, value); err != nil {
+					log.Printf("❌ Failed to store peak of rule %d: %v\n", rule.ID, err)
+				}
+			}
+			drawdown := valuation.Percent(rs.rule.Peak.Sub(value), rs.rule.Peak)
+			m.check(st, rs, "", drawdown.GreaterThanOrEqual(rule.Threshold), drawdown, at,
+				fmt.Sprintf("value is %s%% below its peak of %s", drawdown.StringFixed(2), rs.rule.Peak.StringFixed(2)))
+		case models.RulePositionWeight:
+			for _, p := range v.Positions {
+				weight := valuation.Percent(p.BaseMarketValue, value)
+				m.check(st, rs, p.Symbol, weight.GreaterThanOrEqual(rule.Threshold), weight, at,
+					fmt.Sprintf("%s is %s%% of the portfolio", p.Symbol, weight.StringFixed(2)))
+			}
+		}
+	}
+	for _, rs := range st.rules {
+		rs.primed = true
+	}
+}
+
+// check fires an alert when a condition starts to hold. The first evaluation
+// of a rule only records the state, so a restart does not repeat alerts.
+func (m *monitor) check(st *portfolioState, rs *ruleState, key string, holds bool, metric decimal.Decimal, at time.Time, message string) {
+	fire := holds && !rs.triggered[key] && rs.primed
+	rs.triggered[key] = holds
+	kind := models.AlertKind(rs.rule.Type)
+	if !fire || m.snoozes.Suppressed(kind, rs.rule.ID, at) {
+		return
+	}
+
+	portfolioID, ruleID := st.portfolio.ID, rs.rule.ID
+	alert := models.Alert{
+		UserID:      st.portfolio.UserID,
+		Kind:        kind,
+		RuleID:      &ruleID,
+		PortfolioID: &portfolioID,
+		StockSymbol: key,
+		Price:       metric,
+		Message:     fmt.Sprintf("Portfolio %q: %s", st.portfolio.Name, message),
+		Timestamp:   at,
+	}
+	if err := m.alerts.Create(&alert); err != nil {
+		log.Printf("❌ Failed to store portfolio alert for %d: %v\n", portfolioID, err)
+		return
+	}
+	log.Printf("🚨 %s\n", alert.Message)
+}
@@ -0,0 +1,145 @@
+package corporate
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"stock-alerts/calendar"
+	"stock-alerts/events"
+	"stock-alerts/ledger"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+)
+
+// Publisher announces rule changes to the consumers
+type Publisher interface {
+	PublishRuleChange(change events.RuleChange)
+}
+
+// Applier applies the pending corporate actions that are due
+type Applier struct {
+	actions    repository.CorporateActionRepo
+	portfolios repository.PortfolioRepo
+	ledger     repository.TransactionRepo
+	positions  repository.PositionRepo
+	rules      Publisher
+}
+
+// NewApplier wires the applier to its repositories and the publisher that
+// tells the consumers to reload their rules
+func NewApplier(repos repository.Repositories, rules Publisher) *Applier {
+	return &Applier{
+		actions:    repos.Actions,
+		portfolios: repos.Portfolios,
+		ledger:     repos.Transactions,
+		positions:  repos.Positions,
+		rules:      rules,
+	}
+}
+
+// cutoff is the start of the effective date on the symbol's exchange; prices
+// before it are on the old terms
+func cutoff(action models.CorporateAction) time.Time {
+	d := action.EffectiveDate
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, calendar.ForSymbol(action.Symbol).Location)
+}
+
+// Due reports whether the action's effective date has begun at now on the
+// symbol's exchange
+func Due(action models.CorporateAction, now time.Time) bool {
+	return !now.Before(cutoff(action))
+}
+
+// Start applies due actions at the given period in the background
+func (a *Applier) Start(every time.Duration) {
+	ticker := time.NewTicker(every)
+	go func() {
+		for range ticker.C {
+			if _, err := a.ApplyDue(time.Now()); err != nil {
+				log.Println("❌ Corporate actions:", err)
+			}
+		}
+	}()
+}
+
+// ApplyDue applies the pending actions that are due, oldest first, and returns
+// those applied. It stops at the first failure so that later actions on the
+// same symbols are not applied out of order.
+func (a *Applier) ApplyDue(now time.Time) ([]models.CorporateAction, error) {
+	pending, err := a.actions.ListPending()
+	if err != nil {
+		return nil, err
+	}
+	applied := []models.CorporateAction{}
+	defer func() {
+		if len(applied) == 0 {
+			return
+		}
+		change := events.RuleChange{Op: events.OpReload, Time: now}
+		for _, action := range applied {
+			if action.Type == models.ActionSplit {
+				change.Reset = append(change.Reset, action.Symbol)
+			}
+		}
+		a.rules.PublishRuleChange(change)
+	}()
+
+	for _, action := range pending {
+		if !Due(action, now) {
+			continue
+		}
+		err := a.apply(action, now)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue // applied meanwhile by another instance
+		}
+		if err != nil {
+			return applied, fmt.Errorf("%s %s on %s: %w", action.Type, action.Symbol, action.EffectiveDate.Format("2006-01-02"), err)
+		}
+		action.AppliedAt = &now
+		applied = append(applied, action)
+	}
+	return applied, nil
+}
+
+func (a *Applier) apply(action models.CorporateAction, now time.Time) error {
+	switch action.Type {
+	case models.ActionSplit:
+		ledgers, err := a.actions.ApplySplit(action, cutoff(action), now)
+		if err != nil {
+			return err
+		}
+		for _, portfolioID := range ledgers {
+			if err := a.rebuildPositions(portfolioID); err != nil {
+				return fmt.Errorf("portfolio %d: %w", portfolioID, err)
+			}
+		}
+		log.Printf("✂️  Applied %s-for-1 split of %s\n", action.Ratio, action.Symbol)
+	case models.ActionRename:
+		if err := a.actions.ApplyRename(action, now); err != nil {
+			return err
+		}
+		log.Printf("🏷️  Renamed %s to %s\n", action.Symbol, action.NewSymbol)
+	default:
+		return fmt.Errorf("unknown corporate action type %q", action.Type)
+	}
+	return nil
+}
+
+// rebuildPositions derives a portfolio's positions from its ledger
+func (a *Applier) rebuildPositions(portfolioID uint) error {
+	portfolio, err := a.portfolios.FindByID(portfolioID)
+	if err != nil {
+		return err
+	}
+	transactions, err := a.ledger.ListByPortfolio(portfolioID)
+	if err != nil {
+		return err
+	}
+	book, err := ledger.Replay(transactions, ledger.MethodOf(*portfolio))
+	if err != nil {
+		return err
+	}
+	return a.positions.Replace(portfolioID, book.Positions(portfolioID))
+}
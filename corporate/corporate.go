@@ -0,0 +1,104 @@
+// Package corporate ingests splits and ticker changes and applies them to
+// thresholds, holdings, rules and price history once their effective date
+// has begun on the symbol's exchange.
+package corporate
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// Validate checks an action and normalizes its symbols and effective date
+func Validate(action *models.CorporateAction) error {
+	action.Symbol = strings.ToUpper(strings.TrimSpace(action.Symbol))
+	action.NewSymbol = strings.ToUpper(strings.TrimSpace(action.NewSymbol))
+	if action.Symbol == "" || len(action.Symbol) > 10 {
+		return fmt.Errorf("symbol is required and at most 10 characters")
+	}
+	switch action.Type {
+	case models.ActionSplit:
+		if !action.Ratio.IsPositive() || action.Ratio.Equal(decimal.NewFromInt(1)) {
+			return fmt.Errorf("a split needs a positive ratio other than 1")
+		}
+		action.NewSymbol = ""
+	case models.ActionRename:
+		if action.NewSymbol == "" || len(action.NewSymbol) > 10 || action.NewSymbol == action.Symbol {
+			return fmt.Errorf("a rename needs a different new symbol of at most 10 characters")
+		}
+		action.Ratio = decimal.Zero
+	default:
+		return fmt.Errorf("type must be one of SPLIT, RENAME")
+	}
+	if action.EffectiveDate.IsZero() {
+		return fmt.Errorf("effective date is required")
+	}
+	d := action.EffectiveDate
+	action.EffectiveDate = time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)
+	action.AppliedAt = nil
+	return nil
+}
+
+// ParseRatio reads a split ratio as new shares per old share: "4", "0.1",
+// or "4:1" and "1:10" as new:old
+func ParseRatio(s string) (decimal.Decimal, error) {
+	s = strings.TrimSpace(s)
+	if newShares, oldShares, ok := strings.Cut(s, ":"); ok {
+		n, err1 := decimal.NewFromString(strings.TrimSpace(newShares))
+		o, err2 := decimal.NewFromString(strings.TrimSpace(oldShares))
+		if err1 != nil || err2 != nil || o.IsZero() {
+			return decimal.Zero, fmt.Errorf("ratio %q is not new:old", s)
+		}
+		return n.Div(o), nil
+	}
+	ratio, err := decimal.NewFromString(s)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("ratio %q is not a number", s)
+	}
+	return ratio, nil
+}
+
+// Parse reads a type,symbol,new_symbol,ratio,effective_date CSV with a header
+// row, dates as YYYY-MM-DD. Every row is validated; the first bad one fails
+// the whole file.
+func Parse(r io.Reader) ([]models.CorporateAction, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 5
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	actions := make([]models.CorporateAction, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		line := i + 2
+		action := models.CorporateAction{
+			Type:      models.CorporateActionType(strings.ToUpper(row[0])),
+			Symbol:    row[1],
+			NewSymbol: row[2],
+		}
+		if action.Type == models.ActionSplit {
+			if action.Ratio, err = ParseRatio(row[3]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		if action.EffectiveDate, err = time.Parse("2006-01-02", row[4]); err != nil {
+			return nil, fmt.Errorf("line %d: effective date must be a YYYY-MM-DD date", line)
+		}
+		if err := Validate(&action); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
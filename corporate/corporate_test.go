@@ -0,0 +1,135 @@
+package corporate
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"stock-alerts/events"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParse(t *testing.T) {
+	actions, err := Parse(strings.NewReader(`type,symbol,new_symbol,ratio,effective_date
+split,nvda,,10:1,2024-06-10
+SPLIT,GE,,1:8,2021-0802
+`))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected the bad date on line 3 to fail, got %v", err)
+	}
+
+	actions, err = Parse(strings.NewReader(`type,symbol,new_symbol,ratio,effective_date
+split,nvda,,10:1,2024-06-10
+SPLIT,GE,,0.125,2021-08-02
+RENAME,FB,META,,2022-06-09
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(actions) != 3 {
+		t.Fatalf("Expected 3 actions, got %d", len(actions))
+	}
+	if a := actions[0]; a.Type != models.ActionSplit || a.Symbol != "NVDA" || !a.Ratio.Equal(decimal.NewFromInt(10)) || !a.EffectiveDate.Equal(time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the NVDA split, got %+v", a)
+	}
+	if !actions[1].Ratio.Equal(decimal.RequireFromString("0.125")) {
+		t.Errorf("Expected a reverse split ratio of 0.125, got %s", actions[1].Ratio)
+	}
+	if a := actions[2]; a.Type != models.ActionRename || a.NewSymbol != "META" {
+		t.Errorf("Expected the FB rename, got %+v", a)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	date := time.Date(2024, 6, 10, 15, 0, 0, 0, time.UTC)
+	for _, action := range []models.CorporateAction{
+		{Type: "MERGER", Symbol: "AAPL", EffectiveDate: date},
+		{Type: models.ActionSplit, Symbol: "AAPL", Ratio: decimal.NewFromInt(1), EffectiveDate: date},
+		{Type: models.ActionSplit, Symbol: "AAPL", Ratio: decimal.NewFromInt(-2), EffectiveDate: date},
+		{Type: models.ActionSplit, Symbol: "AAPL", Ratio: decimal.NewFromInt(2)},
+		{Type: models.ActionRename, Symbol: "FB", NewSymbol: "fb", EffectiveDate: date},
+		{Type: models.ActionRename, Symbol: "", NewSymbol: "META", EffectiveDate: date},
+	} {
+		if err := Validate(&action); err == nil {
+			t.Errorf("Expected %+v to be rejected", action)
+		}
+	}
+
+	action := models.CorporateAction{Type: models.ActionSplit, Symbol: " aapl ", Ratio: decimal.NewFromInt(4), NewSymbol: "X", EffectiveDate: date}
+	if err := Validate(&action); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if action.Symbol != "AAPL" || action.NewSymbol != "" || action.EffectiveDate.Hour() != 0 {
+		t.Errorf("Expected the action normalized, got %+v", action)
+	}
+}
+
+func TestDueFollowsTheExchangeDate(t *testing.T) {
+	nvda := models.CorporateAction{Type: models.ActionSplit, Symbol: "NVDA", Ratio: decimal.NewFromInt(10), EffectiveDate: time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)}
+	// 02:00 UTC on the 10th is still the 9th in New York
+	if Due(nvda, time.Date(2024, 6, 10, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the split not due before midnight in New York")
+	}
+	if !Due(nvda, time.Date(2024, 6, 10, 4, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the split due at midnight in New York")
+	}
+	tesco := models.CorporateAction{Type: models.ActionSplit, Symbol: "TSCO.LON", Ratio: decimal.RequireFromString("0.6"), EffectiveDate: time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)}
+	if !Due(tesco, time.Date(2024, 6, 9, 23, 30, 0, 0, time.UTC)) {
+		t.Errorf("Expected the split due at midnight in London")
+	}
+}
+
+type recordingPublisher struct {
+	changes []events.RuleChange
+}
+
+func (p *recordingPublisher) PublishRuleChange(change events.RuleChange) {
+	p.changes = append(p.changes, change)
+}
+
+func TestApplyDue(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	publisher := &recordingPublisher{}
+	applier := NewApplier(repos, publisher)
+	date := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	portfolio := models.Portfolio{UserID: user.ID, Name: "Main"}
+	repos.Portfolios.Create(&portfolio)
+	repos.Transactions.Create(&models.Transaction{PortfolioID: portfolio.ID, Type: models.TransactionBuy, Symbol: "NVDA", Quantity: decimal.NewFromInt(10), Price: decimal.NewFromInt(1000), TradeDate: date.AddDate(0, -1, 0)})
+	repos.Positions.Replace(portfolio.ID, []models.Position{{Symbol: "NVDA", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(1000)}})
+
+	split := models.CorporateAction{Type: models.ActionSplit, Symbol: "NVDA", Ratio: decimal.NewFromInt(10), EffectiveDate: date}
+	rename := models.CorporateAction{Type: models.ActionRename, Symbol: "NVDA", NewSymbol: "NVDX", EffectiveDate: date.AddDate(0, 1, 0)}
+	repos.Actions.Create(&split)
+	repos.Actions.Create(&rename)
+
+	if applied, err := applier.ApplyDue(date); err != nil || len(applied) != 0 || len(publisher.changes) != 0 {
+		t.Errorf("Expected nothing due before the exchange's midnight, got %+v (%v)", applied, err)
+	}
+
+	applied, err := applier.ApplyDue(date.Add(12 * time.Hour))
+	if err != nil {
+		t.Fatalf("ApplyDue failed: %v", err)
+	}
+	if len(applied) != 1 || applied[0].ID != split.ID {
+		t.Errorf("Expected only the split applied, got %+v", applied)
+	}
+	if positions, _ := repos.Positions.ListByPortfolio(portfolio.ID); len(positions) != 1 || !positions[0].Quantity.Equal(decimal.NewFromInt(100)) || !positions[0].AvgCost.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected 100 shares at 100 replayed from the ledger, got %+v", positions)
+	}
+	if len(publisher.changes) != 1 || publisher.changes[0].Op != events.OpReload || len(publisher.changes[0].Reset) != 1 || publisher.changes[0].Reset[0] != "NVDA" {
+		t.Errorf("Expected a reload resetting NVDA to be published, got %+v", publisher.changes)
+	}
+
+	if applied, _ := applier.ApplyDue(date.Add(12 * time.Hour)); len(applied) != 0 {
+		t.Errorf("Expected the split applied once, got %+v", applied)
+	}
+	if pending, _ := repos.Actions.ListPending(); len(pending) != 1 || pending[0].ID != rename.ID {
+		t.Errorf("Expected the rename still pending, got %+v", pending)
+	}
+}
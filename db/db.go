@@ -2,18 +2,44 @@ package db
 
 import (
 	"fmt"
-	"log"
 	"os"
-
-	"stock-alerts/models"
+	"strings"
 
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+// Supported database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Config selects the database driver and how to reach it
+type Config struct {
+	Driver string
+	// DSN is a Postgres connection string, or for SQLite a file path or ":memory:"
+	DSN string
+}
+
+// ConfigFromEnv reads the database configuration from environment variables.
+// DB_DRIVER picks the driver (postgres by default); SQLite reads its file from
+// DB_PATH, Postgres builds its DSN from DB_HOST, DB_PORT, DB_USER, DB_PASSWORD and DB_NAME.
+func ConfigFromEnv() Config {
+	driver := os.Getenv("DB_DRIVER")
+	if driver == "" {
+		driver = DriverPostgres
+	}
+
+	if driver == DriverSQLite {
+		path := os.Getenv("DB_PATH")
+		if path == "" {
+			path = "stock_alerts.db"
+		}
+		return Config{Driver: driver, DSN: path}
+	}
 
-func ConnectDatabase() {
 	// Get database configuration from environment variables
 	host := os.Getenv("DB_HOST")
 	if host == "" {
@@ -42,22 +68,66 @@ func ConnectDatabase() {
 
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
 		host, user, password, dbname, port)
+	return Config{Driver: driver, DSN: dsn}
+}
+
+// Open opens the database without looking at the schema
+func Open(cfg Config) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case DriverPostgres:
+		dialector = postgres.Open(cfg.DSN)
+	case DriverSQLite:
+		if !sqliteAvailable {
+			return nil, fmt.Errorf("DB_DRIVER=sqlite needs a build with cgo (CGO_ENABLED=1); the Docker images are built without it and only run on postgres")
+		}
+		dialector = sqlite.Open(sqliteDSN(cfg.DSN))
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
 
-	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	database, err := gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Auto-migrate tables (include StockPrice now)
-	database.AutoMigrate(
-		&models.User{},
-		&models.Portfolio{},
-		&models.Stock{},
-		&models.Alert{},
-		&models.StockPrice{}, // ✅ added,
-		&models.StockAnalytics{},
-	)
+	if cfg.Driver == DriverSQLite {
+		sqlDB, err := database.DB()
+		if err != nil {
+			return nil, err
+		}
+		// Every connection to :memory: is a new empty database, and file
+		// databases only allow one writer anyway
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return database, nil
+}
+
+// sqliteDSN turns a path into a DSN with foreign keys enforced and a busy
+// timeout, so several services can share one database file
+func sqliteDSN(path string) string {
+	if path == ":memory:" {
+		return "file::memory:?_foreign_keys=on"
+	}
+	if strings.Contains(path, "?") {
+		return path
+	}
+	return "file:" + path + "?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL"
+}
+
+// ConnectDatabase opens the database configured in the environment and
+// refuses to continue unless the schema is at the version this build was
+// written against
+func ConnectDatabase() (*gorm.DB, error) {
+	database, err := Open(ConfigFromEnv())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckSchemaVersion(database); err != nil {
+		return nil, fmt.Errorf("unexpected database schema: %w", err)
+	}
 
-	DB = database
-	fmt.Println("✅ Database connected & migrated")
+	fmt.Println("✅ Database connected, schema up to date")
+	return database, nil
 }
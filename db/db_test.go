@@ -3,34 +3,52 @@ package db
 import (
 	"os"
 	"testing"
+	"testing/fstest"
 )
 
 func TestConnectDatabase(t *testing.T) {
-	// Test with mock environment variables
-	os.Setenv("DB_HOST", "localhost")
-	os.Setenv("DB_PORT", "5432")
-	os.Setenv("DB_USER", "testuser")
-	os.Setenv("DB_PASSWORD", "testpass")
-	os.Setenv("DB_NAME", "testdb")
-
-	// This test will verify the function doesn't panic
-	// In a real environment, you'd use a test database
-	defer func() {
-		if r := recover(); r != nil {
-			t.Errorf("ConnectDatabase panicked: %v", r)
-		}
-	}()
-
-	// Note: This will likely fail to connect to actual DB in CI/CD
-	// but it tests the connection string building logic
-	// ConnectDatabase()
-
-	// Cleanup
-	os.Unsetenv("DB_HOST")
-	os.Unsetenv("DB_PORT")
-	os.Unsetenv("DB_USER")
-	os.Unsetenv("DB_PASSWORD")
-	os.Unsetenv("DB_NAME")
+	// Test against an in-memory SQLite database so no server is needed
+	os.Setenv("DB_DRIVER", "sqlite")
+	os.Setenv("DB_PATH", ":memory:")
+	defer os.Unsetenv("DB_DRIVER")
+	defer os.Unsetenv("DB_PATH")
+
+	database, err := Open(ConfigFromEnv())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	// A fresh database must be rejected until it is migrated
+	if err := CheckSchemaVersion(database); err == nil {
+		t.Error("Expected an unmigrated database to fail the schema check")
+	}
+
+	if err := MigrateUp(database); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+	if err := CheckSchemaVersion(database); err != nil {
+		t.Errorf("Expected migrated database to pass the schema check, got %v", err)
+	}
+}
+
+func TestOpenUnsupportedDriver(t *testing.T) {
+	if _, err := Open(Config{Driver: "oracle"}); err == nil {
+		t.Error("Expected an error for an unsupported driver")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	os.Unsetenv("DB_DRIVER")
+	if cfg := ConfigFromEnv(); cfg.Driver != DriverPostgres ||
+		cfg.DSN != "host=localhost user=postgres password=postgres dbname=stock_alerts port=5432 sslmode=disable" {
+		t.Errorf("Unexpected default config: %+v", cfg)
+	}
+
+	os.Setenv("DB_DRIVER", "sqlite")
+	defer os.Unsetenv("DB_DRIVER")
+	if cfg := ConfigFromEnv(); cfg.Driver != DriverSQLite || cfg.DSN != "stock_alerts.db" {
+		t.Errorf("Unexpected sqlite config: %+v", cfg)
+	}
 }
 
 func TestEnvironmentVariableDefaults(t *testing.T) {
@@ -231,3 +249,114 @@ func containsAt(s, substr string) bool {
 	}
 	return false
 }
+
+// Test that the embedded migrations load in order and match across dialects
+func TestLoadMigrations(t *testing.T) {
+	postgres, err := LoadMigrations(DriverPostgres)
+	if err != nil {
+		t.Fatalf("Failed to load postgres migrations: %v", err)
+	}
+	sqlite, err := LoadMigrations(DriverSQLite)
+	if err != nil {
+		t.Fatalf("Failed to load sqlite migrations: %v", err)
+	}
+	if len(postgres) == 0 {
+		t.Fatal("Expected at least one migration")
+	}
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("Expected the same number of migrations per dialect, got %d and %d", len(postgres), len(sqlite))
+	}
+
+	for i := range postgres {
+		if postgres[i].Name != sqlite[i].Name {
+			t.Errorf("Migration %d is %q for postgres but %q for sqlite", i+1, postgres[i].Name, sqlite[i].Name)
+		}
+	}
+
+	latest, _ := LatestVersion(DriverPostgres)
+	if latest != len(postgres) {
+		t.Errorf("Expected latest version %d, got %d", len(postgres), latest)
+	}
+}
+
+// Test that every migration can be applied and rolled back
+func TestMigrateUpAndDown(t *testing.T) {
+	database, err := Open(Config{Driver: DriverSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	latest, _ := LatestVersion(DriverSQLite)
+
+	if err := MigrateUp(database); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+	if version, _ := CurrentVersion(database); version != latest {
+		t.Errorf("Expected version %d after up, got %d", latest, version)
+	}
+
+	if err := MigrateDown(database, latest); err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+	if version, _ := CurrentVersion(database); version != 0 {
+		t.Errorf("Expected version 0 after down, got %d", version)
+	}
+	if database.Migrator().HasTable("users") {
+		t.Error("Expected users table to be dropped")
+	}
+
+	// And up again from scratch
+	if err := MigrateUp(database); err != nil {
+		t.Fatalf("MigrateUp after down failed: %v", err)
+	}
+}
+
+// Test that malformed migration sets are rejected
+func TestLoadMigrationsValidation(t *testing.T) {
+	tests := []struct {
+		files       fstest.MapFS
+		description string
+	}{
+		{fstest.MapFS{"m/0001_init.up.sql": {}}, "missing down file"},
+		{fstest.MapFS{"m/0001_init.up.sql": {Data: []byte("x")}, "m/0001_init.down.sql": {Data: []byte("x")},
+			"m/0003_gap.up.sql": {Data: []byte("x")}, "m/0003_gap.down.sql": {Data: []byte("x")}}, "gap in versions"},
+		{fstest.MapFS{"m/0001_a.up.sql": {Data: []byte("x")}, "m/0001_b.down.sql": {Data: []byte("x")}}, "conflicting names"},
+		{fstest.MapFS{"m/readme.txt": {Data: []byte("x")}}, "unexpected file"},
+	}
+
+	for _, test := range tests {
+		if _, err := loadMigrations(test.files, "m"); err == nil {
+			t.Errorf("%s: expected an error", test.description)
+		}
+	}
+}
+
+// Test that the SQLite rebuild of portfolios keeps the rows referencing it
+func TestNamedPortfoliosMigrationKeepsData(t *testing.T) {
+	database, err := Open(Config{Driver: DriverSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	migrations, _ := LoadMigrations(DriverSQLite)
+	if err := migrateTo(database, migrations, 5); err != nil {
+		t.Fatalf("Migrating to version 5 failed: %v", err)
+	}
+	database.Exec("INSERT INTO users (id, name) VALUES (1, 'Jane')")
+	database.Exec("INSERT INTO portfolios (id, user_id) VALUES (1, 1)")
+	database.Exec("INSERT INTO stocks (portfolio_id, stock_symbol) VALUES (1, 'AAPL')")
+
+	if err := MigrateUp(database); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+
+	var name string
+	database.Raw("SELECT name FROM portfolios WHERE id = 1").Scan(&name)
+	if name != "Default" {
+		t.Errorf("Expected the existing portfolio to be named Default, got %q", name)
+	}
+	if err := database.Exec("INSERT INTO portfolios (user_id, name) VALUES (1, 'Trading')").Error; err != nil {
+		t.Errorf("Expected a second portfolio to be allowed, got %v", err)
+	}
+	if err := database.Exec("INSERT INTO stocks (portfolio_id, stock_symbol) VALUES (99, 'TSLA')").Error; err == nil {
+		t.Error("Expected foreign keys to be enforced again after migrating")
+	}
+}
@@ -0,0 +1,45 @@
+// Package dbtest opens migrated databases for tests
+package dbtest
+
+import (
+	"os"
+	"testing"
+
+	"stock-alerts/db"
+
+	"gorm.io/gorm"
+)
+
+// Open returns a freshly migrated database for a test. Tests run against an
+// in-memory SQLite database unless TEST_DB_DRIVER=postgres, in which case the
+// DB_* variables select the server and its schema is rebuilt from scratch.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	cfg := db.Config{Driver: db.DriverSQLite, DSN: ":memory:"}
+	if os.Getenv("TEST_DB_DRIVER") == db.DriverPostgres {
+		cfg = db.ConfigFromEnv()
+		cfg.Driver = db.DriverPostgres
+	}
+
+	database, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, _ := database.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if cfg.Driver == db.DriverPostgres {
+		current, err := db.CurrentVersion(database)
+		if err != nil {
+			t.Fatalf("Failed to read schema version: %v", err)
+		}
+		if err := db.MigrateDown(database, current); err != nil {
+			t.Fatalf("Failed to reset test database: %v", err)
+		}
+	}
+	if err := db.MigrateUp(database); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return database
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change with its rollback
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// schemaMigration is a row of the schema version table
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migration files are named <version>_<name>.<up|down>.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// LoadMigrations returns the embedded migrations of a dialect ordered by version.
+// Every dialect keeps its own copy of each migration under migrations/<dialect>.
+func LoadMigrations(dialect string) ([]Migration, error) {
+	return loadMigrations(migrationFiles, path.Join("migrations", dialect))
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected file in migrations: %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, found %d at position %d", m.Version, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// LatestVersion is the schema version the embedded migrations lead to
+func LatestVersion(dialect string) (int, error) {
+	migrations, err := LoadMigrations(dialect)
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations), nil
+}
+
+func ensureVersionTable(db *gorm.DB) error {
+	return db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`).Error
+}
+
+// CurrentVersion returns the highest applied migration, 0 for an empty database
+func CurrentVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Model(&schemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// MigrateUp applies every pending migration, each in its own transaction
+func MigrateUp(db *gorm.DB) error {
+	migrations, err := LoadMigrations(db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	return migrateTo(db, migrations, len(migrations))
+}
+
+// MigrateDown rolls back the given number of applied migrations
+func MigrateDown(db *gorm.DB, steps int) error {
+	migrations, err := LoadMigrations(db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	current, err := CurrentVersion(db)
+	if err != nil {
+		return err
+	}
+	target := current - steps
+	if target < 0 {
+		target = 0
+	}
+	return migrateTo(db, migrations, target)
+}
+
+func migrateTo(db *gorm.DB, migrations []Migration, target int) error {
+	if err := ensureVersionTable(db); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	current, err := CurrentVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database is at version %d, newer than the latest known migration %d", current, len(migrations))
+	}
+
+	for current < target {
+		m := migrations[current]
+		err := runMigration(db, func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s up failed: %w", m.Version, m.Name, err)
+		}
+		fmt.Printf("⬆️  Applied migration %d_%s\n", m.Version, m.Name)
+		current++
+	}
+
+	for current > target {
+		m := migrations[current-1]
+		err := runMigration(db, func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s down failed: %w", m.Version, m.Name, err)
+		}
+		fmt.Printf("⬇️  Reverted migration %d_%s\n", m.Version, m.Name)
+		current--
+	}
+	return nil
+}
+
+// runMigration runs one migration step in a transaction. SQLite can only drop
+// a constraint by rebuilding the table, which trips the foreign keys pointing
+// at it, so as the SQLite docs advise they are switched off for the step and
+// checked before it commits.
+func runMigration(db *gorm.DB, step func(tx *gorm.DB) error) error {
+	if db.Dialector.Name() != "sqlite" {
+		return db.Transaction(step)
+	}
+
+	if err := db.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+		return err
+	}
+	defer db.Exec("PRAGMA foreign_keys = ON")
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := step(tx); err != nil {
+			return err
+		}
+		var violations []struct{ Table string }
+		if err := tx.Raw("PRAGMA foreign_key_check").Scan(&violations).Error; err != nil {
+			return err
+		}
+		if len(violations) > 0 {
+			return fmt.Errorf("foreign key violations in %s", violations[0].Table)
+		}
+		return nil
+	})
+}
+
+// CheckSchemaVersion fails unless the database is exactly at the latest version
+func CheckSchemaVersion(db *gorm.DB) error {
+	latest, err := LatestVersion(db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	current, err := CurrentVersion(db)
+	if err != nil {
+		return err
+	}
+	if current < latest {
+		return fmt.Errorf("database schema is at version %d but this build expects %d; run `go run ./migrate up`", current, latest)
+	}
+	if current > latest {
+		return fmt.Errorf("database schema is at version %d, newer than the %d this build expects", current, latest)
+	}
+	return nil
+}
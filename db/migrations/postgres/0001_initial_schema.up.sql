@@ -0,0 +1,58 @@
+-- Baseline schema. IF NOT EXISTS lets databases that were created by the old
+-- AutoMigrate-at-startup code adopt versioned migrations without data loss.
+
+CREATE TABLE IF NOT EXISTS users (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100),
+    email TEXT,
+    CONSTRAINT uni_users_email UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS portfolios (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT,
+    CONSTRAINT uni_portfolios_user_id UNIQUE (user_id),
+    CONSTRAINT fk_users_portfolio FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE IF NOT EXISTS stocks (
+    id BIGSERIAL PRIMARY KEY,
+    portfolio_id BIGINT,
+    stock_symbol VARCHAR(10),
+    threshold_price DECIMAL,
+    CONSTRAINT fk_portfolios_stocks FOREIGN KEY (portfolio_id) REFERENCES portfolios (id)
+);
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT,
+    stock_symbol VARCHAR(10),
+    price DECIMAL,
+    "timestamp" TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS stock_prices (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(10),
+    price DECIMAL,
+    "timestamp" TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_stock_prices_symbol ON stock_prices (symbol);
+
+CREATE TABLE IF NOT EXISTS stock_analytics (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(10),
+    avg5 DECIMAL,
+    avg20 DECIMAL,
+    signal TEXT,
+    generated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_stock_analytics_symbol ON stock_analytics (symbol);
+
+CREATE TABLE IF NOT EXISTS stock_price_records (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(10),
+    price DECIMAL,
+    "timestamp" TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_stock_price_records_symbol ON stock_price_records (symbol);
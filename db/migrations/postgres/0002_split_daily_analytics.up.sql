@@ -0,0 +1,44 @@
+-- The analytics consumer used to AutoMigrate its daily aggregates into
+-- stock_analytics, on top of the signal columns owned by models.StockAnalytics.
+-- The daily aggregates now live in their own table.
+
+CREATE TABLE stock_daily_analytics (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(10),
+    date TIMESTAMPTZ,
+    min_price DECIMAL,
+    max_price DECIMAL,
+    avg_price DECIMAL,
+    total_volume BIGINT,
+    price_changes BIGINT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_stock_daily_analytics_symbol_date ON stock_daily_analytics (symbol, date);
+
+-- Move rows written by the old consumer and drop its columns
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'stock_analytics' AND column_name = 'date'
+    ) THEN
+        INSERT INTO stock_daily_analytics
+            (symbol, date, min_price, max_price, avg_price, total_volume, price_changes, created_at, updated_at)
+        SELECT symbol, date, min_price, max_price, avg_price, total_volume, price_changes, created_at, updated_at
+        FROM stock_analytics
+        WHERE date IS NOT NULL;
+
+        DELETE FROM stock_analytics WHERE date IS NOT NULL;
+        DROP INDEX IF EXISTS idx_symbol_date;
+        ALTER TABLE stock_analytics
+            DROP COLUMN date,
+            DROP COLUMN min_price,
+            DROP COLUMN max_price,
+            DROP COLUMN avg_price,
+            DROP COLUMN total_volume,
+            DROP COLUMN price_changes,
+            DROP COLUMN created_at,
+            DROP COLUMN updated_at;
+    END IF;
+END $$;
@@ -0,0 +1,23 @@
+DROP TABLE IF EXISTS stock_price_bars_1d;
+DROP TABLE IF EXISTS stock_price_bars_1h;
+DROP TABLE IF EXISTS stock_price_bars_1m;
+
+CREATE TABLE stock_price_records_flat (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(10),
+    price DECIMAL,
+    "timestamp" TIMESTAMPTZ
+);
+
+INSERT INTO stock_price_records_flat (id, symbol, price, "timestamp")
+SELECT id, symbol, price, "timestamp" FROM stock_price_records;
+
+SELECT setval('stock_price_records_flat_id_seq', COALESCE((SELECT MAX(id) FROM stock_price_records_flat), 0) + 1, false);
+
+DROP TABLE stock_price_records;
+DROP FUNCTION IF EXISTS ensure_price_partition(TIMESTAMPTZ);
+
+ALTER TABLE stock_price_records_flat RENAME TO stock_price_records;
+ALTER SEQUENCE stock_price_records_flat_id_seq RENAME TO stock_price_records_id_seq;
+ALTER INDEX stock_price_records_flat_pkey RENAME TO stock_price_records_pkey;
+CREATE INDEX idx_stock_price_records_symbol ON stock_price_records (symbol);
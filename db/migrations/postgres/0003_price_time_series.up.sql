@@ -0,0 +1,105 @@
+-- Partition the raw price history by month, index it by (symbol, timestamp)
+-- and add the OHLC rollup tables read by the history API.
+
+ALTER TABLE stock_price_records RENAME TO stock_price_records_old;
+ALTER SEQUENCE stock_price_records_id_seq RENAME TO stock_price_records_old_id_seq;
+DROP INDEX IF EXISTS idx_stock_price_records_symbol;
+
+CREATE TABLE stock_price_records (
+    id BIGSERIAL,
+    symbol VARCHAR(10) NOT NULL,
+    price DECIMAL,
+    "timestamp" TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (id, "timestamp")
+) PARTITION BY RANGE ("timestamp");
+
+-- Catches rows outside every monthly partition; ensure_price_partition moves
+-- them out when their month gets a partition
+CREATE TABLE stock_price_records_default PARTITION OF stock_price_records DEFAULT;
+
+CREATE INDEX idx_stock_price_records_symbol_timestamp ON stock_price_records (symbol, "timestamp");
+
+-- ensure_price_partition creates the partition holding the given instant's
+-- UTC month if it does not exist yet and returns its name
+CREATE FUNCTION ensure_price_partition(ts TIMESTAMPTZ) RETURNS TEXT AS $$
+DECLARE
+    month_start TIMESTAMP := date_trunc('month', ts AT TIME ZONE 'UTC');
+    lower_bound TIMESTAMPTZ := month_start AT TIME ZONE 'UTC';
+    upper_bound TIMESTAMPTZ := (month_start + INTERVAL '1 month') AT TIME ZONE 'UTC';
+    partition_name TEXT := 'stock_price_records_' || to_char(month_start, '"y"YYYY"m"MM');
+BEGIN
+    IF to_regclass(partition_name) IS NOT NULL THEN
+        RETURN partition_name;
+    END IF;
+
+    EXECUTE format('CREATE TABLE %I (LIKE stock_price_records INCLUDING DEFAULTS)', partition_name);
+    EXECUTE format(
+        'WITH moved AS (DELETE FROM stock_price_records_default WHERE "timestamp" >= %L AND "timestamp" < %L RETURNING *) '
+        'INSERT INTO %I SELECT * FROM moved',
+        lower_bound, upper_bound, partition_name);
+    EXECUTE format(
+        'ALTER TABLE stock_price_records ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)',
+        partition_name, lower_bound, upper_bound);
+    RETURN partition_name;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Partitions for every month that already has data, then copy it over
+DO $$
+DECLARE
+    month_start TIMESTAMPTZ;
+BEGIN
+    FOR month_start IN
+        SELECT DISTINCT date_trunc('month', "timestamp" AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+        FROM stock_price_records_old
+        WHERE "timestamp" IS NOT NULL
+    LOOP
+        PERFORM ensure_price_partition(month_start);
+    END LOOP;
+    PERFORM ensure_price_partition(now());
+END $$;
+
+INSERT INTO stock_price_records (id, symbol, price, "timestamp")
+SELECT id, symbol, price, "timestamp"
+FROM stock_price_records_old
+WHERE "timestamp" IS NOT NULL AND symbol IS NOT NULL;
+
+SELECT setval('stock_price_records_id_seq', COALESCE((SELECT MAX(id) FROM stock_price_records_old), 0) + 1, false);
+
+DROP TABLE stock_price_records_old;
+
+CREATE TABLE stock_price_bars_1m (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(10) NOT NULL,
+    bucket TIMESTAMPTZ NOT NULL,
+    open DECIMAL,
+    high DECIMAL,
+    low DECIMAL,
+    close DECIMAL,
+    count BIGINT,
+    CONSTRAINT uni_stock_price_bars_1m_symbol_bucket UNIQUE (symbol, bucket)
+);
+
+CREATE TABLE stock_price_bars_1h (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(10) NOT NULL,
+    bucket TIMESTAMPTZ NOT NULL,
+    open DECIMAL,
+    high DECIMAL,
+    low DECIMAL,
+    close DECIMAL,
+    count BIGINT,
+    CONSTRAINT uni_stock_price_bars_1h_symbol_bucket UNIQUE (symbol, bucket)
+);
+
+CREATE TABLE stock_price_bars_1d (
+    id BIGSERIAL PRIMARY KEY,
+    symbol VARCHAR(10) NOT NULL,
+    bucket TIMESTAMPTZ NOT NULL,
+    open DECIMAL,
+    high DECIMAL,
+    low DECIMAL,
+    close DECIMAL,
+    count BIGINT,
+    CONSTRAINT uni_stock_price_bars_1d_symbol_bucket UNIQUE (symbol, bucket)
+);
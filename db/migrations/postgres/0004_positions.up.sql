@@ -0,0 +1,10 @@
+CREATE TABLE positions (
+    id BIGSERIAL PRIMARY KEY,
+    portfolio_id BIGINT NOT NULL,
+    symbol VARCHAR(10) NOT NULL,
+    quantity DECIMAL NOT NULL DEFAULT 0,
+    avg_cost DECIMAL NOT NULL DEFAULT 0,
+    currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    CONSTRAINT uni_positions_portfolio_symbol UNIQUE (portfolio_id, symbol),
+    CONSTRAINT fk_portfolios_positions FOREIGN KEY (portfolio_id) REFERENCES portfolios (id)
+);
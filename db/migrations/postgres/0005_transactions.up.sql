@@ -0,0 +1,17 @@
+CREATE TABLE transactions (
+    id BIGSERIAL PRIMARY KEY,
+    portfolio_id BIGINT NOT NULL,
+    type VARCHAR(10) NOT NULL,
+    symbol VARCHAR(10),
+    quantity DECIMAL NOT NULL DEFAULT 0,
+    price DECIMAL NOT NULL DEFAULT 0,
+    fee DECIMAL NOT NULL DEFAULT 0,
+    amount DECIMAL NOT NULL DEFAULT 0,
+    currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    lot_id BIGINT,
+    trade_date TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ,
+    CONSTRAINT fk_portfolios_transactions FOREIGN KEY (portfolio_id) REFERENCES portfolios (id),
+    CONSTRAINT fk_transactions_lot FOREIGN KEY (lot_id) REFERENCES transactions (id)
+);
+CREATE INDEX idx_transactions_portfolio_trade_date ON transactions (portfolio_id, trade_date);
@@ -0,0 +1,5 @@
+-- Fails while any user still has more than one portfolio
+ALTER TABLE portfolios DROP CONSTRAINT IF EXISTS uni_portfolios_user_id_name;
+ALTER TABLE portfolios DROP COLUMN IF EXISTS kind;
+ALTER TABLE portfolios DROP COLUMN IF EXISTS name;
+ALTER TABLE portfolios ADD CONSTRAINT uni_portfolios_user_id UNIQUE (user_id);
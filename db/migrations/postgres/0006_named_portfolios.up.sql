@@ -0,0 +1,8 @@
+-- Users may keep several named portfolios and watchlists. Databases created by
+-- AutoMigrate may name the old constraint either way.
+ALTER TABLE portfolios DROP CONSTRAINT IF EXISTS uni_portfolios_user_id;
+ALTER TABLE portfolios DROP CONSTRAINT IF EXISTS portfolios_user_id_key;
+
+ALTER TABLE portfolios ADD COLUMN name VARCHAR(100) NOT NULL DEFAULT 'Default';
+ALTER TABLE portfolios ADD COLUMN kind VARCHAR(10) NOT NULL DEFAULT 'portfolio';
+ALTER TABLE portfolios ADD CONSTRAINT uni_portfolios_user_id_name UNIQUE (user_id, name);
@@ -0,0 +1,4 @@
+ALTER TABLE alerts DROP COLUMN IF EXISTS message;
+ALTER TABLE alerts DROP COLUMN IF EXISTS portfolio_id;
+ALTER TABLE alerts DROP COLUMN IF EXISTS kind;
+DROP TABLE IF EXISTS portfolio_alert_rules;
@@ -0,0 +1,10 @@
+CREATE TABLE expression_rules (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    symbol VARCHAR(10) NOT NULL,
+    expression VARCHAR(500) NOT NULL,
+    triggered BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ,
+    CONSTRAINT fk_users_expression_rules FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX idx_expression_rules_user_id ON expression_rules (user_id);
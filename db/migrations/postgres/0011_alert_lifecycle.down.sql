@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_alerts_user_status;
+ALTER TABLE alerts DROP COLUMN status_changed_at;
+ALTER TABLE alerts DROP COLUMN snoozed_until;
+ALTER TABLE alerts DROP COLUMN status;
+ALTER TABLE alerts DROP COLUMN rule_id;
@@ -0,0 +1,7 @@
+-- Alerts move through NEW, READ, ACKNOWLEDGED, SNOOZED and RESOLVED, and
+-- remember the rule that raised them so snoozing can silence it
+ALTER TABLE alerts ADD COLUMN rule_id BIGINT;
+ALTER TABLE alerts ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'NEW';
+ALTER TABLE alerts ADD COLUMN snoozed_until TIMESTAMPTZ;
+ALTER TABLE alerts ADD COLUMN status_changed_at TIMESTAMPTZ;
+CREATE INDEX idx_alerts_user_status ON alerts (user_id, status);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_alerts_notified_at;
+ALTER TABLE alerts DROP COLUMN notified_at;
+DROP TABLE IF EXISTS rule_channels;
+DROP TABLE IF EXISTS notification_preferences;
@@ -0,0 +1,34 @@
+-- How and when each user is told about alerts, with per-rule channel overrides
+CREATE TABLE notification_preferences (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    channels VARCHAR(100) NOT NULL DEFAULT '',
+    email TEXT NOT NULL DEFAULT '',
+    webhook_url VARCHAR(500) NOT NULL DEFAULT '',
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    quiet_start VARCHAR(5) NOT NULL DEFAULT '',
+    quiet_end VARCHAR(5) NOT NULL DEFAULT '',
+    digest VARCHAR(10) NOT NULL DEFAULT 'NONE',
+    digest_hour BIGINT NOT NULL DEFAULT 0,
+    digest_weekday BIGINT NOT NULL DEFAULT 0,
+    last_digest_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    CONSTRAINT fk_users_preferences FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX idx_notification_preferences_user_id ON notification_preferences (user_id);
+
+CREATE TABLE rule_channels (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    rule_id BIGINT NOT NULL,
+    channels VARCHAR(100) NOT NULL DEFAULT '',
+    CONSTRAINT fk_users_rule_channels FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX idx_rule_channels_user_id ON rule_channels (user_id);
+CREATE UNIQUE INDEX idx_rule_channels_rule ON rule_channels (kind, rule_id);
+
+-- Alerts raised before the notifier existed count as sent
+ALTER TABLE alerts ADD COLUMN notified_at TIMESTAMPTZ;
+UPDATE alerts SET notified_at = "timestamp";
+CREATE INDEX idx_alerts_notified_at ON alerts (notified_at);
@@ -0,0 +1,13 @@
+-- Splits and ticker changes, applied to thresholds, holdings, rules and price
+-- history once their effective date arrives
+CREATE TABLE corporate_actions (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(10) NOT NULL,
+    symbol VARCHAR(10) NOT NULL,
+    new_symbol VARCHAR(10) NOT NULL DEFAULT '',
+    ratio DECIMAL NOT NULL DEFAULT 0,
+    effective_date TIMESTAMPTZ NOT NULL,
+    applied_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_corporate_actions_type_symbol_date ON corporate_actions (type, symbol, effective_date);
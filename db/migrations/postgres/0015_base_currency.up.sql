@@ -0,0 +1,2 @@
+-- The currency valuations and portfolio alerts of a user are computed in
+ALTER TABLE users ADD COLUMN base_currency VARCHAR(3) NOT NULL DEFAULT 'USD';
@@ -0,0 +1,4 @@
+-- Daily analytics keep the exact sum of their prices; the average is derived
+-- from it instead of being updated incrementally
+ALTER TABLE stock_daily_analytics ADD COLUMN price_sum DECIMAL;
+UPDATE stock_daily_analytics SET price_sum = avg_price * price_changes;
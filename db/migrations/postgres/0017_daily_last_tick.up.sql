@@ -0,0 +1,5 @@
+-- The time of the newest price counted in a day, so replayed history that
+-- was already counted is not counted again. Live prices were counted as they
+-- arrived, so existing rows start from their last update.
+ALTER TABLE stock_daily_analytics ADD COLUMN last_tick TIMESTAMPTZ;
+UPDATE stock_daily_analytics SET last_tick = updated_at;
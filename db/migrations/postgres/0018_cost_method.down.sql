@@ -0,0 +1 @@
+ALTER TABLE portfolios DROP COLUMN cost_method;
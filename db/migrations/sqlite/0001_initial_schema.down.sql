@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS stock_price_records;
+DROP TABLE IF EXISTS stock_analytics;
+DROP TABLE IF EXISTS stock_prices;
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS stocks;
+DROP TABLE IF EXISTS portfolios;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,55 @@
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100),
+    email TEXT,
+    CONSTRAINT uni_users_email UNIQUE (email)
+);
+
+CREATE TABLE portfolios (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    CONSTRAINT uni_portfolios_user_id UNIQUE (user_id),
+    CONSTRAINT fk_users_portfolio FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE stocks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    portfolio_id INTEGER,
+    stock_symbol VARCHAR(10),
+    threshold_price DECIMAL,
+    CONSTRAINT fk_portfolios_stocks FOREIGN KEY (portfolio_id) REFERENCES portfolios (id)
+);
+
+CREATE TABLE alerts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    stock_symbol VARCHAR(10),
+    price DECIMAL,
+    "timestamp" DATETIME
+);
+
+CREATE TABLE stock_prices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(10),
+    price DECIMAL,
+    "timestamp" DATETIME
+);
+CREATE INDEX idx_stock_prices_symbol ON stock_prices (symbol);
+
+CREATE TABLE stock_analytics (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(10),
+    avg5 DECIMAL,
+    avg20 DECIMAL,
+    signal TEXT,
+    generated_at DATETIME
+);
+CREATE INDEX idx_stock_analytics_symbol ON stock_analytics (symbol);
+
+CREATE TABLE stock_price_records (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(10),
+    price DECIMAL,
+    "timestamp" DATETIME
+);
+CREATE INDEX idx_stock_price_records_symbol ON stock_price_records (symbol);
@@ -0,0 +1,13 @@
+CREATE TABLE stock_daily_analytics (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(10),
+    date DATETIME,
+    min_price DECIMAL,
+    max_price DECIMAL,
+    avg_price DECIMAL,
+    total_volume INTEGER,
+    price_changes INTEGER,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE UNIQUE INDEX idx_stock_daily_analytics_symbol_date ON stock_daily_analytics (symbol, date);
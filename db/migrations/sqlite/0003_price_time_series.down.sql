@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS stock_price_bars_1d;
+DROP TABLE IF EXISTS stock_price_bars_1h;
+DROP TABLE IF EXISTS stock_price_bars_1m;
+
+DROP INDEX IF EXISTS idx_stock_price_records_symbol_timestamp;
+CREATE INDEX idx_stock_price_records_symbol ON stock_price_records (symbol);
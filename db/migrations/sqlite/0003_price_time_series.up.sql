@@ -0,0 +1,39 @@
+-- SQLite has no partitioning; retention deletes rows instead of dropping partitions
+DROP INDEX IF EXISTS idx_stock_price_records_symbol;
+CREATE INDEX idx_stock_price_records_symbol_timestamp ON stock_price_records (symbol, "timestamp");
+
+CREATE TABLE stock_price_bars_1m (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(10) NOT NULL,
+    bucket DATETIME NOT NULL,
+    open DECIMAL,
+    high DECIMAL,
+    low DECIMAL,
+    close DECIMAL,
+    count INTEGER,
+    CONSTRAINT uni_stock_price_bars_1m_symbol_bucket UNIQUE (symbol, bucket)
+);
+
+CREATE TABLE stock_price_bars_1h (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(10) NOT NULL,
+    bucket DATETIME NOT NULL,
+    open DECIMAL,
+    high DECIMAL,
+    low DECIMAL,
+    close DECIMAL,
+    count INTEGER,
+    CONSTRAINT uni_stock_price_bars_1h_symbol_bucket UNIQUE (symbol, bucket)
+);
+
+CREATE TABLE stock_price_bars_1d (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(10) NOT NULL,
+    bucket DATETIME NOT NULL,
+    open DECIMAL,
+    high DECIMAL,
+    low DECIMAL,
+    close DECIMAL,
+    count INTEGER,
+    CONSTRAINT uni_stock_price_bars_1d_symbol_bucket UNIQUE (symbol, bucket)
+);
@@ -0,0 +1,17 @@
+CREATE TABLE transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    portfolio_id INTEGER NOT NULL,
+    type VARCHAR(10) NOT NULL,
+    symbol VARCHAR(10),
+    quantity DECIMAL NOT NULL DEFAULT 0,
+    price DECIMAL NOT NULL DEFAULT 0,
+    fee DECIMAL NOT NULL DEFAULT 0,
+    amount DECIMAL NOT NULL DEFAULT 0,
+    currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    lot_id INTEGER,
+    trade_date DATETIME NOT NULL,
+    created_at DATETIME,
+    CONSTRAINT fk_portfolios_transactions FOREIGN KEY (portfolio_id) REFERENCES portfolios (id),
+    CONSTRAINT fk_transactions_lot FOREIGN KEY (lot_id) REFERENCES transactions (id)
+);
+CREATE INDEX idx_transactions_portfolio_trade_date ON transactions (portfolio_id, trade_date);
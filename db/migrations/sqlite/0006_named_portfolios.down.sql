@@ -0,0 +1,10 @@
+-- Fails while any user still has more than one portfolio
+CREATE TABLE portfolios_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    CONSTRAINT uni_portfolios_user_id UNIQUE (user_id),
+    CONSTRAINT fk_users_portfolio FOREIGN KEY (user_id) REFERENCES users (id)
+);
+INSERT INTO portfolios_old (id, user_id) SELECT id, user_id FROM portfolios;
+DROP TABLE portfolios;
+ALTER TABLE portfolios_old RENAME TO portfolios;
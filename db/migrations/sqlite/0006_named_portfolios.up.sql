@@ -0,0 +1,13 @@
+-- Users may keep several named portfolios and watchlists. SQLite cannot drop
+-- the unique constraint on user_id, so the table is rebuilt.
+CREATE TABLE portfolios_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    name VARCHAR(100) NOT NULL DEFAULT 'Default',
+    kind VARCHAR(10) NOT NULL DEFAULT 'portfolio',
+    CONSTRAINT uni_portfolios_user_id_name UNIQUE (user_id, name),
+    CONSTRAINT fk_users_portfolio FOREIGN KEY (user_id) REFERENCES users (id)
+);
+INSERT INTO portfolios_new (id, user_id) SELECT id, user_id FROM portfolios;
+DROP TABLE portfolios;
+ALTER TABLE portfolios_new RENAME TO portfolios;
@@ -0,0 +1,4 @@
+ALTER TABLE alerts DROP COLUMN message;
+ALTER TABLE alerts DROP COLUMN portfolio_id;
+ALTER TABLE alerts DROP COLUMN kind;
+DROP TABLE IF EXISTS portfolio_alert_rules;
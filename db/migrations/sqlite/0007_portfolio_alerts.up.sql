@@ -0,0 +1,15 @@
+CREATE TABLE portfolio_alert_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    portfolio_id INTEGER NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    threshold DECIMAL NOT NULL,
+    peak DECIMAL NOT NULL DEFAULT 0,
+    created_at DATETIME,
+    CONSTRAINT fk_portfolios_alert_rules FOREIGN KEY (portfolio_id) REFERENCES portfolios (id)
+);
+CREATE INDEX idx_portfolio_alert_rules_portfolio_id ON portfolio_alert_rules (portfolio_id);
+
+-- Alerts are no longer only about a stock crossing its threshold
+ALTER TABLE alerts ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'THRESHOLD';
+ALTER TABLE alerts ADD COLUMN portfolio_id INTEGER;
+ALTER TABLE alerts ADD COLUMN message TEXT;
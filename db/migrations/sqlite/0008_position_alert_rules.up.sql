@@ -0,0 +1,13 @@
+CREATE TABLE position_alert_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    portfolio_id INTEGER NOT NULL,
+    symbol VARCHAR(10) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    unit VARCHAR(10) NOT NULL DEFAULT 'PERCENT',
+    value DECIMAL NOT NULL,
+    high_water DECIMAL NOT NULL DEFAULT 0,
+    triggered BOOLEAN NOT NULL DEFAULT 0,
+    created_at DATETIME,
+    CONSTRAINT fk_portfolios_position_alert_rules FOREIGN KEY (portfolio_id) REFERENCES portfolios (id)
+);
+CREATE INDEX idx_position_alert_rules_portfolio_symbol ON position_alert_rules (portfolio_id, symbol);
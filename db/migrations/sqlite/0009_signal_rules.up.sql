@@ -0,0 +1,11 @@
+CREATE TABLE signal_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    symbol VARCHAR(10) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    "from" VARCHAR(10) NOT NULL DEFAULT '',
+    "to" VARCHAR(10) NOT NULL DEFAULT '',
+    created_at DATETIME,
+    CONSTRAINT fk_users_signal_rules FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX idx_signal_rules_user_id ON signal_rules (user_id);
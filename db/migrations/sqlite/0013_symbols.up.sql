@@ -0,0 +1,13 @@
+-- Reference data on the symbols prices can be fetched for; the API seeds it
+-- from the bundled listing and adds the provider's search results
+CREATE TABLE symbols (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    symbol VARCHAR(10) NOT NULL,
+    name VARCHAR(200) NOT NULL DEFAULT '',
+    exchange VARCHAR(10) NOT NULL DEFAULT '',
+    currency VARCHAR(3) NOT NULL DEFAULT '',
+    type VARCHAR(20) NOT NULL DEFAULT '',
+    sector VARCHAR(50) NOT NULL DEFAULT '',
+    updated_at DATETIME
+);
+CREATE UNIQUE INDEX idx_symbols_symbol ON symbols (symbol);
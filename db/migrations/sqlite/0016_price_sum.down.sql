@@ -0,0 +1 @@
+ALTER TABLE stock_daily_analytics DROP COLUMN price_sum;
@@ -0,0 +1,3 @@
+-- The lots a sale closes, and so a portfolio's positions and realized gains,
+-- follow the portfolio's cost method
+ALTER TABLE portfolios ADD COLUMN cost_method VARCHAR(10) NOT NULL DEFAULT 'fifo';
@@ -0,0 +1,7 @@
+//go:build cgo
+
+package db
+
+// sqliteAvailable reports whether this build can open SQLite databases; the
+// SQLite driver is C code and needs cgo
+const sqliteAvailable = true
@@ -0,0 +1,30 @@
+package events
+
+import "time"
+
+// Retry delays of a failing Kafka read or write
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// Backoff spaces out the retries of a failing Kafka call, doubling the delay
+// from 100ms up to 30s. The zero value is ready to use.
+type Backoff struct {
+	delay time.Duration
+}
+
+// Next returns how long to wait before the next retry
+func (b *Backoff) Next() time.Duration {
+	if b.delay == 0 {
+		b.delay = minBackoff
+	}
+	delay := b.delay
+	b.delay = min(2*delay, maxBackoff)
+	return delay
+}
+
+// Reset starts over from the shortest delay after a call succeeds
+func (b *Backoff) Reset() {
+	b.delay = 0
+}
@@ -0,0 +1,25 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDoublesUpToTheLimit(t *testing.T) {
+	var b Backoff
+	var delays []time.Duration
+	for i := 0; i < 11; i++ {
+		delays = append(delays, b.Next())
+	}
+	if delays[0] != 100*time.Millisecond || delays[1] != 200*time.Millisecond || delays[2] != 400*time.Millisecond {
+		t.Errorf("Expected the delay to double from 100ms, got %v", delays[:3])
+	}
+	if delays[9] != 30*time.Second || delays[10] != 30*time.Second {
+		t.Errorf("Expected the delay to stop at 30s, got %v", delays[9:])
+	}
+
+	b.Reset()
+	if d := b.Next(); d != 100*time.Millisecond {
+		t.Errorf("Expected 100ms after a reset, got %v", d)
+	}
+}
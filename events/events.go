@@ -0,0 +1,80 @@
+// Package events holds the Kafka topics, message schemas and retry backoff
+// shared between the API and the consumers
+package events
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Kafka topics
+const (
+	TopicStockPrices = "stock_prices"
+	TopicRuleChanges = "rule_changes"
+	TopicSignals     = "stock_signals"
+	TopicQuarantine  = "stock_prices_quarantine"
+)
+
+// StockPrice is a price tick on the stock prices topic. Prices are JSON
+// numbers and are read as decimals, so 150.10 stays exactly 150.10.
+type StockPrice struct {
+	Symbol string          `json:"symbol"`
+	Price  decimal.Decimal `json:"price"`
+	Time   time.Time       `json:"time"`
+	// Replay marks history republished by the backfill command: analytics
+	// count it, but it raises no alerts and is already stored
+	Replay bool `json:"replay,omitempty"`
+}
+
+// Reasons a price is quarantined for
+const (
+	QuarantineNonPositive = "non_positive" // zero or negative
+	QuarantineSpike       = "spike"        // a move far beyond the symbol's recent volatility
+	QuarantineStale       = "stale"        // the provider's time and price have not changed
+)
+
+// QuarantinedPrice is a price the fetcher held back from the stock prices
+// topic because it failed a data quality check
+type QuarantinedPrice struct {
+	StockPrice
+	Reason    string    `json:"reason"` // one of the Quarantine reasons
+	Detail    string    `json:"detail"`
+	QuoteTime time.Time `json:"quote_time,omitempty"` // the provider's time of the price
+}
+
+// Rule change operations
+const (
+	OpUpsert = "upsert"
+	OpDelete = "delete"
+	// OpReload asks consumers to reload every rule from the database; it is
+	// sent for rules other than stock thresholds, which carry more state
+	OpReload = "reload"
+)
+
+// RuleChange announces that an alert rule was created, changed or removed,
+// so consumers holding rules in memory can update them without a reload
+type RuleChange struct {
+	Op          string          `json:"op"`
+	StockID     uint            `json:"stock_id"`
+	PortfolioID uint            `json:"portfolio_id"`
+	UserID      uint            `json:"user_id"`
+	Symbol      string          `json:"symbol"`
+	Threshold   decimal.Decimal `json:"threshold"`
+	Time        time.Time       `json:"time"`
+	// Reset lists, with OpReload, the symbols whose rule state held in memory
+	// is void, e.g. in pre-split prices; it is taken from the database instead
+	Reset []string `json:"reset,omitempty"`
+}
+
+// SignalEvent is an indicator event of the analytics consumer: a change of the
+// moving-average signal, a crossover, or RSI or price leaving its usual range
+type SignalEvent struct {
+	Symbol string          `json:"symbol"`
+	Type   string          `json:"type"` // a models.SignalType
+	From   string          `json:"from,omitempty"`
+	To     string          `json:"to,omitempty"`
+	Price  decimal.Decimal `json:"price"`
+	Value  float64         `json:"value"` // the indicator behind the event: Avg5, RSI or the band crossed
+	Time   time.Time       `json:"time"`
+}
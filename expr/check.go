@@ -0,0 +1,157 @@
+package expr
+
+import "fmt"
+
+type valueType int
+
+const (
+	typeNumber valueType = iota + 1
+	typeBool
+)
+
+func (t valueType) String() string {
+	if t == typeBool {
+		return "boolean"
+	}
+	return "number"
+}
+
+// variables maps each variable to the number of prices it needs
+var variables = map[string]int{
+	"price":  1, // the latest price
+	"prev":   2, // the price before it
+	"change": 2, // percent change from prev to price
+}
+
+// indicatorWindows maps each indicator function to the number of prices it needs
+// for a period
+var indicatorWindows = map[string]func(period int) int{
+	"sma":      func(n int) int { return n },
+	"rsi":      func(n int) int { return n + 1 },
+	"bb_upper": func(n int) int { return n },
+	"bb_lower": func(n int) int { return n },
+	"high":     func(n int) int { return n },
+	"low":      func(n int) int { return n },
+}
+
+// mathFunctions maps each function on numbers to its number of arguments
+var mathFunctions = map[string]int{
+	"abs": 1,
+	"min": 2,
+	"max": 2,
+}
+
+// checker types a tree and works out how many prices it needs
+type checker struct {
+	window int
+}
+
+func (c *checker) need(n int) {
+	c.window = max(c.window, n)
+}
+
+func (c *checker) check(n node) (valueType, error) {
+	switch n := n.(type) {
+	case *numberLit:
+		return typeNumber, nil
+	case *boolLit:
+		return typeBool, nil
+	case *variable:
+		needed, ok := variables[n.name]
+		if !ok {
+			return 0, &Error{Pos: n.at, Msg: fmt.Sprintf("unknown variable %q (use price, prev or change)", n.name)}
+		}
+		c.need(needed)
+		return typeNumber, nil
+	case *call:
+		return c.checkCall(n)
+	case *unary:
+		want := typeNumber
+		if n.op == "!" {
+			want = typeBool
+		}
+		if err := c.expect(n.x, want, fmt.Sprintf("operand of %q", n.op)); err != nil {
+			return 0, err
+		}
+		return want, nil
+	case *binary:
+		return c.checkBinary(n)
+	}
+	return 0, &Error{Pos: n.position(), Msg: "unsupported expression"}
+}
+
+// expect checks that a node has the wanted type
+func (c *checker) expect(n node, want valueType, what string) error {
+	got, err := c.check(n)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return &Error{Pos: n.position(), Msg: fmt.Sprintf("%s must be a %s, not a %s", what, want, got)}
+	}
+	return nil
+}
+
+func (c *checker) checkCall(n *call) (valueType, error) {
+	if window, ok := indicatorWindows[n.name]; ok {
+		if len(n.args) != 1 {
+			return 0, &Error{Pos: n.at, Msg: fmt.Sprintf("%s takes one period, got %d arguments", n.name, len(n.args))}
+		}
+		lit, ok := n.args[0].(*numberLit)
+		if !ok || lit.value != float64(int(lit.value)) || lit.value < 1 || lit.value > MaxPeriod {
+			return 0, &Error{Pos: n.args[0].position(), Msg: fmt.Sprintf("period of %s must be a whole number from 1 to %d", n.name, MaxPeriod)}
+		}
+		c.need(window(int(lit.value)))
+		return typeNumber, nil
+	}
+
+	arity, ok := mathFunctions[n.name]
+	if !ok {
+		return 0, &Error{Pos: n.at, Msg: fmt.Sprintf("unknown function %q", n.name)}
+	}
+	if len(n.args) != arity {
+		return 0, &Error{Pos: n.at, Msg: fmt.Sprintf("%s takes %d arguments, got %d", n.name, arity, len(n.args))}
+	}
+	for i, arg := range n.args {
+		if err := c.expect(arg, typeNumber, fmt.Sprintf("argument %d of %s", i+1, n.name)); err != nil {
+			return 0, err
+		}
+	}
+	return typeNumber, nil
+}
+
+func (c *checker) checkBinary(n *binary) (valueType, error) {
+	switch n.op {
+	case "&&", "||":
+		n.operand = typeBool
+		if err := c.expect(n.x, typeBool, fmt.Sprintf("left side of %q", n.op)); err != nil {
+			return 0, err
+		}
+		if err := c.expect(n.y, typeBool, fmt.Sprintf("right side of %q", n.op)); err != nil {
+			return 0, err
+		}
+		return typeBool, nil
+	case "==", "!=":
+		x, err := c.check(n.x)
+		if err != nil {
+			return 0, err
+		}
+		n.operand = x
+		if err := c.expect(n.y, x, fmt.Sprintf("right side of %q", n.op)); err != nil {
+			return 0, err
+		}
+		return typeBool, nil
+	}
+
+	n.operand = typeNumber
+	if err := c.expect(n.x, typeNumber, fmt.Sprintf("left side of %q", n.op)); err != nil {
+		return 0, err
+	}
+	if err := c.expect(n.y, typeNumber, fmt.Sprintf("right side of %q", n.op)); err != nil {
+		return 0, err
+	}
+	if precedence[n.op] == precedence["<"] {
+		return typeBool, nil
+	}
+	return typeNumber, nil
+}
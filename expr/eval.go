@@ -0,0 +1,168 @@
+package expr
+
+import (
+	"math"
+	"slices"
+
+	"stock-alerts/indicators"
+)
+
+// bollingerWidth is the number of standard deviations of bb_upper and bb_lower
+const bollingerWidth = 2
+
+// Eval evaluates the condition against a symbol's latest prices, oldest first.
+// It returns ErrNotReady when there are fewer than Window prices.
+func (p *Program) Eval(prices []float64) (bool, error) {
+	if len(prices) < p.window {
+		return false, ErrNotReady
+	}
+	return evalBool(p.root, prices)
+}
+
+func evalBool(n node, prices []float64) (bool, error) {
+	switch n := n.(type) {
+	case *boolLit:
+		return n.value, nil
+	case *unary:
+		x, err := evalBool(n.x, prices)
+		return !x, err
+	case *binary:
+		switch n.op {
+		case "&&", "||":
+			x, err := evalBool(n.x, prices)
+			if err != nil {
+				return false, err
+			}
+			if x == (n.op == "||") {
+				return x, nil // short circuit
+			}
+			return evalBool(n.y, prices)
+		}
+		if n.operand == typeBool {
+			x, err := evalBool(n.x, prices)
+			if err != nil {
+				return false, err
+			}
+			y, err := evalBool(n.y, prices)
+			if err != nil {
+				return false, err
+			}
+			return (x == y) == (n.op == "=="), nil
+		}
+		x, err := evalNumber(n.x, prices)
+		if err != nil {
+			return false, err
+		}
+		y, err := evalNumber(n.y, prices)
+		if err != nil {
+			return false, err
+		}
+		switch n.op {
+		case "==":
+			return x == y, nil
+		case "!=":
+			return x != y, nil
+		case "<":
+			return x < y, nil
+		case "<=":
+			return x <= y, nil
+		case ">":
+			return x > y, nil
+		case ">=":
+			return x >= y, nil
+		}
+	}
+	return false, &Error{Pos: n.position(), Msg: "not a condition"}
+}
+
+func evalNumber(n node, prices []float64) (float64, error) {
+	switch n := n.(type) {
+	case *numberLit:
+		return n.value, nil
+	case *variable:
+		price := prices[len(prices)-1]
+		switch n.name {
+		case "price":
+			return price, nil
+		case "prev":
+			return prices[len(prices)-2], nil
+		case "change":
+			prev := prices[len(prices)-2]
+			if prev == 0 {
+				return 0, &Error{Pos: n.at, Msg: "change from a zero price"}
+			}
+			return (price/prev - 1) * 100, nil
+		}
+	case *call:
+		return evalCall(n, prices)
+	case *unary:
+		x, err := evalNumber(n.x, prices)
+		return -x, err
+	case *binary:
+		x, err := evalNumber(n.x, prices)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evalNumber(n.y, prices)
+		if err != nil {
+			return 0, err
+		}
+		switch n.op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/":
+			if y == 0 {
+				return 0, &Error{Pos: n.at, Msg: "division by zero"}
+			}
+			return x / y, nil
+		}
+	}
+	return 0, &Error{Pos: n.position(), Msg: "not a number"}
+}
+
+func evalCall(n *call, prices []float64) (float64, error) {
+	if _, ok := indicatorWindows[n.name]; ok {
+		period := int(n.args[0].(*numberLit).value)
+		recent := prices[len(prices)-period:]
+		switch n.name {
+		case "sma":
+			v, _ := indicators.SMA(prices, period)
+			return v, nil
+		case "rsi":
+			v, _ := indicators.RSI(prices, period)
+			return v, nil
+		case "bb_upper":
+			band, _ := indicators.Bollinger(prices, period, bollingerWidth)
+			return band.Upper, nil
+		case "bb_lower":
+			band, _ := indicators.Bollinger(prices, period, bollingerWidth)
+			return band.Lower, nil
+		case "high":
+			return slices.Max(recent), nil
+		case "low":
+			return slices.Min(recent), nil
+		}
+	}
+
+	args := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		v, err := evalNumber(arg, prices)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+	switch n.name {
+	case "abs":
+		return math.Abs(args[0]), nil
+	case "min":
+		return math.Min(args[0], args[1]), nil
+	case "max":
+		return math.Max(args[0], args[1]), nil
+	}
+	return 0, &Error{Pos: n.at, Msg: "unknown function"}
+}
@@ -0,0 +1,71 @@
+// Package expr is a small, sandboxed language for custom alert conditions
+// such as `price > sma(20) * 1.05 && rsi(14) < 70`. A condition is compiled
+// once, which parses and type checks it, and is then evaluated against the
+// recent prices of a symbol. There are no loops, assignments or side effects.
+package expr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxLength bounds the source of a condition
+const MaxLength = 500
+
+// MaxPeriod bounds the period of an indicator function
+const MaxPeriod = 200
+
+// Error is a compile or runtime error at a 1-based column of the condition
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Pos, e.Msg)
+}
+
+// ErrNotReady is returned by Eval when there are fewer prices than the
+// condition's indicators need
+var ErrNotReady = errors.New("not enough price history")
+
+// Program is a compiled condition
+type Program struct {
+	src    string
+	root   node
+	window int
+}
+
+// Compile parses and type checks a condition, which must be boolean
+func Compile(src string) (*Program, error) {
+	if len(src) > MaxLength {
+		return nil, &Error{Pos: MaxLength + 1, Msg: fmt.Sprintf("condition is longer than %d characters", MaxLength)}
+	}
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parse(tokens)
+	if err != nil {
+		return nil, err
+	}
+	c := &checker{window: 1}
+	typ, err := c.check(root)
+	if err != nil {
+		return nil, err
+	}
+	if typ != typeBool {
+		return nil, &Error{Pos: root.position(), Msg: "condition must be true or false, not a number"}
+	}
+	return &Program{src: src, root: root, window: c.window}, nil
+}
+
+// Window returns how many of the latest prices the condition needs
+func (p *Program) Window() int {
+	return p.window
+}
+
+// String returns the source of the condition
+func (p *Program) String() string {
+	return p.src
+}
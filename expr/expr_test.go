@@ -0,0 +1,96 @@
+package expr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompileAndEval(t *testing.T) {
+	// sma(5) of the last five prices is 102, rsi(4) is 75
+	prices := []float64{100, 101, 100, 102, 103, 104}
+
+	cases := []struct {
+		src  string
+		want bool
+	}{
+		{"price > sma(5)", true},
+		{"price > sma(5) * 1.05", false},
+		{"price > sma(5) * 1.05 || rsi(4) >= 75", true},
+		{"rsi(4) < 70 && price > 100", false},
+		{"!(price < prev)", true},
+		{"change > 0.9 && change < 1", true},
+		{"high(6) == price && low(6) == 100", true},
+		{"abs(prev - price) <= 1 && max(price, 200) == 200", true},
+		{"price < bb_upper(5) == true", true},
+		{"-price < -103.5", true},
+		{"1 + 2 * 3 == 7", true},
+	}
+	for _, tc := range cases {
+		program, err := Compile(tc.src)
+		if err != nil {
+			t.Errorf("Expected %q to compile, got %v", tc.src, err)
+			continue
+		}
+		got, err := program.Eval(prices)
+		if err != nil || got != tc.want {
+			t.Errorf("Expected %q to be %v, got %v (%v)", tc.src, tc.want, got, err)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	cases := []struct {
+		src string
+		pos int
+		msg string
+	}{
+		{"price > smaa(20)", 9, `unknown function "smaa"`},
+		{"price > volume", 9, `unknown variable "volume"`},
+		{"price + 1", 7, "must be true or false"},
+		{"price > sma(20) &&", 19, "found end of input"},
+		{"price > sma(x)", 13, "period of sma"},
+		{"price > sma(2.5)", 13, "period of sma"},
+		{"price > sma(20, 5)", 9, "one period"},
+		{"(price > 1", 11, `expected ")"`},
+		{"price > 1 1", 11, "after the end"},
+		{"price # 1", 7, "unexpected character"},
+		{"price && true", 1, `left side of "&&" must be a boolean`},
+		{"!price", 2, `operand of "!" must be a boolean`},
+		{"price == true", 10, `right side of "==" must be a number`},
+		{"1..2 > 1", 1, "malformed number"},
+	}
+	for _, tc := range cases {
+		_, err := Compile(tc.src)
+		var exprErr *Error
+		if !errors.As(err, &exprErr) {
+			t.Errorf("Expected a compile error for %q, got %v", tc.src, err)
+			continue
+		}
+		if exprErr.Pos != tc.pos || !strings.Contains(exprErr.Msg, tc.msg) {
+			t.Errorf("Expected %q at column %d for %q, got %v", tc.msg, tc.pos, tc.src, err)
+		}
+	}
+
+	if _, err := Compile(strings.Repeat("(", 100) + "true" + strings.Repeat(")", 100)); err == nil {
+		t.Error("Expected deep nesting to be rejected")
+	}
+	if _, err := Compile(strings.Repeat("price > 1 && ", 50) + "true"); err == nil {
+		t.Error("Expected an overlong condition to be rejected")
+	}
+}
+
+func TestWindowAndNotReady(t *testing.T) {
+	program, _ := Compile("rsi(14) < 30 || price < sma(20)")
+	if program.Window() != 20 {
+		t.Errorf("Expected a window of 20, got %d", program.Window())
+	}
+	if _, err := program.Eval(make([]float64, 19)); !errors.Is(err, ErrNotReady) {
+		t.Errorf("Expected ErrNotReady, got %v", err)
+	}
+
+	program, _ = Compile("price / prev > 1")
+	if _, err := program.Eval([]float64{0, 1}); err == nil || !strings.Contains(err.Error(), "division by zero") {
+		t.Errorf("Expected a division by zero error, got %v", err)
+	}
+}
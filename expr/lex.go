@@ -0,0 +1,100 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+// token is a lexeme of a condition; pos is its 1-based column
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	num  float64
+}
+
+// describe names a token for error messages
+func (t token) describe() string {
+	if t.kind == tokEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators, longest first so "<=" is not read as "<"
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "!"}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdentStart(c byte) bool { return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+// lex splits a condition into tokens, ending with tokEOF
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			text := src[start:i]
+			num, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, &Error{Pos: start + 1, Msg: fmt.Sprintf("malformed number %q", text)}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, pos: start + 1, num: num})
+			continue
+		case isIdentStart(c):
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start + 1})
+			continue
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: start + 1})
+			i++
+			continue
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: start + 1})
+			i++
+			continue
+		case c == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: start + 1})
+			i++
+			continue
+		}
+
+		matched := false
+		for _, op := range operators {
+			if strings.HasPrefix(src[i:], op) {
+				tokens = append(tokens, token{kind: tokOp, text: op, pos: start + 1})
+				i += len(op)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, &Error{Pos: start + 1, Msg: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src) + 1}), nil
+}
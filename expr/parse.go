@@ -0,0 +1,176 @@
+package expr
+
+import "fmt"
+
+// node is a parsed expression
+type node interface {
+	position() int
+}
+
+type numberLit struct {
+	at    int
+	value float64
+}
+
+type boolLit struct {
+	at    int
+	value bool
+}
+
+type variable struct {
+	at   int
+	name string
+}
+
+type call struct {
+	at   int
+	name string
+	args []node
+}
+
+type unary struct {
+	at int
+	op string
+	x  node
+}
+
+type binary struct {
+	at      int
+	op      string
+	x, y    node
+	operand valueType // type of x and y, set by the checker
+}
+
+func (n *numberLit) position() int { return n.at }
+func (n *boolLit) position() int   { return n.at }
+func (n *variable) position() int  { return n.at }
+func (n *call) position() int      { return n.at }
+func (n *unary) position() int     { return n.at }
+func (n *binary) position() int    { return n.at }
+
+// precedence of the binary operators; higher binds tighter
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5,
+}
+
+// maxDepth bounds the nesting of a condition
+const maxDepth = 32
+
+type parser struct {
+	tokens []token
+	next   int
+	depth  int
+}
+
+func (p *parser) peek() token { return p.tokens[p.next] }
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokEOF {
+		p.next++
+	}
+	return t
+}
+
+// parse turns tokens into a tree, failing on anything after the expression
+func parse(tokens []token) (node, error) {
+	p := &parser{tokens: tokens}
+	n, err := p.expression(1)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s after the end of the expression", t.describe())}
+	}
+	return n, nil
+}
+
+// expression parses binary operators of at least the given precedence
+func (p *parser) expression(minPrec int) (node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if t.kind != tokOp || !ok || prec < minPrec {
+			return x, nil
+		}
+		p.advance()
+		y, err := p.expression(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{at: t.pos, op: t.text, x: x, y: y}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, &Error{Pos: p.peek().pos, Msg: "expression is nested too deeply"}
+	}
+
+	t := p.peek()
+	if t.kind == tokOp && (t.text == "!" || t.text == "-") {
+		p.advance()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{at: t.pos, op: t.text, x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokNumber:
+		return &numberLit{at: t.pos, value: t.num}, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return &boolLit{at: t.pos, value: t.text == "true"}, nil
+		}
+		if p.peek().kind != tokLParen {
+			return &variable{at: t.pos, name: t.text}, nil
+		}
+		p.advance()
+		c := &call{at: t.pos, name: t.text}
+		if p.peek().kind == tokRParen {
+			p.advance()
+			return c, nil
+		}
+		for {
+			arg, err := p.expression(1)
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, arg)
+			sep := p.advance()
+			if sep.kind == tokRParen {
+				return c, nil
+			}
+			if sep.kind != tokComma {
+				return nil, &Error{Pos: sep.pos, Msg: fmt.Sprintf("expected \",\" or \")\" but found %s", sep.describe())}
+			}
+		}
+	case tokLParen:
+		x, err := p.expression(1)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokRParen {
+			return nil, &Error{Pos: closing.pos, Msg: fmt.Sprintf("expected \")\" but found %s", closing.describe())}
+		}
+		return x, nil
+	}
+	return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("expected a number, variable or function but found %s", t.describe())}
+}
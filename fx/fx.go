@@ -0,0 +1,130 @@
+// Package fx converts amounts between currencies at the latest rates of the
+// FX pairs the fetcher publishes alongside stock prices. A pair's symbol is
+// the two ISO codes run together: GBPUSD is the price of one GBP in USD.
+package fx
+
+import (
+	"sort"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// Pair returns the symbol of the rate of one unit of from in to
+func Pair(from, to string) string {
+	return from + to
+}
+
+// minorUnits are the currencies some exchanges quote prices in, e.g. pence
+// on the London Stock Exchange, with their major currency
+var minorUnits = map[string]struct {
+	major  string
+	factor decimal.Decimal
+}{
+	"GBX": {"GBP", hundredth},
+	"GBp": {"GBP", hundredth},
+	"ZAC": {"ZAR", hundredth},
+	"ILA": {"ILS", hundredth},
+}
+
+var hundredth = decimal.New(1, -2)
+
+// Major returns the currency a minor unit belongs to and how many of it one
+// unit is worth; other currencies are returned as they are with a factor of 1
+func Major(currency string) (string, decimal.Decimal) {
+	if minor, ok := minorUnits[currency]; ok {
+		return minor.major, minor.factor
+	}
+	return currency, decimal.NewFromInt(1)
+}
+
+// Valid reports whether a currency is a three letter code in upper case
+func Valid(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+	for _, c := range currency {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Rates are the latest rates by pair symbol
+type Rates map[string]decimal.Decimal
+
+// FromPrices picks the rates out of the latest prices by symbol; prices of
+// other symbols are harmless, as no pair symbol is also a ticker
+func FromPrices(prices map[string]models.StockPriceRecord) Rates {
+	rates := Rates{}
+	for symbol, record := range prices {
+		if record.Price.IsPositive() {
+			rates[symbol] = record.Price
+		}
+	}
+	return rates
+}
+
+// crossCurrency is the currency conversions go through when two currencies
+// have no pair of their own
+const crossCurrency = "USD"
+
+// Rate returns the rate from one currency to another: a direct pair, its
+// inverse, or the cross through USD. ok is false when the rates do not link them.
+func (r Rates) Rate(from, to string) (decimal.Decimal, bool) {
+	from, fromFactor := Major(from)
+	to, toFactor := Major(to)
+	rate, ok := r.major(from, to)
+	if !ok {
+		return decimal.Zero, false
+	}
+	return rate.Mul(fromFactor).Div(toFactor), true
+}
+
+func (r Rates) major(from, to string) (decimal.Decimal, bool) {
+	if from == to {
+		return decimal.NewFromInt(1), true
+	}
+	if rate, ok := r[Pair(from, to)]; ok {
+		return rate, true
+	}
+	if rate, ok := r[Pair(to, from)]; ok {
+		return decimal.NewFromInt(1).Div(rate), true
+	}
+	if from != crossCurrency && to != crossCurrency {
+		first, ok1 := r.major(from, crossCurrency)
+		second, ok2 := r.major(crossCurrency, to)
+		if ok1 && ok2 {
+			return first.Mul(second), true
+		}
+	}
+	return decimal.Zero, false
+}
+
+// Convert converts an amount between currencies
+func (r Rates) Convert(amount decimal.Decimal, from, to string) (decimal.Decimal, bool) {
+	rate, ok := r.Rate(from, to)
+	return amount.Mul(rate), ok
+}
+
+// Pairs returns the pair symbols the fetcher follows to convert the
+// currencies to base, sorted
+func Pairs(currencies []string, base string) []string {
+	base, _ = Major(base)
+	seen := map[string]bool{}
+	pairs := []string{}
+	for _, currency := range currencies {
+		major, _ := Major(currency)
+		if major == base || major == "" {
+			continue
+		}
+		if pair := Pair(major, base); !seen[pair] {
+			seen[pair] = true
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.Strings(pairs)
+	return pairs
+}
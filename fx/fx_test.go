@@ -0,0 +1,60 @@
+package fx
+
+import (
+	"testing"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRate(t *testing.T) {
+	rates := Rates{"GBPUSD": decimal.RequireFromString("1.25"), "EURUSD": decimal.RequireFromString("1.1")}
+	for _, tc := range []struct {
+		from, to string
+		want     string
+	}{
+		{"USD", "USD", "1"},
+		{"GBP", "USD", "1.25"},
+		{"USD", "GBP", "0.8"},
+		{"GBX", "USD", "0.0125"},
+		{"USD", "GBX", "80"},
+		{"GBX", "GBP", "0.01"},
+		{"EUR", "GBP", "0.88"},
+	} {
+		rate, ok := rates.Rate(tc.from, tc.to)
+		if !ok || !rate.Equal(decimal.RequireFromString(tc.want)) {
+			t.Errorf("Expected %s to %s at %s, got %s (%v)", tc.from, tc.to, tc.want, rate, ok)
+		}
+	}
+	if _, ok := rates.Rate("JPY", "USD"); ok {
+		t.Errorf("Expected no JPY rate")
+	}
+	// 10 GBP at 1.25 is 12.5 USD, or 11.363636... EUR
+	if amount, ok := rates.Convert(decimal.NewFromInt(1000), "GBX", "EUR"); !ok || !amount.Round(6).Equal(decimal.RequireFromString("11.363636")) {
+		t.Errorf("Expected 1000 pence in EUR, got %s (%v)", amount, ok)
+	}
+}
+
+func TestPairs(t *testing.T) {
+	pairs := Pairs([]string{"USD", "GBX", "GBP", "EUR"}, "USD")
+	if len(pairs) != 2 || pairs[0] != "EURUSD" || pairs[1] != "GBPUSD" {
+		t.Errorf("Expected EURUSD and GBPUSD, got %v", pairs)
+	}
+	if pairs := Pairs([]string{"GBX"}, "GBP"); len(pairs) != 0 {
+		t.Errorf("Expected pence to need no pair in GBP, got %v", pairs)
+	}
+}
+
+func TestFromPricesAndValid(t *testing.T) {
+	rates := FromPrices(map[string]models.StockPriceRecord{"GBPUSD": {Price: decimal.NewFromFloat(1.25)}, "AAPL": {Price: decimal.NewFromInt(190)}, "EURUSD": {Price: decimal.NewFromInt(0)}})
+	if !rates["GBPUSD"].Equal(decimal.RequireFromString("1.25")) {
+		t.Errorf("Expected the GBPUSD rate, got %v", rates)
+	}
+	if _, ok := rates["EURUSD"]; ok {
+		t.Errorf("Expected a zero rate to be ignored")
+	}
+	if !Valid("EUR") || Valid("eur") || Valid("EURO") {
+		t.Errorf("Expected only three upper case letters to be valid")
+	}
+}
@@ -0,0 +1,90 @@
+// Package indicators computes technical indicators over a series of prices,
+// oldest first.
+package indicators
+
+import "math"
+
+// SMA returns the simple moving average of the last n prices
+func SMA(prices []float64, n int) (float64, bool) {
+	if n <= 0 || len(prices) < n {
+		return 0, false
+	}
+	sum := 0.0
+	for _, p := range prices[len(prices)-n:] {
+		sum += p
+	}
+	return sum / float64(n), true
+}
+
+// RSI returns the relative strength index over the last n price changes,
+// using simple averages of the gains and losses. It needs n+1 prices.
+func RSI(prices []float64, n int) (float64, bool) {
+	if n <= 0 || len(prices) < n+1 {
+		return 0, false
+	}
+	gains, losses := 0.0, 0.0
+	window := prices[len(prices)-n-1:]
+	for i := 1; i < len(window); i++ {
+		if change := window[i] - window[i-1]; change > 0 {
+			gains += change
+		} else {
+			losses -= change
+		}
+	}
+	if losses == 0 {
+		if gains == 0 {
+			return 50, true // a flat series is neither overbought nor oversold
+		}
+		return 100, true
+	}
+	rs := gains / losses
+	return 100 - 100/(1+rs), true
+}
+
+// Band is a Bollinger band: the moving average and k standard deviations
+// either side of it
+type Band struct {
+	Middle float64
+	Upper  float64
+	Lower  float64
+}
+
+// Bollinger returns the Bollinger band of the last n prices
+func Bollinger(prices []float64, n int, k float64) (Band, bool) {
+	mean, ok := SMA(prices, n)
+	if !ok {
+		return Band{}, false
+	}
+	variance := 0.0
+	for _, p := range prices[len(prices)-n:] {
+		variance += (p - mean) * (p - mean)
+	}
+	sd := math.Sqrt(variance / float64(n))
+	return Band{Middle: mean, Upper: mean + k*sd, Lower: mean - k*sd}, true
+}
+
+// Window keeps the most recent prices of a series up to a fixed size
+type Window struct {
+	size   int
+	prices []float64
+}
+
+// NewWindow returns an empty window keeping up to size prices
+func NewWindow(size int) *Window {
+	return &Window{size: size, prices: make([]float64, 0, size)}
+}
+
+// Push appends a price, dropping the oldest one when the window is full
+func (w *Window) Push(price float64) {
+	if len(w.prices) == w.size {
+		copy(w.prices, w.prices[1:])
+		w.prices = w.prices[:w.size-1]
+	}
+	w.prices = append(w.prices, price)
+}
+
+// Prices returns the prices in the window, oldest first. The slice is
+// reused by the next Push.
+func (w *Window) Prices() []float64 {
+	return w.prices
+}
@@ -0,0 +1,51 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSMA(t *testing.T) {
+	prices := []float64{1, 2, 3, 4, 5, 6}
+	if avg, ok := SMA(prices, 3); !ok || avg != 5 {
+		t.Errorf("Expected SMA(3) of 5, got %v %v", avg, ok)
+	}
+	if _, ok := SMA(prices, 7); ok {
+		t.Error("Expected SMA to need n prices")
+	}
+}
+
+func TestRSI(t *testing.T) {
+	rising := []float64{1, 2, 3, 4, 5}
+	if rsi, ok := RSI(rising, 4); !ok || rsi != 100 {
+		t.Errorf("Expected RSI 100 on a rising series, got %v %v", rsi, ok)
+	}
+	if rsi, _ := RSI([]float64{5, 5, 5}, 2); rsi != 50 {
+		t.Errorf("Expected RSI 50 on a flat series, got %v", rsi)
+	}
+	// Gains of 2 and losses of 1 give RS 2 and RSI 66.67
+	if rsi, _ := RSI([]float64{10, 12, 11}, 2); math.Abs(rsi-200.0/3) > 1e-9 {
+		t.Errorf("Expected RSI 66.67, got %v", rsi)
+	}
+	if _, ok := RSI(rising, 5); ok {
+		t.Error("Expected RSI to need n+1 prices")
+	}
+}
+
+func TestBollinger(t *testing.T) {
+	band, ok := Bollinger([]float64{2, 4, 4, 4, 5, 5, 7, 9}, 8, 2)
+	if !ok || band.Middle != 5 || band.Upper != 9 || band.Lower != 1 {
+		t.Errorf("Expected band 1/5/9, got %+v", band)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w := NewWindow(3)
+	for _, p := range []float64{1, 2, 3, 4} {
+		w.Push(p)
+	}
+	prices := w.Prices()
+	if len(prices) != 3 || prices[0] != 2 || prices[2] != 4 {
+		t.Errorf("Expected the last 3 prices, got %v", prices)
+	}
+}
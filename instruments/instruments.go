@@ -0,0 +1,83 @@
+// Package instruments tells the kinds of instrument apart by their symbols.
+// A pair's symbol is its two codes run together, like the FX pairs of the fx
+// package: EURUSD is one EUR in USD and BTCUSD one Bitcoin in USD. Any other
+// symbol is an equity.
+package instruments
+
+import (
+	"strings"
+
+	"stock-alerts/models"
+)
+
+// currencies are the ISO codes of the currencies pairs are quoted in
+var currencies = map[string]bool{
+	"AED": true, "ARS": true, "AUD": true, "BRL": true, "CAD": true, "CHF": true,
+	"CLP": true, "CNH": true, "CNY": true, "COP": true, "CZK": true, "DKK": true,
+	"EUR": true, "GBP": true, "HKD": true, "HUF": true, "IDR": true, "ILS": true,
+	"INR": true, "ISK": true, "JPY": true, "KRW": true, "MXN": true, "MYR": true,
+	"NOK": true, "NZD": true, "PHP": true, "PLN": true, "RON": true, "SAR": true,
+	"SEK": true, "SGD": true, "THB": true, "TRY": true, "TWD": true, "USD": true,
+	"ZAR": true,
+}
+
+// coins are the crypto currencies by code, with their names
+var coins = map[string]string{
+	"ADA":  "Cardano",
+	"AVAX": "Avalanche",
+	"BCH":  "Bitcoin Cash",
+	"BNB":  "BNB",
+	"BTC":  "Bitcoin",
+	"DOGE": "Dogecoin",
+	"DOT":  "Polkadot",
+	"ETH":  "Ethereum",
+	"LINK": "Chainlink",
+	"LTC":  "Litecoin",
+	"SOL":  "Solana",
+	"TRX":  "TRON",
+	"USDC": "USD Coin",
+	"USDT": "Tether",
+	"XLM":  "Stellar",
+	"XRP":  "XRP",
+}
+
+// Split returns the two codes of a pair symbol; ok is false for other symbols
+func Split(symbol string) (base, quote string, ok bool) {
+	symbol = strings.ToUpper(symbol)
+	if len(symbol) < 6 {
+		return "", "", false
+	}
+	base, quote = symbol[:len(symbol)-3], symbol[len(symbol)-3:]
+	if !currencies[quote] {
+		return "", "", false
+	}
+	if _, coin := coins[base]; !coin && !currencies[base] {
+		return "", "", false
+	}
+	return base, quote, true
+}
+
+// Classify returns the kind of instrument a symbol names
+func Classify(symbol string) models.InstrumentType {
+	base, _, ok := Split(symbol)
+	switch {
+	case !ok:
+		return models.InstrumentEquity
+	case currencies[base]:
+		return models.InstrumentFX
+	default:
+		return models.InstrumentCrypto
+	}
+}
+
+// Name describes a pair, e.g. "Bitcoin / USD"
+func Name(symbol string) string {
+	base, quote, ok := Split(symbol)
+	if !ok {
+		return ""
+	}
+	if name, ok := coins[base]; ok {
+		base = name
+	}
+	return base + " / " + quote
+}
@@ -0,0 +1,44 @@
+package instruments
+
+import (
+	"testing"
+
+	"stock-alerts/models"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   models.InstrumentType
+	}{
+		{"AAPL", models.InstrumentEquity},
+		{"TSCO.LON", models.InstrumentEquity},
+		{"EURUSD", models.InstrumentFX},
+		{"gbpjpy", models.InstrumentFX},
+		{"BTCUSD", models.InstrumentCrypto},
+		{"DOGEEUR", models.InstrumentCrypto},
+		// Neither half is a currency or coin this knows
+		{"ABCDEF", models.InstrumentEquity},
+		{"BTCXYZ", models.InstrumentEquity},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.symbol); got != tt.want {
+			t.Errorf("Expected %s to be %s, got %s", tt.symbol, tt.want, got)
+		}
+	}
+}
+
+func TestSplitAndName(t *testing.T) {
+	if base, quote, ok := Split("DOGEUSD"); !ok || base != "DOGE" || quote != "USD" {
+		t.Errorf("Expected DOGE and USD, got %q %q %v", base, quote, ok)
+	}
+	if _, _, ok := Split("MSFT"); ok {
+		t.Errorf("Expected MSFT not to split")
+	}
+	if name := Name("BTCUSD"); name != "Bitcoin / USD" {
+		t.Errorf("Expected Bitcoin / USD, got %q", name)
+	}
+	if name := Name("EURGBP"); name != "EUR / GBP" {
+		t.Errorf("Expected EUR / GBP, got %q", name)
+	}
+}
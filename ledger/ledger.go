@@ -0,0 +1,281 @@
+// Package ledger replays a portfolio's transactions into tax lots, positions
+// and realized gains.
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// Method picks which lots a sale closes
+type Method string
+
+const (
+	FIFO        Method = "fifo"     // oldest lots first
+	LIFO        Method = "lifo"     // newest lots first
+	SpecificLot Method = "specific" // every sale names its lot
+)
+
+// Valid reports whether the method is one of the supported ones
+func (m Method) Valid() bool {
+	return m == FIFO || m == LIFO || m == SpecificLot
+}
+
+// MethodOf returns the cost method of a portfolio, FIFO when none is stored
+func MethodOf(portfolio models.Portfolio) Method {
+	if portfolio.CostMethod == "" {
+		return FIFO
+	}
+	return Method(portfolio.CostMethod)
+}
+
+// Lot is the open remainder of a purchase
+type Lot struct {
+	TransactionID uint
+	Symbol        string
+	Currency      string
+	Acquired      time.Time
+	Quantity      decimal.Decimal
+	Cost          decimal.Decimal // of the remaining shares, including the buy fee
+}
+
+// Realization is the part of a sale that closed one lot
+type Realization struct {
+	SellID   uint
+	LotID    uint
+	Symbol   string
+	Currency string
+	Acquired time.Time
+	Sold     time.Time
+	Quantity decimal.Decimal
+	Proceeds decimal.Decimal // net of the sell fee
+	Cost     decimal.Decimal
+	Gain     decimal.Decimal
+}
+
+// LongTerm reports whether the lot was held for more than a year
+func (r Realization) LongTerm() bool {
+	return r.Sold.After(r.Acquired.AddDate(1, 0, 0))
+}
+
+// Book is the state of a ledger after replaying it
+type Book struct {
+	Lots      map[string][]Lot // open lots per symbol, oldest first
+	Realized  []Realization
+	Dividends []models.Transaction
+	Fees      []models.Transaction
+}
+
+// Replay applies the transactions in trade order and returns the resulting book.
+// It fails on a sale of more shares than are held or of an unknown lot.
+func Replay(transactions []models.Transaction, method Method) (*Book, error) {
+	if !method.Valid() {
+		return nil, fmt.Errorf("unknown cost method %q", method)
+	}
+	ordered := append([]models.Transaction{}, transactions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if !ordered[i].TradeDate.Equal(ordered[j].TradeDate) {
+			return ordered[i].TradeDate.Before(ordered[j].TradeDate)
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	book := &Book{Lots: map[string][]Lot{}}
+	for _, tx := range ordered {
+		var err error
+		switch tx.Type {
+		case models.TransactionBuy:
+			err = book.buy(tx)
+		case models.TransactionSell:
+			err = book.sell(tx, method)
+		case models.TransactionSplit:
+			err = book.split(tx)
+		case models.TransactionDividend:
+			book.Dividends = append(book.Dividends, tx)
+		case models.TransactionFee:
+			book.Fees = append(book.Fees, tx)
+		default:
+			err = fmt.Errorf("unknown transaction type %q", tx.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", tx.ID, err)
+		}
+	}
+	return book, nil
+}
+
+func (b *Book) buy(tx models.Transaction) error {
+	if !tx.Quantity.IsPositive() {
+		return fmt.Errorf("buy quantity must be positive")
+	}
+	b.Lots[tx.Symbol] = append(b.Lots[tx.Symbol], Lot{
+		TransactionID: tx.ID,
+		Symbol:        tx.Symbol,
+		Currency:      tx.Currency,
+		Acquired:      tx.TradeDate,
+		Quantity:      tx.Quantity,
+		Cost:          tx.Quantity.Mul(tx.Price).Add(tx.Fee),
+	})
+	return nil
+}
+
+func (b *Book) sell(tx models.Transaction, method Method) error {
+	if !tx.Quantity.IsPositive() {
+		return fmt.Errorf("sell quantity must be positive")
+	}
+	lots := b.Lots[tx.Symbol]
+	order, err := lotOrder(lots, tx, method)
+	if err != nil {
+		return err
+	}
+
+	// Cost and fee are shared out in proportion to the shares closed; the
+	// last part takes what is left so nothing is lost to rounding
+	remaining, fee := tx.Quantity, tx.Fee
+	for _, i := range order {
+		if !remaining.IsPositive() {
+			break
+		}
+		lot := &lots[i]
+		closed := decimal.Min(lot.Quantity, remaining)
+		share, cost := fee, lot.Cost
+		if closed.LessThan(remaining) {
+			share = tx.Fee.Mul(closed).Div(tx.Quantity)
+		}
+		if closed.LessThan(lot.Quantity) {
+			cost = lot.Cost.Mul(closed).Div(lot.Quantity)
+		}
+		proceeds := closed.Mul(tx.Price).Sub(share)
+		b.Realized = append(b.Realized, Realization{
+			SellID:   tx.ID,
+			LotID:    lot.TransactionID,
+			Symbol:   tx.Symbol,
+			Currency: lot.Currency,
+			Acquired: lot.Acquired,
+			Sold:     tx.TradeDate,
+			Quantity: closed,
+			Proceeds: proceeds,
+			Cost:     cost,
+			Gain:     proceeds.Sub(cost),
+		})
+		lot.Quantity = lot.Quantity.Sub(closed)
+		lot.Cost = lot.Cost.Sub(cost)
+		remaining = remaining.Sub(closed)
+		fee = fee.Sub(share)
+	}
+	if remaining.IsPositive() {
+		return fmt.Errorf("selling %s %s but only %s held", tx.Quantity, tx.Symbol, tx.Quantity.Sub(remaining))
+	}
+
+	open := lots[:0]
+	for _, lot := range lots {
+		if lot.Quantity.IsPositive() {
+			open = append(open, lot)
+		}
+	}
+	if len(open) == 0 {
+		delete(b.Lots, tx.Symbol)
+	} else {
+		b.Lots[tx.Symbol] = open
+	}
+	return nil
+}
+
+// lotOrder returns the indexes of the lots a sale draws from, in order
+func lotOrder(lots []Lot, tx models.Transaction, method Method) ([]int, error) {
+	if tx.LotID != nil {
+		for i, lot := range lots {
+			if lot.TransactionID == *tx.LotID {
+				return []int{i}, nil
+			}
+		}
+		return nil, fmt.Errorf("lot %d of %s is not open", *tx.LotID, tx.Symbol)
+	}
+
+	order := make([]int, len(lots))
+	for i := range lots {
+		order[i] = i
+	}
+	switch method {
+	case LIFO:
+		for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+			order[i], order[j] = order[j], order[i]
+		}
+	case SpecificLot:
+		return nil, fmt.Errorf("the specific-lot method needs a lot on every sale")
+	}
+	return order, nil
+}
+
+func (b *Book) split(tx models.Transaction) error {
+	if !tx.Quantity.IsPositive() {
+		return fmt.Errorf("split ratio must be positive")
+	}
+	for i := range b.Lots[tx.Symbol] {
+		lot := &b.Lots[tx.Symbol][i]
+		lot.Quantity = lot.Quantity.Mul(tx.Quantity)
+	}
+	return nil
+}
+
+// Positions sums the open lots into one position per symbol, ordered by symbol
+func (b *Book) Positions(portfolioID uint) []models.Position {
+	positions := make([]models.Position, 0, len(b.Lots))
+	for symbol, lots := range b.Lots {
+		position := models.Position{PortfolioID: portfolioID, Symbol: symbol, Currency: lots[0].Currency}
+		cost := decimal.Zero
+		for _, lot := range lots {
+			position.Quantity = position.Quantity.Add(lot.Quantity)
+			cost = cost.Add(lot.Cost)
+		}
+		position.AvgCost = cost.Div(position.Quantity)
+		positions = append(positions, position)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Symbol < positions[j].Symbol })
+	return positions
+}
+
+// GainsReport sums one calendar year of realized gains and income
+type GainsReport struct {
+	Year         int
+	Method       Method
+	ShortTerm    decimal.Decimal
+	LongTerm     decimal.Decimal
+	Total        decimal.Decimal
+	Dividends    decimal.Decimal
+	Fees         decimal.Decimal
+	Realizations []Realization
+}
+
+// Report builds the realized gains report of a year
+func (b *Book) Report(year int, method Method) GainsReport {
+	report := GainsReport{Year: year, Method: method, Realizations: []Realization{}}
+	for _, r := range b.Realized {
+		if r.Sold.Year() != year {
+			continue
+		}
+		report.Realizations = append(report.Realizations, r)
+		if r.LongTerm() {
+			report.LongTerm = report.LongTerm.Add(r.Gain)
+		} else {
+			report.ShortTerm = report.ShortTerm.Add(r.Gain)
+		}
+	}
+	report.Total = report.ShortTerm.Add(report.LongTerm)
+	for _, tx := range b.Dividends {
+		if tx.TradeDate.Year() == year {
+			report.Dividends = report.Dividends.Add(tx.Amount)
+		}
+	}
+	for _, tx := range b.Fees {
+		if tx.TradeDate.Year() == year {
+			report.Fees = report.Fees.Add(tx.Amount)
+		}
+	}
+	return report
+}
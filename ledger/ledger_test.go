@@ -0,0 +1,137 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func lotID(id uint) *uint {
+	return &id
+}
+
+func equal(d decimal.Decimal, want int64) bool {
+	return d.Equal(decimal.NewFromInt(want))
+}
+
+// Two lots of 10 bought at 100 and 120, then 15 sold at 130
+func sampleLedger() []models.Transaction {
+	return []models.Transaction{
+		{ID: 1, Type: models.TransactionBuy, Symbol: "AAPL", Quantity: decimal.NewFromInt(10), Price: decimal.NewFromInt(100), TradeDate: day(2023, 3, 1)},
+		{ID: 2, Type: models.TransactionBuy, Symbol: "AAPL", Quantity: decimal.NewFromInt(10), Price: decimal.NewFromInt(120), Fee: decimal.NewFromInt(10), TradeDate: day(2024, 6, 1)},
+		{ID: 3, Type: models.TransactionSell, Symbol: "AAPL", Quantity: decimal.NewFromInt(15), Price: decimal.NewFromInt(130), TradeDate: day(2024, 9, 1)},
+		{ID: 4, Type: models.TransactionDividend, Symbol: "AAPL", Amount: decimal.NewFromInt(12), TradeDate: day(2024, 10, 1)},
+		{ID: 5, Type: models.TransactionFee, Amount: decimal.NewFromInt(5), TradeDate: day(2024, 12, 1)},
+	}
+}
+
+func TestReplayFIFO(t *testing.T) {
+	book, err := Replay(sampleLedger(), FIFO)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+
+	report := book.Report(2024, FIFO)
+	// 10 @100 held over a year: 300 long term; 5 @121 (fee included): 45 short term
+	if !equal(report.LongTerm, 300) || !equal(report.ShortTerm, 45) || !equal(report.Total, 345) {
+		t.Errorf("Unexpected FIFO gains: %+v", report)
+	}
+	if !equal(report.Dividends, 12) || !equal(report.Fees, 5) {
+		t.Errorf("Expected dividends 12 and fees 5, got %s and %s", report.Dividends, report.Fees)
+	}
+
+	positions := book.Positions(9)
+	if len(positions) != 1 || !equal(positions[0].Quantity, 5) || !equal(positions[0].AvgCost, 121) || positions[0].PortfolioID != 9 {
+		t.Errorf("Expected 5 AAPL left at 121, got %+v", positions)
+	}
+}
+
+func TestReplayLIFO(t *testing.T) {
+	book, err := Replay(sampleLedger(), LIFO)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	report := book.Report(2024, LIFO)
+	// 10 @121 short term: 90; 5 @100 long term: 150
+	if !equal(report.ShortTerm, 90) || !equal(report.LongTerm, 150) {
+		t.Errorf("Unexpected LIFO gains: %+v", report)
+	}
+	if positions := book.Positions(1); !equal(positions[0].AvgCost, 100) {
+		t.Errorf("Expected the oldest lot to remain, got %+v", positions)
+	}
+}
+
+func TestReplaySpecificLot(t *testing.T) {
+	transactions := sampleLedger()
+	if _, err := Replay(transactions, SpecificLot); err == nil {
+		t.Error("Expected a sale without lot to fail under the specific-lot method")
+	}
+
+	transactions[2].Quantity = decimal.NewFromInt(5)
+	transactions[2].LotID = lotID(2)
+	book, err := Replay(transactions, SpecificLot)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if r := book.Realized; len(r) != 1 || r[0].LotID != 2 || !equal(r[0].Gain, 45) {
+		t.Errorf("Expected 5 shares of lot 2 to be closed, got %+v", r)
+	}
+}
+
+func TestReplaySplitAndSellFee(t *testing.T) {
+	book, err := Replay([]models.Transaction{
+		{ID: 1, Type: models.TransactionBuy, Symbol: "NVDA", Quantity: decimal.NewFromInt(10), Price: decimal.NewFromInt(400), TradeDate: day(2024, 1, 2)},
+		{ID: 2, Type: models.TransactionSplit, Symbol: "NVDA", Quantity: decimal.NewFromInt(10), TradeDate: day(2024, 6, 10)},
+		{ID: 3, Type: models.TransactionSell, Symbol: "NVDA", Quantity: decimal.NewFromInt(50), Price: decimal.NewFromInt(50), Fee: decimal.NewFromInt(20), TradeDate: day(2024, 7, 1)},
+	}, FIFO)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	positions := book.Positions(1)
+	if len(positions) != 1 || !equal(positions[0].Quantity, 50) || !equal(positions[0].AvgCost, 40) {
+		t.Errorf("Expected 50 shares at 40 after the split, got %+v", positions)
+	}
+	if gain := book.Realized[0].Gain; !equal(gain, 480) {
+		t.Errorf("Expected gain of 480 net of the fee, got %s", gain)
+	}
+}
+
+func TestReplayRejectsOverselling(t *testing.T) {
+	_, err := Replay([]models.Transaction{
+		{ID: 1, Type: models.TransactionBuy, Symbol: "AAPL", Quantity: decimal.NewFromInt(1), Price: decimal.NewFromInt(100), TradeDate: day(2024, 1, 2)},
+		{ID: 2, Type: models.TransactionSell, Symbol: "AAPL", Quantity: decimal.NewFromInt(2), Price: decimal.NewFromInt(100), TradeDate: day(2024, 1, 3)},
+	}, FIFO)
+	if err == nil {
+		t.Error("Expected selling more than held to fail")
+	}
+}
+
+func TestReplayKeepsCostsExact(t *testing.T) {
+	// 3 shares for 100 leave an unending cost per share; selling them one by
+	// one must still realize exactly the 100 paid
+	transactions := []models.Transaction{
+		{ID: 1, Type: models.TransactionBuy, Symbol: "AAPL", Quantity: decimal.NewFromInt(3), Price: decimal.NewFromInt(33), Fee: decimal.NewFromInt(1), TradeDate: day(2024, 1, 2)},
+	}
+	for i := uint(2); i <= 4; i++ {
+		transactions = append(transactions, models.Transaction{ID: i, Type: models.TransactionSell, Symbol: "AAPL", Quantity: decimal.NewFromInt(1), Price: decimal.RequireFromString("0.1"), TradeDate: day(2024, 2, 1)})
+	}
+	book, err := Replay(transactions, FIFO)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	cost, proceeds := decimal.Zero, decimal.Zero
+	for _, r := range book.Realized {
+		cost = cost.Add(r.Cost)
+		proceeds = proceeds.Add(r.Proceeds)
+	}
+	if !equal(cost, 100) || !proceeds.Equal(decimal.RequireFromString("0.3")) || len(book.Lots) != 0 {
+		t.Errorf("Expected a cost of 100 and proceeds of 0.3, got %s and %s", cost, proceeds)
+	}
+}
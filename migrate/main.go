@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"stock-alerts/db"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  up           apply all pending migrations
+  down [n]     roll back the last n migrations (default 1)
+  version      print the current and latest schema versions`
+
+func main() {
+	// Load environment variables from .env file
+	err := godotenv.Load()
+	if err != nil {
+		log.Println("Warning: .env file not found, using system environment variables")
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	database, err := db.Open(db.ConfigFromEnv())
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+
+	switch os.Args[1] {
+	case "up":
+		if err := db.MigrateUp(database); err != nil {
+			log.Fatal("❌ ", err)
+		}
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				log.Fatalf("❌ invalid number of steps %q", os.Args[2])
+			}
+		}
+		if err := db.MigrateDown(database, steps); err != nil {
+			log.Fatal("❌ ", err)
+		}
+	case "version":
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	current, err := db.CurrentVersion(database)
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	latest, err := db.LatestVersion(database.Dialector.Name())
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	fmt.Printf("📦 Schema version %d (latest %d)\n", current, latest)
+}
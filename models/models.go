@@ -1,48 +1,542 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func init() {
+	// Prices go out as JSON numbers written exactly, e.g. 150.1 rather than
+	// "150.1"; decimals parse either form without going through float64
+	decimal.MarshalJSONWithoutQuotes = true
+}
 
 type User struct {
-	ID        uint      `gorm:"primaryKey"`
-	Name      string    `gorm:"size:100"`
-	Email     string    `gorm:"unique"`
-	Portfolio Portfolio `gorm:"foreignKey:UserID"`
+	ID           uint                     `gorm:"primaryKey"`
+	Name         string                   `gorm:"size:100"`
+	Email        string                   `gorm:"unique"`
+	BaseCurrency string                   `gorm:"size:3;default:USD"` // valuations and portfolio alerts are in this currency
+	Portfolios   []Portfolio              `gorm:"foreignKey:UserID"`
+	Preferences  *NotificationPreferences `gorm:"foreignKey:UserID"`
 }
 
+// DefaultCurrency is the base currency of users who have not picked one
+const DefaultCurrency = "USD"
+
+// Base returns the user's base currency, DefaultCurrency when unset
+func (u User) Base() string {
+	if u.BaseCurrency == "" {
+		return DefaultCurrency
+	}
+	return u.BaseCurrency
+}
+
+// Symbol is reference data on an instrument prices can be fetched for
+type Symbol struct {
+	ID        uint           `gorm:"primaryKey"`
+	Symbol    string         `gorm:"size:10;uniqueIndex"`
+	Name      string         `gorm:"size:200"`
+	Exchange  string         `gorm:"size:10"` // MIC code, e.g. XNAS; FX or CRYPTO for pairs
+	Currency  string         `gorm:"size:3"`  // the currency of its prices; a pair's quote currency
+	Type      InstrumentType `gorm:"size:20"`
+	Sector    string         `gorm:"size:50"`
+	UpdatedAt time.Time
+}
+
+// InstrumentType is the kind of instrument a symbol names. Providers may
+// report types beyond these, e.g. Mutual Fund, which are priced as equities.
+type InstrumentType string
+
+const (
+	InstrumentEquity InstrumentType = "Equity"
+	InstrumentETF    InstrumentType = "ETF"
+	InstrumentFX     InstrumentType = "FX"     // a currency pair, e.g. EURUSD: one EUR in USD
+	InstrumentCrypto InstrumentType = "Crypto" // a crypto currency in a currency, e.g. BTCUSD
+)
+
+// Pair reports whether the instrument is the price of one currency in another
+func (t InstrumentType) Pair() bool {
+	return t == InstrumentFX || t == InstrumentCrypto
+}
+
+// CorporateActionType is the kind of corporate action
+type CorporateActionType string
+
+const (
+	ActionSplit  CorporateActionType = "SPLIT"  // Ratio new shares per old share
+	ActionRename CorporateActionType = "RENAME" // Symbol is renamed to NewSymbol
+)
+
+// Valid reports whether the action type is known
+func (t CorporateActionType) Valid() bool {
+	return t == ActionSplit || t == ActionRename
+}
+
+// CorporateAction is a split or a ticker change. EffectiveDate is the first
+// trading date on the new terms, at midnight UTC. AppliedAt is set once
+// thresholds, holdings, rules and price history have been adjusted; from then
+// on the price history before EffectiveDate is split-adjusted.
+type CorporateAction struct {
+	ID            uint                `gorm:"primaryKey"`
+	Type          CorporateActionType `gorm:"size:10;uniqueIndex:idx_corporate_actions_type_symbol_date"`
+	Symbol        string              `gorm:"size:10;uniqueIndex:idx_corporate_actions_type_symbol_date"`
+	NewSymbol     string              `gorm:"size:10"`
+	Ratio         decimal.Decimal
+	EffectiveDate time.Time `gorm:"uniqueIndex:idx_corporate_actions_type_symbol_date"`
+	AppliedAt     *time.Time
+	CreatedAt     time.Time
+}
+
+// PortfolioKind tells holdings portfolios from watchlists
+type PortfolioKind string
+
+const (
+	KindPortfolio PortfolioKind = "portfolio"
+	KindWatchlist PortfolioKind = "watchlist" // alert rules only, no holdings
+)
+
+// Valid reports whether the kind is known
+func (k PortfolioKind) Valid() bool {
+	return k == KindPortfolio || k == KindWatchlist
+}
+
+// Portfolio is a named list of stocks; a user may keep several
 type Portfolio struct {
-	ID     uint    `gorm:"primaryKey"`
-	UserID uint    `gorm:"unique"` // 1 user = 1 portfolio
-	Stocks []Stock `gorm:"foreignKey:PortfolioID"`
+	ID     uint          `gorm:"primaryKey"`
+	UserID uint          `gorm:"uniqueIndex:uni_portfolios_user_id_name"`
+	Name   string        `gorm:"size:100;uniqueIndex:uni_portfolios_user_id_name;default:Default"`
+	Kind   PortfolioKind `gorm:"size:10;default:portfolio"`
+	// CostMethod picks the lots a sale closes: fifo, lifo or specific
+	CostMethod string  `gorm:"size:10;default:fifo"`
+	Stocks     []Stock `gorm:"foreignKey:PortfolioID"`
+}
+
+// HasHoldings reports whether positions and transactions may be recorded
+func (p Portfolio) HasHoldings() bool {
+	return p.Kind != KindWatchlist
 }
 
 type Stock struct {
 	ID             uint `gorm:"primaryKey"`
 	PortfolioID    uint
 	StockSymbol    string `gorm:"size:10"`
-	ThresholdPrice float64
+	ThresholdPrice decimal.Decimal
+}
+
+// Position is a holding in a portfolio: how many shares and at what average cost
+type Position struct {
+	ID          uint   `gorm:"primaryKey"`
+	PortfolioID uint   `gorm:"uniqueIndex:uni_positions_portfolio_symbol"`
+	Symbol      string `gorm:"size:10;uniqueIndex:uni_positions_portfolio_symbol"`
+	Quantity    decimal.Decimal
+	AvgCost     decimal.Decimal // average price paid per share
+	Currency    string          `gorm:"size:3;default:USD"`
+}
+
+// TransactionType is the kind of ledger entry
+type TransactionType string
+
+const (
+	TransactionBuy      TransactionType = "BUY"
+	TransactionSell     TransactionType = "SELL"
+	TransactionDividend TransactionType = "DIVIDEND"
+	TransactionSplit    TransactionType = "SPLIT"
+	TransactionFee      TransactionType = "FEE"
+)
+
+// Transaction is an entry in a portfolio's ledger; positions are derived by
+// replaying the ledger in trade order.
+//   - BUY and SELL use Quantity, Price and Fee. A SELL may name the BUY it
+//     closes in LotID; otherwise lots are picked by the cost method.
+//   - DIVIDEND and FEE use Amount.
+//   - SPLIT uses Quantity as the number of new shares per old share.
+type Transaction struct {
+	ID          uint            `gorm:"primaryKey"`
+	PortfolioID uint            `gorm:"index:idx_transactions_portfolio_trade_date"`
+	Type        TransactionType `gorm:"size:10"`
+	Symbol      string          `gorm:"size:10"`
+	Quantity    decimal.Decimal
+	Price       decimal.Decimal
+	Fee         decimal.Decimal
+	Amount      decimal.Decimal
+	Currency    string `gorm:"size:3;default:USD"`
+	LotID       *uint
+	TradeDate   time.Time `gorm:"index:idx_transactions_portfolio_trade_date"`
+	CreatedAt   time.Time
+}
+
+// AlertKind tells what triggered an alert
+type AlertKind string
+
+// The other alert kinds are the PortfolioRuleType, PositionRuleType and
+// SignalType values
+const (
+	AlertThreshold  AlertKind = "THRESHOLD"  // a stock crossing its threshold price
+	AlertExpression AlertKind = "EXPRESSION" // an ExpressionRule starting to hold
+)
+
+// AlertStatus is where an alert is in its lifecycle
+type AlertStatus string
+
+const (
+	AlertNew          AlertStatus = "NEW"
+	AlertRead         AlertStatus = "READ"
+	AlertAcknowledged AlertStatus = "ACKNOWLEDGED"
+	AlertSnoozed      AlertStatus = "SNOOZED" // the rule raises no alerts until SnoozedUntil
+	AlertResolved     AlertStatus = "RESOLVED"
+)
+
+// alertTransitions lists the statuses each status may move to
+var alertTransitions = map[AlertStatus][]AlertStatus{
+	AlertNew:          {AlertRead, AlertAcknowledged, AlertSnoozed, AlertResolved},
+	AlertRead:         {AlertAcknowledged, AlertSnoozed, AlertResolved},
+	AlertAcknowledged: {AlertSnoozed, AlertResolved},
+	AlertSnoozed:      {AlertAcknowledged, AlertSnoozed, AlertResolved},
+}
+
+// Valid reports whether the status is known
+func (s AlertStatus) Valid() bool {
+	_, ok := alertTransitions[s]
+	return ok || s == AlertResolved
+}
+
+// CanBecome reports whether an alert may move from s to the given status.
+// Resolved alerts are final and nothing goes back to NEW.
+func (s AlertStatus) CanBecome(to AlertStatus) bool {
+	for _, allowed := range alertTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
 }
 
 type Alert struct {
-	ID          uint `gorm:"primaryKey"`
-	UserID      uint
-	StockSymbol string `gorm:"size:10"`
-	Price       float64
+	ID          uint            `gorm:"primaryKey"`
+	UserID      uint            `gorm:"index:idx_alerts_user_status"`
+	Kind        AlertKind       `gorm:"size:20;default:THRESHOLD"`
+	RuleID      *uint           // the rule that raised the alert; a stock for THRESHOLD alerts
+	PortfolioID *uint           // set for portfolio alerts
+	StockSymbol string          `gorm:"size:10"`
+	Price       decimal.Decimal // the price, or the portfolio metric that triggered
+	Message     string
 	Timestamp   time.Time
+
+	Status          AlertStatus `gorm:"size:20;default:NEW;index:idx_alerts_user_status"`
+	SnoozedUntil    *time.Time
+	StatusChangedAt *time.Time
+	NotifiedAt      *time.Time `gorm:"index"` // when the notifier sent the alert; nil while queued
+}
+
+// NotificationChannel is a way of telling a user about an alert, on top of
+// the alert being listed by the API
+type NotificationChannel string
+
+const (
+	ChannelEmail   NotificationChannel = "EMAIL"
+	ChannelWebhook NotificationChannel = "WEBHOOK" // POSTs JSON to the user's WebhookURL
+)
+
+// Valid reports whether the channel is known
+func (c NotificationChannel) Valid() bool {
+	return c == ChannelEmail || c == ChannelWebhook
+}
+
+// Channels is a set of channels, stored as a comma-separated list
+type Channels []NotificationChannel
+
+// Value stores the channels as a comma-separated list
+func (c Channels) Value() (driver.Value, error) {
+	names := make([]string, len(c))
+	for i, channel := range c {
+		names[i] = string(channel)
+	}
+	return strings.Join(names, ","), nil
+}
+
+// Scan reads a comma-separated list of channels
+func (c *Channels) Scan(value any) error {
+	var list string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		list = v
+	case []byte:
+		list = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Channels", value)
+	}
+	*c = Channels{}
+	for _, name := range strings.Split(list, ",") {
+		if name != "" {
+			*c = append(*c, NotificationChannel(name))
+		}
+	}
+	return nil
+}
+
+// DigestFrequency is how often a user receives a digest
+type DigestFrequency string
+
+const (
+	DigestNone   DigestFrequency = "NONE"
+	DigestDaily  DigestFrequency = "DAILY"
+	DigestWeekly DigestFrequency = "WEEKLY"
+)
+
+// Valid reports whether the frequency is known
+func (f DigestFrequency) Valid() bool {
+	return f == DigestNone || f == DigestDaily || f == DigestWeekly
+}
+
+// NotificationPreferences is how and when a user is told about alerts.
+// Quiet hours and the digest schedule are in the user's Timezone.
+type NotificationPreferences struct {
+	ID         uint     `gorm:"primaryKey"`
+	UserID     uint     `gorm:"uniqueIndex"`
+	Channels   Channels `gorm:"size:100"` // default channels for every rule
+	Email      string   // the account email when empty
+	WebhookURL string   `gorm:"size:500"`
+	Timezone   string   `gorm:"size:64;default:UTC"` // IANA name, e.g. Europe/Paris
+	// QuietStart and QuietEnd are "HH:MM"; alerts in between are queued and
+	// sent when the quiet hours end. The range may span midnight.
+	QuietStart    string          `gorm:"size:5"`
+	QuietEnd      string          `gorm:"size:5"`
+	Digest        DigestFrequency `gorm:"size:10;default:NONE"`
+	DigestHour    int             // local hour the digest is sent at
+	DigestWeekday time.Weekday    // weekly digests only; 0 is Sunday
+	LastDigestAt  *time.Time
+	UpdatedAt     time.Time
+}
+
+// RuleChannels overrides a user's default channels for one rule. Kind and
+// RuleID identify the rule the way they do on alerts.
+type RuleChannels struct {
+	ID       uint      `gorm:"primaryKey"`
+	UserID   uint      `gorm:"index"`
+	Kind     AlertKind `gorm:"size:20;uniqueIndex:idx_rule_channels_rule"`
+	RuleID   uint      `gorm:"uniqueIndex:idx_rule_channels_rule"`
+	Channels Channels  `gorm:"size:100"` // empty silences the rule outside the app
+}
+
+// PortfolioRuleType is the metric a portfolio alert rule watches
+type PortfolioRuleType string
+
+const (
+	RuleValueAbove     PortfolioRuleType = "VALUE_ABOVE"     // total value rises to Threshold
+	RuleValueBelow     PortfolioRuleType = "VALUE_BELOW"     // total value falls to Threshold
+	RuleDailyChange    PortfolioRuleType = "DAILY_CHANGE"    // value moves Threshold % from the previous close
+	RuleDrawdown       PortfolioRuleType = "DRAWDOWN"        // value falls Threshold % below its peak
+	RulePositionWeight PortfolioRuleType = "POSITION_WEIGHT" // one position exceeds Threshold % of the value
+)
+
+// Valid reports whether the rule type is known
+func (t PortfolioRuleType) Valid() bool {
+	switch t {
+	case RuleValueAbove, RuleValueBelow, RuleDailyChange, RuleDrawdown, RulePositionWeight:
+		return true
+	}
+	return false
+}
+
+// PositionRuleType is the kind of alert that follows a position
+type PositionRuleType string
+
+const (
+	RuleTrailingStop PositionRuleType = "TRAILING_STOP" // price falls Value below the highest price since entry
+	RuleStopLoss     PositionRuleType = "STOP_LOSS"     // price falls Value below the average cost
+	RuleTakeProfit   PositionRuleType = "TAKE_PROFIT"   // price rises Value above the average cost
+)
+
+// Valid reports whether the rule type is known
+func (t PositionRuleType) Valid() bool {
+	return t == RuleTrailingStop || t == RuleStopLoss || t == RuleTakeProfit
+}
+
+// RuleUnit tells whether a rule's Value is a percentage or a price amount
+type RuleUnit string
+
+const (
+	UnitPercent RuleUnit = "PERCENT"
+	UnitAmount  RuleUnit = "AMOUNT"
+)
+
+// PositionAlertRule is an alert tied to a portfolio's position in a symbol.
+// HighWater and Triggered are kept up to date by the alert consumer so a
+// restart neither resets a trailing stop nor repeats an alert.
+type PositionAlertRule struct {
+	ID          uint             `gorm:"primaryKey"`
+	PortfolioID uint             `gorm:"index:idx_position_alert_rules_portfolio_symbol"`
+	Symbol      string           `gorm:"size:10;index:idx_position_alert_rules_portfolio_symbol"`
+	Type        PositionRuleType `gorm:"size:20"`
+	Unit        RuleUnit         `gorm:"size:10;default:PERCENT"`
+	Value       decimal.Decimal
+	HighWater   decimal.Decimal // highest price since entry, for trailing stops
+	Triggered   bool            // the condition held at the last price
+	CreatedAt   time.Time
+}
+
+// PortfolioAlertRule is an alert on a whole portfolio rather than one stock
+type PortfolioAlertRule struct {
+	ID          uint              `gorm:"primaryKey"`
+	PortfolioID uint              `gorm:"index"`
+	Type        PortfolioRuleType `gorm:"size:20"`
+	Threshold   decimal.Decimal
+	Peak        decimal.Decimal // highest value seen, kept for DRAWDOWN rules
+	CreatedAt   time.Time
 }
 
 // ✅ New model for persistence consumer
 type StockPrice struct {
 	ID        uint   `gorm:"primaryKey"`
 	Symbol    string `gorm:"size:10;index"`
-	Price     float64
+	Price     decimal.Decimal
 	Timestamp time.Time
 }
 
+// ExpressionRule is a custom condition on a symbol written in the expr
+// language, e.g. `price > sma(20) * 1.05 && rsi(14) < 70`. Triggered is kept
+// up to date by the alert consumer so a restart does not repeat an alert.
+type ExpressionRule struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"index"`
+	Symbol     string `gorm:"size:10"`
+	Expression string `gorm:"size:500"`
+	Triggered  bool   // the condition held at the last price
+	CreatedAt  time.Time
+}
+
+// Moving-average signals of StockAnalytics
+const (
+	SignalBullish = "BULLISH" // Avg5 above Avg20
+	SignalBearish = "BEARISH" // Avg5 below Avg20
+	SignalNeutral = "NEUTRAL" // the averages are within a hair of each other
+)
+
+// StockAnalytics is a moving-average signal, stored each time it changes
 type StockAnalytics struct {
 	ID          uint   `gorm:"primaryKey"`
 	Symbol      string `gorm:"size:10;index"`
-	Avg5        float64
-	Avg20       float64
+	Avg5        decimal.Decimal
+	Avg20       decimal.Decimal
 	Signal      string // "BULLISH", "BEARISH", "NEUTRAL"
 	GeneratedAt time.Time
 }
+
+// SignalType is an indicator event of the analytics consumer
+type SignalType string
+
+const (
+	SignalChange         SignalType = "SIGNAL_CHANGE"   // Signal moved between BULLISH, NEUTRAL and BEARISH
+	SignalGoldenCross    SignalType = "GOLDEN_CROSS"    // Avg5 crossed above Avg20
+	SignalDeathCross     SignalType = "DEATH_CROSS"     // Avg5 crossed below Avg20
+	SignalRSIOverbought  SignalType = "RSI_OVERBOUGHT"  // RSI(14) rose to 70 or above
+	SignalRSIOversold    SignalType = "RSI_OVERSOLD"    // RSI(14) fell to 30 or below
+	SignalBollingerUpper SignalType = "BOLLINGER_UPPER" // price broke above the upper Bollinger band
+	SignalBollingerLower SignalType = "BOLLINGER_LOWER" // price broke below the lower Bollinger band
+)
+
+// Valid reports whether the signal type is known
+func (t SignalType) Valid() bool {
+	switch t {
+	case SignalChange, SignalGoldenCross, SignalDeathCross, SignalRSIOverbought,
+		SignalRSIOversold, SignalBollingerUpper, SignalBollingerLower:
+		return true
+	}
+	return false
+}
+
+// SignalRule subscribes a user to an indicator event on a symbol. From and To
+// narrow SIGNAL_CHANGE rules to one transition; empty matches any signal.
+type SignalRule struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index"`
+	Symbol    string     `gorm:"size:10"`
+	Type      SignalType `gorm:"size:20"`
+	From      string     `gorm:"size:10"`
+	To        string     `gorm:"size:10"`
+	CreatedAt time.Time
+}
+
+// StockPriceRecord is a single price tick stored by the persistence consumer.
+// On Postgres the table is partitioned by month on Timestamp.
+type StockPriceRecord struct {
+	ID        uint   `gorm:"primaryKey"`
+	Symbol    string `gorm:"size:10;index:idx_stock_price_records_symbol_timestamp"`
+	Price     decimal.Decimal
+	Timestamp time.Time `gorm:"index:idx_stock_price_records_symbol_timestamp"`
+}
+
+// TableName overrides the default table name
+func (StockPriceRecord) TableName() string {
+	return "stock_price_records"
+}
+
+// DailyAnalytics holds the per-day aggregates maintained by the analytics
+// consumer. Date is the exchange's trading date, at midnight UTC.
+type DailyAnalytics struct {
+	ID           uint      `gorm:"primaryKey"`
+	Symbol       string    `gorm:"size:10;uniqueIndex:idx_stock_daily_analytics_symbol_date"`
+	Date         time.Time `gorm:"uniqueIndex:idx_stock_daily_analytics_symbol_date"`
+	MinPrice     decimal.Decimal
+	MaxPrice     decimal.Decimal
+	AvgPrice     decimal.Decimal // PriceSum / PriceChanges
+	PriceSum     decimal.Decimal // exact, so the average does not drift over many updates
+	TotalVolume  int64
+	PriceChanges int       // number of price updates in a day
+	LastTick     time.Time // the newest price counted
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// TableName overrides the default table name
+func (DailyAnalytics) TableName() string {
+	return "stock_daily_analytics"
+}
+
+// BarInterval is the width of a downsampled price bar
+type BarInterval string
+
+const (
+	Interval1m BarInterval = "1m"
+	Interval1h BarInterval = "1h"
+	Interval1d BarInterval = "1d"
+)
+
+// BarIntervals lists the rollup intervals from finest to coarsest
+var BarIntervals = []BarInterval{Interval1m, Interval1h, Interval1d}
+
+// Duration returns the width of the interval
+func (i BarInterval) Duration() time.Duration {
+	switch i {
+	case Interval1m:
+		return time.Minute
+	case Interval1h:
+		return time.Hour
+	case Interval1d:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// Valid reports whether the interval is one of the rollup intervals
+func (i BarInterval) Valid() bool {
+	return i.Duration() > 0
+}
+
+// PriceBar is an OHLC rollup of the raw price history. Each interval has its
+// own table, stock_price_bars_<interval>, and buckets are aligned in UTC.
+type PriceBar struct {
+	ID     uint      `gorm:"primaryKey"`
+	Symbol string    `gorm:"size:10"`
+	Bucket time.Time // start of the interval
+	Open   decimal.Decimal
+	High   decimal.Decimal
+	Low    decimal.Decimal
+	Close  decimal.Decimal
+	Count  int // number of raw ticks in the bar
+}
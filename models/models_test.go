@@ -3,6 +3,8 @@ package models
 import (
 	"testing"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 func TestUserModel(t *testing.T) {
@@ -37,15 +39,15 @@ func TestStockModel(t *testing.T) {
 		ID:             1,
 		PortfolioID:    1,
 		StockSymbol:    "AAPL",
-		ThresholdPrice: 150.00,
+		ThresholdPrice: decimal.NewFromFloat(150.00),
 	}
 
 	if stock.StockSymbol != "AAPL" {
 		t.Errorf("Expected stock symbol to be 'AAPL', got %s", stock.StockSymbol)
 	}
 
-	if stock.ThresholdPrice != 150.00 {
-		t.Errorf("Expected threshold price to be 150.00, got %f", stock.ThresholdPrice)
+	if !stock.ThresholdPrice.Equal(decimal.NewFromFloat(150.00)) {
+		t.Errorf("Expected threshold price to be 150.00, got %s", stock.ThresholdPrice)
 	}
 }
 
@@ -55,7 +57,7 @@ func TestAlertModel(t *testing.T) {
 		ID:          1,
 		UserID:      1,
 		StockSymbol: "AAPL",
-		Price:       155.50,
+		Price:       decimal.NewFromFloat(155.50),
 		Timestamp:   now,
 	}
 
@@ -63,8 +65,8 @@ func TestAlertModel(t *testing.T) {
 		t.Errorf("Expected alert stock symbol to be 'AAPL', got %s", alert.StockSymbol)
 	}
 
-	if alert.Price != 155.50 {
-		t.Errorf("Expected alert price to be 155.50, got %f", alert.Price)
+	if !alert.Price.Equal(decimal.NewFromFloat(155.50)) {
+		t.Errorf("Expected alert price to be 155.50, got %s", alert.Price)
 	}
 
 	if alert.Timestamp != now {
@@ -77,7 +79,7 @@ func TestStockPriceModel(t *testing.T) {
 	stockPrice := StockPrice{
 		ID:        1,
 		Symbol:    "TSLA",
-		Price:     250.75,
+		Price:     decimal.NewFromFloat(250.75),
 		Timestamp: now,
 	}
 
@@ -85,8 +87,8 @@ func TestStockPriceModel(t *testing.T) {
 		t.Errorf("Expected stock price symbol to be 'TSLA', got %s", stockPrice.Symbol)
 	}
 
-	if stockPrice.Price != 250.75 {
-		t.Errorf("Expected stock price to be 250.75, got %f", stockPrice.Price)
+	if !stockPrice.Price.Equal(decimal.NewFromFloat(250.75)) {
+		t.Errorf("Expected stock price to be 250.75, got %s", stockPrice.Price)
 	}
 }
 
@@ -95,8 +97,8 @@ func TestStockAnalyticsModel(t *testing.T) {
 	analytics := StockAnalytics{
 		ID:          1,
 		Symbol:      "GOOGL",
-		Avg5:        2500.00,
-		Avg20:       2450.00,
+		Avg5:        decimal.NewFromFloat(2500.00),
+		Avg20:       decimal.NewFromFloat(2450.00),
 		Signal:      "BULLISH",
 		GeneratedAt: now,
 	}
@@ -109,8 +111,8 @@ func TestStockAnalyticsModel(t *testing.T) {
 		t.Errorf("Expected analytics signal to be 'BULLISH', got %s", analytics.Signal)
 	}
 
-	if analytics.Avg5 <= analytics.Avg20 {
-		t.Errorf("Expected Avg5 (%f) to be greater than Avg20 (%f) for BULLISH signal", analytics.Avg5, analytics.Avg20)
+	if analytics.Avg5.LessThanOrEqual(analytics.Avg20) {
+		t.Errorf("Expected Avg5 (%s) to be greater than Avg20 (%s) for BULLISH signal", analytics.Avg5, analytics.Avg20)
 	}
 }
 
@@ -134,3 +136,23 @@ func TestValidateStockSymbol(t *testing.T) {
 		}
 	}
 }
+
+func TestAlertStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to AlertStatus
+		want     bool
+	}{
+		{AlertNew, AlertRead, true},
+		{AlertRead, AlertNew, false},
+		{AlertAcknowledged, AlertRead, false},
+		{AlertSnoozed, AlertSnoozed, true},
+		{AlertSnoozed, AlertResolved, true},
+		{AlertResolved, AlertAcknowledged, false},
+		{AlertStatus("GONE"), AlertRead, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanBecome(tt.to); got != tt.want {
+			t.Errorf("Expected %s -> %s to be %v, got %v", tt.from, tt.to, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"stock-alerts/db"
+	"stock-alerts/repository"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Load environment variables from .env file
+	err := godotenv.Load()
+	if err != nil {
+		log.Println("Warning: .env file not found, using system environment variables")
+	}
+
+	// Connect DB
+	database, err := db.ConnectDatabase()
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	n := newNotifier(repository.NewGormRepositories(database), sendersFromEnv())
+
+	log.Println("📨 Notifier starting...")
+
+	// Alerts are picked up from the database, so one instance should run
+	ticker := time.NewTicker(pollIntervalFromEnv())
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		now := time.Now()
+		if err := n.dispatch(now); err != nil {
+			log.Println("❌ Alert dispatch failed:", err)
+		}
+		if err := n.sendDigests(now); err != nil {
+			log.Println("❌ Digest run failed:", err)
+		}
+	}
+}
+
+// pollIntervalFromEnv reads NOTIFY_POLL, defaulting to 30 seconds
+func pollIntervalFromEnv() time.Duration {
+	interval := 30 * time.Second
+	if v := os.Getenv("NOTIFY_POLL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Printf("⚠️  Ignoring invalid NOTIFY_POLL %q\n", v)
+		} else {
+			interval = d
+		}
+	}
+	return interval
+}
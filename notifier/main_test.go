@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"stock-alerts/models"
+	"stock-alerts/notify"
+	"stock-alerts/repository"
+
+	"github.com/shopspring/decimal"
+)
+
+// recordingSender keeps the messages it is asked to send
+type recordingSender struct {
+	sent []notify.Message
+	to   []recipient
+}
+
+func (s *recordingSender) Send(to recipient, msg notify.Message) error {
+	s.sent = append(s.sent, msg)
+	s.to = append(s.to, to)
+	return nil
+}
+
+func setupNotifier(t *testing.T) (*notifier, repository.Repositories, *recordingSender, *recordingSender) {
+	t.Helper()
+	repos := repository.NewMemoryRepositories()
+	email, webhook := &recordingSender{}, &recordingSender{}
+	n := newNotifier(repos, map[models.NotificationChannel]sender{
+		models.ChannelEmail:   email,
+		models.ChannelWebhook: webhook,
+	})
+	return n, repos, email, webhook
+}
+
+func TestDispatchRespectsChannelsAndQuietHours(t *testing.T) {
+	n, repos, email, webhook := setupNotifier(t)
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	repos.Notifications.SavePreferences(&models.NotificationPreferences{
+		UserID:     user.ID,
+		Channels:   models.Channels{models.ChannelEmail},
+		WebhookURL: "https://example.com/hook",
+		Timezone:   "Europe/Paris",
+		QuietStart: "22:00",
+		QuietEnd:   "07:00",
+	})
+	loud, quiet := uint(1), uint(2)
+	repos.Notifications.SaveRuleChannels(&models.RuleChannels{UserID: user.ID, Kind: models.AlertThreshold, RuleID: loud,
+		Channels: models.Channels{models.ChannelEmail, models.ChannelWebhook}})
+	repos.Notifications.SaveRuleChannels(&models.RuleChannels{UserID: user.ID, Kind: models.AlertThreshold, RuleID: quiet, Channels: models.Channels{}})
+
+	// 23:00 in Paris
+	night := time.Date(2025, 1, 10, 22, 0, 0, 0, time.UTC)
+	for _, ruleID := range []uint{loud, quiet} {
+		id := ruleID
+		repos.Alerts.Create(&models.Alert{UserID: user.ID, RuleID: &id, StockSymbol: "AAPL", Price: decimal.NewFromInt(151), Timestamp: night})
+	}
+	repos.Alerts.Create(&models.Alert{UserID: user.ID, Kind: models.AlertExpression, StockSymbol: "AAPL", Message: "AAPL: price > 150", Timestamp: night})
+
+	n.dispatch(night)
+	if len(email.sent) != 0 || len(webhook.sent) != 0 {
+		t.Fatalf("Expected alerts to be queued during quiet hours, got %d emails and %d webhooks", len(email.sent), len(webhook.sent))
+	}
+
+	morning := time.Date(2025, 1, 11, 6, 0, 0, 0, time.UTC)
+	n.dispatch(morning)
+	if len(email.sent) != 1 || len(email.sent[0].Alerts) != 2 || email.to[0].Email != "jane@example.com" {
+		t.Fatalf("Expected one email with the default and the loud rule's alerts, got %+v", email.sent)
+	}
+	if len(webhook.sent) != 1 || len(webhook.sent[0].Alerts) != 1 || webhook.sent[0].Alerts[0].RuleID == nil || *webhook.sent[0].Alerts[0].RuleID != loud {
+		t.Errorf("Expected the loud rule's alert on the webhook, got %+v", webhook.sent)
+	}
+	if queued, _ := repos.Alerts.ListUnnotified(); len(queued) != 0 {
+		t.Errorf("Expected every alert to be marked sent, got %d queued", len(queued))
+	}
+
+	n.dispatch(morning.Add(time.Minute))
+	if len(email.sent) != 1 {
+		t.Errorf("Expected no alert to be sent twice, got %d emails", len(email.sent))
+	}
+}
+
+func TestDispatchWithoutPreferences(t *testing.T) {
+	n, repos, email, _ := setupNotifier(t)
+	repos.Alerts.Create(&models.Alert{UserID: 5, StockSymbol: "AAPL", Price: decimal.NewFromInt(151), Timestamp: time.Now()})
+	n.dispatch(time.Now())
+	if len(email.sent) != 0 {
+		t.Errorf("Expected no email without preferences, got %d", len(email.sent))
+	}
+	if queued, _ := repos.Alerts.ListUnnotified(); len(queued) != 0 {
+		t.Errorf("Expected the alert to be marked sent, got %d queued", len(queued))
+	}
+}
+
+func TestSendDigests(t *testing.T) {
+	n, repos, email, _ := setupNotifier(t)
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	subscribed := time.Date(2025, 3, 2, 12, 0, 0, 0, time.UTC)
+	repos.Notifications.SavePreferences(&models.NotificationPreferences{
+		UserID:   user.ID,
+		Channels: models.Channels{models.ChannelEmail},
+		Digest:   models.DigestDaily,
+		// DigestHour 0: sent at midnight UTC
+	})
+	// As if the last digest went out when the user subscribed
+	repos.Notifications.SetLastDigest(user.ID, subscribed)
+
+	portfolio := models.Portfolio{UserID: user.ID, Name: "Main"}
+	repos.Portfolios.Create(&portfolio)
+	repos.Stocks.Create(&models.Stock{PortfolioID: portfolio.ID, StockSymbol: "AAPL", ThresholdPrice: decimal.NewFromInt(150)})
+	repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "AAPL", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(100), Currency: "USD"})
+	repos.Bars.Upsert(models.Interval1d, []models.PriceBar{{Symbol: "AAPL", Bucket: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), Close: decimal.NewFromInt(140)}})
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(154), Timestamp: time.Date(2025, 3, 2, 20, 0, 0, 0, time.UTC)})
+	repos.Alerts.Create(&models.Alert{UserID: user.ID, StockSymbol: "AAPL", Price: decimal.NewFromInt(151), Timestamp: time.Date(2025, 3, 2, 15, 0, 0, 0, time.UTC)})
+	repos.Analytics.SaveSignal(&models.StockAnalytics{Symbol: "AAPL", Signal: models.SignalBullish, GeneratedAt: time.Date(2025, 3, 2, 16, 0, 0, 0, time.UTC)})
+
+	n.sendDigests(time.Date(2025, 3, 2, 23, 0, 0, 0, time.UTC))
+	if len(email.sent) != 0 {
+		t.Fatalf("Expected no digest before midnight, got %d", len(email.sent))
+	}
+
+	midnight := time.Date(2025, 3, 3, 0, 1, 0, 0, time.UTC)
+	n.sendDigests(midnight)
+	if len(email.sent) != 1 || email.sent[0].Digest == nil {
+		t.Fatalf("Expected one digest, got %+v", email.sent)
+	}
+	digest := email.sent[0].Digest
+	if len(digest.Alerts) != 1 || len(digest.Signals) != 1 || len(digest.Portfolios) != 1 {
+		t.Fatalf("Expected an alert, a signal and a portfolio, got %+v", digest)
+	}
+	if p := digest.Portfolios[0]; !p.Value.Equal(decimal.NewFromInt(1540)) || !p.Change.Equal(decimal.NewFromInt(140)) || p.Currency != "USD" {
+		t.Errorf("Expected a value of 1540 USD up 140 from the close, got %+v", p)
+	}
+	if !strings.Contains(email.sent[0].Text, "AAPL turned BULLISH") {
+		t.Errorf("Expected the signal in the digest text, got:\n%s", email.sent[0].Text)
+	}
+
+	n.sendDigests(midnight.Add(time.Hour))
+	if len(email.sent) != 1 {
+		t.Errorf("Expected one digest per day, got %d", len(email.sent))
+	}
+}
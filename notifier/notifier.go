@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"stock-alerts/fx"
+	"stock-alerts/models"
+	"stock-alerts/notify"
+	"stock-alerts/repository"
+	"stock-alerts/valuation"
+)
+
+// notifier sends queued alerts on each user's channels and assembles digests
+type notifier struct {
+	users         repository.UserRepo
+	portfolios    repository.PortfolioRepo
+	positions     repository.PositionRepo
+	alerts        repository.AlertRepo
+	notifications repository.NotificationRepo
+	prices        repository.PriceRepo
+	bars          repository.BarRepo
+	analytics     repository.AnalyticsRepo
+	senders       map[models.NotificationChannel]sender
+}
+
+func newNotifier(repos repository.Repositories, senders map[models.NotificationChannel]sender) *notifier {
+	return &notifier{
+		users:         repos.Users,
+		portfolios:    repos.Portfolios,
+		positions:     repos.Positions,
+		alerts:        repos.Alerts,
+		notifications: repos.Notifications,
+		prices:        repos.Prices,
+		bars:          repos.Bars,
+		analytics:     repos.Analytics,
+		senders:       senders,
+	}
+}
+
+// ruleKey identifies the rule behind an alert, as RuleChannels does
+type ruleKey struct {
+	kind   models.AlertKind
+	ruleID uint
+}
+
+// dispatch sends every queued alert whose user is outside quiet hours
+func (n *notifier) dispatch(now time.Time) error {
+	alerts, err := n.alerts.ListUnnotified()
+	if err != nil {
+		return err
+	}
+	byUser := map[uint][]models.Alert{}
+	var users []uint
+	for _, alert := range alerts {
+		if _, ok := byUser[alert.UserID]; !ok {
+			users = append(users, alert.UserID)
+		}
+		byUser[alert.UserID] = append(byUser[alert.UserID], alert)
+	}
+	for _, userID := range users {
+		if err := n.dispatchUser(userID, byUser[userID], now); err != nil {
+			log.Printf("❌ Failed to notify user %d: %v\n", userID, err)
+		}
+	}
+	return nil
+}
+
+// dispatchUser sends a user's queued alerts, one message per channel.
+// Alerts the user has already handled in the app are not sent, and failed
+// deliveries are logged rather than retried.
+func (n *notifier) dispatchUser(userID uint, alerts []models.Alert, now time.Time) error {
+	ids := make([]uint, len(alerts))
+	for i, alert := range alerts {
+		ids[i] = alert.ID
+	}
+
+	prefs, err := n.notifications.FindPreferences(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Without preferences alerts are only listed in the app
+		return n.alerts.MarkNotified(ids, now)
+	}
+	if err != nil {
+		return err
+	}
+	if notify.InQuietHours(*prefs, now) {
+		return nil
+	}
+
+	overrides, err := n.notifications.ListRuleChannels(userID)
+	if err != nil {
+		return err
+	}
+	channelsOf := map[ruleKey]models.Channels{}
+	for _, o := range overrides {
+		channelsOf[ruleKey{o.Kind, o.RuleID}] = o.Channels
+	}
+
+	perChannel := map[models.NotificationChannel][]models.Alert{}
+	for _, alert := range alerts {
+		if alert.Status != models.AlertNew {
+			continue
+		}
+		channels := prefs.Channels
+		if alert.RuleID != nil {
+			if override, ok := channelsOf[ruleKey{alert.Kind, *alert.RuleID}]; ok {
+				channels = override
+			}
+		}
+		for _, channel := range channels {
+			perChannel[channel] = append(perChannel[channel], alert)
+		}
+	}
+
+	if len(perChannel) > 0 {
+		to, err := n.recipient(*prefs)
+		if err != nil {
+			return err
+		}
+		loc, _ := notify.Location(*prefs)
+		for _, channel := range []models.NotificationChannel{models.ChannelEmail, models.ChannelWebhook} {
+			if len(perChannel[channel]) > 0 {
+				n.send(channel, to, notify.AlertsMessage(perChannel[channel], loc))
+			}
+		}
+	}
+	return n.alerts.MarkNotified(ids, now)
+}
+
+// recipient resolves where a user's messages go
+func (n *notifier) recipient(prefs models.NotificationPreferences) (recipient, error) {
+	user, err := n.users.FindByID(prefs.UserID)
+	if err != nil {
+		return recipient{}, err
+	}
+	to := recipient{UserID: user.ID, Name: user.Name, Email: prefs.Email, WebhookURL: prefs.WebhookURL}
+	if to.Email == "" {
+		to.Email = user.Email
+	}
+	return to, nil
+}
+
+// send delivers a message on one channel, logging the outcome
+func (n *notifier) send(channel models.NotificationChannel, to recipient, msg notify.Message) {
+	s, ok := n.senders[channel]
+	if !ok {
+		log.Printf("⚠️  No sender for channel %s\n", channel)
+		return
+	}
+	if err := s.Send(to, msg); err != nil {
+		log.Printf("❌ %s to user %d failed: %v\n", channel, to.UserID, err)
+		return
+	}
+	log.Printf("📨 %s sent to user %d: %s\n", channel, to.UserID, msg.Subject)
+}
+
+// ----------------- Digests -----------------
+
+// sendDigests sends the digests that are due. An empty digest is skipped
+// but still counts as sent.
+func (n *notifier) sendDigests(now time.Time) error {
+	subscribers, err := n.notifications.ListDigests()
+	if err != nil {
+		return err
+	}
+	for _, prefs := range subscribers {
+		from, due := notify.DigestDue(prefs, now)
+		if !due {
+			continue
+		}
+		digest, err := n.buildDigest(prefs, from, now)
+		if err != nil {
+			log.Printf("❌ Failed to build the digest of user %d: %v\n", prefs.UserID, err)
+			continue
+		}
+		if !digest.Empty() {
+			to, err := n.recipient(prefs)
+			if err != nil {
+				log.Printf("❌ Failed to send the digest of user %d: %v\n", prefs.UserID, err)
+				continue
+			}
+			loc, _ := notify.Location(prefs)
+			msg := digest.Message(loc)
+			for _, channel := range prefs.Channels {
+				n.send(channel, to, msg)
+			}
+		}
+		if err := n.notifications.SetLastDigest(prefs.UserID, now); err != nil {
+			log.Printf("❌ Failed to record the digest of user %d: %v\n", prefs.UserID, err)
+		}
+	}
+	return nil
+}
+
+// buildDigest gathers a user's alerts, portfolio performance and the signal
+// changes of their symbols over [from, to)
+func (n *notifier) buildDigest(prefs models.NotificationPreferences, from, to time.Time) (notify.Digest, error) {
+	digest := notify.Digest{Frequency: prefs.Digest, From: from, To: to}
+	alerts, err := n.alerts.ListBetween(prefs.UserID, from, to)
+	if err != nil {
+		return digest, err
+	}
+	digest.Alerts = alerts
+
+	base := models.DefaultCurrency
+	user, err := n.users.FindByID(prefs.UserID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return digest, err
+	}
+	if err == nil {
+		base = user.Base()
+	}
+
+	portfolios, err := n.portfolios.ListByUser(prefs.UserID)
+	if err != nil {
+		return digest, err
+	}
+	symbols := map[string]bool{}
+	for _, portfolio := range portfolios {
+		for _, stock := range portfolio.Stocks {
+			symbols[stock.StockSymbol] = true
+		}
+		if !portfolio.HasHoldings() {
+			continue
+		}
+		positions, err := n.positions.ListByPortfolio(portfolio.ID)
+		if err != nil {
+			return digest, err
+		}
+		if len(positions) == 0 {
+			continue
+		}
+		summary, err := n.summarize(portfolio, positions, base, from)
+		if err != nil {
+			return digest, err
+		}
+		digest.Portfolios = append(digest.Portfolios, summary)
+		for _, p := range positions {
+			symbols[p.Symbol] = true
+		}
+	}
+
+	if len(symbols) > 0 {
+		list := make([]string, 0, len(symbols))
+		for symbol := range symbols {
+			list = append(list, symbol)
+		}
+		sort.Strings(list)
+		digest.Signals, err = n.analytics.ListSignals(list, from, to)
+		if err != nil {
+			return digest, err
+		}
+	}
+	return digest, nil
+}
+
+// summarize values a portfolio in the base currency at the latest prices and
+// rates and at the daily closes before `from`. Symbols without a close fall
+// back to the latest price.
+func (n *notifier) summarize(portfolio models.Portfolio, positions []models.Position, base string, from time.Time) (notify.PortfolioSummary, error) {
+	symbols := make([]string, len(positions))
+	currencies := make([]string, len(positions))
+	for i, p := range positions {
+		symbols[i] = p.Symbol
+		currencies[i] = p.Currency
+	}
+	latest, err := n.prices.Latest(append(symbols, fx.Pairs(currencies, base)...))
+	if err != nil {
+		return notify.PortfolioSummary{}, err
+	}
+	bars, err := n.bars.ListBetween(models.Interval1d, from.AddDate(0, 0, -7), from)
+	if err != nil {
+		return notify.PortfolioSummary{}, err
+	}
+	closes := map[string]models.StockPriceRecord{}
+	for _, bar := range bars {
+		closes[bar.Symbol] = models.StockPriceRecord{Symbol: bar.Symbol, Price: bar.Close, Timestamp: bar.Bucket}
+	}
+	for symbol, record := range latest {
+		if _, ok := closes[symbol]; !ok {
+			closes[symbol] = record
+		}
+	}
+
+	now := valuation.Value(portfolio.ID, positions, latest)
+	now.Convert(base, fx.FromPrices(latest))
+	before := valuation.Value(portfolio.ID, positions, closes)
+	before.Convert(base, fx.FromPrices(closes))
+	summary := notify.PortfolioSummary{
+		Name:     portfolio.Name,
+		Currency: base,
+		Value:    now.Base.MarketValue,
+		Unpriced: append(now.Unpriced, unconverted(now)...),
+	}
+	if start := before.Base.MarketValue; len(summary.Unpriced) == 0 && before.Converted() && start.IsPositive() {
+		summary.Change = summary.Value.Sub(start)
+		summary.ChangePct = valuation.Percent(summary.Change, start)
+	}
+	return summary, nil
+}
+
+// unconverted lists the priced symbols whose currency has no rate to the
+// base currency, and so are left out of the value
+func unconverted(v valuation.Valuation) []string {
+	symbols := []string{}
+	for _, p := range v.Positions {
+		for _, currency := range v.Base.Unconverted {
+			if p.Priced && p.Currency == currency {
+				symbols = append(symbols, p.Symbol)
+			}
+		}
+	}
+	return symbols
+}
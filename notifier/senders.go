@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"stock-alerts/models"
+	"stock-alerts/notify"
+)
+
+// recipient is where a user's messages go
+type recipient struct {
+	UserID     uint
+	Name       string
+	Email      string
+	WebhookURL string
+}
+
+// sender delivers messages on one channel
+type sender interface {
+	Send(to recipient, msg notify.Message) error
+}
+
+// sendersFromEnv builds the channel senders. Without SMTP_ADDR emails are
+// only logged.
+func sendersFromEnv() map[models.NotificationChannel]sender {
+	var email sender = logSender{}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		from := os.Getenv("SMTP_FROM")
+		if from == "" {
+			from = "alerts@localhost"
+		}
+		var auth smtp.Auth
+		if user := os.Getenv("SMTP_USERNAME"); user != "" {
+			host := strings.Split(addr, ":")[0]
+			auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		email = &emailSender{addr: addr, from: from, auth: auth}
+	} else {
+		log.Println("⚠️  SMTP_ADDR not set, emails will only be logged")
+	}
+	return map[models.NotificationChannel]sender{
+		models.ChannelEmail:   email,
+		models.ChannelWebhook: &webhookSender{client: &http.Client{Timeout: 10 * time.Second}},
+	}
+}
+
+// ----------------- Email -----------------
+type emailSender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (s *emailSender) Send(to recipient, msg notify.Message) error {
+	if to.Email == "" {
+		return fmt.Errorf("user %d has no email address", to.UserID)
+	}
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		s.from, to.Email, msg.Subject, strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{to.Email}, []byte(body))
+}
+
+// logSender stands in for email when no SMTP server is configured
+type logSender struct{}
+
+func (logSender) Send(to recipient, msg notify.Message) error {
+	log.Printf("📧 Email to %s: %s\n%s", to.Email, msg.Subject, msg.Text)
+	return nil
+}
+
+// ----------------- Webhook -----------------
+type webhookSender struct {
+	client *http.Client
+}
+
+// webhookPayload is the JSON body POSTed to a user's webhook
+type webhookPayload struct {
+	UserID uint
+	notify.Message
+}
+
+func (s *webhookSender) Send(to recipient, msg notify.Message) error {
+	if to.WebhookURL == "" {
+		return fmt.Errorf("user %d has no webhook URL", to.UserID)
+	}
+	body, err := json.Marshal(webhookPayload{UserID: to.UserID, Message: msg})
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(to.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// Message is what a channel delivers to a user
+type Message struct {
+	Subject string
+	Text    string
+	Alerts  []models.Alert `json:",omitempty"`
+	Digest  *Digest        `json:",omitempty"`
+}
+
+// Describe returns an alert's message, or a threshold alert's price
+func Describe(alert models.Alert) string {
+	if alert.Message != "" {
+		return alert.Message
+	}
+	return fmt.Sprintf("%s reached %s", alert.StockSymbol, alert.Price.StringFixed(2))
+}
+
+// AlertsMessage describes alerts sent together, such as those queued during quiet hours
+func AlertsMessage(alerts []models.Alert, loc *time.Location) Message {
+	msg := Message{Alerts: alerts}
+	if len(alerts) == 1 {
+		msg.Subject = "Stock alert: " + Describe(alerts[0])
+	} else {
+		msg.Subject = fmt.Sprintf("%d stock alerts", len(alerts))
+	}
+	var b strings.Builder
+	for _, alert := range alerts {
+		fmt.Fprintf(&b, "%s  %s\n", alert.Timestamp.In(loc).Format("Jan 2 15:04"), Describe(alert))
+	}
+	msg.Text = b.String()
+	return msg
+}
+
+// PortfolioSummary is a portfolio's performance over a digest period. The
+// change compares today's value with the value of the same positions at the
+// closes before the period.
+type PortfolioSummary struct {
+	Name      string
+	Currency  string // of Value and Change, the user's base currency
+	Value     decimal.Decimal
+	Change    decimal.Decimal
+	ChangePct decimal.Decimal
+	Unpriced  []string `json:",omitempty"` // symbols left out for lack of a price or FX rate
+}
+
+// Digest summarizes a user's alerts, portfolios and signals over a period
+type Digest struct {
+	Frequency  models.DigestFrequency
+	From, To   time.Time
+	Alerts     []models.Alert
+	Portfolios []PortfolioSummary
+	Signals    []models.StockAnalytics
+}
+
+// Empty reports whether the digest has nothing to tell
+func (d Digest) Empty() bool {
+	return len(d.Alerts) == 0 && len(d.Portfolios) == 0 && len(d.Signals) == 0
+}
+
+// maxDigestAlerts caps the alerts listed one by one in a digest
+const maxDigestAlerts = 20
+
+// Message renders the digest in the user's timezone
+func (d Digest) Message(loc *time.Location) Message {
+	period := "Daily"
+	if d.Frequency == models.DigestWeekly {
+		period = "Weekly"
+	}
+	msg := Message{
+		Subject: fmt.Sprintf("%s stock digest: %d alerts", period, len(d.Alerts)),
+		Digest:  &d,
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s digest, %s to %s\n", period, d.From.In(loc).Format("Jan 2 15:04"), d.To.In(loc).Format("Jan 2 15:04"))
+
+	fmt.Fprintf(&b, "\nAlerts (%d)\n", len(d.Alerts))
+	counts := map[models.AlertKind]int{}
+	for _, alert := range d.Alerts {
+		counts[alert.Kind]++
+	}
+	for _, kind := range sortedKinds(counts) {
+		fmt.Fprintf(&b, "  %s: %d\n", kind, counts[kind])
+	}
+	for i, alert := range d.Alerts {
+		if i == maxDigestAlerts {
+			fmt.Fprintf(&b, "  ... and %d more\n", len(d.Alerts)-maxDigestAlerts)
+			break
+		}
+		fmt.Fprintf(&b, "  %s  %s\n", alert.Timestamp.In(loc).Format("Jan 2 15:04"), Describe(alert))
+	}
+
+	if len(d.Portfolios) > 0 {
+		b.WriteString("\nPortfolios\n")
+		for _, p := range d.Portfolios {
+			fmt.Fprintf(&b, "  %s: %s %s (%s, %s%%)", p.Name, p.Value.StringFixed(2), p.Currency, signed(p.Change), signed(p.ChangePct))
+			if len(p.Unpriced) > 0 {
+				fmt.Fprintf(&b, ", unpriced: %s", strings.Join(p.Unpriced, ", "))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(d.Signals) > 0 {
+		b.WriteString("\nSignals\n")
+		for _, signal := range d.Signals {
+			fmt.Fprintf(&b, "  %s  %s turned %s\n", signal.GeneratedAt.In(loc).Format("Jan 2 15:04"), signal.Symbol, signal.Signal)
+		}
+	}
+	msg.Text = b.String()
+	return msg
+}
+
+// sortedKinds returns the kinds of the counts, most frequent first
+func sortedKinds(counts map[models.AlertKind]int) []models.AlertKind {
+	kinds := make([]models.AlertKind, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if counts[kinds[i]] != counts[kinds[j]] {
+			return counts[kinds[i]] > counts[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+	return kinds
+}
+
+// signed formats an amount with two decimals and its sign
+func signed(d decimal.Decimal) string {
+	if d.IsNegative() {
+		return d.StringFixed(2)
+	}
+	return "+" + d.StringFixed(2)
+}
@@ -0,0 +1,143 @@
+// Package notify decides when and how users are told about their alerts:
+// preference checks, quiet hours, the digest schedule and message texts.
+// It is shared by the API, which validates preferences, and the notifier,
+// which sends the messages.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+	_ "time/tzdata" // users pick any IANA timezone, whatever the image ships
+
+	"stock-alerts/models"
+)
+
+// ParseClock reads an "HH:MM" time of day as minutes after midnight
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an HH:MM time", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Location returns the user's timezone, UTC when none is set
+func Location(prefs models.NotificationPreferences) (*time.Location, error) {
+	if prefs.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(prefs.Timezone)
+}
+
+// Validate checks preferences submitted by a user
+func Validate(prefs models.NotificationPreferences) error {
+	seen := map[models.NotificationChannel]bool{}
+	for _, channel := range prefs.Channels {
+		if !channel.Valid() {
+			return fmt.Errorf("channel %q must be EMAIL or WEBHOOK", channel)
+		}
+		if seen[channel] {
+			return fmt.Errorf("channel %s is listed twice", channel)
+		}
+		seen[channel] = true
+	}
+	if seen[models.ChannelWebhook] || prefs.WebhookURL != "" {
+		if err := validWebhook(prefs.WebhookURL); err != nil {
+			return err
+		}
+	}
+	if _, err := Location(prefs); err != nil {
+		return fmt.Errorf("unknown timezone %q", prefs.Timezone)
+	}
+	if (prefs.QuietStart == "") != (prefs.QuietEnd == "") {
+		return errors.New("quiet hours need both a start and an end")
+	}
+	for _, clock := range []string{prefs.QuietStart, prefs.QuietEnd} {
+		if clock == "" {
+			continue
+		}
+		if _, err := ParseClock(clock); err != nil {
+			return err
+		}
+	}
+	if prefs.Digest != "" && !prefs.Digest.Valid() {
+		return errors.New("digest must be NONE, DAILY or WEEKLY")
+	}
+	if prefs.DigestHour < 0 || prefs.DigestHour > 23 {
+		return errors.New("digest hour must be between 0 and 23")
+	}
+	if prefs.DigestWeekday < time.Sunday || prefs.DigestWeekday > time.Saturday {
+		return errors.New("digest weekday must be between 0 (Sunday) and 6 (Saturday)")
+	}
+	if prefs.Digest != "" && prefs.Digest != models.DigestNone && len(prefs.Channels) == 0 {
+		return errors.New("a digest needs at least one channel")
+	}
+	return nil
+}
+
+// validWebhook checks that a webhook URL is an absolute http(s) URL
+func validWebhook(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook URL must be an http or https URL")
+	}
+	return nil
+}
+
+// InQuietHours reports whether at falls in the user's quiet hours. The
+// start is inclusive and the end exclusive; a start after the end spans
+// midnight.
+func InQuietHours(prefs models.NotificationPreferences, at time.Time) bool {
+	start, err1 := ParseClock(prefs.QuietStart)
+	end, err2 := ParseClock(prefs.QuietEnd)
+	loc, err3 := Location(prefs)
+	if err1 != nil || err2 != nil || err3 != nil || start == end {
+		return false
+	}
+	local := at.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// DigestDue reports whether a digest is due at now and the period it
+// covers. A digest is due once the latest scheduled time has passed without
+// one being sent; a new subscriber waits for the next scheduled time.
+func DigestDue(prefs models.NotificationPreferences, now time.Time) (from time.Time, due bool) {
+	if prefs.Digest != models.DigestDaily && prefs.Digest != models.DigestWeekly {
+		return time.Time{}, false
+	}
+	loc, err := Location(prefs)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(loc)
+	slot := time.Date(local.Year(), local.Month(), local.Day(), prefs.DigestHour, 0, 0, 0, loc)
+	days := 1
+	if prefs.Digest == models.DigestWeekly {
+		days = 7
+		slot = slot.AddDate(0, 0, -((int(local.Weekday()) - int(prefs.DigestWeekday) + 7) % 7))
+	}
+	if slot.After(now) {
+		slot = slot.AddDate(0, 0, -days)
+	}
+
+	from = slot.AddDate(0, 0, -days)
+	switch {
+	case prefs.LastDigestAt != nil:
+		if !prefs.LastDigestAt.Before(slot) {
+			return time.Time{}, false
+		}
+		if prefs.LastDigestAt.After(from) {
+			from = *prefs.LastDigestAt
+		}
+	case !prefs.UpdatedAt.Before(slot):
+		return time.Time{}, false
+	}
+	return from, true
+}
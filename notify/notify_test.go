@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestValidate(t *testing.T) {
+	valid := models.NotificationPreferences{
+		Channels:   models.Channels{models.ChannelEmail, models.ChannelWebhook},
+		WebhookURL: "https://example.com/hook",
+		Timezone:   "America/New_York",
+		QuietStart: "22:00",
+		QuietEnd:   "07:30",
+		Digest:     models.DigestWeekly,
+		DigestHour: 8,
+	}
+	if err := Validate(valid); err != nil {
+		t.Fatalf("Expected valid preferences, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *models.NotificationPreferences)
+	}{
+		{"unknown channel", func(p *models.NotificationPreferences) { p.Channels = models.Channels{"SMS"} }},
+		{"duplicate channel", func(p *models.NotificationPreferences) {
+			p.Channels = models.Channels{models.ChannelEmail, models.ChannelEmail}
+		}},
+		{"webhook without URL", func(p *models.NotificationPreferences) { p.WebhookURL = "" }},
+		{"webhook not http", func(p *models.NotificationPreferences) { p.WebhookURL = "ftp://example.com" }},
+		{"unknown timezone", func(p *models.NotificationPreferences) { p.Timezone = "Mars/Olympus" }},
+		{"quiet start only", func(p *models.NotificationPreferences) { p.QuietEnd = "" }},
+		{"bad clock", func(p *models.NotificationPreferences) { p.QuietStart = "25:00" }},
+		{"bad digest", func(p *models.NotificationPreferences) { p.Digest = "HOURLY" }},
+		{"bad hour", func(p *models.NotificationPreferences) { p.DigestHour = 24 }},
+		{"bad weekday", func(p *models.NotificationPreferences) { p.DigestWeekday = 7 }},
+		{"digest without channels", func(p *models.NotificationPreferences) { p.Channels, p.WebhookURL = nil, "" }},
+	}
+	for _, tt := range tests {
+		prefs := valid
+		tt.change(&prefs)
+		if err := Validate(prefs); err == nil {
+			t.Errorf("Expected %s to be rejected", tt.name)
+		}
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	overnight := models.NotificationPreferences{Timezone: "Europe/Paris", QuietStart: "22:00", QuietEnd: "07:00"}
+	daytime := models.NotificationPreferences{QuietStart: "12:00", QuietEnd: "13:30"}
+	tests := []struct {
+		prefs models.NotificationPreferences
+		at    time.Time
+		want  bool
+	}{
+		// 21:30 UTC is 22:30 in Paris in winter
+		{overnight, time.Date(2025, 1, 10, 21, 30, 0, 0, time.UTC), true},
+		{overnight, time.Date(2025, 1, 10, 5, 59, 0, 0, time.UTC), true},
+		{overnight, time.Date(2025, 1, 10, 6, 0, 0, 0, time.UTC), false},
+		{overnight, time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC), false},
+		{daytime, time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC), true},
+		{daytime, time.Date(2025, 1, 10, 13, 30, 0, 0, time.UTC), false},
+		{models.NotificationPreferences{}, time.Date(2025, 1, 10, 3, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		if got := InQuietHours(tt.prefs, tt.at); got != tt.want {
+			t.Errorf("Expected InQuietHours(%s-%s, %v) to be %v, got %v", tt.prefs.QuietStart, tt.prefs.QuietEnd, tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestDigestDue(t *testing.T) {
+	loc, _ := time.LoadLocation("America/New_York")
+	subscribed := time.Date(2025, 3, 1, 12, 0, 0, 0, loc)
+	daily := models.NotificationPreferences{Timezone: "America/New_York", Digest: models.DigestDaily, DigestHour: 8, UpdatedAt: subscribed}
+
+	if _, due := DigestDue(daily, time.Date(2025, 3, 1, 20, 0, 0, 0, loc)); due {
+		t.Errorf("Expected a new subscriber to wait for the next scheduled time")
+	}
+	from, due := DigestDue(daily, time.Date(2025, 3, 2, 8, 5, 0, 0, loc))
+	if !due || !from.Equal(time.Date(2025, 3, 1, 8, 0, 0, 0, loc)) {
+		t.Errorf("Expected the first digest to cover the previous day, got %v %v", from, due)
+	}
+
+	sent := time.Date(2025, 3, 2, 8, 5, 0, 0, loc)
+	daily.LastDigestAt = &sent
+	if _, due := DigestDue(daily, time.Date(2025, 3, 2, 23, 0, 0, 0, loc)); due {
+		t.Errorf("Expected no second digest on the same day")
+	}
+	from, due = DigestDue(daily, time.Date(2025, 3, 3, 9, 0, 0, 0, loc))
+	if !due || !from.Equal(sent) {
+		t.Errorf("Expected the digest to start at the last one, got %v %v", from, due)
+	}
+
+	weekly := models.NotificationPreferences{Digest: models.DigestWeekly, DigestHour: 9, DigestWeekday: time.Monday, UpdatedAt: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)}
+	if _, due := DigestDue(weekly, time.Date(2025, 3, 2, 23, 0, 0, 0, time.UTC)); due {
+		t.Errorf("Expected no weekly digest before Monday")
+	}
+	from, due = DigestDue(weekly, time.Date(2025, 3, 5, 10, 0, 0, 0, time.UTC))
+	if !due || !from.Equal(time.Date(2025, 2, 24, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the weekly digest to cover the week before Monday, got %v %v", from, due)
+	}
+	if _, due := DigestDue(models.NotificationPreferences{Digest: models.DigestNone}, time.Now()); due {
+		t.Errorf("Expected no digest without a subscription")
+	}
+}
+
+func TestDigestMessage(t *testing.T) {
+	at := time.Date(2025, 3, 3, 14, 30, 0, 0, time.UTC)
+	digest := Digest{
+		Frequency: models.DigestDaily,
+		From:      at.Add(-24 * time.Hour),
+		To:        at,
+		Alerts: []models.Alert{
+			{Kind: models.AlertThreshold, StockSymbol: "AAPL", Price: decimal.NewFromInt(151), Timestamp: at},
+			{Kind: models.AlertExpression, Message: "AAPL: price > sma(20)", Timestamp: at},
+		},
+		Portfolios: []PortfolioSummary{{Name: "Main", Currency: "EUR", Value: decimal.NewFromInt(1510), Change: decimal.NewFromInt(10), ChangePct: decimal.RequireFromString("0.67")}},
+		Signals:    []models.StockAnalytics{{Symbol: "AAPL", Signal: models.SignalBullish, GeneratedAt: at}},
+	}
+	msg := digest.Message(time.UTC)
+	if msg.Subject != "Daily stock digest: 2 alerts" {
+		t.Errorf("Unexpected subject %q", msg.Subject)
+	}
+	for _, want := range []string{"AAPL reached 151.00", "AAPL: price > sma(20)", "Main: 1510.00 EUR (+10.00, +0.67%)", "AAPL turned BULLISH"} {
+		if !strings.Contains(msg.Text, want) {
+			t.Errorf("Expected the digest to contain %q, got:\n%s", want, msg.Text)
+		}
+	}
+	if (Digest{}).Empty() != true || digest.Empty() {
+		t.Errorf("Expected only the blank digest to be empty")
+	}
+}
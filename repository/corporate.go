@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"stock-alerts/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ----------------- Corporate Actions -----------------
+type gormCorporateActionRepo struct {
+	db *gorm.DB
+}
+
+// symbolColumns lists every table holding a symbol a rename moves, with its
+// column and, for history unique per symbol, the other column of the key.
+// Alerts keep the symbol they were raised for.
+var symbolColumns = []struct{ table, column, key string }{
+	{"stocks", "stock_symbol", ""},
+	{"positions", "symbol", ""}, // merged by mergePositions first
+	{"transactions", "symbol", ""},
+	{"position_alert_rules", "symbol", ""},
+	{"expression_rules", "symbol", ""},
+	{"signal_rules", "symbol", ""},
+	{"stock_prices", "symbol", ""},
+	{"stock_price_records", "symbol", ""},
+	{"stock_price_bars_1m", "symbol", "bucket"},
+	{"stock_price_bars_1h", "symbol", "bucket"},
+	{"stock_price_bars_1d", "symbol", "bucket"},
+	{"stock_daily_analytics", "symbol", "date"},
+	{"stock_analytics", "symbol", ""},
+}
+
+func (r *gormCorporateActionRepo) Create(action *models.CorporateAction) (bool, error) {
+	action.EffectiveDate = action.EffectiveDate.UTC()
+	result := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "type"}, {Name: "symbol"}, {Name: "effective_date"}},
+		DoNothing: true,
+	}).Create(action)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormCorporateActionRepo) List(symbol string) ([]models.CorporateAction, error) {
+	query := r.db.Order("effective_date, id")
+	if symbol != "" {
+		query = query.Where("symbol = ? OR new_symbol = ?", symbol, symbol)
+	}
+	var actions []models.CorporateAction
+	err := query.Find(&actions).Error
+	return actions, err
+}
+
+func (r *gormCorporateActionRepo) ListPending() ([]models.CorporateAction, error) {
+	var actions []models.CorporateAction
+	err := r.db.Where("applied_at IS NULL").Order("effective_date, id").Find(&actions).Error
+	return actions, err
+}
+
+func (r *gormCorporateActionRepo) DeletePending(id uint) error {
+	result := r.db.Where("id = ? AND applied_at IS NULL", id).Delete(&models.CorporateAction{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// claim marks an action applied, failing with ErrNotFound when it already is.
+// The row stays locked until the transaction ends, so concurrent appliers
+// cannot both apply it.
+func claim(tx *gorm.DB, id uint, at time.Time) error {
+	result := tx.Model(&models.CorporateAction{}).Where("id = ? AND applied_at IS NULL", id).Update("applied_at", at.UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormCorporateActionRepo) ApplySplit(action models.CorporateAction, cutoff, at time.Time) ([]uint, error) {
+	symbol, ratio := action.Symbol, action.Ratio
+	date, cutoff := action.EffectiveDate.UTC(), cutoff.UTC()
+	divide := func(column string) clause.Expr { return gorm.Expr(column+" / ?", ratio) }
+
+	var ledgers []uint
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := claim(tx, action.ID, at); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Stock{}).Where("stock_symbol = ?", symbol).
+			Update("threshold_price", divide("threshold_price")).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PositionAlertRule{}).Where("symbol = ?", symbol).
+			Update("high_water", divide("high_water")).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PositionAlertRule{}).Where("symbol = ? AND unit = ?", symbol, models.UnitAmount).
+			Update("value", divide("value")).Error; err != nil {
+			return err
+		}
+
+		// Ledgers holding the symbol before the split get a SPLIT entry, unless
+		// one was recorded by hand; positions without ledger entries in the symbol
+		// are scaled here
+		var held []models.Transaction
+		if err := tx.Where("symbol = ? AND trade_date < ?", symbol, date).Order("trade_date, id").Find(&held).Error; err != nil {
+			return err
+		}
+		var recorded []uint
+		if err := tx.Model(&models.Transaction{}).
+			Where("symbol = ? AND type = ? AND trade_date = ?", symbol, models.TransactionSplit, date).
+			Pluck("portfolio_id", &recorded).Error; err != nil {
+			return err
+		}
+		skip := map[uint]bool{}
+		for _, id := range recorded {
+			skip[id] = true
+		}
+		for _, t := range held {
+			if skip[t.PortfolioID] {
+				continue
+			}
+			skip[t.PortfolioID] = true
+			ledgers = append(ledgers, t.PortfolioID)
+			split := models.Transaction{
+				PortfolioID: t.PortfolioID,
+				Type:        models.TransactionSplit,
+				Symbol:      symbol,
+				Quantity:    ratio,
+				Currency:    t.Currency,
+				TradeDate:   date,
+			}
+			if err := tx.Create(&split).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.Position{}).
+			Where("symbol = ? AND NOT EXISTS (?)", symbol, tx.Model(&models.Transaction{}).Select("1").
+				Where("transactions.portfolio_id = positions.portfolio_id AND transactions.symbol = ?", symbol)).
+			Updates(map[string]any{"quantity": gorm.Expr("quantity * ?", ratio), "avg_cost": divide("avg_cost")}).Error; err != nil {
+			return err
+		}
+
+		// Price history before the split
+		if err := tx.Model(&models.StockPriceRecord{}).Where(`symbol = ? AND "timestamp" < ?`, symbol, cutoff).
+			Update("price", divide("price")).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.StockPrice{}).Where(`symbol = ? AND "timestamp" < ?`, symbol, cutoff).
+			Update("price", divide("price")).Error; err != nil {
+			return err
+		}
+		for _, interval := range models.BarIntervals {
+			// Bars ending after the cutoff may hold post-split ticks; they are left as is
+			if err := tx.Table("stock_price_bars_"+string(interval)).
+				Where("symbol = ? AND bucket <= ?", symbol, cutoff.Add(-interval.Duration())).
+				Updates(map[string]any{"open": divide("open"), "high": divide("high"), "low": divide("low"), "close": divide("close")}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.DailyAnalytics{}).Where("symbol = ? AND date < ?", symbol, date).
+			Updates(map[string]any{"min_price": divide("min_price"), "max_price": divide("max_price"), "avg_price": divide("avg_price"), "price_sum": divide("price_sum")}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.StockAnalytics{}).Where("symbol = ? AND generated_at < ?", symbol, cutoff).
+			Updates(map[string]any{"avg5": divide("avg5"), "avg20": divide("avg20")}).Error; err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ledgers, nil
+}
+
+// mergePositions folds a portfolio's position in the old symbol into the one it
+// already holds in the new symbol, so the rename keeps one position per symbol
+func mergePositions(tx *gorm.DB, from, to string) error {
+	var old []models.Position
+	if err := tx.Where("symbol = ? AND portfolio_id IN (?)", from, tx.Model(&models.Position{}).Select("portfolio_id").Where("symbol = ?", to)).
+		Find(&old).Error; err != nil {
+		return err
+	}
+	for _, position := range old {
+		var target models.Position
+		if err := tx.Where("portfolio_id = ? AND symbol = ?", position.PortfolioID, to).First(&target).Error; err != nil {
+			return err
+		}
+		target = mergePosition(target, position)
+		if err := tx.Save(&target).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&position).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergePosition adds a holding's shares and cost to another's
+func mergePosition(into, other models.Position) models.Position {
+	quantity := into.Quantity.Add(other.Quantity)
+	if quantity.IsPositive() {
+		cost := into.Quantity.Mul(into.AvgCost).Add(other.Quantity.Mul(other.AvgCost))
+		into.AvgCost = cost.Div(quantity)
+	}
+	into.Quantity = quantity
+	return into
+}
+
+func (r *gormCorporateActionRepo) ApplyRename(action models.CorporateAction, at time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := claim(tx, action.ID, at); err != nil {
+			return err
+		}
+		if err := mergePositions(tx, action.Symbol, action.NewSymbol); err != nil {
+			return err
+		}
+		for _, c := range symbolColumns {
+			// History the new symbol already has wins over the old symbol's
+			if c.key != "" {
+				err := tx.Exec(fmt.Sprintf("DELETE FROM %[1]s WHERE %[2]s = ? AND %[3]s IN (SELECT %[3]s FROM %[1]s WHERE %[2]s = ?)", c.table, c.column, c.key),
+					action.Symbol, action.NewSymbol).Error
+				if err != nil {
+					return err
+				}
+			}
+			if err := tx.Table(c.table).Where(c.column+" = ?", action.Symbol).
+				Update(c.column, action.NewSymbol).Error; err != nil {
+				return err
+			}
+		}
+
+		// The new symbol takes over the catalog entry unless it has its own
+		var entry models.Symbol
+		err := tx.Where("symbol = ?", action.Symbol).First(&entry).Error
+		if err == nil {
+			entry.ID, entry.Symbol = 0, action.NewSymbol
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error; err != nil {
+				return err
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,703 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewGormRepositories returns repositories backed by the given database
+func NewGormRepositories(db *gorm.DB) Repositories {
+	return Repositories{
+		Users:           &gormUserRepo{db: db},
+		Symbols:         &gormSymbolRepo{db: db},
+		Portfolios:      &gormPortfolioRepo{db: db},
+		Stocks:          &gormStockRepo{db: db},
+		Positions:       &gormPositionRepo{db: db},
+		Transactions:    &gormTransactionRepo{db: db},
+		PortfolioRules:  &gormPortfolioRuleRepo{db: db},
+		PositionRules:   &gormPositionRuleRepo{db: db},
+		SignalRules:     &gormSignalRuleRepo{db: db},
+		ExpressionRules: &gormExpressionRuleRepo{db: db},
+		Alerts:          &gormAlertRepo{db: db},
+		Notifications:   &gormNotificationRepo{db: db},
+		Prices:          &gormPriceRepo{db: db},
+		Bars:            &gormBarRepo{db: db},
+		Analytics:       &gormAnalyticsRepo{db: db},
+		AnalyticsShadow: &gormAnalyticsShadowRepo{db: db},
+		Actions:         &gormCorporateActionRepo{db: db},
+	}
+}
+
+// translate maps GORM errors onto the repository errors
+func translate(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// ----------------- Users -----------------
+type gormUserRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormUserRepo) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r *gormUserRepo) List() ([]models.User, error) {
+	var users []models.User
+	err := r.db.Find(&users).Error
+	return users, err
+}
+
+func (r *gormUserRepo) FindByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.First(&user, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepo) SetBaseCurrency(id uint, currency string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, id).Error; err != nil {
+			return translate(err)
+		}
+		if user.Base() == (models.User{BaseCurrency: currency}).Base() {
+			return nil
+		}
+		if err := tx.Model(&user).Update("base_currency", currency).Error; err != nil {
+			return err
+		}
+		// Drawdown peaks were measured in the old currency
+		return tx.Model(&models.PortfolioAlertRule{}).
+			Where("type = ? AND portfolio_id IN (?)", models.RuleDrawdown,
+				tx.Model(&models.Portfolio{}).Select("id").Where("user_id = ?", id)).
+			Update("peak", decimal.Zero).Error
+	})
+}
+
+// ----------------- Symbols -----------------
+type gormSymbolRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormSymbolRepo) Upsert(symbols []models.Symbol) error {
+	if len(symbols) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "symbol"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "exchange", "currency", "type", "sector", "updated_at"}),
+	}).CreateInBatches(symbols, 500).Error
+}
+
+func (r *gormSymbolRepo) Find(symbol string) (*models.Symbol, error) {
+	var entry models.Symbol
+	if err := r.db.Where("symbol = ?", strings.ToUpper(symbol)).First(&entry).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &entry, nil
+}
+
+func (r *gormSymbolRepo) Search(q string, limit int) ([]models.Symbol, error) {
+	q = strings.ToUpper(q)
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q)
+	var symbols []models.Symbol
+	err := r.db.Where(`symbol LIKE ? ESCAPE '\' OR UPPER(name) LIKE ? ESCAPE '\'`, escaped+"%", "%"+escaped+"%").
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "CASE WHEN symbol = ? THEN 0 WHEN symbol LIKE ? ESCAPE '\\' THEN 1 ELSE 2 END, symbol",
+			Vars:               []any{q, escaped + "%"},
+			WithoutParentheses: true,
+		}}).
+		Limit(limit).Find(&symbols).Error
+	return symbols, err
+}
+
+func (r *gormSymbolRepo) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Symbol{}).Count(&count).Error
+	return count, err
+}
+
+// ----------------- Portfolios -----------------
+type gormPortfolioRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormPortfolioRepo) Create(portfolio *models.Portfolio) error {
+	return r.db.Create(portfolio).Error
+}
+
+func (r *gormPortfolioRepo) List() ([]models.Portfolio, error) {
+	var portfolios []models.Portfolio
+	err := r.db.Find(&portfolios).Error
+	return portfolios, err
+}
+
+func (r *gormPortfolioRepo) FindByID(id uint) (*models.Portfolio, error) {
+	var portfolio models.Portfolio
+	if err := r.db.First(&portfolio, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &portfolio, nil
+}
+
+func (r *gormPortfolioRepo) FindByUserID(userID uint) (*models.Portfolio, error) {
+	var portfolio models.Portfolio
+	err := r.db.Preload("Stocks").Where("user_id = ?", userID).Order("id").First(&portfolio).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &portfolio, nil
+}
+
+func (r *gormPortfolioRepo) ListByUser(userID uint) ([]models.Portfolio, error) {
+	var portfolios []models.Portfolio
+	err := r.db.Preload("Stocks").Where("user_id = ?", userID).Order("id").Find(&portfolios).Error
+	return portfolios, err
+}
+
+func (r *gormPortfolioRepo) SetCostMethod(id uint, method string) error {
+	result := r.db.Model(&models.Portfolio{}).Where("id = ?", id).Update("cost_method", method)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ----------------- Stocks -----------------
+type gormStockRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormStockRepo) Create(stock *models.Stock) error {
+	return r.db.Create(stock).Error
+}
+
+func (r *gormStockRepo) List() ([]models.Stock, error) {
+	var stocks []models.Stock
+	err := r.db.Find(&stocks).Error
+	return stocks, err
+}
+
+func (r *gormStockRepo) ListByPortfolio(portfolioID uint) ([]models.Stock, error) {
+	var stocks []models.Stock
+	err := r.db.Where("portfolio_id = ?", portfolioID).Find(&stocks).Error
+	return stocks, err
+}
+
+func (r *gormStockRepo) ListBySymbol(symbol string) ([]models.Stock, error) {
+	var stocks []models.Stock
+	err := r.db.Where("stock_symbol = ?", symbol).Find(&stocks).Error
+	return stocks, err
+}
+
+func (r *gormStockRepo) MoveSymbol(fromPortfolioID, toPortfolioID uint, symbol string) ([]models.Stock, error) {
+	var stocks []models.Stock
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("portfolio_id = ? AND stock_symbol = ?", fromPortfolioID, symbol).Find(&stocks).Error; err != nil {
+			return err
+		}
+		if len(stocks) == 0 {
+			return ErrNotFound
+		}
+		ids := make([]uint, len(stocks))
+		for i := range stocks {
+			ids[i] = stocks[i].ID
+			stocks[i].PortfolioID = toPortfolioID
+		}
+		return tx.Model(&models.Stock{}).Where("id IN ?", ids).Update("portfolio_id", toPortfolioID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stocks, nil
+}
+
+// ----------------- Positions -----------------
+type gormPositionRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormPositionRepo) Upsert(position *models.Position) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "portfolio_id"}, {Name: "symbol"}},
+		DoUpdates: clause.AssignmentColumns([]string{"quantity", "avg_cost", "currency"}),
+	}).Create(position).Error
+}
+
+func (r *gormPositionRepo) ListByPortfolio(portfolioID uint) ([]models.Position, error) {
+	var positions []models.Position
+	err := r.db.Where("portfolio_id = ?", portfolioID).Order("symbol").Find(&positions).Error
+	return positions, err
+}
+
+func (r *gormPositionRepo) Delete(portfolioID uint, symbol string) error {
+	result := r.db.Where("portfolio_id = ? AND symbol = ?", portfolioID, symbol).Delete(&models.Position{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormPositionRepo) List() ([]models.Position, error) {
+	var positions []models.Position
+	err := r.db.Order("portfolio_id, symbol").Find(&positions).Error
+	return positions, err
+}
+
+func (r *gormPositionRepo) Replace(portfolioID uint, positions []models.Position) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("portfolio_id = ?", portfolioID).Delete(&models.Position{}).Error; err != nil {
+			return err
+		}
+		if len(positions) == 0 {
+			return nil
+		}
+		for i := range positions {
+			positions[i].ID = 0
+			positions[i].PortfolioID = portfolioID
+		}
+		return tx.Create(&positions).Error
+	})
+}
+
+// ----------------- Transactions -----------------
+type gormTransactionRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormTransactionRepo) Create(transaction *models.Transaction) error {
+	transaction.TradeDate = transaction.TradeDate.UTC()
+	return r.db.Create(transaction).Error
+}
+
+func (r *gormTransactionRepo) ListByPortfolio(portfolioID uint) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := r.db.Where("portfolio_id = ?", portfolioID).Order("trade_date, id").Find(&transactions).Error
+	return transactions, err
+}
+
+func (r *gormTransactionRepo) Delete(portfolioID, id uint) error {
+	result := r.db.Where("portfolio_id = ? AND id = ?", portfolioID, id).Delete(&models.Transaction{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ----------------- Portfolio Rules -----------------
+type gormPortfolioRuleRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormPortfolioRuleRepo) Create(rule *models.PortfolioAlertRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *gormPortfolioRuleRepo) List() ([]models.PortfolioAlertRule, error) {
+	var rules []models.PortfolioAlertRule
+	err := r.db.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (r *gormPortfolioRuleRepo) ListByPortfolio(portfolioID uint) ([]models.PortfolioAlertRule, error) {
+	var rules []models.PortfolioAlertRule
+	err := r.db.Where("portfolio_id = ?", portfolioID).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (r *gormPortfolioRuleRepo) Delete(portfolioID, id uint) error {
+	result := r.db.Where("portfolio_id = ? AND id = ?", portfolioID, id).Delete(&models.PortfolioAlertRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormPortfolioRuleRepo) UpdatePeak(id uint, peak decimal.Decimal) error {
+	return r.db.Model(&models.PortfolioAlertRule{}).Where("id = ?", id).Update("peak", peak).Error
+}
+
+// ----------------- Position Rules -----------------
+type gormPositionRuleRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormPositionRuleRepo) Create(rule *models.PositionAlertRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *gormPositionRuleRepo) List() ([]models.PositionAlertRule, error) {
+	var rules []models.PositionAlertRule
+	err := r.db.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (r *gormPositionRuleRepo) ListByPortfolio(portfolioID uint) ([]models.PositionAlertRule, error) {
+	var rules []models.PositionAlertRule
+	err := r.db.Where("portfolio_id = ?", portfolioID).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (r *gormPositionRuleRepo) Delete(portfolioID, id uint) error {
+	result := r.db.Where("portfolio_id = ? AND id = ?", portfolioID, id).Delete(&models.PositionAlertRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormPositionRuleRepo) UpdateState(id uint, highWater decimal.Decimal, triggered bool) error {
+	return r.db.Model(&models.PositionAlertRule{}).Where("id = ?", id).
+		Updates(map[string]any{"high_water": highWater, "triggered": triggered}).Error
+}
+
+// ----------------- Signal Rules -----------------
+type gormSignalRuleRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormSignalRuleRepo) Create(rule *models.SignalRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *gormSignalRuleRepo) List() ([]models.SignalRule, error) {
+	var rules []models.SignalRule
+	err := r.db.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (r *gormSignalRuleRepo) ListByUser(userID uint) ([]models.SignalRule, error) {
+	var rules []models.SignalRule
+	err := r.db.Where("user_id = ?", userID).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (r *gormSignalRuleRepo) Delete(userID, id uint) error {
+	result := r.db.Where("user_id = ? AND id = ?", userID, id).Delete(&models.SignalRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ----------------- Expression Rules -----------------
+type gormExpressionRuleRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormExpressionRuleRepo) Create(rule *models.ExpressionRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *gormExpressionRuleRepo) List() ([]models.ExpressionRule, error) {
+	var rules []models.ExpressionRule
+	err := r.db.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (r *gormExpressionRuleRepo) ListByUser(userID uint) ([]models.ExpressionRule, error) {
+	var rules []models.ExpressionRule
+	err := r.db.Where("user_id = ?", userID).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (r *gormExpressionRuleRepo) Delete(userID, id uint) error {
+	result := r.db.Where("user_id = ? AND id = ?", userID, id).Delete(&models.ExpressionRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormExpressionRuleRepo) UpdateTriggered(id uint, triggered bool) error {
+	return r.db.Model(&models.ExpressionRule{}).Where("id = ?", id).Update("triggered", triggered).Error
+}
+
+// ----------------- Alerts -----------------
+type gormAlertRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormAlertRepo) Create(alert *models.Alert) error {
+	return r.db.Create(alert).Error
+}
+
+func (r *gormAlertRepo) ListByUser(userID uint) ([]models.Alert, error) {
+	var alerts []models.Alert
+	err := r.db.Where("user_id = ?", userID).Find(&alerts).Error
+	return alerts, err
+}
+
+func (r *gormAlertRepo) FindByIDs(userID uint, ids []uint) ([]models.Alert, error) {
+	var alerts []models.Alert
+	err := r.db.Where("user_id = ? AND id IN ?", userID, ids).Order("id").Find(&alerts).Error
+	return alerts, err
+}
+
+func (r *gormAlertRepo) SetStatus(ids []uint, status models.AlertStatus, snoozedUntil *time.Time, at time.Time) error {
+	return r.db.Model(&models.Alert{}).Where("id IN ?", ids).Updates(map[string]any{
+		"status":            status,
+		"snoozed_until":     snoozedUntil,
+		"status_changed_at": at,
+	}).Error
+}
+
+func (r *gormAlertRepo) CountByStatus(userID uint) (map[models.AlertStatus]int, error) {
+	var rows []struct {
+		Status models.AlertStatus
+		Count  int
+	}
+	err := r.db.Model(&models.Alert{}).Select("status, COUNT(*) AS count").
+		Where("user_id = ?", userID).Group("status").Scan(&rows).Error
+	counts := map[models.AlertStatus]int{}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, err
+}
+
+func (r *gormAlertRepo) ListSnoozed(at time.Time) ([]models.Alert, error) {
+	var alerts []models.Alert
+	err := r.db.Where("status = ? AND snoozed_until > ?", models.AlertSnoozed, at).Find(&alerts).Error
+	return alerts, err
+}
+
+func (r *gormAlertRepo) ListUnnotified() ([]models.Alert, error) {
+	var alerts []models.Alert
+	err := r.db.Where("notified_at IS NULL").Order("id").Find(&alerts).Error
+	return alerts, err
+}
+
+func (r *gormAlertRepo) MarkNotified(ids []uint, at time.Time) error {
+	return r.db.Model(&models.Alert{}).Where("id IN ?", ids).Update("notified_at", at).Error
+}
+
+func (r *gormAlertRepo) ListBetween(userID uint, from, to time.Time) ([]models.Alert, error) {
+	var alerts []models.Alert
+	err := r.db.Where(`user_id = ? AND "timestamp" >= ? AND "timestamp" < ?`, userID, from, to).
+		Order(`"timestamp"`).Find(&alerts).Error
+	return alerts, err
+}
+
+// ----------------- Notifications -----------------
+type gormNotificationRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormNotificationRepo) FindPreferences(userID uint) (*models.NotificationPreferences, error) {
+	var prefs models.NotificationPreferences
+	if err := r.db.Where("user_id = ?", userID).First(&prefs).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &prefs, nil
+}
+
+func (r *gormNotificationRepo) SavePreferences(prefs *models.NotificationPreferences) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"channels", "email", "webhook_url", "timezone",
+			"quiet_start", "quiet_end", "digest", "digest_hour", "digest_weekday", "updated_at"}),
+	}).Create(prefs).Error
+}
+
+func (r *gormNotificationRepo) ListDigests() ([]models.NotificationPreferences, error) {
+	var prefs []models.NotificationPreferences
+	err := r.db.Where("digest <> ?", models.DigestNone).Order("user_id").Find(&prefs).Error
+	return prefs, err
+}
+
+func (r *gormNotificationRepo) SetLastDigest(userID uint, at time.Time) error {
+	return r.db.Model(&models.NotificationPreferences{}).Where("user_id = ?", userID).Update("last_digest_at", at).Error
+}
+
+func (r *gormNotificationRepo) SaveRuleChannels(channels *models.RuleChannels) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "rule_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "channels"}),
+	}).Create(channels).Error
+}
+
+func (r *gormNotificationRepo) ListRuleChannels(userID uint) ([]models.RuleChannels, error) {
+	var channels []models.RuleChannels
+	err := r.db.Where("user_id = ?", userID).Order("id").Find(&channels).Error
+	return channels, err
+}
+
+func (r *gormNotificationRepo) DeleteRuleChannels(userID, id uint) error {
+	result := r.db.Where("user_id = ? AND id = ?", userID, id).Delete(&models.RuleChannels{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ----------------- Analytics -----------------
+type gormAnalyticsRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormAnalyticsRepo) FindDaily(symbol string, date time.Time) (*models.DailyAnalytics, error) {
+	var analytics models.DailyAnalytics
+	err := r.db.Where("symbol = ? AND date = ?", symbol, date).First(&analytics).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &analytics, nil
+}
+
+func (r *gormAnalyticsRepo) SaveDaily(analytics *models.DailyAnalytics) error {
+	return r.db.Save(analytics).Error
+}
+
+func (r *gormAnalyticsRepo) SaveSignal(signal *models.StockAnalytics) error {
+	return r.db.Create(signal).Error
+}
+
+func (r *gormAnalyticsRepo) ListSignals(symbols []string, from, to time.Time) ([]models.StockAnalytics, error) {
+	var signals []models.StockAnalytics
+	err := r.db.Where("symbol IN ? AND generated_at >= ? AND generated_at < ?", symbols, from, to).
+		Order("generated_at").Find(&signals).Error
+	return signals, err
+}
+
+// ----------------- Analytics Shadow -----------------
+type gormAnalyticsShadowRepo struct {
+	db *gorm.DB
+}
+
+// analyticsTables are the tables a rebuild replaces, with the column their
+// rows are dated by. Each shadow copy is named after its table plus "_rebuild".
+var analyticsTables = []struct{ name, dateColumn string }{
+	{models.DailyAnalytics{}.TableName(), "date"},
+	{"stock_analytics", "generated_at"},
+}
+
+// analyticsInsertBatch is the number of rows per INSERT into a shadow copy
+const analyticsInsertBatch = 500
+
+// The copies are made with CREATE TABLE AS, so they have the live columns but
+// no keys or defaults; Insert numbers the rows itself
+
+func (r *gormAnalyticsShadowRepo) Reset(keepBefore time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range analyticsTables {
+			shadow := table.name + "_rebuild"
+			for _, statement := range []string{
+				fmt.Sprintf("DROP TABLE IF EXISTS %s", shadow),
+				fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s WHERE 1 = 0", shadow, table.name),
+			} {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			err := tx.Exec(fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE %s < ?", shadow, table.name, table.dateColumn), keepBefore.UTC()).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *gormAnalyticsShadowRepo) Insert(daily []models.DailyAnalytics, signals []models.StockAnalytics) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if len(daily) > 0 {
+			next, err := nextShadowID(tx, analyticsTables[0].name+"_rebuild")
+			if err != nil {
+				return err
+			}
+			for i := range daily {
+				daily[i].ID = next + uint(i)
+			}
+			if err := tx.Table(analyticsTables[0].name+"_rebuild").CreateInBatches(&daily, analyticsInsertBatch).Error; err != nil {
+				return err
+			}
+		}
+		if len(signals) > 0 {
+			next, err := nextShadowID(tx, analyticsTables[1].name+"_rebuild")
+			if err != nil {
+				return err
+			}
+			for i := range signals {
+				signals[i].ID = next + uint(i)
+			}
+			return tx.Table(analyticsTables[1].name+"_rebuild").CreateInBatches(&signals, analyticsInsertBatch).Error
+		}
+		return nil
+	})
+}
+
+// nextShadowID returns the first id free in a shadow copy
+func nextShadowID(tx *gorm.DB, shadow string) (uint, error) {
+	var last uint
+	err := tx.Raw(fmt.Sprintf("SELECT COALESCE(MAX(id), 0) FROM %s", shadow)).Scan(&last).Error
+	return last + 1, err
+}
+
+// Swap copies every column but the id, so the live tables keep numbering
+// their rows with their own sequences
+func (r *gormAnalyticsShadowRepo) Swap() error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range analyticsTables {
+			shadow := table.name + "_rebuild"
+			columnTypes, err := tx.Migrator().ColumnTypes(table.name)
+			if err != nil {
+				return err
+			}
+			columns := []string{}
+			for _, column := range columnTypes {
+				if column.Name() != "id" {
+					columns = append(columns, fmt.Sprintf("%q", column.Name()))
+				}
+			}
+			list := strings.Join(columns, ", ")
+			for _, statement := range []string{
+				fmt.Sprintf("DELETE FROM %s", table.name),
+				fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s ORDER BY id", table.name, list, list, shadow),
+				fmt.Sprintf("DROP TABLE %s", shadow),
+			} {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
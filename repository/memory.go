@@ -0,0 +1,1424 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// NewMemoryRepositories returns repositories that keep everything in memory.
+// They are meant for tests and share one store, so a portfolio created through
+// one repository sees the stocks added through another.
+func NewMemoryRepositories() Repositories {
+	s := &memoryStore{bars: map[models.BarInterval][]models.PriceBar{}}
+	return Repositories{
+		Users:           &memoryUserRepo{s},
+		Symbols:         &memorySymbolRepo{s},
+		Portfolios:      &memoryPortfolioRepo{s},
+		Stocks:          &memoryStockRepo{s},
+		Positions:       &memoryPositionRepo{s},
+		Transactions:    &memoryTransactionRepo{s},
+		PortfolioRules:  &memoryPortfolioRuleRepo{s},
+		PositionRules:   &memoryPositionRuleRepo{s},
+		SignalRules:     &memorySignalRuleRepo{s},
+		ExpressionRules: &memoryExpressionRuleRepo{s},
+		Alerts:          &memoryAlertRepo{s},
+		Notifications:   &memoryNotificationRepo{s},
+		Prices:          &memoryPriceRepo{s},
+		Bars:            &memoryBarRepo{s},
+		Analytics:       &memoryAnalyticsRepo{s},
+		AnalyticsShadow: &memoryAnalyticsShadowRepo{s},
+		Actions:         &memoryCorporateActionRepo{s},
+	}
+}
+
+type memoryStore struct {
+	mu              sync.Mutex
+	lastID          uint
+	users           []models.User
+	symbols         []models.Symbol
+	portfolios      []models.Portfolio
+	stocks          []models.Stock
+	positions       []models.Position
+	transactions    []models.Transaction
+	portfolioRules  []models.PortfolioAlertRule
+	positionRules   []models.PositionAlertRule
+	signalRules     []models.SignalRule
+	expressionRules []models.ExpressionRule
+	alerts          []models.Alert
+	preferences     []models.NotificationPreferences
+	ruleChannels    []models.RuleChannels
+	prices          []models.StockPriceRecord
+	bars            map[models.BarInterval][]models.PriceBar
+	analytics       []models.DailyAnalytics
+	signals         []models.StockAnalytics
+	shadow          *analyticsShadow // between Reset and Swap
+	actions         []models.CorporateAction
+}
+
+// nextID hands out primary keys; callers must hold the lock
+func (s *memoryStore) nextID() uint {
+	s.lastID++
+	return s.lastID
+}
+
+// ----------------- Users -----------------
+type memoryUserRepo struct{ s *memoryStore }
+
+func (r *memoryUserRepo) Create(user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	user.ID = r.s.nextID()
+	r.s.users = append(r.s.users, *user)
+	return nil
+}
+
+func (r *memoryUserRepo) List() ([]models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return append([]models.User{}, r.s.users...), nil
+}
+
+func (r *memoryUserRepo) FindByID(id uint) (*models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, user := range r.s.users {
+		if user.ID == id {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepo) SetBaseCurrency(id uint, currency string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.users {
+		if r.s.users[i].ID == id {
+			if r.s.users[i].Base() == (models.User{BaseCurrency: currency}).Base() {
+				return nil
+			}
+			r.s.users[i].BaseCurrency = currency
+			// Drawdown peaks were measured in the old currency
+			owned := map[uint]bool{}
+			for _, p := range r.s.portfolios {
+				owned[p.ID] = p.UserID == id
+			}
+			for j, rule := range r.s.portfolioRules {
+				if owned[rule.PortfolioID] && rule.Type == models.RuleDrawdown {
+					r.s.portfolioRules[j].Peak = decimal.Zero
+				}
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// ----------------- Symbols -----------------
+type memorySymbolRepo struct{ s *memoryStore }
+
+func (r *memorySymbolRepo) Upsert(symbols []models.Symbol) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, entry := range symbols {
+		entry.UpdatedAt = time.Now()
+		replaced := false
+		for i, existing := range r.s.symbols {
+			if existing.Symbol == entry.Symbol {
+				entry.ID = existing.ID
+				r.s.symbols[i] = entry
+				replaced = true
+			}
+		}
+		if !replaced {
+			entry.ID = r.s.nextID()
+			r.s.symbols = append(r.s.symbols, entry)
+		}
+	}
+	return nil
+}
+
+func (r *memorySymbolRepo) Find(symbol string) (*models.Symbol, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, entry := range r.s.symbols {
+		if entry.Symbol == strings.ToUpper(symbol) {
+			return &entry, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memorySymbolRepo) Search(q string, limit int) ([]models.Symbol, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	q = strings.ToUpper(q)
+	rank := func(entry models.Symbol) int {
+		switch {
+		case entry.Symbol == q:
+			return 0
+		case strings.HasPrefix(entry.Symbol, q):
+			return 1
+		case strings.Contains(strings.ToUpper(entry.Name), q):
+			return 2
+		}
+		return -1
+	}
+	matches := []models.Symbol{}
+	for _, entry := range r.s.symbols {
+		if rank(entry) >= 0 {
+			matches = append(matches, entry)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if ri, rj := rank(matches[i]), rank(matches[j]); ri != rj {
+			return ri < rj
+		}
+		return matches[i].Symbol < matches[j].Symbol
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func (r *memorySymbolRepo) Count() (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return int64(len(r.s.symbols)), nil
+}
+
+// ----------------- Portfolios -----------------
+type memoryPortfolioRepo struct{ s *memoryStore }
+
+func (r *memoryPortfolioRepo) Create(portfolio *models.Portfolio) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if portfolio.Name == "" {
+		portfolio.Name = "Default"
+	}
+	if portfolio.Kind == "" {
+		portfolio.Kind = models.KindPortfolio
+	}
+	if portfolio.CostMethod == "" {
+		portfolio.CostMethod = "fifo"
+	}
+	for _, p := range r.s.portfolios {
+		if p.UserID == portfolio.UserID && p.Name == portfolio.Name {
+			return fmt.Errorf("portfolio %q already exists", portfolio.Name)
+		}
+	}
+	portfolio.ID = r.s.nextID()
+	r.s.portfolios = append(r.s.portfolios, *portfolio)
+	return nil
+}
+
+func (r *memoryPortfolioRepo) List() ([]models.Portfolio, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return append([]models.Portfolio{}, r.s.portfolios...), nil
+}
+
+func (r *memoryPortfolioRepo) FindByID(id uint) (*models.Portfolio, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, p := range r.s.portfolios {
+		if p.ID == id {
+			return &p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPortfolioRepo) FindByUserID(userID uint) (*models.Portfolio, error) {
+	portfolios, _ := r.ListByUser(userID)
+	if len(portfolios) == 0 {
+		return nil, ErrNotFound
+	}
+	return &portfolios[0], nil
+}
+
+func (r *memoryPortfolioRepo) ListByUser(userID uint) ([]models.Portfolio, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	portfolios := []models.Portfolio{}
+	for _, p := range r.s.portfolios {
+		if p.UserID == userID {
+			p.Stocks = nil
+			for _, stock := range r.s.stocks {
+				if stock.PortfolioID == p.ID {
+					p.Stocks = append(p.Stocks, stock)
+				}
+			}
+			portfolios = append(portfolios, p)
+		}
+	}
+	return portfolios, nil
+}
+
+func (r *memoryPortfolioRepo) SetCostMethod(id uint, method string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.portfolios {
+		if r.s.portfolios[i].ID == id {
+			r.s.portfolios[i].CostMethod = method
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// ----------------- Stocks -----------------
+type memoryStockRepo struct{ s *memoryStore }
+
+func (r *memoryStockRepo) Create(stock *models.Stock) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	stock.ID = r.s.nextID()
+	r.s.stocks = append(r.s.stocks, *stock)
+	return nil
+}
+
+func (r *memoryStockRepo) List() ([]models.Stock, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return append([]models.Stock{}, r.s.stocks...), nil
+}
+
+func (r *memoryStockRepo) ListByPortfolio(portfolioID uint) ([]models.Stock, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	stocks := []models.Stock{}
+	for _, stock := range r.s.stocks {
+		if stock.PortfolioID == portfolioID {
+			stocks = append(stocks, stock)
+		}
+	}
+	return stocks, nil
+}
+
+func (r *memoryStockRepo) ListBySymbol(symbol string) ([]models.Stock, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	stocks := []models.Stock{}
+	for _, stock := range r.s.stocks {
+		if stock.StockSymbol == symbol {
+			stocks = append(stocks, stock)
+		}
+	}
+	return stocks, nil
+}
+
+func (r *memoryStockRepo) MoveSymbol(fromPortfolioID, toPortfolioID uint, symbol string) ([]models.Stock, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	moved := []models.Stock{}
+	for i, stock := range r.s.stocks {
+		if stock.PortfolioID == fromPortfolioID && stock.StockSymbol == symbol {
+			r.s.stocks[i].PortfolioID = toPortfolioID
+			moved = append(moved, r.s.stocks[i])
+		}
+	}
+	if len(moved) == 0 {
+		return nil, ErrNotFound
+	}
+	return moved, nil
+}
+
+// ----------------- Positions -----------------
+type memoryPositionRepo struct{ s *memoryStore }
+
+func (r *memoryPositionRepo) Upsert(position *models.Position) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if position.Currency == "" {
+		position.Currency = "USD"
+	}
+	for i, p := range r.s.positions {
+		if p.PortfolioID == position.PortfolioID && p.Symbol == position.Symbol {
+			position.ID = p.ID
+			r.s.positions[i] = *position
+			return nil
+		}
+	}
+	position.ID = r.s.nextID()
+	r.s.positions = append(r.s.positions, *position)
+	return nil
+}
+
+func (r *memoryPositionRepo) ListByPortfolio(portfolioID uint) ([]models.Position, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	positions := []models.Position{}
+	for _, p := range r.s.positions {
+		if p.PortfolioID == portfolioID {
+			positions = append(positions, p)
+		}
+	}
+	sort.SliceStable(positions, func(i, j int) bool { return positions[i].Symbol < positions[j].Symbol })
+	return positions, nil
+}
+
+func (r *memoryPositionRepo) Delete(portfolioID uint, symbol string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i, p := range r.s.positions {
+		if p.PortfolioID == portfolioID && p.Symbol == symbol {
+			r.s.positions = append(r.s.positions[:i], r.s.positions[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryPositionRepo) List() ([]models.Position, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	positions := append([]models.Position{}, r.s.positions...)
+	sort.SliceStable(positions, func(i, j int) bool {
+		if positions[i].PortfolioID != positions[j].PortfolioID {
+			return positions[i].PortfolioID < positions[j].PortfolioID
+		}
+		return positions[i].Symbol < positions[j].Symbol
+	})
+	return positions, nil
+}
+
+func (r *memoryPositionRepo) Replace(portfolioID uint, positions []models.Position) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	kept := r.s.positions[:0]
+	for _, p := range r.s.positions {
+		if p.PortfolioID != portfolioID {
+			kept = append(kept, p)
+		}
+	}
+	for i := range positions {
+		positions[i].ID = r.s.nextID()
+		positions[i].PortfolioID = portfolioID
+		if positions[i].Currency == "" {
+			positions[i].Currency = "USD"
+		}
+		kept = append(kept, positions[i])
+	}
+	r.s.positions = kept
+	return nil
+}
+
+// ----------------- Transactions -----------------
+type memoryTransactionRepo struct{ s *memoryStore }
+
+func (r *memoryTransactionRepo) Create(transaction *models.Transaction) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if transaction.Currency == "" {
+		transaction.Currency = "USD"
+	}
+	transaction.ID = r.s.nextID()
+	transaction.CreatedAt = time.Now()
+	r.s.transactions = append(r.s.transactions, *transaction)
+	return nil
+}
+
+func (r *memoryTransactionRepo) ListByPortfolio(portfolioID uint) ([]models.Transaction, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	transactions := []models.Transaction{}
+	for _, tx := range r.s.transactions {
+		if tx.PortfolioID == portfolioID {
+			transactions = append(transactions, tx)
+		}
+	}
+	sort.SliceStable(transactions, func(i, j int) bool {
+		if !transactions[i].TradeDate.Equal(transactions[j].TradeDate) {
+			return transactions[i].TradeDate.Before(transactions[j].TradeDate)
+		}
+		return transactions[i].ID < transactions[j].ID
+	})
+	return transactions, nil
+}
+
+func (r *memoryTransactionRepo) Delete(portfolioID, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i, tx := range r.s.transactions {
+		if tx.PortfolioID == portfolioID && tx.ID == id {
+			r.s.transactions = append(r.s.transactions[:i], r.s.transactions[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// ----------------- Portfolio Rules -----------------
+type memoryPortfolioRuleRepo struct{ s *memoryStore }
+
+func (r *memoryPortfolioRuleRepo) Create(rule *models.PortfolioAlertRule) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	rule.ID = r.s.nextID()
+	rule.CreatedAt = time.Now()
+	r.s.portfolioRules = append(r.s.portfolioRules, *rule)
+	return nil
+}
+
+func (r *memoryPortfolioRuleRepo) List() ([]models.PortfolioAlertRule, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return append([]models.PortfolioAlertRule{}, r.s.portfolioRules...), nil
+}
+
+func (r *memoryPortfolioRuleRepo) ListByPortfolio(portfolioID uint) ([]models.PortfolioAlertRule, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	rules := []models.PortfolioAlertRule{}
+	for _, rule := range r.s.portfolioRules {
+		if rule.PortfolioID == portfolioID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (r *memoryPortfolioRuleRepo) Delete(portfolioID, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i, rule := range r.s.portfolioRules {
+		if rule.PortfolioID == portfolioID && rule.ID == id {
+			r.s.portfolioRules = append(r.s.portfolioRules[:i], r.s.portfolioRules[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryPortfolioRuleRepo) UpdatePeak(id uint, peak decimal.Decimal) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.portfolioRules {
+		if r.s.portfolioRules[i].ID == id {
+			r.s.portfolioRules[i].Peak = peak
+		}
+	}
+	return nil
+}
+
+// ----------------- Position Rules -----------------
+type memoryPositionRuleRepo struct{ s *memoryStore }
+
+func (r *memoryPositionRuleRepo) Create(rule *models.PositionAlertRule) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if rule.Unit == "" {
+		rule.Unit = models.UnitPercent
+	}
+	rule.ID = r.s.nextID()
+	rule.CreatedAt = time.Now()
+	r.s.positionRules = append(r.s.positionRules, *rule)
+	return nil
+}
+
+func (r *memoryPositionRuleRepo) List() ([]models.PositionAlertRule, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return append([]models.PositionAlertRule{}, r.s.positionRules...), nil
+}
+
+func (r *memoryPositionRuleRepo) ListByPortfolio(portfolioID uint) ([]models.PositionAlertRule, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	rules := []models.PositionAlertRule{}
+	for _, rule := range r.s.positionRules {
+		if rule.PortfolioID == portfolioID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (r *memoryPositionRuleRepo) Delete(portfolioID, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i, rule := range r.s.positionRules {
+		if rule.PortfolioID == portfolioID && rule.ID == id {
+			r.s.positionRules = append(r.s.positionRules[:i], r.s.positionRules[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryPositionRuleRepo) UpdateState(id uint, highWater decimal.Decimal, triggered bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.positionRules {
+		if r.s.positionRules[i].ID == id {
+			r.s.positionRules[i].HighWater = highWater
+			r.s.positionRules[i].Triggered = triggered
+		}
+	}
+	return nil
+}
+
+// ----------------- Signal Rules -----------------
+type memorySignalRuleRepo struct{ s *memoryStore }
+
+func (r *memorySignalRuleRepo) Create(rule *models.SignalRule) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	rule.ID = r.s.nextID()
+	rule.CreatedAt = time.Now()
+	r.s.signalRules = append(r.s.signalRules, *rule)
+	return nil
+}
+
+func (r *memorySignalRuleRepo) List() ([]models.SignalRule, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return append([]models.SignalRule{}, r.s.signalRules...), nil
+}
+
+func (r *memorySignalRuleRepo) ListByUser(userID uint) ([]models.SignalRule, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	rules := []models.SignalRule{}
+	for _, rule := range r.s.signalRules {
+		if rule.UserID == userID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (r *memorySignalRuleRepo) Delete(userID, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i, rule := range r.s.signalRules {
+		if rule.UserID == userID && rule.ID == id {
+			r.s.signalRules = append(r.s.signalRules[:i], r.s.signalRules[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// ----------------- Expression Rules -----------------
+type memoryExpressionRuleRepo struct{ s *memoryStore }
+
+func (r *memoryExpressionRuleRepo) Create(rule *models.ExpressionRule) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	rule.ID = r.s.nextID()
+	rule.CreatedAt = time.Now()
+	r.s.expressionRules = append(r.s.expressionRules, *rule)
+	return nil
+}
+
+func (r *memoryExpressionRuleRepo) List() ([]models.ExpressionRule, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return append([]models.ExpressionRule{}, r.s.expressionRules...), nil
+}
+
+func (r *memoryExpressionRuleRepo) ListByUser(userID uint) ([]models.ExpressionRule, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	rules := []models.ExpressionRule{}
+	for _, rule := range r.s.expressionRules {
+		if rule.UserID == userID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (r *memoryExpressionRuleRepo) Delete(userID, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i, rule := range r.s.expressionRules {
+		if rule.UserID == userID && rule.ID == id {
+			r.s.expressionRules = append(r.s.expressionRules[:i], r.s.expressionRules[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryExpressionRuleRepo) UpdateTriggered(id uint, triggered bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.expressionRules {
+		if r.s.expressionRules[i].ID == id {
+			r.s.expressionRules[i].Triggered = triggered
+		}
+	}
+	return nil
+}
+
+// ----------------- Alerts -----------------
+type memoryAlertRepo struct{ s *memoryStore }
+
+func (r *memoryAlertRepo) Create(alert *models.Alert) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if alert.Kind == "" {
+		alert.Kind = models.AlertThreshold
+	}
+	if alert.Status == "" {
+		alert.Status = models.AlertNew
+	}
+	alert.ID = r.s.nextID()
+	r.s.alerts = append(r.s.alerts, *alert)
+	return nil
+}
+
+func (r *memoryAlertRepo) FindByIDs(userID uint, ids []uint) ([]models.Alert, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	wanted := map[uint]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	alerts := []models.Alert{}
+	for _, alert := range r.s.alerts {
+		if alert.UserID == userID && wanted[alert.ID] {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+func (r *memoryAlertRepo) SetStatus(ids []uint, status models.AlertStatus, snoozedUntil *time.Time, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	wanted := map[uint]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	for i := range r.s.alerts {
+		if wanted[r.s.alerts[i].ID] {
+			r.s.alerts[i].Status = status
+			r.s.alerts[i].SnoozedUntil = snoozedUntil
+			r.s.alerts[i].StatusChangedAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *memoryAlertRepo) CountByStatus(userID uint) (map[models.AlertStatus]int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	counts := map[models.AlertStatus]int{}
+	for _, alert := range r.s.alerts {
+		if alert.UserID == userID {
+			counts[alert.Status]++
+		}
+	}
+	return counts, nil
+}
+
+func (r *memoryAlertRepo) ListSnoozed(at time.Time) ([]models.Alert, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	alerts := []models.Alert{}
+	for _, alert := range r.s.alerts {
+		if alert.Status == models.AlertSnoozed && alert.SnoozedUntil != nil && alert.SnoozedUntil.After(at) {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+func (r *memoryAlertRepo) ListUnnotified() ([]models.Alert, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	alerts := []models.Alert{}
+	for _, alert := range r.s.alerts {
+		if alert.NotifiedAt == nil {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+func (r *memoryAlertRepo) MarkNotified(ids []uint, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	wanted := map[uint]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	for i := range r.s.alerts {
+		if wanted[r.s.alerts[i].ID] {
+			r.s.alerts[i].NotifiedAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *memoryAlertRepo) ListBetween(userID uint, from, to time.Time) ([]models.Alert, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	alerts := []models.Alert{}
+	for _, alert := range r.s.alerts {
+		if alert.UserID == userID && !alert.Timestamp.Before(from) && alert.Timestamp.Before(to) {
+			alerts = append(alerts, alert)
+		}
+	}
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].Timestamp.Before(alerts[j].Timestamp) })
+	return alerts, nil
+}
+
+func (r *memoryAlertRepo) ListByUser(userID uint) ([]models.Alert, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	alerts := []models.Alert{}
+	for _, alert := range r.s.alerts {
+		if alert.UserID == userID {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+// ----------------- Prices -----------------
+type memoryPriceRepo struct{ s *memoryStore }
+
+func (r *memoryPriceRepo) Create(record *models.StockPriceRecord) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	record.ID = r.s.nextID()
+	r.s.prices = append(r.s.prices, *record)
+	return nil
+}
+
+func (r *memoryPriceRepo) CreateBatch(records []models.StockPriceRecord) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range records {
+		records[i].ID = r.s.nextID()
+		r.s.prices = append(r.s.prices, records[i])
+	}
+	return nil
+}
+
+func (r *memoryPriceRepo) ListBetween(from, to time.Time) ([]models.StockPriceRecord, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	records := []models.StockPriceRecord{}
+	for _, record := range r.s.prices {
+		if !record.Timestamp.Before(from) && record.Timestamp.Before(to) {
+			records = append(records, record)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Timestamp.Before(records[j].Timestamp) })
+	return records, nil
+}
+
+func (r *memoryPriceRepo) List(symbol string, from, to time.Time) ([]models.StockPriceRecord, error) {
+	records, _ := r.ListBetween(from, to)
+	kept := records[:0]
+	for _, record := range records {
+		if record.Symbol == symbol {
+			kept = append(kept, record)
+		}
+	}
+	return kept, nil
+}
+
+func (r *memoryPriceRepo) EnsurePartitions(from time.Time, months int) error {
+	return nil
+}
+
+func (r *memoryPriceRepo) DeleteBefore(cutoff time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	kept := r.s.prices[:0]
+	for _, record := range r.s.prices {
+		if !record.Timestamp.Before(cutoff) {
+			kept = append(kept, record)
+		}
+	}
+	r.s.prices = kept
+	return nil
+}
+
+func (r *memoryPriceRepo) Latest(symbols []string) (map[string]models.StockPriceRecord, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	wanted := map[string]bool{}
+	for _, symbol := range symbols {
+		wanted[symbol] = true
+	}
+	latest := map[string]models.StockPriceRecord{}
+	for _, record := range r.s.prices {
+		if !wanted[record.Symbol] {
+			continue
+		}
+		if current, ok := latest[record.Symbol]; !ok || !record.Timestamp.Before(current.Timestamp) {
+			latest[record.Symbol] = record
+		}
+	}
+	return latest, nil
+}
+
+func (r *memoryPriceRepo) Oldest() (time.Time, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if len(r.s.prices) == 0 {
+		return time.Time{}, ErrNotFound
+	}
+	oldest := r.s.prices[0].Timestamp
+	for _, record := range r.s.prices[1:] {
+		if record.Timestamp.Before(oldest) {
+			oldest = record.Timestamp
+		}
+	}
+	return oldest, nil
+}
+
+// ----------------- Bars -----------------
+type memoryBarRepo struct{ s *memoryStore }
+
+func (r *memoryBarRepo) Upsert(interval models.BarInterval, bars []models.PriceBar) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+next:
+	for _, bar := range bars {
+		existing := r.s.bars[interval]
+		for i, b := range existing {
+			if b.Symbol == bar.Symbol && b.Bucket.Equal(bar.Bucket) {
+				bar.ID = b.ID
+				existing[i] = bar
+				continue next
+			}
+		}
+		bar.ID = r.s.nextID()
+		r.s.bars[interval] = append(existing, bar)
+	}
+	return nil
+}
+
+func (r *memoryBarRepo) List(interval models.BarInterval, symbol string, from, to time.Time) ([]models.PriceBar, error) {
+	bars, _ := r.ListBetween(interval, from, to)
+	filtered := []models.PriceBar{}
+	for _, bar := range bars {
+		if bar.Symbol == symbol {
+			filtered = append(filtered, bar)
+		}
+	}
+	return filtered, nil
+}
+
+func (r *memoryBarRepo) ListBetween(interval models.BarInterval, from, to time.Time) ([]models.PriceBar, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	bars := []models.PriceBar{}
+	for _, bar := range r.s.bars[interval] {
+		if !bar.Bucket.Before(from) && bar.Bucket.Before(to) {
+			bars = append(bars, bar)
+		}
+	}
+	sort.SliceStable(bars, func(i, j int) bool {
+		if !bars[i].Bucket.Equal(bars[j].Bucket) {
+			return bars[i].Bucket.Before(bars[j].Bucket)
+		}
+		return bars[i].Symbol < bars[j].Symbol
+	})
+	return bars, nil
+}
+
+func (r *memoryBarRepo) LatestBucket(interval models.BarInterval) (time.Time, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var latest time.Time
+	for _, bar := range r.s.bars[interval] {
+		if bar.Bucket.After(latest) {
+			latest = bar.Bucket
+		}
+	}
+	if latest.IsZero() {
+		return time.Time{}, ErrNotFound
+	}
+	return latest, nil
+}
+
+// ----------------- Notifications -----------------
+type memoryNotificationRepo struct{ s *memoryStore }
+
+func (r *memoryNotificationRepo) FindPreferences(userID uint) (*models.NotificationPreferences, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, prefs := range r.s.preferences {
+		if prefs.UserID == userID {
+			return &prefs, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryNotificationRepo) SavePreferences(prefs *models.NotificationPreferences) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if prefs.Timezone == "" {
+		prefs.Timezone = "UTC"
+	}
+	if prefs.Digest == "" {
+		prefs.Digest = models.DigestNone
+	}
+	prefs.UpdatedAt = time.Now()
+	for i, existing := range r.s.preferences {
+		if existing.UserID == prefs.UserID {
+			prefs.ID, prefs.LastDigestAt = existing.ID, existing.LastDigestAt
+			r.s.preferences[i] = *prefs
+			return nil
+		}
+	}
+	prefs.ID = r.s.nextID()
+	r.s.preferences = append(r.s.preferences, *prefs)
+	return nil
+}
+
+func (r *memoryNotificationRepo) ListDigests() ([]models.NotificationPreferences, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	prefs := []models.NotificationPreferences{}
+	for _, p := range r.s.preferences {
+		if p.Digest != models.DigestNone {
+			prefs = append(prefs, p)
+		}
+	}
+	return prefs, nil
+}
+
+func (r *memoryNotificationRepo) SetLastDigest(userID uint, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.preferences {
+		if r.s.preferences[i].UserID == userID {
+			r.s.preferences[i].LastDigestAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *memoryNotificationRepo) SaveRuleChannels(channels *models.RuleChannels) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i, existing := range r.s.ruleChannels {
+		if existing.Kind == channels.Kind && existing.RuleID == channels.RuleID {
+			channels.ID = existing.ID
+			r.s.ruleChannels[i] = *channels
+			return nil
+		}
+	}
+	channels.ID = r.s.nextID()
+	r.s.ruleChannels = append(r.s.ruleChannels, *channels)
+	return nil
+}
+
+func (r *memoryNotificationRepo) ListRuleChannels(userID uint) ([]models.RuleChannels, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	channels := []models.RuleChannels{}
+	for _, c := range r.s.ruleChannels {
+		if c.UserID == userID {
+			channels = append(channels, c)
+		}
+	}
+	return channels, nil
+}
+
+func (r *memoryNotificationRepo) DeleteRuleChannels(userID, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i, c := range r.s.ruleChannels {
+		if c.UserID == userID && c.ID == id {
+			r.s.ruleChannels = append(r.s.ruleChannels[:i], r.s.ruleChannels[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// ----------------- Analytics -----------------
+type memoryAnalyticsRepo struct{ s *memoryStore }
+
+func (r *memoryAnalyticsRepo) FindDaily(symbol string, date time.Time) (*models.DailyAnalytics, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, a := range r.s.analytics {
+		if a.Symbol == symbol && a.Date.Equal(date) {
+			return &a, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryAnalyticsRepo) SaveDaily(analytics *models.DailyAnalytics) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	now := time.Now()
+	analytics.UpdatedAt = now
+	for i, a := range r.s.analytics {
+		if a.ID == analytics.ID {
+			r.s.analytics[i] = *analytics
+			return nil
+		}
+	}
+	analytics.ID = r.s.nextID()
+	analytics.CreatedAt = now
+	r.s.analytics = append(r.s.analytics, *analytics)
+	return nil
+}
+
+func (r *memoryAnalyticsRepo) SaveSignal(signal *models.StockAnalytics) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	signal.ID = r.s.nextID()
+	r.s.signals = append(r.s.signals, *signal)
+	return nil
+}
+
+func (r *memoryAnalyticsRepo) ListSignals(symbols []string, from, to time.Time) ([]models.StockAnalytics, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	wanted := map[string]bool{}
+	for _, symbol := range symbols {
+		wanted[symbol] = true
+	}
+	signals := []models.StockAnalytics{}
+	for _, signal := range r.s.signals {
+		if wanted[signal.Symbol] && !signal.GeneratedAt.Before(from) && signal.GeneratedAt.Before(to) {
+			signals = append(signals, signal)
+		}
+	}
+	sort.SliceStable(signals, func(i, j int) bool { return signals[i].GeneratedAt.Before(signals[j].GeneratedAt) })
+	return signals, nil
+}
+
+// ----------------- Analytics Shadow -----------------
+type memoryAnalyticsShadowRepo struct{ s *memoryStore }
+
+// analyticsShadow holds the rows of a rebuild until they are swapped in
+type analyticsShadow struct {
+	daily   []models.DailyAnalytics
+	signals []models.StockAnalytics
+}
+
+func (r *memoryAnalyticsShadowRepo) Reset(keepBefore time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.shadow = &analyticsShadow{}
+	for _, a := range r.s.analytics {
+		if a.Date.Before(keepBefore) {
+			r.s.shadow.daily = append(r.s.shadow.daily, a)
+		}
+	}
+	for _, signal := range r.s.signals {
+		if signal.GeneratedAt.Before(keepBefore) {
+			r.s.shadow.signals = append(r.s.shadow.signals, signal)
+		}
+	}
+	return nil
+}
+
+func (r *memoryAnalyticsShadowRepo) Insert(daily []models.DailyAnalytics, signals []models.StockAnalytics) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if r.s.shadow == nil {
+		return fmt.Errorf("no rebuild in progress")
+	}
+	r.s.shadow.daily = append(r.s.shadow.daily, daily...)
+	r.s.shadow.signals = append(r.s.shadow.signals, signals...)
+	return nil
+}
+
+func (r *memoryAnalyticsShadowRepo) Swap() error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if r.s.shadow == nil {
+		return fmt.Errorf("no rebuild in progress")
+	}
+	now := time.Now()
+	r.s.analytics = make([]models.DailyAnalytics, len(r.s.shadow.daily))
+	for i, a := range r.s.shadow.daily {
+		a.ID = r.s.nextID()
+		if a.CreatedAt.IsZero() {
+			a.CreatedAt, a.UpdatedAt = now, now
+		}
+		r.s.analytics[i] = a
+	}
+	r.s.signals = make([]models.StockAnalytics, len(r.s.shadow.signals))
+	for i, signal := range r.s.shadow.signals {
+		signal.ID = r.s.nextID()
+		r.s.signals[i] = signal
+	}
+	r.s.shadow = nil
+	return nil
+}
+
+// ----------------- Corporate Actions -----------------
+type memoryCorporateActionRepo struct{ s *memoryStore }
+
+func (r *memoryCorporateActionRepo) Create(action *models.CorporateAction) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	action.EffectiveDate = action.EffectiveDate.UTC()
+	for _, a := range r.s.actions {
+		if a.Type == action.Type && a.Symbol == action.Symbol && a.EffectiveDate.Equal(action.EffectiveDate) {
+			return false, nil
+		}
+	}
+	action.ID = r.s.nextID()
+	action.CreatedAt = time.Now()
+	r.s.actions = append(r.s.actions, *action)
+	return true, nil
+}
+
+func (r *memoryCorporateActionRepo) list(keep func(models.CorporateAction) bool) []models.CorporateAction {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	actions := []models.CorporateAction{}
+	for _, a := range r.s.actions {
+		if keep(a) {
+			actions = append(actions, a)
+		}
+	}
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].EffectiveDate.Before(actions[j].EffectiveDate) })
+	return actions
+}
+
+func (r *memoryCorporateActionRepo) List(symbol string) ([]models.CorporateAction, error) {
+	return r.list(func(a models.CorporateAction) bool {
+		return symbol == "" || a.Symbol == symbol || a.NewSymbol == symbol
+	}), nil
+}
+
+func (r *memoryCorporateActionRepo) ListPending() ([]models.CorporateAction, error) {
+	return r.list(func(a models.CorporateAction) bool { return a.AppliedAt == nil }), nil
+}
+
+func (r *memoryCorporateActionRepo) DeletePending(id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i, a := range r.s.actions {
+		if a.ID == id && a.AppliedAt == nil {
+			r.s.actions = append(r.s.actions[:i], r.s.actions[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// claim marks an action applied, failing with ErrNotFound when it already
+// is; callers must hold the lock
+func (r *memoryCorporateActionRepo) claim(id uint, at time.Time) error {
+	for i := range r.s.actions {
+		if r.s.actions[i].ID == id && r.s.actions[i].AppliedAt == nil {
+			at := at.UTC()
+			r.s.actions[i].AppliedAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryCorporateActionRepo) ApplySplit(action models.CorporateAction, cutoff, at time.Time) ([]uint, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if err := r.claim(action.ID, at); err != nil {
+		return nil, err
+	}
+	symbol, ratio, date := action.Symbol, action.Ratio, action.EffectiveDate.UTC()
+
+	for i := range r.s.stocks {
+		if r.s.stocks[i].StockSymbol == symbol {
+			r.s.stocks[i].ThresholdPrice = r.s.stocks[i].ThresholdPrice.Div(ratio)
+		}
+	}
+	for i := range r.s.positionRules {
+		if rule := &r.s.positionRules[i]; rule.Symbol == symbol {
+			rule.HighWater = rule.HighWater.Div(ratio)
+			if rule.Unit == models.UnitAmount {
+				rule.Value = rule.Value.Div(ratio)
+			}
+		}
+	}
+
+	skip, withLedger := map[uint]bool{}, map[uint]bool{}
+	for _, t := range r.s.transactions {
+		if t.Symbol != symbol {
+			continue
+		}
+		withLedger[t.PortfolioID] = true
+		if t.Type == models.TransactionSplit && t.TradeDate.Equal(date) {
+			skip[t.PortfolioID] = true
+		}
+	}
+	var ledgers []uint
+	held := append([]models.Transaction{}, r.s.transactions...)
+	sort.SliceStable(held, func(i, j int) bool { return held[i].TradeDate.Before(held[j].TradeDate) })
+	for _, t := range held {
+		if t.Symbol != symbol || !t.TradeDate.Before(date) || skip[t.PortfolioID] {
+			continue
+		}
+		skip[t.PortfolioID] = true
+		ledgers = append(ledgers, t.PortfolioID)
+		r.s.transactions = append(r.s.transactions, models.Transaction{
+			ID:          r.s.nextID(),
+			PortfolioID: t.PortfolioID,
+			Type:        models.TransactionSplit,
+			Symbol:      symbol,
+			Quantity:    ratio,
+			Currency:    t.Currency,
+			TradeDate:   date,
+			CreatedAt:   time.Now(),
+		})
+	}
+	for i := range r.s.positions {
+		if p := &r.s.positions[i]; p.Symbol == symbol && !withLedger[p.PortfolioID] {
+			p.Quantity = p.Quantity.Mul(ratio)
+			p.AvgCost = p.AvgCost.Div(ratio)
+		}
+	}
+
+	for i := range r.s.prices {
+		if p := &r.s.prices[i]; p.Symbol == symbol && p.Timestamp.Before(cutoff) {
+			p.Price = p.Price.Div(ratio)
+		}
+	}
+	for interval, bars := range r.s.bars {
+		for i := range bars {
+			if b := &bars[i]; b.Symbol == symbol && !b.Bucket.Add(interval.Duration()).After(cutoff) {
+				b.Open, b.High, b.Low, b.Close = b.Open.Div(ratio), b.High.Div(ratio), b.Low.Div(ratio), b.Close.Div(ratio)
+			}
+		}
+	}
+	for i := range r.s.analytics {
+		if a := &r.s.analytics[i]; a.Symbol == symbol && a.Date.Before(date) {
+			a.MinPrice, a.MaxPrice, a.AvgPrice = a.MinPrice.Div(ratio), a.MaxPrice.Div(ratio), a.AvgPrice.Div(ratio)
+			a.PriceSum = a.PriceSum.Div(ratio)
+		}
+	}
+	for i := range r.s.signals {
+		if s := &r.s.signals[i]; s.Symbol == symbol && s.GeneratedAt.Before(cutoff) {
+			s.Avg5, s.Avg20 = s.Avg5.Div(ratio), s.Avg20.Div(ratio)
+		}
+	}
+	return ledgers, nil
+}
+
+func (r *memoryCorporateActionRepo) ApplyRename(action models.CorporateAction, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	from, to := action.Symbol, action.NewSymbol
+	rename := func(symbol *string) {
+		if *symbol == from {
+			*symbol = to
+		}
+	}
+
+	if err := r.claim(action.ID, at); err != nil {
+		return err
+	}
+
+	// Like the unique keys of the positions, bars and daily analytics tables:
+	// a position held in both symbols is merged, and history the new symbol
+	// already has wins over the old symbol's
+	holding := map[uint]int{}
+	for i, p := range r.s.positions {
+		if p.Symbol == to {
+			holding[p.PortfolioID] = i
+		}
+	}
+	positions := make([]models.Position, 0, len(r.s.positions))
+	for _, p := range r.s.positions {
+		if i, ok := holding[p.PortfolioID]; ok && p.Symbol == from {
+			r.s.positions[i] = mergePosition(r.s.positions[i], p)
+		}
+	}
+	for _, p := range r.s.positions {
+		if _, ok := holding[p.PortfolioID]; !ok || p.Symbol != from {
+			positions = append(positions, p)
+		}
+	}
+	r.s.positions = positions
+	for i := range r.s.stocks {
+		rename(&r.s.stocks[i].StockSymbol)
+	}
+	for i := range r.s.positions {
+		rename(&r.s.positions[i].Symbol)
+	}
+	for i := range r.s.transactions {
+		rename(&r.s.transactions[i].Symbol)
+	}
+	for i := range r.s.positionRules {
+		rename(&r.s.positionRules[i].Symbol)
+	}
+	for i := range r.s.expressionRules {
+		rename(&r.s.expressionRules[i].Symbol)
+	}
+	for i := range r.s.signalRules {
+		rename(&r.s.signalRules[i].Symbol)
+	}
+	for i := range r.s.prices {
+		rename(&r.s.prices[i].Symbol)
+	}
+	for interval, bars := range r.s.bars {
+		taken := map[int64]bool{}
+		for _, bar := range bars {
+			if bar.Symbol == to {
+				taken[bar.Bucket.UnixNano()] = true
+			}
+		}
+		kept := make([]models.PriceBar, 0, len(bars))
+		for _, bar := range bars {
+			if bar.Symbol == from && taken[bar.Bucket.UnixNano()] {
+				continue
+			}
+			rename(&bar.Symbol)
+			kept = append(kept, bar)
+		}
+		r.s.bars[interval] = kept
+	}
+	taken := map[int64]bool{}
+	for _, a := range r.s.analytics {
+		if a.Symbol == to {
+			taken[a.Date.UnixNano()] = true
+		}
+	}
+	analytics := make([]models.DailyAnalytics, 0, len(r.s.analytics))
+	for _, a := range r.s.analytics {
+		if a.Symbol == from && taken[a.Date.UnixNano()] {
+			continue
+		}
+		rename(&a.Symbol)
+		analytics = append(analytics, a)
+	}
+	r.s.analytics = analytics
+	for i := range r.s.signals {
+		rename(&r.s.signals[i].Symbol)
+	}
+
+	// The new symbol takes over the catalog entry unless it has its own
+	known := map[string]int{}
+	for i, entry := range r.s.symbols {
+		known[entry.Symbol] = i
+	}
+	if i, ok := known[from]; ok {
+		if _, taken := known[to]; !taken {
+			entry := r.s.symbols[i]
+			entry.ID, entry.Symbol = r.s.nextID(), to
+			r.s.symbols = append(r.s.symbols, entry)
+		}
+	}
+	return nil
+}
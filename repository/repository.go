@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrNotFound is returned when a lookup matches no rows
+var ErrNotFound = errors.New("record not found")
+
+// UserRepo stores users
+type UserRepo interface {
+	Create(user *models.User) error
+	List() ([]models.User, error)
+	FindByID(id uint) (*models.User, error)
+	// SetBaseCurrency changes a user's base currency, ErrNotFound for an unknown
+	// user. A change clears the peaks of the user's drawdown rules.
+	SetBaseCurrency(id uint, currency string) error
+}
+
+// SymbolRepo stores the symbols catalog
+type SymbolRepo interface {
+	// Upsert inserts entries or replaces the existing entries of the same symbols
+	Upsert(symbols []models.Symbol) error
+	// Find returns a symbol's entry, ErrNotFound if it is not in the catalog
+	Find(symbol string) (*models.Symbol, error)
+	// Search returns up to limit entries whose symbol starts with q or whose
+	// name contains it, ignoring case: the exact symbol first, then symbol
+	// prefixes, then names
+	Search(q string, limit int) ([]models.Symbol, error)
+	Count() (int64, error)
+}
+
+// PortfolioRepo stores portfolios
+type PortfolioRepo interface {
+	Create(portfolio *models.Portfolio) error
+	List() ([]models.Portfolio, error)
+	FindByID(id uint) (*models.Portfolio, error)
+	// FindByUserID returns the user's first portfolio with its stocks loaded
+	FindByUserID(userID uint) (*models.Portfolio, error)
+	// ListByUser returns the user's portfolios and watchlists with their stocks, oldest first
+	ListByUser(userID uint) ([]models.Portfolio, error)
+	// SetCostMethod changes a portfolio's cost method, ErrNotFound for an unknown portfolio
+	SetCostMethod(id uint, method string) error
+}
+
+// StockRepo stores the watched stocks and their thresholds
+type StockRepo interface {
+	Create(stock *models.Stock) error
+	List() ([]models.Stock, error)
+	ListByPortfolio(portfolioID uint) ([]models.Stock, error)
+	ListBySymbol(symbol string) ([]models.Stock, error)
+	// MoveSymbol moves a portfolio's stocks in a symbol to another portfolio
+	// and returns them; ErrNotFound if the source has none
+	MoveSymbol(fromPortfolioID, toPortfolioID uint, symbol string) ([]models.Stock, error)
+}
+
+// PositionRepo stores the holdings of each portfolio
+type PositionRepo interface {
+	// Upsert inserts the position or replaces the portfolio's existing position in the symbol
+	Upsert(position *models.Position) error
+	ListByPortfolio(portfolioID uint) ([]models.Position, error)
+	// Delete removes a position, ErrNotFound if the portfolio does not hold the symbol
+	Delete(portfolioID uint, symbol string) error
+	List() ([]models.Position, error)
+	// Replace swaps all positions of a portfolio for the given ones
+	Replace(portfolioID uint, positions []models.Position) error
+}
+
+// PortfolioRuleRepo stores the alert rules on whole portfolios
+type PortfolioRuleRepo interface {
+	Create(rule *models.PortfolioAlertRule) error
+	List() ([]models.PortfolioAlertRule, error)
+	ListByPortfolio(portfolioID uint) ([]models.PortfolioAlertRule, error)
+	// Delete removes a rule, ErrNotFound if the portfolio has no such rule
+	Delete(portfolioID, id uint) error
+	UpdatePeak(id uint, peak decimal.Decimal) error
+}
+
+// PositionRuleRepo stores the stop-loss, take-profit and trailing-stop rules
+type PositionRuleRepo interface {
+	Create(rule *models.PositionAlertRule) error
+	List() ([]models.PositionAlertRule, error)
+	ListByPortfolio(portfolioID uint) ([]models.PositionAlertRule, error)
+	// Delete removes a rule, ErrNotFound if the portfolio has no such rule
+	Delete(portfolioID, id uint) error
+	// UpdateState stores the high-water mark and trigger state of a rule
+	UpdateState(id uint, highWater decimal.Decimal, triggered bool) error
+}
+
+// SignalRuleRepo stores the users' subscriptions to indicator events
+type SignalRuleRepo interface {
+	Create(rule *models.SignalRule) error
+	List() ([]models.SignalRule, error)
+	ListByUser(userID uint) ([]models.SignalRule, error)
+	// Delete removes a rule, ErrNotFound if the user has no such rule
+	Delete(userID, id uint) error
+}
+
+// ExpressionRuleRepo stores the users' custom alert conditions
+type ExpressionRuleRepo interface {
+	Create(rule *models.ExpressionRule) error
+	List() ([]models.ExpressionRule, error)
+	ListByUser(userID uint) ([]models.ExpressionRule, error)
+	// Delete removes a rule, ErrNotFound if the user has no such rule
+	Delete(userID, id uint) error
+	UpdateTriggered(id uint, triggered bool) error
+}
+
+// TransactionRepo stores the ledger of each portfolio
+type TransactionRepo interface {
+	Create(transaction *models.Transaction) error
+	// ListByPortfolio returns the ledger ordered by trade date
+	ListByPortfolio(portfolioID uint) ([]models.Transaction, error)
+	// Delete removes a ledger entry, ErrNotFound if the portfolio has no such entry
+	Delete(portfolioID, id uint) error
+}
+
+// AlertRepo stores triggered alerts
+type AlertRepo interface {
+	Create(alert *models.Alert) error
+	ListByUser(userID uint) ([]models.Alert, error)
+	// FindByIDs returns those of the given alerts that belong to the user
+	FindByIDs(userID uint, ids []uint) ([]models.Alert, error)
+	// SetStatus moves alerts to a status, storing snoozedUntil with it
+	SetStatus(ids []uint, status models.AlertStatus, snoozedUntil *time.Time, at time.Time) error
+	// CountByStatus counts a user's alerts per status
+	CountByStatus(userID uint) (map[models.AlertStatus]int, error)
+	// ListSnoozed returns the alerts snoozed past the given time
+	ListSnoozed(at time.Time) ([]models.Alert, error)
+	// ListUnnotified returns the alerts the notifier has not sent yet, oldest first
+	ListUnnotified() ([]models.Alert, error)
+	MarkNotified(ids []uint, at time.Time) error
+	// ListBetween returns a user's alerts raised in [from, to), oldest first
+	ListBetween(userID uint, from, to time.Time) ([]models.Alert, error)
+}
+
+// NotificationRepo stores how and when users are told about alerts
+type NotificationRepo interface {
+	// FindPreferences returns a user's preferences, ErrNotFound if none were saved
+	FindPreferences(userID uint) (*models.NotificationPreferences, error)
+	// SavePreferences inserts or replaces the preferences of prefs.UserID,
+	// keeping the time of the last digest
+	SavePreferences(prefs *models.NotificationPreferences) error
+	// ListDigests returns the preferences of the users who receive a digest
+	ListDigests() ([]models.NotificationPreferences, error)
+	SetLastDigest(userID uint, at time.Time) error
+	// SaveRuleChannels inserts or replaces the channels of a rule
+	SaveRuleChannels(channels *models.RuleChannels) error
+	ListRuleChannels(userID uint) ([]models.RuleChannels, error)
+	// DeleteRuleChannels removes an override, ErrNotFound if the user has no such override
+	DeleteRuleChannels(userID, id uint) error
+}
+
+// PriceRepo stores the raw price history
+type PriceRepo interface {
+	Create(record *models.StockPriceRecord) error
+	// CreateBatch stores many ticks with multi-row inserts in one transaction
+	CreateBatch(records []models.StockPriceRecord) error
+	// ListBetween returns the ticks of every symbol in [from, to) ordered by time
+	ListBetween(from, to time.Time) ([]models.StockPriceRecord, error)
+	// List returns a symbol's ticks in [from, to) ordered by time
+	List(symbol string, from, to time.Time) ([]models.StockPriceRecord, error)
+	// EnsurePartitions prepares storage for the months from `from` onwards,
+	// where the backend partitions by time
+	EnsurePartitions(from time.Time, months int) error
+	// DeleteBefore drops history older than the cutoff. Partitioned backends
+	// drop whole months, so rows may outlive the cutoff until their month ends.
+	DeleteBefore(cutoff time.Time) error
+	// Latest returns the newest tick of each symbol; symbols without history are left out
+	Latest(symbols []string) (map[string]models.StockPriceRecord, error)
+	// Oldest returns the time of the oldest tick, ErrNotFound if there is none
+	Oldest() (time.Time, error)
+}
+
+// BarRepo stores the OHLC rollups of the price history
+type BarRepo interface {
+	// Upsert inserts bars or replaces the existing bar of the same symbol and bucket
+	Upsert(interval models.BarInterval, bars []models.PriceBar) error
+	// List returns a symbol's bars in [from, to) ordered by bucket
+	List(interval models.BarInterval, symbol string, from, to time.Time) ([]models.PriceBar, error)
+	// ListBetween returns the bars of every symbol in [from, to) ordered by bucket
+	ListBetween(interval models.BarInterval, from, to time.Time) ([]models.PriceBar, error)
+	// LatestBucket returns the newest bucket of an interval, ErrNotFound if there is none
+	LatestBucket(interval models.BarInterval) (time.Time, error)
+}
+
+// AnalyticsRepo stores the daily aggregates of the analytics consumer
+type AnalyticsRepo interface {
+	FindDaily(symbol string, date time.Time) (*models.DailyAnalytics, error)
+	SaveDaily(analytics *models.DailyAnalytics) error
+	// SaveSignal records a change of a symbol's moving-average signal
+	SaveSignal(signal *models.StockAnalytics) error
+	// ListSignals returns the signal changes of the symbols in [from, to), oldest first
+	ListSignals(symbols []string, from, to time.Time) ([]models.StockAnalytics, error)
+}
+
+// AnalyticsShadowRepo rebuilds the analytics tables: recomputed rows go to
+// shadow copies, which then replace the live rows in one transaction
+type AnalyticsShadowRepo interface {
+	// Reset empties the shadow copies, creating them if need be, and copies in
+	// the live rows dated before keepBefore, which the rebuild leaves as they are
+	Reset(keepBefore time.Time) error
+	// Insert adds recomputed rows to the shadow copies
+	Insert(daily []models.DailyAnalytics, signals []models.StockAnalytics) error
+	// Swap replaces the live rows with the shadow copies' and drops the copies
+	Swap() error
+}
+
+// CorporateActionRepo stores splits and ticker changes and applies them
+// across the tables that hold symbols and prices
+type CorporateActionRepo interface {
+	// Create stores an action unless one of the same type, symbol and
+	// effective date exists, reporting whether it was stored
+	Create(action *models.CorporateAction) (bool, error)
+	// List returns the actions on a symbol, as old or new symbol, or every
+	// action for "", by effective date
+	List(symbol string) ([]models.CorporateAction, error)
+	// ListPending returns the actions not applied yet, by effective date
+	ListPending() ([]models.CorporateAction, error)
+	// DeletePending removes an action not applied yet, ErrNotFound otherwise
+	DeletePending(id uint) error
+	// ApplySplit divides thresholds, amount rules and the prices before cutoff
+	// by the ratio, multiplies the shares of positions entered directly, and
+	// records a SPLIT in the ledgers holding the symbol. It returns the
+	// portfolios with a ledger, whose positions must be replayed.
+	// Both Apply methods mark the action applied, and fail with ErrNotFound
+	// when it already is.
+	ApplySplit(action models.CorporateAction, cutoff, at time.Time) ([]uint, error)
+	// ApplyRename moves stocks, holdings, ledgers, rules and price history
+	// from the old symbol to the new one
+	ApplyRename(action models.CorporateAction, at time.Time) error
+}
+
+// Repositories bundles every repository a service may need
+type Repositories struct {
+	Users           UserRepo
+	Symbols         SymbolRepo
+	Portfolios      PortfolioRepo
+	Stocks          StockRepo
+	Positions       PositionRepo
+	Transactions    TransactionRepo
+	PortfolioRules  PortfolioRuleRepo
+	PositionRules   PositionRuleRepo
+	SignalRules     SignalRuleRepo
+	ExpressionRules ExpressionRuleRepo
+	Alerts          AlertRepo
+	Notifications   NotificationRepo
+	Prices          PriceRepo
+	Bars            BarRepo
+	Analytics       AnalyticsRepo
+	AnalyticsShadow AnalyticsShadowRepo
+	Actions         CorporateActionRepo
+}
@@ -0,0 +1,849 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"stock-alerts/db/dbtest"
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// forEachImpl runs a test against the GORM and the in-memory repositories,
+// so the fakes used by consumer tests keep behaving like the real thing
+func forEachImpl(t *testing.T, test func(t *testing.T, repos Repositories)) {
+	t.Run("gorm", func(t *testing.T) { test(t, NewGormRepositories(dbtest.Open(t))) })
+	t.Run("memory", func(t *testing.T) { test(t, NewMemoryRepositories()) })
+}
+
+func TestPortfolioIncludesStocks(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+
+		if _, err := repos.Portfolios.FindByUserID(user.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+
+		portfolio := models.Portfolio{UserID: user.ID}
+		repos.Portfolios.Create(&portfolio)
+		repos.Stocks.Create(&models.Stock{PortfolioID: portfolio.ID, StockSymbol: "AAPL"})
+
+		found, err := repos.Portfolios.FindByUserID(user.ID)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(found.Stocks) != 1 || found.Stocks[0].StockSymbol != "AAPL" {
+			t.Errorf("Expected only AAPL in portfolio, got %+v", found.Stocks)
+		}
+
+		stocks, _ := repos.Stocks.ListBySymbol("AAPL")
+		if len(stocks) != 1 {
+			t.Errorf("Expected 1 AAPL stock, got %d", len(stocks))
+		}
+	})
+}
+
+func TestUserBaseCurrency(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		if err := repos.Users.SetBaseCurrency(user.ID, "GBP"); err != nil {
+			t.Fatalf("SetBaseCurrency failed: %v", err)
+		}
+		found, _ := repos.Users.FindByID(user.ID)
+		if found.Base() != "GBP" {
+			t.Errorf("Expected GBP, got %q", found.BaseCurrency)
+		}
+		if err := repos.Users.SetBaseCurrency(999, "GBP"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for a missing user, got %v", err)
+		}
+	})
+}
+
+// Test that a new base currency clears the drawdown peaks of the user's
+// portfolios only
+func TestBaseCurrencyChangeClearsPeaks(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		jane := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&jane)
+		john := models.User{Name: "John", Email: "john@example.com"}
+		repos.Users.Create(&john)
+		mine := models.Portfolio{UserID: jane.ID, Name: "Trading"}
+		repos.Portfolios.Create(&mine)
+		theirs := models.Portfolio{UserID: john.ID, Name: "Trading"}
+		repos.Portfolios.Create(&theirs)
+		rules := []models.PortfolioAlertRule{
+			{PortfolioID: mine.ID, Type: models.RuleDrawdown, Threshold: decimal.NewFromInt(10), Peak: decimal.NewFromInt(2500)},
+			{PortfolioID: theirs.ID, Type: models.RuleDrawdown, Threshold: decimal.NewFromInt(10), Peak: decimal.NewFromInt(2500)},
+		}
+		for i := range rules {
+			repos.PortfolioRules.Create(&rules[i])
+		}
+
+		peaks := func() map[uint]string {
+			stored, _ := repos.PortfolioRules.List()
+			peaks := map[uint]string{}
+			for _, rule := range stored {
+				peaks[rule.PortfolioID] = rule.Peak.String()
+			}
+			return peaks
+		}
+		repos.Users.SetBaseCurrency(jane.ID, models.DefaultCurrency)
+		if p := peaks(); p[mine.ID] != "2500" {
+			t.Errorf("Expected the peak kept without a change, got %v", p)
+		}
+		repos.Users.SetBaseCurrency(jane.ID, "EUR")
+		if p := peaks(); p[mine.ID] != "0" || p[theirs.ID] != "2500" {
+			t.Errorf("Expected only Jane's peak cleared, got %v", p)
+		}
+	})
+}
+
+func TestAnalyticsSaveDaily(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		date := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+
+		daily := &models.DailyAnalytics{Symbol: "AAPL", Date: date, AvgPrice: decimal.NewFromInt(10)}
+		if err := repos.Analytics.SaveDaily(daily); err != nil {
+			t.Fatalf("SaveDaily failed: %v", err)
+		}
+		daily.AvgPrice = decimal.NewFromInt(12)
+		repos.Analytics.SaveDaily(daily)
+
+		found, err := repos.Analytics.FindDaily("AAPL", date)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !found.AvgPrice.Equal(decimal.NewFromInt(12)) || found.ID != daily.ID {
+			t.Errorf("Expected updated row %d with avg 12, got %+v", daily.ID, found)
+		}
+	})
+}
+
+// Test that a rebuild keeps the old rows, replaces the recomputed ones and
+// leaves the live rows untouched until the swap
+func TestAnalyticsShadowSwap(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+		repos.Analytics.SaveDaily(&models.DailyAnalytics{Symbol: "AAPL", Date: day(2), AvgPrice: decimal.NewFromInt(10)})
+		repos.Analytics.SaveDaily(&models.DailyAnalytics{Symbol: "AAPL", Date: day(3), AvgPrice: decimal.NewFromInt(99)})
+		repos.Analytics.SaveSignal(&models.StockAnalytics{Symbol: "AAPL", Signal: models.SignalBearish, GeneratedAt: day(2).Add(15 * time.Hour)})
+		repos.Analytics.SaveSignal(&models.StockAnalytics{Symbol: "AAPL", Signal: models.SignalBearish, GeneratedAt: day(3).Add(15 * time.Hour)})
+
+		if err := repos.AnalyticsShadow.Reset(day(3)); err != nil {
+			t.Fatalf("Reset failed: %v", err)
+		}
+		err := repos.AnalyticsShadow.Insert(
+			[]models.DailyAnalytics{
+				{Symbol: "AAPL", Date: day(3), AvgPrice: decimal.NewFromInt(11)},
+				{Symbol: "AAPL", Date: day(4), AvgPrice: decimal.NewFromInt(12)},
+			},
+			[]models.StockAnalytics{{Symbol: "AAPL", Signal: models.SignalBullish, GeneratedAt: day(3).Add(16 * time.Hour)}},
+		)
+		if err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+		if found, _ := repos.Analytics.FindDaily("AAPL", day(3)); found == nil || !found.AvgPrice.Equal(decimal.NewFromInt(99)) {
+			t.Errorf("Expected the live row until the swap, got %+v", found)
+		}
+
+		if err := repos.AnalyticsShadow.Swap(); err != nil {
+			t.Fatalf("Swap failed: %v", err)
+		}
+		for d, avg := range map[int]int64{2: 10, 3: 11, 4: 12} {
+			found, err := repos.Analytics.FindDaily("AAPL", day(d))
+			if err != nil || !found.AvgPrice.Equal(decimal.NewFromInt(avg)) {
+				t.Errorf("Expected avg %d on day %d, got %+v (%v)", avg, d, found, err)
+			}
+		}
+		signals, _ := repos.Analytics.ListSignals([]string{"AAPL"}, day(1), day(5))
+		if len(signals) != 2 || signals[0].Signal != models.SignalBearish || signals[1].Signal != models.SignalBullish {
+			t.Errorf("Expected the kept and the recomputed signal, got %+v", signals)
+		}
+
+		// A new row after the swap gets a fresh id
+		next := &models.DailyAnalytics{Symbol: "MSFT", Date: day(4)}
+		if err := repos.Analytics.SaveDaily(next); err != nil || next.ID == 0 {
+			t.Errorf("Expected the live table to keep numbering rows, got id %d (%v)", next.ID, err)
+		}
+		if err := repos.AnalyticsShadow.Swap(); err == nil {
+			t.Error("Expected a second swap to fail without a rebuild")
+		}
+	})
+}
+
+func TestBarsUpsertAndList(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		bucket := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+		if _, err := repos.Bars.LatestBucket(models.Interval1m); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound on empty table, got %v", err)
+		}
+
+		repos.Bars.Upsert(models.Interval1m, []models.PriceBar{
+			{Symbol: "AAPL", Bucket: bucket, Open: decimal.NewFromInt(1), High: decimal.NewFromInt(2), Low: decimal.NewFromInt(1), Close: decimal.NewFromInt(2), Count: 2},
+			{Symbol: "AAPL", Bucket: bucket.Add(time.Minute), Open: decimal.NewFromInt(2), High: decimal.NewFromInt(2), Low: decimal.NewFromInt(2), Close: decimal.NewFromInt(2), Count: 1},
+		})
+		err := repos.Bars.Upsert(models.Interval1m, []models.PriceBar{
+			{Symbol: "AAPL", Bucket: bucket, Open: decimal.NewFromInt(1), High: decimal.NewFromInt(3), Low: decimal.NewFromInt(1), Close: decimal.NewFromInt(3), Count: 3},
+		})
+		if err != nil {
+			t.Fatalf("Upsert failed: %v", err)
+		}
+
+		bars, _ := repos.Bars.List(models.Interval1m, "AAPL", bucket, bucket.Add(time.Hour))
+		if len(bars) != 2 || !bars[0].Close.Equal(decimal.NewFromInt(3)) || bars[0].Count != 3 {
+			t.Errorf("Expected the first bar to be replaced, got %+v", bars)
+		}
+		latest, _ := repos.Bars.LatestBucket(models.Interval1m)
+		if !latest.Equal(bucket.Add(time.Minute)) {
+			t.Errorf("Expected latest bucket %v, got %v", bucket.Add(time.Minute), latest)
+		}
+		if other, _ := repos.Bars.List(models.Interval1h, "AAPL", bucket, bucket.Add(time.Hour)); len(other) != 0 {
+			t.Errorf("Expected intervals to be stored separately, got %+v", other)
+		}
+	})
+}
+
+func TestPricesListAndDelete(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+		for _, offset := range []time.Duration{-48 * time.Hour, -time.Hour, -time.Minute} {
+			repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(1), Timestamp: now.Add(offset)})
+		}
+
+		records, err := repos.Prices.ListBetween(now.Add(-2*time.Hour), now)
+		if err != nil || len(records) != 2 {
+			t.Fatalf("Expected 2 recent records, got %d (%v)", len(records), err)
+		}
+		if !records[0].Timestamp.Before(records[1].Timestamp) {
+			t.Errorf("Expected records ordered by time, got %+v", records)
+		}
+
+		repos.Prices.DeleteBefore(now.Add(-24 * time.Hour))
+		all, _ := repos.Prices.ListBetween(time.Time{}, now)
+		if len(all) != 2 {
+			t.Errorf("Expected the old record to be deleted, got %d records", len(all))
+		}
+	})
+}
+
+func TestPricesListBySymbol(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+		repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(2), Timestamp: now.Add(-time.Minute)})
+		repos.Prices.Create(&models.StockPriceRecord{Symbol: "MSFT", Price: decimal.NewFromInt(3), Timestamp: now.Add(-time.Minute)})
+		repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(1), Timestamp: now.Add(-time.Hour)})
+		repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(9), Timestamp: now})
+
+		records, err := repos.Prices.List("AAPL", now.Add(-2*time.Hour), now)
+		if err != nil || len(records) != 2 || !records[0].Price.Equal(decimal.NewFromInt(1)) || !records[1].Price.Equal(decimal.NewFromInt(2)) {
+			t.Errorf("Expected the two AAPL ticks in time order, got %+v (%v)", records, err)
+		}
+	})
+}
+
+func TestPricesCreateBatch(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+		records := make([]models.StockPriceRecord, 2500)
+		for i := range records {
+			records[i] = models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(int64(i)), Timestamp: now.Add(time.Duration(i) * time.Second)}
+		}
+		if err := repos.Prices.CreateBatch(records); err != nil {
+			t.Fatalf("CreateBatch failed: %v", err)
+		}
+
+		stored, _ := repos.Prices.ListBetween(now, now.Add(time.Hour))
+		if len(stored) != len(records) {
+			t.Errorf("Expected %d stored records, got %d", len(records), len(stored))
+		}
+		if records[0].ID == 0 {
+			t.Error("Expected IDs to be assigned")
+		}
+	})
+}
+
+func TestPositionsUpsertAndDelete(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		portfolio := models.Portfolio{UserID: user.ID}
+		repos.Portfolios.Create(&portfolio)
+
+		first := models.Position{PortfolioID: portfolio.ID, Symbol: "MSFT", Quantity: decimal.NewFromInt(5), AvgCost: decimal.NewFromInt(300)}
+		if err := repos.Positions.Upsert(&first); err != nil {
+			t.Fatalf("Upsert failed: %v", err)
+		}
+		repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "AAPL", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(100)})
+		replaced := models.Position{PortfolioID: portfolio.ID, Symbol: "MSFT", Quantity: decimal.NewFromInt(8), AvgCost: decimal.NewFromInt(310), Currency: "USD"}
+		repos.Positions.Upsert(&replaced)
+
+		positions, _ := repos.Positions.ListByPortfolio(portfolio.ID)
+		if len(positions) != 2 || positions[0].Symbol != "AAPL" || !positions[1].Quantity.Equal(decimal.NewFromInt(8)) {
+			t.Fatalf("Expected AAPL and the replaced MSFT position, got %+v", positions)
+		}
+		if positions[0].Currency != "USD" {
+			t.Errorf("Expected currency to default to USD, got %q", positions[0].Currency)
+		}
+
+		if err := repos.Positions.Delete(portfolio.ID, "AAPL"); err != nil {
+			t.Errorf("Delete failed: %v", err)
+		}
+		if err := repos.Positions.Delete(portfolio.ID, "AAPL"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound on second delete, got %v", err)
+		}
+	})
+}
+
+func TestPricesLatest(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+		if _, err := repos.Prices.Oldest(); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound without history, got %v", err)
+		}
+		repos.Prices.CreateBatch([]models.StockPriceRecord{
+			{Symbol: "AAPL", Price: decimal.NewFromInt(101), Timestamp: now},
+			{Symbol: "AAPL", Price: decimal.NewFromInt(100), Timestamp: now.Add(-time.Minute)},
+			{Symbol: "MSFT", Price: decimal.NewFromInt(300), Timestamp: now.Add(-time.Hour)},
+			{Symbol: "TSLA", Price: decimal.NewFromInt(200), Timestamp: now},
+		})
+
+		latest, err := repos.Prices.Latest([]string{"AAPL", "MSFT", "NVDA"})
+		if err != nil {
+			t.Fatalf("Latest failed: %v", err)
+		}
+		if len(latest) != 2 || !latest["AAPL"].Price.Equal(decimal.NewFromInt(101)) || !latest["MSFT"].Price.Equal(decimal.NewFromInt(300)) {
+			t.Errorf("Expected the newest AAPL and MSFT ticks only, got %+v", latest)
+		}
+
+		oldest, err := repos.Prices.Oldest()
+		if err != nil || !oldest.Equal(now.Add(-time.Hour)) {
+			t.Errorf("Expected the MSFT tick to be the oldest, got %v (%v)", oldest, err)
+		}
+	})
+}
+
+func TestTransactionsAndPositionReplace(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		portfolio := models.Portfolio{UserID: user.ID}
+		repos.Portfolios.Create(&portfolio)
+
+		date := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+		later := models.Transaction{PortfolioID: portfolio.ID, Type: models.TransactionSell, Symbol: "AAPL", Quantity: decimal.NewFromInt(1), TradeDate: date.AddDate(0, 0, 1)}
+		earlier := models.Transaction{PortfolioID: portfolio.ID, Type: models.TransactionBuy, Symbol: "AAPL", Quantity: decimal.NewFromInt(2), TradeDate: date}
+		repos.Transactions.Create(&later)
+		if err := repos.Transactions.Create(&earlier); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		transactions, _ := repos.Transactions.ListByPortfolio(portfolio.ID)
+		if len(transactions) != 2 || transactions[0].ID != earlier.ID || transactions[0].Currency != "USD" {
+			t.Errorf("Expected the ledger ordered by trade date, got %+v", transactions)
+		}
+		if err := repos.Transactions.Delete(portfolio.ID, later.ID); err != nil {
+			t.Errorf("Delete failed: %v", err)
+		}
+		if err := repos.Transactions.Delete(portfolio.ID+1, earlier.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for another portfolio, got %v", err)
+		}
+
+		repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "MSFT", Quantity: decimal.NewFromInt(1)})
+		err := repos.Positions.Replace(portfolio.ID, []models.Position{{Symbol: "AAPL", Quantity: decimal.NewFromInt(2), AvgCost: decimal.NewFromInt(100), Currency: "USD"}})
+		if err != nil {
+			t.Fatalf("Replace failed: %v", err)
+		}
+		positions, _ := repos.Positions.ListByPortfolio(portfolio.ID)
+		if len(positions) != 1 || positions[0].Symbol != "AAPL" {
+			t.Errorf("Expected only the AAPL position, got %+v", positions)
+		}
+	})
+}
+
+func TestPortfoliosPerUserAndMoveSymbol(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		trading := models.Portfolio{UserID: user.ID, Name: "Trading"}
+		watchlist := models.Portfolio{UserID: user.ID, Name: "Ideas", Kind: models.KindWatchlist}
+		repos.Portfolios.Create(&trading)
+		if err := repos.Portfolios.Create(&watchlist); err != nil {
+			t.Fatalf("Expected a second portfolio per user, got %v", err)
+		}
+		if err := repos.Portfolios.Create(&models.Portfolio{UserID: user.ID, Name: "Trading"}); err == nil {
+			t.Error("Expected duplicate portfolio names to be rejected")
+		}
+		repos.Stocks.Create(&models.Stock{PortfolioID: watchlist.ID, StockSymbol: "NVDA", ThresholdPrice: decimal.NewFromInt(500)})
+
+		moved, err := repos.Stocks.MoveSymbol(watchlist.ID, trading.ID, "NVDA")
+		if err != nil || len(moved) != 1 || moved[0].PortfolioID != trading.ID {
+			t.Fatalf("Expected NVDA to move to trading, got %+v (%v)", moved, err)
+		}
+		if _, err := repos.Stocks.MoveSymbol(watchlist.ID, trading.ID, "NVDA"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound once moved, got %v", err)
+		}
+
+		portfolios, _ := repos.Portfolios.ListByUser(user.ID)
+		if len(portfolios) != 2 || portfolios[0].Name != "Trading" || len(portfolios[0].Stocks) != 1 {
+			t.Errorf("Expected Trading first holding NVDA, got %+v", portfolios)
+		}
+		if portfolios[1].Kind != models.KindWatchlist || portfolios[0].Kind != models.KindPortfolio {
+			t.Errorf("Expected kinds to round-trip, got %+v", portfolios)
+		}
+	})
+}
+
+func TestPortfolioRulesAndAlertKinds(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		portfolio := models.Portfolio{UserID: user.ID}
+		repos.Portfolios.Create(&portfolio)
+
+		rule := models.PortfolioAlertRule{PortfolioID: portfolio.ID, Type: models.RuleDrawdown, Threshold: decimal.NewFromInt(10)}
+		if err := repos.PortfolioRules.Create(&rule); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		repos.PortfolioRules.UpdatePeak(rule.ID, decimal.NewFromInt(2500))
+		rules, _ := repos.PortfolioRules.ListByPortfolio(portfolio.ID)
+		if len(rules) != 1 || !rules[0].Peak.Equal(decimal.NewFromInt(2500)) {
+			t.Errorf("Expected the stored peak, got %+v", rules)
+		}
+
+		repos.Alerts.Create(&models.Alert{UserID: user.ID, StockSymbol: "AAPL", Price: decimal.NewFromInt(1)})
+		repos.Alerts.Create(&models.Alert{UserID: user.ID, Kind: models.AlertKind(models.RuleDrawdown), PortfolioID: &portfolio.ID, Price: decimal.NewFromInt(12)})
+		alerts, _ := repos.Alerts.ListByUser(user.ID)
+		if len(alerts) != 2 || alerts[0].Kind != models.AlertThreshold || alerts[1].PortfolioID == nil || *alerts[1].PortfolioID != portfolio.ID {
+			t.Errorf("Expected a threshold and a portfolio alert, got %+v", alerts)
+		}
+	})
+}
+
+func TestPositionRules(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		portfolio := models.Portfolio{UserID: user.ID}
+		repos.Portfolios.Create(&portfolio)
+
+		rule := models.PositionAlertRule{PortfolioID: portfolio.ID, Symbol: "AAPL", Type: models.RuleTrailingStop, Value: decimal.NewFromInt(10), HighWater: decimal.NewFromInt(100)}
+		if err := repos.PositionRules.Create(&rule); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := repos.PositionRules.UpdateState(rule.ID, decimal.NewFromInt(130), true); err != nil {
+			t.Fatalf("UpdateState failed: %v", err)
+		}
+		rules, _ := repos.PositionRules.List()
+		if len(rules) != 1 || rules[0].Unit != models.UnitPercent || !rules[0].HighWater.Equal(decimal.NewFromInt(130)) || !rules[0].Triggered {
+			t.Errorf("Expected the stored state with the default unit, got %+v", rules)
+		}
+
+		if err := repos.PositionRules.Delete(portfolio.ID+1, rule.ID); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound for another portfolio, got %v", err)
+		}
+		if err := repos.PositionRules.Delete(portfolio.ID, rule.ID); err != nil {
+			t.Errorf("Delete failed: %v", err)
+		}
+		if rules, _ := repos.PositionRules.ListByPortfolio(portfolio.ID); len(rules) != 0 {
+			t.Errorf("Expected no rules after delete, got %+v", rules)
+		}
+	})
+}
+
+func TestSignalRulesAndSignals(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+
+		rule := models.SignalRule{UserID: user.ID, Symbol: "AAPL", Type: models.SignalChange, From: models.SignalNeutral, To: models.SignalBullish}
+		if err := repos.SignalRules.Create(&rule); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		rules, _ := repos.SignalRules.List()
+		if len(rules) != 1 || rules[0].From != models.SignalNeutral || rules[0].To != models.SignalBullish {
+			t.Errorf("Expected the stored transition, got %+v", rules)
+		}
+		if err := repos.SignalRules.Delete(user.ID+1, rule.ID); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound for another user, got %v", err)
+		}
+		if err := repos.SignalRules.Delete(user.ID, rule.ID); err != nil {
+			t.Errorf("Delete failed: %v", err)
+		}
+
+		signal := models.StockAnalytics{Symbol: "AAPL", Avg5: decimal.NewFromInt(101), Avg20: decimal.NewFromInt(100), Signal: models.SignalBullish, GeneratedAt: time.Now()}
+		if err := repos.Analytics.SaveSignal(&signal); err != nil || signal.ID == 0 {
+			t.Errorf("Expected the signal to be stored, got %v", err)
+		}
+	})
+}
+
+func TestExpressionRules(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+
+		rule := models.ExpressionRule{UserID: user.ID, Symbol: "AAPL", Expression: "price > sma(20)"}
+		if err := repos.ExpressionRules.Create(&rule); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := repos.ExpressionRules.UpdateTriggered(rule.ID, true); err != nil {
+			t.Fatalf("UpdateTriggered failed: %v", err)
+		}
+		rules, _ := repos.ExpressionRules.List()
+		if len(rules) != 1 || rules[0].Expression != "price > sma(20)" || !rules[0].Triggered {
+			t.Errorf("Expected the stored rule and state, got %+v", rules)
+		}
+		if err := repos.ExpressionRules.Delete(user.ID+1, rule.ID); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound for another user, got %v", err)
+		}
+		if err := repos.ExpressionRules.Delete(user.ID, rule.ID); err != nil {
+			t.Errorf("Delete failed: %v", err)
+		}
+	})
+}
+
+func TestAlertLifecycle(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		ruleID := uint(7)
+		first := models.Alert{UserID: user.ID, RuleID: &ruleID, StockSymbol: "AAPL", Price: decimal.NewFromInt(150), Timestamp: time.Now()}
+		second := models.Alert{UserID: user.ID, StockSymbol: "AAPL", Price: decimal.NewFromInt(155), Timestamp: time.Now()}
+		repos.Alerts.Create(&first)
+		repos.Alerts.Create(&second)
+
+		found, err := repos.Alerts.FindByIDs(user.ID, []uint{first.ID, second.ID})
+		if err != nil || len(found) != 2 || found[0].Status != models.AlertNew {
+			t.Fatalf("Expected two new alerts, got %+v (%v)", found, err)
+		}
+		if found, _ := repos.Alerts.FindByIDs(user.ID+1, []uint{first.ID}); len(found) != 0 {
+			t.Errorf("Expected no alerts for another user, got %+v", found)
+		}
+
+		now := time.Now()
+		until := now.Add(time.Hour)
+		if err := repos.Alerts.SetStatus([]uint{first.ID}, models.AlertSnoozed, &until, now); err != nil {
+			t.Fatalf("SetStatus failed: %v", err)
+		}
+		if err := repos.Alerts.SetStatus([]uint{second.ID}, models.AlertRead, nil, now); err != nil {
+			t.Fatalf("SetStatus failed: %v", err)
+		}
+
+		snoozed, _ := repos.Alerts.ListSnoozed(now)
+		if len(snoozed) != 1 || snoozed[0].ID != first.ID || *snoozed[0].RuleID != ruleID {
+			t.Errorf("Expected the snoozed alert, got %+v", snoozed)
+		}
+		if snoozed, _ := repos.Alerts.ListSnoozed(until.Add(time.Minute)); len(snoozed) != 0 {
+			t.Errorf("Expected the snooze to have expired, got %+v", snoozed)
+		}
+
+		counts, err := repos.Alerts.CountByStatus(user.ID)
+		if err != nil || counts[models.AlertSnoozed] != 1 || counts[models.AlertRead] != 1 || counts[models.AlertNew] != 0 {
+			t.Errorf("Unexpected counts: %+v (%v)", counts, err)
+		}
+	})
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		if found, err := repos.Users.FindByID(user.ID); err != nil || found.Email != user.Email {
+			t.Errorf("Expected to find the user, got %+v (%v)", found, err)
+		}
+		if _, err := repos.Notifications.FindPreferences(user.ID); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound before saving, got %v", err)
+		}
+
+		prefs := models.NotificationPreferences{UserID: user.ID, Channels: models.Channels{models.ChannelEmail, models.ChannelWebhook},
+			Digest: models.DigestDaily, DigestHour: 8}
+		if err := repos.Notifications.SavePreferences(&prefs); err != nil {
+			t.Fatalf("SavePreferences failed: %v", err)
+		}
+		sent := time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC)
+		repos.Notifications.SetLastDigest(user.ID, sent)
+
+		prefs = models.NotificationPreferences{UserID: user.ID, Channels: models.Channels{models.ChannelEmail},
+			Timezone: "Europe/Paris", QuietStart: "22:00", QuietEnd: "07:00", Digest: models.DigestWeekly}
+		if err := repos.Notifications.SavePreferences(&prefs); err != nil {
+			t.Fatalf("SavePreferences failed on update: %v", err)
+		}
+		found, err := repos.Notifications.FindPreferences(user.ID)
+		if err != nil || len(found.Channels) != 1 || found.Channels[0] != models.ChannelEmail || found.Timezone != "Europe/Paris" {
+			t.Fatalf("Expected the updated preferences, got %+v (%v)", found, err)
+		}
+		if found.LastDigestAt == nil || !found.LastDigestAt.Equal(sent) {
+			t.Errorf("Expected the last digest to be kept, got %v", found.LastDigestAt)
+		}
+		if digests, _ := repos.Notifications.ListDigests(); len(digests) != 1 || digests[0].Digest != models.DigestWeekly {
+			t.Errorf("Expected one digest subscriber, got %+v", digests)
+		}
+
+		override := models.RuleChannels{UserID: user.ID, Kind: models.AlertThreshold, RuleID: 4, Channels: models.Channels{models.ChannelWebhook}}
+		repos.Notifications.SaveRuleChannels(&override)
+		override = models.RuleChannels{UserID: user.ID, Kind: models.AlertThreshold, RuleID: 4, Channels: models.Channels{}}
+		if err := repos.Notifications.SaveRuleChannels(&override); err != nil {
+			t.Fatalf("SaveRuleChannels failed: %v", err)
+		}
+		overrides, _ := repos.Notifications.ListRuleChannels(user.ID)
+		if len(overrides) != 1 || len(overrides[0].Channels) != 0 {
+			t.Fatalf("Expected one override without channels, got %+v", overrides)
+		}
+		if err := repos.Notifications.DeleteRuleChannels(user.ID+1, overrides[0].ID); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound for another user, got %v", err)
+		}
+		if err := repos.Notifications.DeleteRuleChannels(user.ID, overrides[0].ID); err != nil {
+			t.Errorf("DeleteRuleChannels failed: %v", err)
+		}
+	})
+}
+
+func TestAlertNotificationQueue(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		start := time.Date(2025, 3, 3, 14, 30, 0, 0, time.UTC)
+		first := models.Alert{UserID: user.ID, StockSymbol: "AAPL", Price: decimal.NewFromInt(150), Timestamp: start}
+		second := models.Alert{UserID: user.ID, StockSymbol: "AAPL", Price: decimal.NewFromInt(155), Timestamp: start.Add(time.Hour)}
+		repos.Alerts.Create(&first)
+		repos.Alerts.Create(&second)
+
+		queued, _ := repos.Alerts.ListUnnotified()
+		if len(queued) != 2 || queued[0].ID != first.ID {
+			t.Fatalf("Expected both alerts queued oldest first, got %+v", queued)
+		}
+		if err := repos.Alerts.MarkNotified([]uint{first.ID}, start); err != nil {
+			t.Fatalf("MarkNotified failed: %v", err)
+		}
+		if queued, _ := repos.Alerts.ListUnnotified(); len(queued) != 1 || queued[0].ID != second.ID {
+			t.Errorf("Expected only the second alert queued, got %+v", queued)
+		}
+		if between, _ := repos.Alerts.ListBetween(user.ID, start.Add(time.Minute), start.Add(2*time.Hour)); len(between) != 1 || between[0].ID != second.ID {
+			t.Errorf("Expected the second alert in range, got %+v", between)
+		}
+
+		repos.Analytics.SaveSignal(&models.StockAnalytics{Symbol: "AAPL", Signal: models.SignalBullish, GeneratedAt: start})
+		repos.Analytics.SaveSignal(&models.StockAnalytics{Symbol: "MSFT", Signal: models.SignalBearish, GeneratedAt: start})
+		if signals, _ := repos.Analytics.ListSignals([]string{"AAPL"}, start, start.Add(time.Hour)); len(signals) != 1 || signals[0].Signal != models.SignalBullish {
+			t.Errorf("Expected the AAPL signal, got %+v", signals)
+		}
+	})
+}
+
+func TestSymbolsUpsertAndSearch(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		err := repos.Symbols.Upsert([]models.Symbol{
+			{Symbol: "AAPL", Name: "Apple Inc.", Exchange: "XNAS", Currency: "USD", Type: "Equity"},
+			{Symbol: "AA", Name: "Alcoa Corporation", Exchange: "XNYS", Currency: "USD", Type: "Equity"},
+			{Symbol: "MSFT", Name: "Microsoft Corporation", Exchange: "XNAS", Currency: "USD", Type: "Equity"},
+			{Symbol: "SPY", Name: "SPDR S&P 500 ETF 100%_", Exchange: "ARCX", Currency: "USD", Type: "ETF"},
+		})
+		if err != nil {
+			t.Fatalf("Upsert failed: %v", err)
+		}
+		repos.Symbols.Upsert([]models.Symbol{{Symbol: "AAPL", Name: "Apple Inc", Exchange: "XNAS", Currency: "USD", Type: "Equity", Sector: "Technology"}})
+
+		if count, _ := repos.Symbols.Count(); count != 4 {
+			t.Errorf("Expected 4 symbols, got %d", count)
+		}
+		found, err := repos.Symbols.Find("aapl")
+		if err != nil || found.Sector != "Technology" || found.Name != "Apple Inc" {
+			t.Errorf("Expected the updated AAPL entry, got %+v (%v)", found, err)
+		}
+		if _, err := repos.Symbols.Find("APPL"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+
+		results, _ := repos.Symbols.Search("aa", 10)
+		if len(results) != 2 || results[0].Symbol != "AA" || results[1].Symbol != "AAPL" {
+			t.Errorf("Expected AA then AAPL, got %+v", results)
+		}
+		if results, _ := repos.Symbols.Search("corp", 10); len(results) != 2 || results[0].Symbol != "AA" {
+			t.Errorf("Expected the two corporations by name, got %+v", results)
+		}
+		if results, _ := repos.Symbols.Search("micro", 1); len(results) != 1 || results[0].Symbol != "MSFT" {
+			t.Errorf("Expected MSFT, got %+v", results)
+		}
+		if results, _ := repos.Symbols.Search("%", 10); len(results) != 1 || results[0].Symbol != "SPY" {
+			t.Errorf("Expected %% to match literally, got %+v", results)
+		}
+		if results, _ := repos.Symbols.Search("_", 10); len(results) != 1 {
+			t.Errorf("Expected _ to match literally, got %+v", results)
+		}
+	})
+}
+
+func TestCorporateActionSplit(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		date := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+		cutoff := time.Date(2024, 6, 10, 4, 0, 0, 0, time.UTC) // midnight in New York
+
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		direct := models.Portfolio{UserID: user.ID, Name: "Direct"}
+		ledgered := models.Portfolio{UserID: user.ID, Name: "Ledger"}
+		repos.Portfolios.Create(&direct)
+		repos.Portfolios.Create(&ledgered)
+		stock := models.Stock{PortfolioID: direct.ID, StockSymbol: "NVDA", ThresholdPrice: decimal.NewFromInt(1000)}
+		repos.Stocks.Create(&stock)
+		repos.Positions.Upsert(&models.Position{PortfolioID: direct.ID, Symbol: "NVDA", Quantity: decimal.NewFromInt(5), AvgCost: decimal.NewFromInt(800)})
+		repos.Transactions.Create(&models.Transaction{PortfolioID: ledgered.ID, Type: models.TransactionBuy, Symbol: "NVDA", Quantity: decimal.NewFromInt(10), Price: decimal.NewFromInt(400), TradeDate: date.AddDate(0, -1, 0)})
+		// A ledger entry in another symbol leaves the NVDA position entered directly
+		repos.Transactions.Create(&models.Transaction{PortfolioID: direct.ID, Type: models.TransactionDividend, Symbol: "AAPL", Amount: decimal.NewFromInt(3), TradeDate: date.AddDate(0, -1, 0)})
+		repos.PositionRules.Create(&models.PositionAlertRule{PortfolioID: direct.ID, Symbol: "NVDA", Type: models.RuleTrailingStop, Unit: models.UnitAmount, Value: decimal.NewFromInt(50), HighWater: decimal.NewFromInt(1200)})
+		repos.Prices.Create(&models.StockPriceRecord{Symbol: "NVDA", Price: decimal.NewFromInt(1200), Timestamp: cutoff.Add(-20 * time.Hour)})
+		repos.Prices.Create(&models.StockPriceRecord{Symbol: "NVDA", Price: decimal.NewFromInt(121), Timestamp: cutoff.Add(10 * time.Hour)})
+		repos.Bars.Upsert(models.Interval1d, []models.PriceBar{
+			{Symbol: "NVDA", Bucket: date.AddDate(0, 0, -1), Open: decimal.NewFromInt(1180), High: decimal.NewFromInt(1210), Low: decimal.NewFromInt(1170), Close: decimal.NewFromInt(1200), Count: 1},
+			{Symbol: "NVDA", Bucket: date, Open: decimal.NewFromInt(120), High: decimal.NewFromInt(122), Low: decimal.NewFromInt(119), Close: decimal.NewFromInt(121), Count: 1},
+		})
+		repos.Analytics.SaveDaily(&models.DailyAnalytics{Symbol: "NVDA", Date: date.AddDate(0, 0, -1), MinPrice: decimal.NewFromInt(1170), MaxPrice: decimal.NewFromInt(1210), AvgPrice: decimal.NewFromInt(1190)})
+
+		action := models.CorporateAction{Type: models.ActionSplit, Symbol: "NVDA", Ratio: decimal.NewFromInt(10), EffectiveDate: date}
+		if created, err := repos.Actions.Create(&action); !created || err != nil {
+			t.Fatalf("Expected the action to be stored, got %v (%v)", created, err)
+		}
+		if created, _ := repos.Actions.Create(&models.CorporateAction{Type: models.ActionSplit, Symbol: "NVDA", Ratio: decimal.NewFromInt(10), EffectiveDate: date}); created {
+			t.Errorf("Expected a duplicate action to be skipped")
+		}
+
+		ledgers, err := repos.Actions.ApplySplit(action, cutoff, date)
+		if err != nil {
+			t.Fatalf("ApplySplit failed: %v", err)
+		}
+		if len(ledgers) != 1 || ledgers[0] != ledgered.ID {
+			t.Errorf("Expected the ledger portfolio to need a replay, got %v", ledgers)
+		}
+		if stocks, _ := repos.Stocks.ListBySymbol("NVDA"); !stocks[0].ThresholdPrice.Equal(decimal.NewFromInt(100)) {
+			t.Errorf("Expected threshold 100, got %s", stocks[0].ThresholdPrice)
+		}
+		if positions, _ := repos.Positions.ListByPortfolio(direct.ID); !positions[0].Quantity.Equal(decimal.NewFromInt(50)) || !positions[0].AvgCost.Equal(decimal.NewFromInt(80)) {
+			t.Errorf("Expected 50 shares at 80, got %+v", positions[0])
+		}
+		if transactions, _ := repos.Transactions.ListByPortfolio(ledgered.ID); len(transactions) != 2 || transactions[1].Type != models.TransactionSplit || !transactions[1].Quantity.Equal(decimal.NewFromInt(10)) {
+			t.Errorf("Expected a SPLIT entry in the ledger, got %+v", transactions)
+		}
+		if rules, _ := repos.PositionRules.List(); !rules[0].HighWater.Equal(decimal.NewFromInt(120)) || !rules[0].Value.Equal(decimal.NewFromInt(5)) {
+			t.Errorf("Expected the rule's high water and amount divided, got %+v", rules[0])
+		}
+		prices, _ := repos.Prices.List("NVDA", date.AddDate(0, 0, -2), date.AddDate(0, 0, 2))
+		if len(prices) != 2 || !prices[0].Price.Equal(decimal.NewFromInt(120)) || !prices[1].Price.Equal(decimal.NewFromInt(121)) {
+			t.Errorf("Expected only the tick before the split adjusted, got %+v", prices)
+		}
+		bars, _ := repos.Bars.List(models.Interval1d, "NVDA", date.AddDate(0, 0, -2), date.AddDate(0, 0, 2))
+		if len(bars) != 2 || !bars[0].Close.Equal(decimal.NewFromInt(120)) || !bars[0].High.Equal(decimal.NewFromInt(121)) || !bars[1].Close.Equal(decimal.NewFromInt(121)) {
+			t.Errorf("Expected only the bar before the split adjusted, got %+v", bars)
+		}
+		if daily, _ := repos.Analytics.FindDaily("NVDA", date.AddDate(0, 0, -1)); !daily.AvgPrice.Equal(decimal.NewFromInt(119)) {
+			t.Errorf("Expected the daily average adjusted, got %+v", daily)
+		}
+		if pending, _ := repos.Actions.ListPending(); len(pending) != 0 {
+			t.Errorf("Expected no pending action, got %+v", pending)
+		}
+		if _, err := repos.Actions.ApplySplit(action, cutoff, date); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected a second application to fail with ErrNotFound, got %v", err)
+		}
+		if stocks, _ := repos.Stocks.ListBySymbol("NVDA"); !stocks[0].ThresholdPrice.Equal(decimal.NewFromInt(100)) {
+			t.Errorf("Expected the threshold divided once, got %s", stocks[0].ThresholdPrice)
+		}
+		if actions, _ := repos.Actions.List("NVDA"); len(actions) != 1 || actions[0].AppliedAt == nil {
+			t.Errorf("Expected the action marked applied, got %+v", actions)
+		}
+	})
+}
+
+func TestCorporateActionRename(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		date := time.Date(2022, 6, 9, 0, 0, 0, 0, time.UTC)
+		repos.Symbols.Upsert([]models.Symbol{{Symbol: "FB", Name: "Meta Platforms Inc.", Exchange: "XNAS", Currency: "USD"}})
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		portfolio := models.Portfolio{UserID: user.ID, Name: "Main"}
+		repos.Portfolios.Create(&portfolio)
+		repos.Stocks.Create(&models.Stock{PortfolioID: portfolio.ID, StockSymbol: "FB", ThresholdPrice: decimal.NewFromInt(200)})
+		repos.Transactions.Create(&models.Transaction{PortfolioID: portfolio.ID, Type: models.TransactionBuy, Symbol: "FB", Quantity: decimal.NewFromInt(3), Price: decimal.NewFromInt(180), TradeDate: date.AddDate(0, -2, 0)})
+		repos.Positions.Replace(portfolio.ID, []models.Position{{Symbol: "FB", Quantity: decimal.NewFromInt(3), AvgCost: decimal.NewFromInt(180)}})
+		repos.ExpressionRules.Create(&models.ExpressionRule{UserID: user.ID, Symbol: "FB", Expression: "price > 250"})
+		repos.Prices.Create(&models.StockPriceRecord{Symbol: "FB", Price: decimal.NewFromInt(190), Timestamp: date.Add(-time.Hour)})
+		repos.Bars.Upsert(models.Interval1h, []models.PriceBar{{Symbol: "FB", Bucket: date.Add(-time.Hour), Close: decimal.NewFromInt(190), Count: 1}})
+
+		action := models.CorporateAction{Type: models.ActionRename, Symbol: "FB", NewSymbol: "META", EffectiveDate: date}
+		repos.Actions.Create(&action)
+		if err := repos.Actions.ApplyRename(action, date); err != nil {
+			t.Fatalf("ApplyRename failed: %v", err)
+		}
+
+		if stocks, _ := repos.Stocks.ListBySymbol("META"); len(stocks) != 1 || !stocks[0].ThresholdPrice.Equal(decimal.NewFromInt(200)) {
+			t.Errorf("Expected the stock under META, got %+v", stocks)
+		}
+		if positions, _ := repos.Positions.ListByPortfolio(portfolio.ID); len(positions) != 1 || positions[0].Symbol != "META" {
+			t.Errorf("Expected the position under META, got %+v", positions)
+		}
+		if transactions, _ := repos.Transactions.ListByPortfolio(portfolio.ID); transactions[0].Symbol != "META" {
+			t.Errorf("Expected the ledger under META, got %+v", transactions)
+		}
+		if rules, _ := repos.ExpressionRules.List(); rules[0].Symbol != "META" {
+			t.Errorf("Expected the expression rule under META, got %+v", rules)
+		}
+		if prices, _ := repos.Prices.List("META", date.AddDate(0, 0, -1), date); len(prices) != 1 {
+			t.Errorf("Expected the price history under META, got %+v", prices)
+		}
+		if bars, _ := repos.Bars.List(models.Interval1h, "META", date.AddDate(0, 0, -1), date); len(bars) != 1 {
+			t.Errorf("Expected the bars under META, got %+v", bars)
+		}
+		if entry, err := repos.Symbols.Find("META"); err != nil || entry.Name != "Meta Platforms Inc." {
+			t.Errorf("Expected META in the catalog, got %+v (%v)", entry, err)
+		}
+		if actions, _ := repos.Actions.List("META"); len(actions) != 1 || actions[0].AppliedAt == nil {
+			t.Errorf("Expected the applied rename listed under META, got %+v", actions)
+		}
+	})
+}
+
+// Test that a rename onto a symbol that already has positions and history
+// merges the positions and keeps the new symbol's history
+func TestCorporateActionRenameOntoHeldSymbol(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, repos Repositories) {
+		date := time.Date(2022, 6, 9, 0, 0, 0, 0, time.UTC)
+		bucket := date.Add(-time.Hour)
+		user := models.User{Name: "Jane", Email: "jane@example.com"}
+		repos.Users.Create(&user)
+		portfolio := models.Portfolio{UserID: user.ID, Name: "Main"}
+		repos.Portfolios.Create(&portfolio)
+		repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "FB", Quantity: decimal.NewFromInt(3), AvgCost: decimal.NewFromInt(180)})
+		repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "META", Quantity: decimal.NewFromInt(2), AvgCost: decimal.NewFromInt(330)})
+		repos.Bars.Upsert(models.Interval1h, []models.PriceBar{
+			{Symbol: "FB", Bucket: bucket, Close: decimal.NewFromInt(190), Count: 1},
+			{Symbol: "FB", Bucket: bucket.Add(-time.Hour), Close: decimal.NewFromInt(189), Count: 1},
+			{Symbol: "META", Bucket: bucket, Close: decimal.NewFromInt(191), Count: 1},
+		})
+		repos.Analytics.SaveDaily(&models.DailyAnalytics{Symbol: "FB", Date: date.AddDate(0, 0, -1), AvgPrice: decimal.NewFromInt(190)})
+		repos.Analytics.SaveDaily(&models.DailyAnalytics{Symbol: "META", Date: date.AddDate(0, 0, -1), AvgPrice: decimal.NewFromInt(191)})
+
+		action := models.CorporateAction{Type: models.ActionRename, Symbol: "FB", NewSymbol: "META", EffectiveDate: date}
+		repos.Actions.Create(&action)
+		if err := repos.Actions.ApplyRename(action, date); err != nil {
+			t.Fatalf("ApplyRename failed: %v", err)
+		}
+
+		// 3 at 180 and 2 at 330 cost 1200 for 5 shares
+		positions, _ := repos.Positions.ListByPortfolio(portfolio.ID)
+		if len(positions) != 1 || positions[0].Symbol != "META" || !positions[0].Quantity.Equal(decimal.NewFromInt(5)) || !positions[0].AvgCost.Equal(decimal.NewFromInt(240)) {
+			t.Errorf("Expected one META position of 5 at 240, got %+v", positions)
+		}
+		bars, _ := repos.Bars.List(models.Interval1h, "META", date.AddDate(0, 0, -1), date)
+		if len(bars) != 2 || !bars[0].Close.Equal(decimal.NewFromInt(189)) || !bars[1].Close.Equal(decimal.NewFromInt(191)) {
+			t.Errorf("Expected META's own bar kept and FB's earlier one moved, got %+v", bars)
+		}
+		if daily, err := repos.Analytics.FindDaily("META", date.AddDate(0, 0, -1)); err != nil || !daily.AvgPrice.Equal(decimal.NewFromInt(191)) {
+			t.Errorf("Expected META's own daily analytics kept, got %+v (%v)", daily, err)
+		}
+		if pending, _ := repos.Actions.ListPending(); len(pending) != 0 {
+			t.Errorf("Expected the rename applied, got %+v pending", pending)
+		}
+	})
+}
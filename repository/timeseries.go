@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"stock-alerts/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ----------------- Prices -----------------
+type gormPriceRepo struct {
+	db *gorm.DB
+}
+
+// Times are stored in UTC so that SQLite, which compares them as text, orders
+// them the same way Postgres does
+
+func (r *gormPriceRepo) Create(record *models.StockPriceRecord) error {
+	record.Timestamp = record.Timestamp.UTC()
+	return r.db.Create(record).Error
+}
+
+// priceInsertBatch is the number of rows per INSERT statement; Postgres allows
+// 65535 bind parameters per statement and each row uses three
+const priceInsertBatch = 1000
+
+func (r *gormPriceRepo) CreateBatch(records []models.StockPriceRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	for i := range records {
+		records[i].Timestamp = records[i].Timestamp.UTC()
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(&records, priceInsertBatch).Error
+	})
+}
+
+func (r *gormPriceRepo) ListBetween(from, to time.Time) ([]models.StockPriceRecord, error) {
+	var records []models.StockPriceRecord
+	err := r.db.Where(`"timestamp" >= ? AND "timestamp" < ?`, from.UTC(), to.UTC()).
+		Order(`"timestamp", id`).Find(&records).Error
+	return records, err
+}
+
+func (r *gormPriceRepo) List(symbol string, from, to time.Time) ([]models.StockPriceRecord, error) {
+	var records []models.StockPriceRecord
+	err := r.db.Where(`symbol = ? AND "timestamp" >= ? AND "timestamp" < ?`, symbol, from.UTC(), to.UTC()).
+		Order(`"timestamp", id`).Find(&records).Error
+	return records, err
+}
+
+func (r *gormPriceRepo) partitioned() bool {
+	return r.db.Dialector.Name() == "postgres"
+}
+
+func (r *gormPriceRepo) EnsurePartitions(from time.Time, months int) error {
+	if !r.partitioned() {
+		return nil
+	}
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < months; i++ {
+		if err := r.db.Exec("SELECT ensure_price_partition(?)", month.AddDate(0, i, 0)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Monthly partitions are named by ensure_price_partition in migration 0003
+var pricePartitionName = regexp.MustCompile(`^stock_price_records_y(\d{4})m(\d{2})$`)
+
+func (r *gormPriceRepo) DeleteBefore(cutoff time.Time) error {
+	if !r.partitioned() {
+		return r.db.Where(`"timestamp" < ?`, cutoff.UTC()).Delete(&models.StockPriceRecord{}).Error
+	}
+
+	var partitions []string
+	err := r.db.Raw(`SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'stock_price_records'`).Scan(&partitions).Error
+	if err != nil {
+		return err
+	}
+
+	for _, name := range partitions {
+		match := pricePartitionName.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		year, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		end := time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC)
+		if !end.After(cutoff) {
+			if err := r.db.Exec(fmt.Sprintf("DROP TABLE %q", name)).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	// Stray rows outside the monthly partitions are deleted one by one
+	return r.db.Exec(`DELETE FROM stock_price_records_default WHERE "timestamp" < ?`, cutoff).Error
+}
+
+func (r *gormPriceRepo) Latest(symbols []string) (map[string]models.StockPriceRecord, error) {
+	latest := make(map[string]models.StockPriceRecord, len(symbols))
+	if len(symbols) == 0 {
+		return latest, nil
+	}
+	var records []models.StockPriceRecord
+	err := r.db.Where(`symbol IN ? AND "timestamp" = (SELECT MAX(p."timestamp") FROM stock_price_records p WHERE p.symbol = stock_price_records.symbol)`, symbols).
+		Order("id").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	// Ticks sharing the newest timestamp resolve to the last one stored
+	for _, record := range records {
+		latest[record.Symbol] = record
+	}
+	return latest, nil
+}
+
+func (r *gormPriceRepo) Oldest() (time.Time, error) {
+	var record models.StockPriceRecord
+	if err := r.db.Order(`"timestamp"`).Take(&record).Error; err != nil {
+		return time.Time{}, translate(err)
+	}
+	return record.Timestamp, nil
+}
+
+// ----------------- Bars -----------------
+type gormBarRepo struct {
+	db *gorm.DB
+}
+
+func (r *gormBarRepo) table(interval models.BarInterval) (*gorm.DB, error) {
+	if !interval.Valid() {
+		return nil, fmt.Errorf("unknown bar interval %q", interval)
+	}
+	return r.db.Table("stock_price_bars_" + string(interval)), nil
+}
+
+func (r *gormBarRepo) Upsert(interval models.BarInterval, bars []models.PriceBar) error {
+	if len(bars) == 0 {
+		return nil
+	}
+	table, err := r.table(interval)
+	if err != nil {
+		return err
+	}
+	for i := range bars {
+		bars[i].Bucket = bars[i].Bucket.UTC()
+	}
+	return table.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "symbol"}, {Name: "bucket"}},
+		DoUpdates: clause.AssignmentColumns([]string{"open", "high", "low", "close", "count"}),
+	}).Create(&bars).Error
+}
+
+func (r *gormBarRepo) List(interval models.BarInterval, symbol string, from, to time.Time) ([]models.PriceBar, error) {
+	table, err := r.table(interval)
+	if err != nil {
+		return nil, err
+	}
+	var bars []models.PriceBar
+	err = table.Where("symbol = ? AND bucket >= ? AND bucket < ?", symbol, from.UTC(), to.UTC()).
+		Order("bucket").Find(&bars).Error
+	return bars, err
+}
+
+func (r *gormBarRepo) ListBetween(interval models.BarInterval, from, to time.Time) ([]models.PriceBar, error) {
+	table, err := r.table(interval)
+	if err != nil {
+		return nil, err
+	}
+	var bars []models.PriceBar
+	err = table.Where("bucket >= ? AND bucket < ?", from.UTC(), to.UTC()).
+		Order("bucket, symbol").Find(&bars).Error
+	return bars, err
+}
+
+func (r *gormBarRepo) LatestBucket(interval models.BarInterval) (time.Time, error) {
+	table, err := r.table(interval)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var bar models.PriceBar
+	if err := table.Order("bucket DESC").First(&bar).Error; err != nil {
+		return time.Time{}, translate(err)
+	}
+	return bar.Bucket, nil
+}
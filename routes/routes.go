@@ -1,100 +1,1749 @@
 package routes
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"stock-alerts/db"
+	"stock-alerts/alerting"
+	"stock-alerts/calendar"
+	"stock-alerts/corporate"
+	"stock-alerts/events"
+	"stock-alerts/expr"
+	"stock-alerts/fx"
+	"stock-alerts/ledger"
 	"stock-alerts/models"
+	"stock-alerts/notify"
+	"stock-alerts/repository"
+	"stock-alerts/symbols"
+	"stock-alerts/valuation"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 )
 
+// RulePublisher announces alert rule changes to the consumers
+type RulePublisher interface {
+	PublishRuleChange(change events.RuleChange)
+}
+
+// Handler serves the HTTP API on top of the repositories
+type Handler struct {
+	users          repository.UserRepo
+	portfolios     repository.PortfolioRepo
+	stocks         repository.StockRepo
+	positions      repository.PositionRepo
+	ledger         repository.TransactionRepo
+	portfolioRules repository.PortfolioRuleRepo
+	positionRules  repository.PositionRuleRepo
+	signalRules    repository.SignalRuleRepo
+	expressions    repository.ExpressionRuleRepo
+	alerts         repository.AlertRepo
+	notifications  repository.NotificationRepo
+	prices         repository.PriceRepo
+	bars           repository.BarRepo
+	symbols        *symbols.Catalog
+	actions        repository.CorporateActionRepo
+	applier        *corporate.Applier
+	rules          RulePublisher
+}
+
+// NewHandler wires the handlers to their repositories, the symbol catalog and
+// the publisher of rule changes
+func NewHandler(repos repository.Repositories, rules RulePublisher, catalog *symbols.Catalog) *Handler {
+	return &Handler{
+		users:          repos.Users,
+		portfolios:     repos.Portfolios,
+		stocks:         repos.Stocks,
+		positions:      repos.Positions,
+		ledger:         repos.Transactions,
+		portfolioRules: repos.PortfolioRules,
+		positionRules:  repos.PositionRules,
+		signalRules:    repos.SignalRules,
+		expressions:    repos.ExpressionRules,
+		alerts:         repos.Alerts,
+		notifications:  repos.Notifications,
+		prices:         repos.Prices,
+		bars:           repos.Bars,
+		symbols:        catalog,
+		actions:        repos.Actions,
+		applier:        corporate.NewApplier(repos, rules),
+		rules:          rules,
+	}
+}
+
 // RegisterRoutes adds endpoints
-func RegisterRoutes(r *gin.Engine) {
+func RegisterRoutes(r *gin.Engine, h *Handler) {
 	// User routes
-	r.POST("/users", createUser)
-	r.GET("/users", listUsers)
+	r.POST("/users", h.createUser)
+	r.GET("/users", h.listUsers)
+	r.PUT("/users/:id/base-currency", h.setBaseCurrency)
 
-	// Portfolio routes
-	r.POST("/users/:id/portfolio", createPortfolio)
-	r.GET("/users/:id/portfolio", getPortfolio)
+	// Portfolio routes; the singular routes act on the user's first portfolio
+	r.POST("/users/:id/portfolio", h.createPortfolio)
+	r.GET("/users/:id/portfolio", h.getPortfolio)
+	r.GET("/users/:id/portfolio/valuation", h.getValuation)
+	r.POST("/users/:id/portfolios", h.createPortfolio)
+	r.GET("/users/:id/portfolios", h.listPortfolios)
+	r.GET("/portfolio/:id/valuation", h.getPortfolioValuation)
+	r.PUT("/portfolio/:id/cost-method", h.setCostMethod)
 
 	// Stock routes
-	r.POST("/portfolio/:id/stocks", addStock)
-	r.GET("/portfolio/:id/stocks", listStocks)
+	r.POST("/portfolio/:id/stocks", h.addStock)
+	r.GET("/portfolio/:id/stocks", h.listStocks)
+	r.POST("/portfolio/:id/stocks/:symbol/move", h.moveSymbol)
+
+	// Position routes
+	r.PUT("/portfolio/:id/positions", h.upsertPosition)
+	r.GET("/portfolio/:id/positions", h.listPositions)
+	r.DELETE("/portfolio/:id/positions/:symbol", h.deletePosition)
+
+	// Transaction ledger
+	r.POST("/portfolio/:id/transactions", h.addTransaction)
+	r.GET("/portfolio/:id/transactions", h.listTransactions)
+	r.DELETE("/portfolio/:id/transactions/:txid", h.deleteTransaction)
+	r.GET("/portfolio/:id/realized-gains", h.getRealizedGains)
+
+	// Portfolio alert rules
+	r.POST("/portfolio/:id/alert-rules", h.addPortfolioRule)
+	r.GET("/portfolio/:id/alert-rules", h.listPortfolioRules)
+	r.DELETE("/portfolio/:id/alert-rules/:ruleid", h.deletePortfolioRule)
+
+	// Stop-loss, take-profit and trailing-stop rules on positions
+	r.POST("/portfolio/:id/positions/:symbol/stops", h.addStop)
+	r.GET("/portfolio/:id/stops", h.listStops)
+	r.DELETE("/portfolio/:id/stops/:stopid", h.deleteStop)
+
+	// Subscriptions to analytics signals
+	r.POST("/users/:id/signal-rules", h.addSignalRule)
+	r.GET("/users/:id/signal-rules", h.listSignalRules)
+	r.DELETE("/users/:id/signal-rules/:ruleid", h.deleteSignalRule)
+
+	// Custom conditions in the expression language
+	r.POST("/users/:id/expression-rules", h.addExpressionRule)
+	r.GET("/users/:id/expression-rules", h.listExpressionRules)
+	r.DELETE("/users/:id/expression-rules/:ruleid", h.deleteExpressionRule)
+
+	// Replays a rule over the price history without raising alerts
+	r.POST("/rules/backtest", h.backtestRule)
+
+	// Alerts and their lifecycle
+	r.GET("/users/:id/alerts", h.getAlerts)
+	r.GET("/users/:id/alerts/counts", h.countAlerts)
+	r.PUT("/users/:id/alerts/:alertid", h.updateAlert)
+	r.POST("/users/:id/alerts/transition", h.transitionAlerts)
+
+	// Notification preferences and per-rule channels
+	r.GET("/users/:id/preferences", h.getPreferences)
+	r.PUT("/users/:id/preferences", h.savePreferences)
+	r.PUT("/users/:id/rule-channels", h.saveRuleChannels)
+	r.GET("/users/:id/rule-channels", h.listRuleChannels)
+	r.DELETE("/users/:id/rule-channels/:channelid", h.deleteRuleChannels)
 
-	// Alerts
-	r.GET("/users/:id/alerts", getAlerts)
+	// Price history
+	r.GET("/stocks/:symbol/history", h.getHistory)
+
+	// Exchange trading calendars
+	r.GET("/markets/:exchange/calendar", h.getMarketCalendar)
+
+	// Symbol catalog
+	r.GET("/symbols/search", h.searchSymbols)
+	r.GET("/symbols/:symbol", h.getSymbol)
+
+	// Corporate actions
+	r.POST("/corporate-actions", h.addCorporateAction)
+	r.POST("/corporate-actions/import", h.importCorporateActions)
+	r.GET("/corporate-actions", h.listCorporateActions)
+	r.DELETE("/corporate-actions/:actionid", h.deleteCorporateAction)
 }
 
 // ----------------- User Handlers -----------------
-func createUser(c *gin.Context) {
+func (h *Handler) createUser(c *gin.Context) {
 	var user models.User
 	if err := c.ShouldBindJSON(&user); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	db.DB.Create(&user)
+	if user.BaseCurrency == "" {
+		user.BaseCurrency = models.DefaultCurrency
+	}
+	if !validBaseCurrency(user.BaseCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "base currency must be a three letter ISO code such as USD"})
+		return
+	}
+	if err := h.users.Create(&user); err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// setBaseCurrency changes the currency a user's valuations and portfolio
+// alerts are computed in. Body: {"BaseCurrency": "EUR"}
+func (h *Handler) setBaseCurrency(c *gin.Context) {
+	var body struct{ BaseCurrency string }
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validBaseCurrency(body.BaseCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "base currency must be a three letter ISO code such as USD"})
+		return
+	}
+	userID := parseID(c.Param("id"))
+	err := h.users.SetBaseCurrency(userID, body.BaseCurrency)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	user, err := h.users.FindByID(userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, user)
 }
 
-func listUsers(c *gin.Context) {
-	var users []models.User
-	db.DB.Find(&users)
+// validBaseCurrency accepts ISO codes but not minor units such as GBX
+func validBaseCurrency(currency string) bool {
+	major, _ := fx.Major(currency)
+	return fx.Valid(currency) && major == currency
+}
+
+func (h *Handler) listUsers(c *gin.Context) {
+	users, err := h.users.List()
+	if err != nil {
+		serverError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, users)
 }
 
+// ----------------- Notification Handlers -----------------
+
+// getPreferences returns a user's notification preferences, or the defaults
+// (no channels, UTC, no digest) if none were saved
+func (h *Handler) getPreferences(c *gin.Context) {
+	userID := parseID(c.Param("id"))
+	prefs, err := h.notifications.FindPreferences(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusOK, models.NotificationPreferences{UserID: userID, Channels: models.Channels{}, Timezone: "UTC", Digest: models.DigestNone})
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// savePreferences replaces a user's notification preferences.
+// Body: {"Channels": ["EMAIL", "WEBHOOK"], "WebhookURL": "https://...", "Timezone": "Europe/Paris",
+// "QuietStart": "22:00", "QuietEnd": "07:00", "Digest": "NONE|DAILY|WEEKLY", "DigestHour": 8, "DigestWeekday": 1}
+func (h *Handler) savePreferences(c *gin.Context) {
+	var prefs models.NotificationPreferences
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := notify.Validate(prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := parseID(c.Param("id"))
+	if _, err := h.users.FindByID(userID); errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	} else if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	prefs.ID, prefs.UserID, prefs.LastDigestAt = 0, userID, nil
+	if prefs.Channels == nil {
+		prefs.Channels = models.Channels{}
+	}
+	prefs.UpdatedAt = time.Now()
+	if err := h.notifications.SavePreferences(&prefs); err != nil {
+		serverError(c, err)
+		return
+	}
+	saved, err := h.notifications.FindPreferences(userID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, saved)
+}
+
+// saveRuleChannels sets the channels of one rule, overriding the user's
+// defaults; an empty list keeps the rule's alerts in the app only.
+// Body: {"Kind": "THRESHOLD", "RuleID": 4, "Channels": ["WEBHOOK"]}, where
+// Kind and RuleID are those of the rule's alerts.
+func (h *Handler) saveRuleChannels(c *gin.Context) {
+	var override models.RuleChannels
+	if err := c.ShouldBindJSON(&override); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := parseID(c.Param("id"))
+	for _, channel := range override.Channels {
+		if !channel.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "channels must be EMAIL or WEBHOOK"})
+			return
+		}
+		if channel == models.ChannelWebhook {
+			prefs, err := h.notifications.FindPreferences(userID)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				serverError(c, err)
+				return
+			}
+			if prefs == nil || prefs.WebhookURL == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "set a webhook URL in the preferences first"})
+				return
+			}
+		}
+	}
+
+	owned, err := h.ownsRule(userID, override.Kind, override.RuleID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if !owned {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+
+	override.ID, override.UserID = 0, userID
+	if override.Channels == nil {
+		override.Channels = models.Channels{}
+	}
+	if err := h.notifications.SaveRuleChannels(&override); err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, override)
+}
+
+// ownsRule reports whether the rule raising alerts of the given kind and
+// rule ID belongs to the user
+func (h *Handler) ownsRule(userID uint, kind models.AlertKind, ruleID uint) (bool, error) {
+	switch {
+	case kind == models.AlertExpression:
+		rules, err := h.expressions.ListByUser(userID)
+		for _, rule := range rules {
+			if rule.ID == ruleID {
+				return true, nil
+			}
+		}
+		return false, err
+	case models.SignalType(kind).Valid():
+		rules, err := h.signalRules.ListByUser(userID)
+		for _, rule := range rules {
+			if rule.ID == ruleID && rule.Type == models.SignalType(kind) {
+				return true, nil
+			}
+		}
+		return false, err
+	}
+
+	portfolios, err := h.portfolios.ListByUser(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, portfolio := range portfolios {
+		switch {
+		case kind == models.AlertThreshold:
+			for _, stock := range portfolio.Stocks {
+				if stock.ID == ruleID {
+					return true, nil
+				}
+			}
+		case models.PortfolioRuleType(kind).Valid():
+			rules, err := h.portfolioRules.ListByPortfolio(portfolio.ID)
+			if err != nil {
+				return false, err
+			}
+			for _, rule := range rules {
+				if rule.ID == ruleID && rule.Type == models.PortfolioRuleType(kind) {
+					return true, nil
+				}
+			}
+		case models.PositionRuleType(kind).Valid():
+			rules, err := h.positionRules.ListByPortfolio(portfolio.ID)
+			if err != nil {
+				return false, err
+			}
+			for _, rule := range rules {
+				if rule.ID == ruleID && rule.Type == models.PositionRuleType(kind) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+func (h *Handler) listRuleChannels(c *gin.Context) {
+	overrides, err := h.notifications.ListRuleChannels(parseID(c.Param("id")))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, overrides)
+}
+
+func (h *Handler) deleteRuleChannels(c *gin.Context) {
+	err := h.notifications.DeleteRuleChannels(parseID(c.Param("id")), parseID(c.Param("channelid")))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule channels not found"})
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
 // ----------------- Portfolio Handlers -----------------
-func createPortfolio(c *gin.Context) {
+
+// createPortfolio creates a portfolio or watchlist. The body is optional:
+// {"Name": "Retirement", "Kind": "portfolio|watchlist", "CostMethod": "fifo|lifo|specific"}.
+func (h *Handler) createPortfolio(c *gin.Context) {
 	userID := c.Param("id")
 	var portfolio models.Portfolio
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&portfolio); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	portfolio.ID = 0
+	portfolio.Stocks = nil
 	portfolio.UserID = uint(parseID(userID))
-	db.DB.Create(&portfolio)
+	if portfolio.Kind == "" {
+		portfolio.Kind = models.KindPortfolio
+	}
+	if !portfolio.Kind.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be portfolio or watchlist"})
+		return
+	}
+	if portfolio.CostMethod == "" {
+		portfolio.CostMethod = string(ledger.FIFO)
+	}
+	if !ledger.Method(portfolio.CostMethod).Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cost method must be one of fifo, lifo, specific"})
+		return
+	}
+	if portfolio.Name == "" {
+		portfolio.Name = "Default"
+	}
+
+	existing, err := h.portfolios.ListByUser(portfolio.UserID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	for _, p := range existing {
+		if p.Name == portfolio.Name {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("a portfolio named %q already exists", portfolio.Name)})
+			return
+		}
+	}
+	if err := h.portfolios.Create(&portfolio); err != nil {
+		serverError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, portfolio)
 }
 
-func getPortfolio(c *gin.Context) {
+func (h *Handler) getPortfolio(c *gin.Context) {
 	userID := c.Param("id")
-	var portfolio models.Portfolio
-	err := db.DB.Preload("Stocks").Where("user_id = ?", userID).First(&portfolio).Error
-	if err != nil {
+	portfolio, err := h.portfolios.FindByUserID(parseID(userID))
+	if errors.Is(err, repository.ErrNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "portfolio not found"})
 		return
 	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, portfolio)
 }
 
-// ----------------- Stock Handlers -----------------
-func addStock(c *gin.Context) {
+func (h *Handler) listPortfolios(c *gin.Context) {
+	userID := c.Param("id")
+	portfolios, err := h.portfolios.ListByUser(parseID(userID))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, portfolios)
+}
+
+func (h *Handler) getValuation(c *gin.Context) {
+	userID := c.Param("id")
+	portfolio, err := h.portfolios.FindByUserID(parseID(userID))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "portfolio not found"})
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	h.writeValuation(c, portfolio)
+}
+
+func (h *Handler) getPortfolioValuation(c *gin.Context) {
+	portfolio, ok := h.findPortfolio(c, parseID(c.Param("id")))
+	if !ok {
+		return
+	}
+	h.writeValuation(c, portfolio)
+}
+
+// writeValuation values a portfolio per currency and in its owner's base
+// currency at the latest prices and FX rates
+func (h *Handler) writeValuation(c *gin.Context, portfolio *models.Portfolio) {
+	base := models.DefaultCurrency
+	owner, err := h.users.FindByID(portfolio.UserID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		serverError(c, err)
+		return
+	}
+	if err == nil {
+		base = owner.Base()
+	}
+	positions, err := h.positions.ListByPortfolio(portfolio.ID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	symbols := make([]string, 0, len(positions))
+	currencies := make([]string, 0, len(positions))
+	for _, position := range positions {
+		symbols = append(symbols, position.Symbol)
+		currencies = append(currencies, position.Currency)
+	}
+	prices, err := h.prices.Latest(append(symbols, fx.Pairs(currencies, base)...))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	v := valuation.Value(portfolio.ID, positions, prices)
+	v.Convert(base, fx.FromPrices(prices))
+	c.JSON(http.StatusOK, v)
+}
+
+// symbolCurrency is the currency the symbol is quoted in according to the
+// catalog, empty when unknown
+func (h *Handler) symbolCurrency(symbol string) string {
+	if h.symbols == nil {
+		return ""
+	}
+	entry, err := h.symbols.Lookup(symbol)
+	if err != nil {
+		return ""
+	}
+	return entry.Currency
+}
+
+// ----------------- Position Handlers -----------------
+func (h *Handler) upsertPosition(c *gin.Context) {
 	portfolioID := c.Param("id")
-	var stock models.Stock
-	if err := c.ShouldBindJSON(&stock); err != nil {
+	var position models.Position
+	if err := c.ShouldBindJSON(&position); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	stock.PortfolioID = uint(parseID(portfolioID))
-	db.DB.Create(&stock)
-	c.JSON(http.StatusOK, stock)
+	if position.Symbol == "" || position.Quantity.IsNegative() || position.AvgCost.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is required and quantity and avg cost cannot be negative"})
+		return
+	}
+	if position.Currency == "" {
+		position.Currency = h.symbolCurrency(position.Symbol)
+	}
+	position.ID = 0
+	position.PortfolioID = uint(parseID(portfolioID))
+	if _, ok := h.findHoldingsPortfolio(c, position.PortfolioID); !ok {
+		return
+	}
+	transactions, err := h.ledger.ListByPortfolio(position.PortfolioID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if len(transactions) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "positions of a portfolio with transactions are derived from its ledger"})
+		return
+	}
+	if err := h.positions.Upsert(&position); err != nil {
+		serverError(c, err)
+		return
+	}
+	h.publishReload()
+	c.JSON(http.StatusOK, position)
 }
 
-func listStocks(c *gin.Context) {
+func (h *Handler) listPositions(c *gin.Context) {
 	portfolioID := c.Param("id")
-	var stocks []models.Stock
-	db.DB.Where("portfolio_id = ?", portfolioID).Find(&stocks)
-	c.JSON(http.StatusOK, stocks)
+	positions, err := h.positions.ListByPortfolio(parseID(portfolioID))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, positions)
 }
 
-// ----------------- Alerts Handler -----------------
-func getAlerts(c *gin.Context) {
-	userID := c.Param("id")
-	var alerts []models.Alert
-	db.DB.Where("user_id = ?", userID).Find(&alerts)
-	c.JSON(http.StatusOK, alerts)
+func (h *Handler) deletePosition(c *gin.Context) {
+	portfolioID := c.Param("id")
+	err := h.positions.Delete(parseID(portfolioID), c.Param("symbol"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "position not found"})
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	h.publishReload()
+	c.Status(http.StatusNoContent)
 }
 
-// ----------------- Helper -----------------
-func parseID(id string) uint {
-	var val uint
-	fmt.Sscanf(id, "%d", &val)
-	return val
+// ----------------- Transaction Handlers -----------------
+func (h *Handler) addTransaction(c *gin.Context) {
+	portfolioID := c.Param("id")
+	var tx models.Transaction
+	if err := c.ShouldBindJSON(&tx); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch tx.Type {
+	case models.TransactionBuy, models.TransactionSell, models.TransactionSplit, models.TransactionDividend:
+		if tx.Symbol == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is required"})
+			return
+		}
+	case models.TransactionFee:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of BUY, SELL, DIVIDEND, SPLIT, FEE"})
+		return
+	}
+	if tx.Price.IsNegative() || tx.Fee.IsNegative() || tx.Amount.IsNegative() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price, fee and amount must not be negative"})
+		return
+	}
+	if tx.TradeDate.IsZero() {
+		tx.TradeDate = time.Now()
+	}
+	if tx.Currency == "" && tx.Symbol != "" {
+		tx.Currency = h.symbolCurrency(tx.Symbol)
+	}
+	tx.PortfolioID = uint(parseID(portfolioID))
+	portfolio, ok := h.findHoldingsPortfolio(c, tx.PortfolioID)
+	if !ok {
+		return
+	}
+
+	transactions, err := h.ledger.ListByPortfolio(tx.PortfolioID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	// Check the ledger still replays with the new entry before storing it; the
+	// entry has no ID yet, so it sorts last among those of the same trade date
+	tx.ID = ^uint(0)
+	if _, err := ledger.Replay(append(transactions, tx), ledger.MethodOf(*portfolio)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tx.ID = 0
+
+	if err := h.ledger.Create(&tx); err != nil {
+		serverError(c, err)
+		return
+	}
+	if err := h.rebuildPositions(*portfolio); err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tx)
+}
+
+func (h *Handler) listTransactions(c *gin.Context) {
+	portfolioID := c.Param("id")
+	transactions, err := h.ledger.ListByPortfolio(parseID(portfolioID))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, transactions)
+}
+
+func (h *Handler) deleteTransaction(c *gin.Context) {
+	portfolioID := parseID(c.Param("id"))
+	txID := parseID(c.Param("txid"))
+	portfolio, ok := h.findPortfolio(c, portfolioID)
+	if !ok {
+		return
+	}
+	transactions, err := h.ledger.ListByPortfolio(portfolioID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+
+	remaining := make([]models.Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		if tx.ID != txID {
+			remaining = append(remaining, tx)
+		}
+	}
+	if len(remaining) == len(transactions) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "transaction not found"})
+		return
+	}
+	if _, err := ledger.Replay(remaining, ledger.MethodOf(*portfolio)); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.ledger.Delete(portfolioID, txID); err != nil {
+		serverError(c, err)
+		return
+	}
+	if err := h.rebuildPositions(*portfolio); err != nil {
+		serverError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// getRealizedGains reports the realized gains, dividends and fees of a year.
+// Query: year (default the current year), method=fifo|lifo|specific (default
+// the portfolio's cost method, which its positions follow too).
+func (h *Handler) getRealizedGains(c *gin.Context) {
+	portfolio, ok := h.findPortfolio(c, parseID(c.Param("id")))
+	if !ok {
+		return
+	}
+	method := ledger.Method(c.DefaultQuery("method", string(ledger.MethodOf(*portfolio))))
+	if !method.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "method must be one of fifo, lifo, specific"})
+		return
+	}
+	year := time.Now().Year()
+	if v := c.Query("year"); v != "" {
+		if _, err := fmt.Sscanf(v, "%d", &year); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "year must be a number"})
+			return
+		}
+	}
+
+	transactions, err := h.ledger.ListByPortfolio(portfolio.ID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	book, err := ledger.Replay(transactions, method)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, book.Report(year, method))
+}
+
+// setCostMethod changes the lots a portfolio's sales close and rebuilds its
+// positions. Body: {"Method": "fifo|lifo|specific"}.
+func (h *Handler) setCostMethod(c *gin.Context) {
+	var body struct {
+		Method ledger.Method
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !body.Method.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "method must be one of fifo, lifo, specific"})
+		return
+	}
+	portfolio, ok := h.findHoldingsPortfolio(c, parseID(c.Param("id")))
+	if !ok {
+		return
+	}
+	transactions, err := h.ledger.ListByPortfolio(portfolio.ID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if _, err := ledger.Replay(transactions, body.Method); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.portfolios.SetCostMethod(portfolio.ID, string(body.Method)); err != nil {
+		serverError(c, err)
+		return
+	}
+	portfolio.CostMethod = string(body.Method)
+	if len(transactions) > 0 {
+		if err := h.rebuildPositions(*portfolio); err != nil {
+			serverError(c, err)
+			return
+		}
+	}
+	portfolio.Stocks = nil
+	c.JSON(http.StatusOK, portfolio)
+}
+
+// rebuildPositions derives a portfolio's positions from its ledger and has
+// the consumers reload them, as stops and portfolio rules use the quantities
+// and average costs
+func (h *Handler) rebuildPositions(portfolio models.Portfolio) error {
+	transactions, err := h.ledger.ListByPortfolio(portfolio.ID)
+	if err != nil {
+		return err
+	}
+	book, err := ledger.Replay(transactions, ledger.MethodOf(portfolio))
+	if err != nil {
+		return err
+	}
+	if err := h.positions.Replace(portfolio.ID, book.Positions(portfolio.ID)); err != nil {
+		return err
+	}
+	h.publishReload()
+	return nil
+}
+
+// ----------------- Stock Handlers -----------------
+func (h *Handler) addStock(c *gin.Context) {
+	portfolioID := c.Param("id")
+	var stock models.Stock
+	if err := c.ShouldBindJSON(&stock); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	stock.PortfolioID = uint(parseID(portfolioID))
+	portfolio, ok := h.findPortfolio(c, stock.PortfolioID)
+	if !ok {
+		return
+	}
+	stock.StockSymbol = strings.ToUpper(strings.TrimSpace(stock.StockSymbol))
+	if stock.StockSymbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is required"})
+		return
+	}
+	// Without a catalog the symbol is taken as given
+	if h.symbols != nil {
+		entry, err := h.symbols.Lookup(stock.StockSymbol)
+		if errors.Is(err, symbols.ErrUnknownSymbol) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown symbol %q", stock.StockSymbol)})
+			return
+		}
+		if errors.Is(err, symbols.ErrEmptyCatalog) {
+			emptyCatalog(c)
+			return
+		}
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		stock.StockSymbol = entry.Symbol
+	}
+	if err := h.stocks.Create(&stock); err != nil {
+		serverError(c, err)
+		return
+	}
+	h.publishRule(stock, portfolio.UserID)
+	c.JSON(http.StatusOK, stock)
+}
+
+// moveSymbol moves the alert rules on a symbol to another portfolio or
+// watchlist of the same user. Body: {"PortfolioID": <target>}.
+func (h *Handler) moveSymbol(c *gin.Context) {
+	var body struct {
+		PortfolioID uint
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, ok := h.findPortfolio(c, parseID(c.Param("id")))
+	if !ok {
+		return
+	}
+	to, ok := h.findPortfolio(c, body.PortfolioID)
+	if !ok {
+		return
+	}
+	if from.UserID != to.UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "portfolios belong to different users"})
+		return
+	}
+
+	moved, err := h.stocks.MoveSymbol(from.ID, to.ID, strings.ToUpper(strings.TrimSpace(c.Param("symbol"))))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "symbol not in portfolio"})
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	for _, stock := range moved {
+		h.publishRule(stock, to.UserID)
+	}
+	c.JSON(http.StatusOK, moved)
+}
+
+// publishRule announces the current state of a stock's alert rule
+func (h *Handler) publishRule(stock models.Stock, userID uint) {
+	h.rules.PublishRuleChange(events.RuleChange{
+		Op:          events.OpUpsert,
+		StockID:     stock.ID,
+		PortfolioID: stock.PortfolioID,
+		UserID:      userID,
+		Symbol:      stock.StockSymbol,
+		Threshold:   stock.ThresholdPrice,
+		Time:        time.Now(),
+	})
+}
+
+func (h *Handler) listStocks(c *gin.Context) {
+	portfolioID := c.Param("id")
+	stocks, err := h.stocks.ListByPortfolio(parseID(portfolioID))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stocks)
+}
+
+// ----------------- Portfolio Rule Handlers -----------------
+
+// addPortfolioRule adds an alert on the whole portfolio.
+// Body: {"Type": "VALUE_ABOVE|VALUE_BELOW|DAILY_CHANGE|DRAWDOWN|POSITION_WEIGHT", "Threshold": 10}
+// where Threshold is a value for the VALUE rules and a percentage otherwise.
+func (h *Handler) addPortfolioRule(c *gin.Context) {
+	var rule models.PortfolioAlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !rule.Type.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of VALUE_ABOVE, VALUE_BELOW, DAILY_CHANGE, DRAWDOWN, POSITION_WEIGHT"})
+		return
+	}
+	if !rule.Threshold.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be positive"})
+		return
+	}
+	rule.ID = 0
+	rule.Peak = decimal.Zero
+	rule.PortfolioID = parseID(c.Param("id"))
+	if _, ok := h.findHoldingsPortfolio(c, rule.PortfolioID); !ok {
+		return
+	}
+	if err := h.portfolioRules.Create(&rule); err != nil {
+		serverError(c, err)
+		return
+	}
+	h.publishReload()
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) listPortfolioRules(c *gin.Context) {
+	rules, err := h.portfolioRules.ListByPortfolio(parseID(c.Param("id")))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *Handler) deletePortfolioRule(c *gin.Context) {
+	err := h.portfolioRules.Delete(parseID(c.Param("id")), parseID(c.Param("ruleid")))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	h.publishReload()
+	c.Status(http.StatusNoContent)
+}
+
+// ----------------- Position Rule Handlers -----------------
+
+// addStop adds a stop-loss, take-profit or trailing stop to an open position.
+// Body: {"Type": "TRAILING_STOP|STOP_LOSS|TAKE_PROFIT", "Unit": "PERCENT|AMOUNT", "Value": 10}
+// where Value is the distance from the average cost, or from the highest
+// price since the rule was added for trailing stops.
+func (h *Handler) addStop(c *gin.Context) {
+	var rule models.PositionAlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !rule.Type.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of TRAILING_STOP, STOP_LOSS, TAKE_PROFIT"})
+		return
+	}
+	if rule.Unit == "" {
+		rule.Unit = models.UnitPercent
+	}
+	if rule.Unit != models.UnitPercent && rule.Unit != models.UnitAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unit must be PERCENT or AMOUNT"})
+		return
+	}
+	if !rule.Value.IsPositive() || (rule.Unit == models.UnitPercent && rule.Type != models.RuleTakeProfit && rule.Value.GreaterThanOrEqual(decimal.NewFromInt(100))) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "value must be positive, and below 100 for a percentage under the price"})
+		return
+	}
+
+	rule.ID = 0
+	rule.Triggered = false
+	rule.PortfolioID = parseID(c.Param("id"))
+	rule.Symbol = strings.ToUpper(strings.TrimSpace(c.Param("symbol")))
+	if _, ok := h.findHoldingsPortfolio(c, rule.PortfolioID); !ok {
+		return
+	}
+	positions, err := h.positions.ListByPortfolio(rule.PortfolioID)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	var position *models.Position
+	for i := range positions {
+		if positions[i].Symbol == rule.Symbol {
+			position = &positions[i]
+		}
+	}
+	if position == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "position not found"})
+		return
+	}
+
+	// A trailing stop follows the price up from the better of cost and the latest price
+	latest, err := h.prices.Latest([]string{rule.Symbol})
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	rule.HighWater = decimal.Max(position.AvgCost, latest[rule.Symbol].Price)
+
+	if err := h.positionRules.Create(&rule); err != nil {
+		serverError(c, err)
+		return
+	}
+	h.publishReload()
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) listStops(c *gin.Context) {
+	rules, err := h.positionRules.ListByPortfolio(parseID(c.Param("id")))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *Handler) deleteStop(c *gin.Context) {
+	err := h.positionRules.Delete(parseID(c.Param("id")), parseID(c.Param("stopid")))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	h.publishReload()
+	c.Status(http.StatusNoContent)
+}
+
+// publishReload asks the alert and portfolio consumers to reload their rules
+func (h *Handler) publishReload() {
+	h.rules.PublishRuleChange(events.RuleChange{Op: events.OpReload, Time: time.Now()})
+}
+
+// ----------------- Signal Rule Handlers -----------------
+
+// addSignalRule subscribes a user to an indicator event on a symbol.
+// Body: {"Symbol": "AAPL", "Type": "SIGNAL_CHANGE|GOLDEN_CROSS|DEATH_CROSS|RSI_OVERBOUGHT|RSI_OVERSOLD|BOLLINGER_UPPER|BOLLINGER_LOWER"}
+// plus optional "From" and "To" signals (BULLISH, BEARISH, NEUTRAL) for SIGNAL_CHANGE.
+func (h *Handler) addSignalRule(c *gin.Context) {
+	var rule models.SignalRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rule.Symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is required"})
+		return
+	}
+	if !rule.Type.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of SIGNAL_CHANGE, GOLDEN_CROSS, DEATH_CROSS, RSI_OVERBOUGHT, RSI_OVERSOLD, BOLLINGER_UPPER, BOLLINGER_LOWER"})
+		return
+	}
+	if rule.Type != models.SignalChange && (rule.From != "" || rule.To != "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to only apply to SIGNAL_CHANGE"})
+		return
+	}
+	for _, signal := range []string{rule.From, rule.To} {
+		if signal != "" && signal != models.SignalBullish && signal != models.SignalBearish && signal != models.SignalNeutral {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be BULLISH, BEARISH or NEUTRAL"})
+			return
+		}
+	}
+	if rule.From != "" && rule.From == rule.To {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must differ"})
+		return
+	}
+
+	rule.ID = 0
+	rule.UserID = parseID(c.Param("id"))
+	if err := h.signalRules.Create(&rule); err != nil {
+		serverError(c, err)
+		return
+	}
+	h.publishReload()
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) listSignalRules(c *gin.Context) {
+	rules, err := h.signalRules.ListByUser(parseID(c.Param("id")))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *Handler) deleteSignalRule(c *gin.Context) {
+	err := h.signalRules.Delete(parseID(c.Param("id")), parseID(c.Param("ruleid")))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	h.publishReload()
+	c.Status(http.StatusNoContent)
+}
+
+// ----------------- Expression Rule Handlers -----------------
+
+// addExpressionRule adds a custom condition on a symbol.
+// Body: {"Symbol": "AAPL", "Expression": "price > sma(20) * 1.05 && rsi(14) < 70"}.
+// A condition that does not compile is answered with its error and the
+// column it points at.
+func (h *Handler) addExpressionRule(c *gin.Context) {
+	var rule models.ExpressionRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rule.Symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is required"})
+		return
+	}
+	if _, err := expr.Compile(rule.Expression); err != nil {
+		var exprErr *expr.Error
+		if errors.As(err, &exprErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "position": exprErr.Pos})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule.ID = 0
+	rule.Triggered = false
+	rule.UserID = parseID(c.Param("id"))
+	if err := h.expressions.Create(&rule); err != nil {
+		serverError(c, err)
+		return
+	}
+	h.publishReload()
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) listExpressionRules(c *gin.Context) {
+	rules, err := h.expressions.ListByUser(parseID(c.Param("id")))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *Handler) deleteExpressionRule(c *gin.Context) {
+	err := h.expressions.Delete(parseID(c.Param("id")), parseID(c.Param("ruleid")))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	h.publishReload()
+	c.Status(http.StatusNoContent)
+}
+
+// ----------------- Backtest Handler -----------------
+
+// Longest ranges a backtest may replay
+const (
+	maxTickBacktest = 31 * 24 * time.Hour
+	maxBarBacktest  = 5 * 366 * 24 * time.Hour
+)
+
+// backtestRequest is the body of POST /rules/backtest. Interval picks the
+// closes of a rollup; without it the raw ticks are replayed.
+type backtestRequest struct {
+	Symbol   string
+	From     time.Time
+	To       time.Time
+	Interval models.BarInterval
+	Rule     alerting.BacktestRule
+}
+
+type backtestResponse struct {
+	Symbol   string
+	From     time.Time
+	To       time.Time
+	Interval models.BarInterval
+	*alerting.BacktestResult
+}
+
+// backtestRule reports how often a rule would have fired over a symbol's
+// stored prices. To defaults to now; ranges are limited to 31 days of ticks
+// or 5 years of bars.
+func (h *Handler) backtestRule(c *gin.Context) {
+	var req backtestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol is required"})
+		return
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if !req.From.Before(req.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	limit := maxTickBacktest
+	if req.Interval != "" {
+		if !req.Interval.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be one of 1m, 1h, 1d"})
+			return
+		}
+		limit = maxBarBacktest
+	}
+	if req.To.Sub(req.From) > limit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("range must not exceed %d days", int(limit.Hours()/24))})
+		return
+	}
+
+	var prices []models.StockPriceRecord
+	if req.Interval == "" {
+		records, err := h.prices.List(req.Symbol, req.From, req.To)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		prices = records
+	} else {
+		bars, err := h.bars.List(req.Interval, req.Symbol, req.From, req.To)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		for _, bar := range bars {
+			prices = append(prices, models.StockPriceRecord{Symbol: bar.Symbol, Price: bar.Close, Timestamp: bar.Bucket})
+		}
+	}
+
+	result, err := alerting.Backtest(req.Symbol, req.Rule, prices)
+	if err != nil {
+		var exprErr *expr.Error
+		if errors.As(err, &exprErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "position": exprErr.Pos})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, backtestResponse{
+		Symbol:         req.Symbol,
+		From:           req.From,
+		To:             req.To,
+		Interval:       req.Interval,
+		BacktestResult: result,
+	})
+}
+
+// ----------------- Alerts Handler -----------------
+
+// getAlerts lists a user's alerts, optionally only those of ?status=
+func (h *Handler) getAlerts(c *gin.Context) {
+	userID := c.Param("id")
+	status := models.AlertStatus(c.Query("status"))
+	if status != "" && !status.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of NEW, READ, ACKNOWLEDGED, SNOOZED, RESOLVED"})
+		return
+	}
+	alerts, err := h.alerts.ListByUser(parseID(userID))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if status != "" {
+		kept := []models.Alert{}
+		for _, alert := range alerts {
+			if alert.Status == status {
+				kept = append(kept, alert)
+			}
+		}
+		alerts = kept
+	}
+	c.JSON(http.StatusOK, alerts)
+}
+
+// countAlerts returns a user's unread (NEW) alert count and the count per status
+func (h *Handler) countAlerts(c *gin.Context) {
+	counts, err := h.alerts.CountByStatus(parseID(c.Param("id")))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Unread": counts[models.AlertNew], "ByStatus": counts})
+}
+
+// alertTransition moves alerts to a status. SnoozedUntil is required for
+// SNOOZED and must be in the future. All applies the transition to every
+// alert of the user that allows it, instead of the listed IDs.
+type alertTransition struct {
+	IDs          []uint
+	All          bool
+	Status       models.AlertStatus
+	SnoozedUntil *time.Time
+}
+
+// updateAlert moves one alert to a status.
+// Body: {"Status": "READ|ACKNOWLEDGED|SNOOZED|RESOLVED", "SnoozedUntil": "2025-06-01T09:00:00Z"}
+func (h *Handler) updateAlert(c *gin.Context) {
+	var req alertTransition
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, alertID := parseID(c.Param("id")), parseID(c.Param("alertid"))
+	req.IDs, req.All = []uint{alertID}, false
+	if _, ok := h.applyTransition(c, userID, req); !ok {
+		return
+	}
+	alerts, err := h.alerts.FindByIDs(userID, req.IDs)
+	if err != nil || len(alerts) != 1 {
+		serverError(c, fmt.Errorf("reloading alert %d: %v", alertID, err))
+		return
+	}
+	c.JSON(http.StatusOK, alerts[0])
+}
+
+// transitionAlerts moves many alerts to a status at once.
+// Body: {"IDs": [1, 2], "Status": "READ"} or {"All": true, "Status": "READ"}
+func (h *Handler) transitionAlerts(c *gin.Context) {
+	var req alertTransition
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.All && len(req.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "IDs or All is required"})
+		return
+	}
+	updated, ok := h.applyTransition(c, parseID(c.Param("id")), req)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Updated": updated})
+}
+
+// applyTransition checks and stores a transition, answering errors itself.
+// Listed alerts must all exist and allow the transition, or none is changed.
+func (h *Handler) applyTransition(c *gin.Context, userID uint, req alertTransition) (int, bool) {
+	if !req.Status.Valid() || req.Status == models.AlertNew {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of READ, ACKNOWLEDGED, SNOOZED, RESOLVED"})
+		return 0, false
+	}
+	now := time.Now()
+	if req.Status == models.AlertSnoozed {
+		if req.SnoozedUntil == nil || !req.SnoozedUntil.After(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "snoozing needs a SnoozedUntil in the future"})
+			return 0, false
+		}
+	} else {
+		req.SnoozedUntil = nil
+	}
+
+	var alerts []models.Alert
+	var err error
+	if req.All {
+		alerts, err = h.alerts.ListByUser(userID)
+	} else {
+		alerts, err = h.alerts.FindByIDs(userID, req.IDs)
+	}
+	if err != nil {
+		serverError(c, err)
+		return 0, false
+	}
+
+	found := map[uint]bool{}
+	ids := []uint{}
+	snoozeChanged := req.Status == models.AlertSnoozed
+	for _, alert := range alerts {
+		found[alert.ID] = true
+		if !alert.Status.CanBecome(req.Status) {
+			if req.All {
+				continue
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("alert %d is %s and cannot become %s", alert.ID, alert.Status, req.Status)})
+			return 0, false
+		}
+		ids = append(ids, alert.ID)
+		snoozeChanged = snoozeChanged || alert.Status == models.AlertSnoozed
+	}
+	for _, id := range req.IDs {
+		if !req.All && !found[id] {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("alert %d not found", id)})
+			return 0, false
+		}
+	}
+
+	if len(ids) > 0 {
+		if err := h.alerts.SetStatus(ids, req.Status, req.SnoozedUntil, now); err != nil {
+			serverError(c, err)
+			return 0, false
+		}
+		// The alert consumer silences snoozed rules, so it must reload them
+		if snoozeChanged {
+			h.publishReload()
+		}
+	}
+	return len(ids), true
+}
+
+// ----------------- History Handler -----------------
+
+// historyBars is how many bars are returned when no range is given
+const historyBars = 100
+
+// getHistory returns OHLC bars from the rollup tables.
+// Query: interval=1m|1h|1d (default 1h), from and to as RFC3339 (default the
+// last 100 bars up to now).
+func (h *Handler) getHistory(c *gin.Context) {
+	interval := models.BarInterval(c.DefaultQuery("interval", string(models.Interval1h)))
+	if !interval.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be one of 1m, 1h, 1d"})
+		return
+	}
+
+	to := time.Now()
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC3339 time"})
+			return
+		}
+		to = t
+	}
+	from := to.Add(-historyBars * interval.Duration())
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC3339 time"})
+			return
+		}
+		from = t
+	}
+
+	bars, err := h.bars.List(interval, c.Param("symbol"), from, to)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, bars)
+}
+
+// ----------------- Market Calendar Handler -----------------
+
+// maxCalendarDays caps the range of a market calendar request
+const maxCalendarDays = 366
+
+// holiday is a weekday on which an exchange does not trade
+type holiday struct {
+	Date time.Time
+	Name string
+}
+
+// getMarketCalendar returns an exchange's status and its sessions and
+// holidays from `from` (default today) to `to` (default two weeks later)
+func (h *Handler) getMarketCalendar(c *gin.Context) {
+	exchange, ok := calendar.Lookup(c.Param("exchange"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown exchange, expected XNYS, XNAS, ARCX, XLON, FX or CRYPTO"})
+		return
+	}
+
+	now := time.Now()
+	from, to := now, now.AddDate(0, 0, 14)
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := c.Query(name); v != "" {
+			t, err := time.ParseInLocation("2006-01-02", v, exchange.Location)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a YYYY-MM-DD date"})
+				return
+			}
+			*target = t
+		}
+	}
+	if !to.After(from) || to.Sub(from) > maxCalendarDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("to must be after from and at most %d days later", maxCalendarDays)})
+		return
+	}
+
+	holidays := []holiday{}
+	for d := from.In(exchange.Location); d.Before(to); d = d.AddDate(0, 0, 1) {
+		if name, ok := exchange.Holiday(d); ok {
+			holidays = append(holidays, holiday{Date: time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC), Name: name})
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Code":     exchange.Code,
+		"Name":     exchange.Name,
+		"Timezone": exchange.Location.String(),
+		"Open":     exchange.IsOpen(now),
+		"NextOpen": exchange.NextOpen(now),
+		"Sessions": exchange.Sessions(from, to),
+		"Holidays": holidays,
+	})
+}
+
+// ----------------- Symbol Handlers -----------------
+
+// maxSymbolResults caps the matches of a symbol search
+const maxSymbolResults = 50
+
+// searchSymbols finds symbols by prefix or name: ?q=<text>&limit=<n>, 10 by default
+func (h *Handler) searchSymbols(c *gin.Context) {
+	q := c.Query("q")
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	limit := 10
+	if v := c.Query("limit"); v != "" {
+		if _, err := fmt.Sscanf(v, "%d", &limit); err != nil || limit < 1 || limit > maxSymbolResults {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be a number from 1 to %d", maxSymbolResults)})
+			return
+		}
+	}
+
+	results, err := h.symbols.Search(q, limit)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+func (h *Handler) getSymbol(c *gin.Context) {
+	entry, err := h.symbols.Lookup(c.Param("symbol"))
+	if errors.Is(err, symbols.ErrUnknownSymbol) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown symbol"})
+		return
+	}
+	if errors.Is(err, symbols.ErrEmptyCatalog) {
+		emptyCatalog(c)
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// ----------------- Corporate Action Handlers -----------------
+
+// addCorporateAction records a split or rename and applies it right away when
+// its effective date has begun.
+// Body: {"Type": "SPLIT", "Symbol": "NVDA", "Ratio": 10, "EffectiveDate": "2024-06-10T00:00:00Z"}
+// or {"Type": "RENAME", "Symbol": "FB", "NewSymbol": "META", "EffectiveDate": ...}.
+func (h *Handler) addCorporateAction(c *gin.Context) {
+	var action models.CorporateAction
+	if err := c.ShouldBindJSON(&action); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	action.ID = 0
+	if err := corporate.Validate(&action); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	created, err := h.actions.Create(&action)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if !created {
+		c.JSON(http.StatusConflict, gin.H{"error": "an action of this type on this symbol and date is already recorded"})
+		return
+	}
+
+	applied, ok := h.applyDueActions(c)
+	if !ok {
+		return
+	}
+	for _, a := range applied {
+		if a.ID == action.ID {
+			action.AppliedAt = a.AppliedAt
+		}
+	}
+	c.JSON(http.StatusOK, action)
+}
+
+// importCorporateActions records the actions of a CSV body with a
+// type,symbol,new_symbol,ratio,effective_date header. Actions already recorded
+// are skipped, so a provider's file can be imported again as it grows.
+func (h *Handler) importCorporateActions(c *gin.Context) {
+	actions, err := corporate.Parse(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	created := 0
+	for i := range actions {
+		ok, err := h.actions.Create(&actions[i])
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		if ok {
+			created++
+		}
+	}
+
+	applied, ok := h.applyDueActions(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Created": created, "Skipped": len(actions) - created, "Applied": applied})
+}
+
+// applyDueActions applies the actions that are due, answering 409 itself when
+// one cannot be applied
+func (h *Handler) applyDueActions(c *gin.Context) ([]models.CorporateAction, bool) {
+	applied, err := h.applier.ApplyDue(time.Now())
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "recorded, but applying failed: " + err.Error()})
+		return nil, false
+	}
+	return applied, true
+}
+
+// listCorporateActions lists the actions by effective date. Query: symbol
+// (old or new) and pending=true for the actions not applied yet.
+func (h *Handler) listCorporateActions(c *gin.Context) {
+	var actions []models.CorporateAction
+	var err error
+	if c.Query("pending") == "true" {
+		actions, err = h.actions.ListPending()
+	} else {
+		actions, err = h.actions.List(strings.ToUpper(c.Query("symbol")))
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, actions)
+}
+
+// deleteCorporateAction removes an action that has not been applied; applied
+// actions cannot be undone
+func (h *Handler) deleteCorporateAction(c *gin.Context) {
+	err := h.actions.DeletePending(parseID(c.Param("actionid")))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no pending corporate action with this id"})
+		return
+	}
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ----------------- Helper -----------------
+
+// findPortfolio loads a portfolio, answering 404 or 500 itself when it cannot
+func (h *Handler) findPortfolio(c *gin.Context, id uint) (*models.Portfolio, bool) {
+	portfolio, err := h.portfolios.FindByID(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "portfolio not found"})
+		return nil, false
+	}
+	if err != nil {
+		serverError(c, err)
+		return nil, false
+	}
+	return portfolio, true
+}
+
+// findHoldingsPortfolio loads a portfolio that may hold positions, answering
+// itself when there is none
+func (h *Handler) findHoldingsPortfolio(c *gin.Context, id uint) (*models.Portfolio, bool) {
+	portfolio, ok := h.findPortfolio(c, id)
+	if !ok {
+		return nil, false
+	}
+	if !portfolio.HasHoldings() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "watchlists carry no holdings"})
+		return nil, false
+	}
+	return portfolio, true
+}
+
+// emptyCatalog answers 503 while symbols cannot be checked against the catalog
+func emptyCatalog(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "the symbol catalog is empty, so symbols cannot be checked; restart the API to seed it"})
+}
+
+func parseID(id string) uint {
+	var val uint
+	fmt.Sscanf(id, "%d", &val)
+	return val
+}
+
+func serverError(c *gin.Context, err error) {
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 }
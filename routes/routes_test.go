@@ -3,25 +3,58 @@ package routes
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"stock-alerts/alerting"
+	"stock-alerts/calendar"
+	"stock-alerts/db/dbtest"
+	"stock-alerts/events"
+	"stock-alerts/ledger"
 	"stock-alerts/models"
+	"stock-alerts/repository"
+	"stock-alerts/symbols"
+	"stock-alerts/valuation"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 )
 
+// recordingPublisher keeps the rule changes the handlers publish
+type recordingPublisher struct {
+	changes []events.RuleChange
+}
+
+func (p *recordingPublisher) PublishRuleChange(change events.RuleChange) {
+	p.changes = append(p.changes, change)
+}
+
 // Setup test router
-func setupTestRouter() *gin.Engine {
+func setupTestRouter(t *testing.T) *gin.Engine {
+	router, _, _ := setupTestRouterWithRepos(t)
+	return router
+}
+
+// Setup test router backed by a migrated test database
+func setupTestRouterWithRepos(t *testing.T) (*gin.Engine, repository.Repositories, *recordingPublisher) {
 	gin.SetMode(gin.TestMode)
+	repos := repository.NewGormRepositories(dbtest.Open(t))
+	publisher := &recordingPublisher{}
+	catalog := symbols.NewCatalog(repos.Symbols, nil)
+	if err := catalog.Seed(); err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
 	router := gin.Default()
-	RegisterRoutes(router)
-	return router
+	RegisterRoutes(router, NewHandler(repos, publisher, catalog))
+	return router, repos, publisher
 }
 
 // Test that routes are properly registered
 func TestRouteRegistration(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 
 	// Test that all expected routes are registered
 	routes := router.Routes()
@@ -29,11 +62,54 @@ func TestRouteRegistration(t *testing.T) {
 	expectedRoutes := []string{
 		"POST /users",
 		"GET /users",
+		"PUT /users/:id/base-currency",
 		"POST /users/:id/portfolio",
 		"GET /users/:id/portfolio",
+		"GET /users/:id/portfolio/valuation",
+		"POST /users/:id/portfolios",
+		"GET /users/:id/portfolios",
+		"GET /portfolio/:id/valuation",
+		"PUT /portfolio/:id/cost-method",
+		"POST /portfolio/:id/stocks/:symbol/move",
+		"PUT /portfolio/:id/positions",
+		"GET /portfolio/:id/positions",
+		"DELETE /portfolio/:id/positions/:symbol",
+		"POST /portfolio/:id/transactions",
+		"GET /portfolio/:id/transactions",
+		"DELETE /portfolio/:id/transactions/:txid",
+		"GET /portfolio/:id/realized-gains",
+		"POST /portfolio/:id/alert-rules",
+		"GET /portfolio/:id/alert-rules",
+		"DELETE /portfolio/:id/alert-rules/:ruleid",
+		"POST /portfolio/:id/positions/:symbol/stops",
+		"GET /portfolio/:id/stops",
+		"DELETE /portfolio/:id/stops/:stopid",
+		"POST /users/:id/signal-rules",
+		"GET /users/:id/signal-rules",
+		"DELETE /users/:id/signal-rules/:ruleid",
+		"POST /users/:id/expression-rules",
+		"GET /users/:id/expression-rules",
+		"DELETE /users/:id/expression-rules/:ruleid",
+		"POST /rules/backtest",
 		"POST /portfolio/:id/stocks",
 		"GET /portfolio/:id/stocks",
 		"GET /users/:id/alerts",
+		"GET /users/:id/alerts/counts",
+		"PUT /users/:id/alerts/:alertid",
+		"POST /users/:id/alerts/transition",
+		"GET /markets/:exchange/calendar",
+		"GET /symbols/search",
+		"GET /symbols/:symbol",
+		"POST /corporate-actions",
+		"POST /corporate-actions/import",
+		"GET /corporate-actions",
+		"DELETE /corporate-actions/:actionid",
+		"GET /users/:id/preferences",
+		"PUT /users/:id/preferences",
+		"PUT /users/:id/rule-channels",
+		"GET /users/:id/rule-channels",
+		"DELETE /users/:id/rule-channels/:channelid",
+		"GET /stocks/:symbol/history",
 	}
 
 	routeMap := make(map[string]bool)
@@ -51,7 +127,7 @@ func TestRouteRegistration(t *testing.T) {
 
 // Test basic request handling (without database)
 func TestCreateUserWithInvalidData(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 
 	// Send invalid JSON
 	req, _ := http.NewRequest("POST", "/users", bytes.NewBufferString(`{"invalid": json}`))
@@ -121,7 +197,7 @@ func TestStockModelJSONSerialization(t *testing.T) {
 		ID:             1,
 		PortfolioID:    1,
 		StockSymbol:    "AAPL",
-		ThresholdPrice: 150.00,
+		ThresholdPrice: decimal.NewFromFloat(150.00),
 	}
 
 	jsonData, err := json.Marshal(stock)
@@ -139,14 +215,14 @@ func TestStockModelJSONSerialization(t *testing.T) {
 		t.Errorf("Expected symbol %s, got %s", stock.StockSymbol, unmarshaledStock.StockSymbol)
 	}
 
-	if unmarshaledStock.ThresholdPrice != stock.ThresholdPrice {
-		t.Errorf("Expected threshold %f, got %f", stock.ThresholdPrice, unmarshaledStock.ThresholdPrice)
+	if !unmarshaledStock.ThresholdPrice.Equal(stock.ThresholdPrice) {
+		t.Errorf("Expected threshold %s, got %s", stock.ThresholdPrice, unmarshaledStock.ThresholdPrice)
 	}
 }
 
 // Test HTTP request structure validation
 func TestHTTPRequestValidation(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 
 	tests := []struct {
 		method      string
@@ -156,9 +232,9 @@ func TestHTTPRequestValidation(t *testing.T) {
 		expectCode  int
 		description string
 	}{
-		{"POST", "/users", "application/json", `{}`, 500, "Empty JSON should cause server error (no DB)"},
+		{"POST", "/users", "application/json", `{}`, 200, "Empty JSON should create a user"},
 		{"POST", "/users", "application/json", `{"invalid"}`, 400, "Invalid JSON should return 400"},
-		{"GET", "/users", "", "", 500, "GET request should cause server error (no DB)"},
+		{"GET", "/users", "", "", 200, "GET request should list users"},
 		{"POST", "/nonexistent", "application/json", `{}`, 404, "Non-existent route should return 404"},
 	}
 
@@ -185,24 +261,51 @@ func TestHTTPRequestValidation(t *testing.T) {
 
 // Test parameter extraction
 func TestParameterExtraction(t *testing.T) {
-	router := setupTestRouter()
+	router := setupTestRouter(t)
 
 	// Test with numeric parameter
 	req, _ := http.NewRequest("GET", "/users/123/portfolio", nil)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	// Should handle parameter correctly (though DB will fail)
-	if w.Code == http.StatusBadRequest {
-		t.Error("Parameter parsing should not return 400")
+	// Should handle parameter correctly (no portfolio exists yet)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for missing portfolio, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// Test stocks are added unchecked when the handler has no symbol catalog
+func TestAddStockWithoutCatalog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewMemoryRepositories()
+	router := gin.New()
+	RegisterRoutes(router, NewHandler(repos, &recordingPublisher{}, nil))
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	portfolio := models.Portfolio{UserID: user.ID}
+	repos.Portfolios.Create(&portfolio)
+
+	path := fmt.Sprintf("/portfolio/%d/stocks", portfolio.ID)
+	req, _ := http.NewRequest("POST", path, bytes.NewBufferString(`{"StockSymbol": " nvda", "ThresholdPrice": 500}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var stock models.Stock
+	json.Unmarshal(w.Body.Bytes(), &stock)
+	if w.Code != http.StatusOK || stock.StockSymbol != "NVDA" {
+		t.Errorf("Expected NVDA to be added, got %d: %s", w.Code, w.Body.String())
 	}
 }
 
 // Test middleware and recovery
 func TestGinRecoveryMiddleware(t *testing.T) {
-	router := setupTestRouter()
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	RegisterRoutes(router, NewHandler(repository.Repositories{}, &recordingPublisher{}, nil))
 
-	// This should trigger the recovery middleware due to nil DB
+	// This should trigger the recovery middleware due to nil repositories
 	req, _ := http.NewRequest("GET", "/users", nil)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -212,3 +315,1131 @@ func TestGinRecoveryMiddleware(t *testing.T) {
 		t.Errorf("Expected recovery middleware to return 500, got %d", w.Code)
 	}
 }
+
+// Test the user, portfolio, stock and alert flow end to end
+func TestPortfolioFlow(t *testing.T) {
+	router, repos, publisher := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/users", `{"Name": "Jane", "Email": "jane@example.com"}`)
+	var user models.User
+	json.Unmarshal(w.Body.Bytes(), &user)
+	if w.Code != http.StatusOK || user.ID == 0 {
+		t.Fatalf("Expected user to be created, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do("POST", fmt.Sprintf("/users/%d/portfolio", user.ID), "")
+	var portfolio models.Portfolio
+	json.Unmarshal(w.Body.Bytes(), &portfolio)
+	if w.Code != http.StatusOK || portfolio.UserID != user.ID {
+		t.Fatalf("Expected portfolio for user %d, got %d: %s", user.ID, w.Code, w.Body.String())
+	}
+
+	w = do("POST", fmt.Sprintf("/portfolio/%d/stocks", portfolio.ID), `{"StockSymbol": "AAPL", "ThresholdPrice": 150}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected stock to be added, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(publisher.changes) != 1 || publisher.changes[0].UserID != user.ID || publisher.changes[0].Symbol != "AAPL" {
+		t.Errorf("Expected a rule change for the new stock, got %+v", publisher.changes)
+	}
+
+	w = do("POST", "/portfolio/999/stocks", `{"StockSymbol": "AAPL", "ThresholdPrice": 150}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing portfolio, got %d", w.Code)
+	}
+
+	w = do("GET", fmt.Sprintf("/users/%d/portfolio", user.ID), "")
+	json.Unmarshal(w.Body.Bytes(), &portfolio)
+	if len(portfolio.Stocks) != 1 || portfolio.Stocks[0].StockSymbol != "AAPL" {
+		t.Errorf("Expected portfolio to contain AAPL, got %+v", portfolio.Stocks)
+	}
+
+	repos.Alerts.Create(&models.Alert{UserID: user.ID, StockSymbol: "AAPL", Price: decimal.NewFromInt(155)})
+	w = do("GET", fmt.Sprintf("/users/%d/alerts", user.ID), "")
+	var alerts []models.Alert
+	json.Unmarshal(w.Body.Bytes(), &alerts)
+	if len(alerts) != 1 {
+		t.Errorf("Expected 1 alert, got %d", len(alerts))
+	}
+}
+
+// Test the history endpoint reads bars from the rollup tables
+func TestGetHistory(t *testing.T) {
+	router, repos, _ := setupTestRouterWithRepos(t)
+	bucket := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+	repos.Bars.Upsert(models.Interval1h, []models.PriceBar{
+		{Symbol: "AAPL", Bucket: bucket, Open: decimal.NewFromInt(1), High: decimal.NewFromInt(2), Low: decimal.NewFromInt(1), Close: decimal.NewFromInt(2), Count: 5},
+		{Symbol: "AAPL", Bucket: bucket.Add(time.Hour), Open: decimal.NewFromInt(2), High: decimal.NewFromInt(3), Low: decimal.NewFromInt(2), Close: decimal.NewFromInt(3), Count: 5},
+	})
+
+	req, _ := http.NewRequest("GET", "/stocks/AAPL/history?interval=1h&from=2025-01-02T00:00:00Z&to=2025-01-03T00:00:00Z", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var bars []models.PriceBar
+	json.Unmarshal(w.Body.Bytes(), &bars)
+	if w.Code != http.StatusOK || len(bars) != 2 {
+		t.Fatalf("Expected 2 bars, got %d: %s", w.Code, w.Body.String())
+	}
+	if !bars[1].Close.Equal(decimal.NewFromInt(3)) {
+		t.Errorf("Expected second bar to close at 3, got %s", bars[1].Close)
+	}
+
+	for _, query := range []string{"interval=5m", "from=yesterday"} {
+		req, _ := http.NewRequest("GET", "/stocks/AAPL/history?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, w.Code)
+		}
+	}
+}
+
+// Test positions are valued at the latest persisted prices
+func TestPortfolioValuation(t *testing.T) {
+	router, repos, _ := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	portfolio := models.Portfolio{UserID: user.ID}
+	repos.Portfolios.Create(&portfolio)
+
+	w := do("PUT", fmt.Sprintf("/portfolio/%d/positions", portfolio.ID), `{"Symbol": "AAPL", "Quantity": 10, "AvgCost": 100}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected position to be stored, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", fmt.Sprintf("/portfolio/%d/positions", portfolio.ID), `{"Symbol": "AAPL", "Quantity": -1}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative quantity, got %d", w.Code)
+	}
+	if w := do("PUT", "/portfolio/999/positions", `{"Symbol": "AAPL", "Quantity": 1}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing portfolio, got %d", w.Code)
+	}
+
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(120), Timestamp: time.Now()})
+
+	w = do("GET", fmt.Sprintf("/users/%d/portfolio/valuation", user.ID), "")
+	var v valuation.Valuation
+	json.Unmarshal(w.Body.Bytes(), &v)
+	if w.Code != http.StatusOK || len(v.Positions) != 1 {
+		t.Fatalf("Expected 1 valued position, got %d: %s", w.Code, w.Body.String())
+	}
+	if !v.Positions[0].MarketValue.Equal(decimal.NewFromInt(1200)) || !v.Totals["USD"].UnrealizedPnL.Equal(decimal.NewFromInt(200)) {
+		t.Errorf("Expected market value 1200 and P&L 200, got %+v", v)
+	}
+
+	if w := do("DELETE", fmt.Sprintf("/portfolio/%d/positions/AAPL", portfolio.ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on delete, got %d", w.Code)
+	}
+	if w := do("GET", "/users/999/portfolio/valuation", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a user without portfolio, got %d", w.Code)
+	}
+}
+
+// Test valuations are summed in the owner's base currency
+func TestBaseCurrencyValuation(t *testing.T) {
+	router, repos, _ := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "/users", `{"Name": "Jane", "Email": "jane@example.com", "BaseCurrency": "GBX"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a minor unit base currency, got %d", w.Code)
+	}
+	w := do("POST", "/users", `{"Name": "Jane", "Email": "jane@example.com"}`)
+	var user models.User
+	json.Unmarshal(w.Body.Bytes(), &user)
+	if w.Code != http.StatusOK || user.BaseCurrency != "USD" {
+		t.Fatalf("Expected a USD user, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do("PUT", fmt.Sprintf("/users/%d/base-currency", user.ID), `{"BaseCurrency": "EUR"}`)
+	json.Unmarshal(w.Body.Bytes(), &user)
+	if w.Code != http.StatusOK || user.BaseCurrency != "EUR" {
+		t.Fatalf("Expected the base currency to change to EUR, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/users/999/base-currency", `{"BaseCurrency": "EUR"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing user, got %d", w.Code)
+	}
+	if w := do("PUT", fmt.Sprintf("/users/%d/base-currency", user.ID), `{"BaseCurrency": "euro"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid currency, got %d", w.Code)
+	}
+
+	portfolio := models.Portfolio{UserID: user.ID}
+	repos.Portfolios.Create(&portfolio)
+	do("PUT", fmt.Sprintf("/portfolio/%d/positions", portfolio.ID), `{"Symbol": "AAPL", "Quantity": 10, "AvgCost": 100}`)
+	w = do("PUT", fmt.Sprintf("/portfolio/%d/positions", portfolio.ID), `{"Symbol": "BP.LON", "Quantity": 100, "AvgCost": 400}`)
+	var position models.Position
+	json.Unmarshal(w.Body.Bytes(), &position)
+	if position.Currency != "GBX" {
+		t.Errorf("Expected the currency to come from the catalog, got %q", position.Currency)
+	}
+
+	now := time.Now()
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(120), Timestamp: now})
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "BP.LON", Price: decimal.NewFromInt(500), Timestamp: now})
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "USDEUR", Price: decimal.NewFromFloat(0.9), Timestamp: now})
+
+	var v valuation.Valuation
+	w = do("GET", fmt.Sprintf("/portfolio/%d/valuation", portfolio.ID), "")
+	json.Unmarshal(w.Body.Bytes(), &v)
+	if v.Base == nil || v.Base.Currency != "EUR" || !v.Base.MarketValue.Equal(decimal.NewFromInt(1080)) || len(v.Base.Unconverted) != 1 || v.Base.Unconverted[0] != "GBX" {
+		t.Fatalf("Expected 1080 EUR with GBX unconverted, got %s", w.Body.String())
+	}
+
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "GBPEUR", Price: decimal.NewFromFloat(1.2), Timestamp: now})
+	w = do("GET", fmt.Sprintf("/portfolio/%d/valuation", portfolio.ID), "")
+	v = valuation.Valuation{}
+	json.Unmarshal(w.Body.Bytes(), &v)
+	// 1200 USD at 0.9 and 50000 pence, 500 GBP, at 1.2
+	if v.Base == nil || !v.Base.MarketValue.Equal(decimal.NewFromInt(1680)) || len(v.Base.Unconverted) != 0 {
+		t.Errorf("Expected 1680 EUR, got %s", w.Body.String())
+	}
+}
+
+// Test the ledger drives positions and the realized gains report
+func TestTransactionLedger(t *testing.T) {
+	router, repos, _ := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	portfolio := models.Portfolio{UserID: user.ID}
+	repos.Portfolios.Create(&portfolio)
+	path := fmt.Sprintf("/portfolio/%d/transactions", portfolio.ID)
+
+	var buy models.Transaction
+	w := do("POST", path, `{"Type": "BUY", "Symbol": "AAPL", "Quantity": 10, "Price": 100, "TradeDate": "2025-01-02T00:00:00Z"}`)
+	json.Unmarshal(w.Body.Bytes(), &buy)
+	if w.Code != http.StatusOK || buy.ID == 0 {
+		t.Fatalf("Expected buy to be recorded, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do("POST", path, `{"Type": "SELL", "Symbol": "AAPL", "Quantity": 4, "Price": 150, "TradeDate": "2025-03-01T00:00:00Z"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected sell to be recorded, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", path, `{"Type": "SELL", "Symbol": "AAPL", "Quantity": 100, "Price": 150}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when selling more than held, got %d", w.Code)
+	}
+	if w := do("POST", path, `{"Type": "GIFT", "Symbol": "AAPL"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown type, got %d", w.Code)
+	}
+
+	positions, _ := repos.Positions.ListByPortfolio(portfolio.ID)
+	if len(positions) != 1 || !positions[0].Quantity.Equal(decimal.NewFromInt(6)) {
+		t.Errorf("Expected 6 AAPL derived from the ledger, got %+v", positions)
+	}
+	if w := do("PUT", fmt.Sprintf("/portfolio/%d/positions", portfolio.ID), `{"Symbol": "MSFT", "Quantity": 1}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when editing derived positions, got %d", w.Code)
+	}
+
+	w = do("GET", fmt.Sprintf("/portfolio/%d/realized-gains?year=2025", portfolio.ID), "")
+	var report ledger.GainsReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if w.Code != http.StatusOK || !report.Total.Equal(decimal.NewFromInt(200)) || len(report.Realizations) != 1 {
+		t.Errorf("Expected 200 realized in 2025, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", fmt.Sprintf("/portfolio/%d/realized-gains?method=specific", portfolio.ID), ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for sales without lots under the specific method, got %d", w.Code)
+	}
+
+	if w := do("DELETE", fmt.Sprintf("%s/%d", path, buy.ID), ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when deleting a sold lot, got %d", w.Code)
+	}
+	for _, body := range []string{
+		`{"Type": "BUY", "Symbol": "AAPL", "Quantity": 1, "Price": -100}`,
+		`{"Type": "BUY", "Symbol": "AAPL", "Quantity": 1, "Price": 100, "Fee": -1}`,
+		`{"Type": "DIVIDEND", "Symbol": "AAPL", "Amount": -5}`,
+	} {
+		if w := do("POST", path, body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
+
+// Test that every change to positions has the consumers reload them
+func TestPositionChangesPublishReload(t *testing.T) {
+	router, repos, publisher := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	manual := models.Portfolio{UserID: user.ID, Name: "Manual"}
+	repos.Portfolios.Create(&manual)
+	traded := models.Portfolio{UserID: user.ID, Name: "Traded"}
+	repos.Portfolios.Create(&traded)
+
+	var buy models.Transaction
+	steps := []struct {
+		name, method, path, body string
+		out                      any
+	}{
+		{"upsert a position", "PUT", fmt.Sprintf("/portfolio/%d/positions", manual.ID), `{"Symbol": "AAPL", "Quantity": 10, "AvgCost": 100}`, nil},
+		{"delete a position", "DELETE", fmt.Sprintf("/portfolio/%d/positions/AAPL", manual.ID), "", nil},
+		{"add a transaction", "POST", fmt.Sprintf("/portfolio/%d/transactions", traded.ID), `{"Type": "BUY", "Symbol": "AAPL", "Quantity": 10, "Price": 100}`, &buy},
+		{"change the cost method", "PUT", fmt.Sprintf("/portfolio/%d/cost-method", traded.ID), `{"Method": "lifo"}`, nil},
+		{"delete a transaction", "DELETE", "", "", nil},
+	}
+	for _, step := range steps {
+		if step.path == "" {
+			step.path = fmt.Sprintf("/portfolio/%d/transactions/%d", traded.ID, buy.ID)
+		}
+		publisher.changes = nil
+		w := do(step.method, step.path, step.body)
+		if w.Code >= 300 {
+			t.Fatalf("%s: expected success, got %d: %s", step.name, w.Code, w.Body.String())
+		}
+		if step.out != nil {
+			json.Unmarshal(w.Body.Bytes(), step.out)
+		}
+		if len(publisher.changes) != 1 || publisher.changes[0].Op != events.OpReload {
+			t.Errorf("%s: expected a reload to be published, got %+v", step.name, publisher.changes)
+		}
+	}
+}
+
+// Test that a portfolio's positions and realized gains follow its cost method
+func TestPortfolioCostMethod(t *testing.T) {
+	router, repos, _ := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	if w := do("POST", fmt.Sprintf("/users/%d/portfolios", user.ID), `{"Name": "Taxable", "CostMethod": "hifo"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown cost method, got %d", w.Code)
+	}
+	var portfolio models.Portfolio
+	w := do("POST", fmt.Sprintf("/users/%d/portfolios", user.ID), `{"Name": "Taxable", "CostMethod": "lifo"}`)
+	json.Unmarshal(w.Body.Bytes(), &portfolio)
+	if w.Code != http.StatusOK || portfolio.CostMethod != "lifo" {
+		t.Fatalf("Expected a LIFO portfolio, got %d: %s", w.Code, w.Body.String())
+	}
+
+	path := fmt.Sprintf("/portfolio/%d/transactions", portfolio.ID)
+	do("POST", path, `{"Type": "BUY", "Symbol": "AAPL", "Quantity": 10, "Price": 100, "TradeDate": "2025-01-02T00:00:00Z"}`)
+	do("POST", path, `{"Type": "BUY", "Symbol": "AAPL", "Quantity": 10, "Price": 200, "TradeDate": "2025-02-03T00:00:00Z"}`)
+	do("POST", path, `{"Type": "SELL", "Symbol": "AAPL", "Quantity": 10, "Price": 250, "TradeDate": "2025-03-03T00:00:00Z"}`)
+
+	// LIFO sold the lot bought at 200, so the one at 100 is left
+	positions, _ := repos.Positions.ListByPortfolio(portfolio.ID)
+	if len(positions) != 1 || !positions[0].AvgCost.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected the lot at 100 left, got %+v", positions)
+	}
+	var report ledger.GainsReport
+	w = do("GET", fmt.Sprintf("/portfolio/%d/realized-gains?year=2025", portfolio.ID), "")
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if report.Method != ledger.LIFO || !report.Total.Equal(decimal.NewFromInt(500)) {
+		t.Errorf("Expected 500 realized under LIFO, got %d: %s", w.Code, w.Body.String())
+	}
+
+	method := fmt.Sprintf("/portfolio/%d/cost-method", portfolio.ID)
+	if w := do("PUT", method, `{"Method": "specific"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when sales name no lots, got %d", w.Code)
+	}
+	if w := do("PUT", method, `{"Method": "fifo"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the method to change, got %d: %s", w.Code, w.Body.String())
+	}
+	if positions, _ := repos.Positions.ListByPortfolio(portfolio.ID); len(positions) != 1 || !positions[0].AvgCost.Equal(decimal.NewFromInt(200)) {
+		t.Errorf("Expected the lot at 200 left under FIFO, got %+v", positions)
+	}
+}
+
+// Test named portfolios, watchlists and moving symbols between them
+func TestPortfoliosAndWatchlists(t *testing.T) {
+	router, repos, publisher := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	path := fmt.Sprintf("/users/%d/portfolios", user.ID)
+
+	var retirement, watchlist models.Portfolio
+	w := do("POST", path, `{"Name": "Retirement"}`)
+	json.Unmarshal(w.Body.Bytes(), &retirement)
+	if w.Code != http.StatusOK || retirement.Kind != models.KindPortfolio {
+		t.Fatalf("Expected a portfolio, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do("POST", path, `{"Name": "Ideas", "Kind": "watchlist"}`)
+	json.Unmarshal(w.Body.Bytes(), &watchlist)
+	if w.Code != http.StatusOK || watchlist.Kind != models.KindWatchlist {
+		t.Fatalf("Expected a watchlist, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", path, `{"Name": "Ideas"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate name, got %d", w.Code)
+	}
+	if w := do("POST", path, `{"Name": "Other", "Kind": "basket"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown kind, got %d", w.Code)
+	}
+
+	do("POST", fmt.Sprintf("/portfolio/%d/stocks", watchlist.ID), `{"StockSymbol": "NVDA", "ThresholdPrice": 500}`)
+	if w := do("PUT", fmt.Sprintf("/portfolio/%d/positions", watchlist.ID), `{"Symbol": "NVDA", "Quantity": 1}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a position in a watchlist, got %d", w.Code)
+	}
+
+	w = do("POST", fmt.Sprintf("/portfolio/%d/stocks/nvda/move", watchlist.ID), fmt.Sprintf(`{"PortfolioID": %d}`, retirement.ID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected NVDA to move, got %d: %s", w.Code, w.Body.String())
+	}
+	last := publisher.changes[len(publisher.changes)-1]
+	if last.PortfolioID != retirement.ID || last.Symbol != "NVDA" {
+		t.Errorf("Expected a rule change for the moved stock, got %+v", last)
+	}
+
+	other := models.User{Name: "John", Email: "john@example.com"}
+	repos.Users.Create(&other)
+	foreign := models.Portfolio{UserID: other.ID}
+	repos.Portfolios.Create(&foreign)
+	w = do("POST", fmt.Sprintf("/portfolio/%d/stocks/NVDA/move", retirement.ID), fmt.Sprintf(`{"PortfolioID": %d}`, foreign.ID))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when moving to another user's portfolio, got %d", w.Code)
+	}
+
+	w = do("GET", path, "")
+	var portfolios []models.Portfolio
+	json.Unmarshal(w.Body.Bytes(), &portfolios)
+	if len(portfolios) != 2 || len(portfolios[0].Stocks) != 1 || len(portfolios[1].Stocks) != 0 {
+		t.Errorf("Expected NVDA in the retirement portfolio only, got %+v", portfolios)
+	}
+}
+
+// Test portfolio alert rules are validated and stored
+func TestPortfolioAlertRules(t *testing.T) {
+	router, repos, publisher := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	portfolio := models.Portfolio{UserID: user.ID}
+	repos.Portfolios.Create(&portfolio)
+	path := fmt.Sprintf("/portfolio/%d/alert-rules", portfolio.ID)
+
+	var rule models.PortfolioAlertRule
+	w := do("POST", path, `{"Type": "DRAWDOWN", "Threshold": 10}`)
+	json.Unmarshal(w.Body.Bytes(), &rule)
+	if w.Code != http.StatusOK || rule.ID == 0 {
+		t.Fatalf("Expected rule to be created, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(publisher.changes) != 1 || publisher.changes[0].Op != events.OpReload {
+		t.Errorf("Expected a reload to be published, got %+v", publisher.changes)
+	}
+	for _, body := range []string{`{"Type": "VOLUME", "Threshold": 1}`, `{"Type": "DRAWDOWN", "Threshold": 0}`} {
+		if w := do("POST", path, body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	w = do("GET", path, "")
+	var rules []models.PortfolioAlertRule
+	json.Unmarshal(w.Body.Bytes(), &rules)
+	if len(rules) != 1 || rules[0].Type != models.RuleDrawdown {
+		t.Errorf("Expected the drawdown rule, got %+v", rules)
+	}
+
+	if w := do("DELETE", fmt.Sprintf("%s/%d", path, rule.ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on delete, got %d", w.Code)
+	}
+	if len(publisher.changes) != 2 || publisher.changes[1].Op != events.OpReload {
+		t.Errorf("Expected a reload to be published on delete, got %+v", publisher.changes)
+	}
+	if w := do("DELETE", fmt.Sprintf("%s/%d", path, rule.ID), ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 on second delete, got %d", w.Code)
+	}
+}
+
+func TestPositionStops(t *testing.T) {
+	router, repos, publisher := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	portfolio := models.Portfolio{UserID: user.ID}
+	repos.Portfolios.Create(&portfolio)
+	repos.Positions.Upsert(&models.Position{PortfolioID: portfolio.ID, Symbol: "AAPL", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(100)})
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromInt(120), Timestamp: time.Now()})
+
+	var rule models.PositionAlertRule
+	w := do("POST", fmt.Sprintf("/portfolio/%d/positions/aapl/stops", portfolio.ID), `{"Type": "TRAILING_STOP", "Value": 10}`)
+	json.Unmarshal(w.Body.Bytes(), &rule)
+	if w.Code != http.StatusOK || rule.ID == 0 {
+		t.Fatalf("Expected stop to be created, got %d: %s", w.Code, w.Body.String())
+	}
+	if rule.Symbol != "AAPL" || rule.Unit != models.UnitPercent || !rule.HighWater.Equal(decimal.NewFromInt(120)) {
+		t.Errorf("Expected a percent AAPL stop trailing from 120, got %+v", rule)
+	}
+	if len(publisher.changes) != 1 || publisher.changes[0].Op != events.OpReload {
+		t.Errorf("Expected a reload to be published, got %+v", publisher.changes)
+	}
+
+	for _, body := range []string{
+		`{"Type": "STOP", "Value": 10}`,
+		`{"Type": "STOP_LOSS", "Unit": "SHARES", "Value": 10}`,
+		`{"Type": "STOP_LOSS", "Value": 0}`,
+		`{"Type": "STOP_LOSS", "Value": 100}`,
+	} {
+		if w := do("POST", fmt.Sprintf("/portfolio/%d/positions/AAPL/stops", portfolio.ID), body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+	if w := do("POST", fmt.Sprintf("/portfolio/%d/positions/TSLA/stops", portfolio.ID), `{"Type": "STOP_LOSS", "Value": 5}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a position, got %d", w.Code)
+	}
+
+	var rules []models.PositionAlertRule
+	w = do("GET", fmt.Sprintf("/portfolio/%d/stops", portfolio.ID), "")
+	json.Unmarshal(w.Body.Bytes(), &rules)
+	if len(rules) != 1 || rules[0].Type != models.RuleTrailingStop {
+		t.Errorf("Expected the trailing stop, got %+v", rules)
+	}
+
+	path := fmt.Sprintf("/portfolio/%d/stops/%d", portfolio.ID, rule.ID)
+	if w := do("DELETE", path, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on delete, got %d", w.Code)
+	}
+	if w := do("DELETE", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 on second delete, got %d", w.Code)
+	}
+}
+
+func TestSignalRules(t *testing.T) {
+	router, repos, publisher := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	path := fmt.Sprintf("/users/%d/signal-rules", user.ID)
+
+	var rule models.SignalRule
+	w := do("POST", path, `{"Symbol": "AAPL", "Type": "SIGNAL_CHANGE", "From": "NEUTRAL", "To": "BULLISH"}`)
+	json.Unmarshal(w.Body.Bytes(), &rule)
+	if w.Code != http.StatusOK || rule.ID == 0 || rule.UserID != user.ID {
+		t.Fatalf("Expected rule to be created, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(publisher.changes) != 1 || publisher.changes[0].Op != events.OpReload {
+		t.Errorf("Expected a reload to be published, got %+v", publisher.changes)
+	}
+	if w := do("POST", path, `{"Symbol": "AAPL", "Type": "RSI_OVERSOLD"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected an RSI rule to be created, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"Type": "GOLDEN_CROSS"}`,
+		`{"Symbol": "AAPL", "Type": "MACD"}`,
+		`{"Symbol": "AAPL", "Type": "GOLDEN_CROSS", "To": "BULLISH"}`,
+		`{"Symbol": "AAPL", "Type": "SIGNAL_CHANGE", "To": "UP"}`,
+		`{"Symbol": "AAPL", "Type": "SIGNAL_CHANGE", "From": "BULLISH", "To": "BULLISH"}`,
+	} {
+		if w := do("POST", path, body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	var rules []models.SignalRule
+	w = do("GET", path, "")
+	json.Unmarshal(w.Body.Bytes(), &rules)
+	if len(rules) != 2 || rules[0].To != models.SignalBullish {
+		t.Errorf("Expected both rules, got %+v", rules)
+	}
+
+	if w := do("DELETE", fmt.Sprintf("%s/%d", path, rule.ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on delete, got %d", w.Code)
+	}
+	if w := do("DELETE", fmt.Sprintf("%s/%d", path, rule.ID), ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 on second delete, got %d", w.Code)
+	}
+}
+
+func TestExpressionRules(t *testing.T) {
+	router, repos, publisher := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	path := fmt.Sprintf("/users/%d/expression-rules", user.ID)
+
+	var rule models.ExpressionRule
+	w := do("POST", path, `{"Symbol": "AAPL", "Expression": "price > sma(20) * 1.05 && rsi(14) < 70"}`)
+	json.Unmarshal(w.Body.Bytes(), &rule)
+	if w.Code != http.StatusOK || rule.ID == 0 || rule.UserID != user.ID {
+		t.Fatalf("Expected rule to be created, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(publisher.changes) != 1 || publisher.changes[0].Op != events.OpReload {
+		t.Errorf("Expected a reload to be published, got %+v", publisher.changes)
+	}
+
+	w = do("POST", path, `{"Symbol": "AAPL", "Expression": "price > smaa(20)"}`)
+	var failure struct {
+		Error    string `json:"error"`
+		Position int    `json:"position"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &failure)
+	if w.Code != http.StatusBadRequest || failure.Position != 9 || !strings.Contains(failure.Error, "smaa") {
+		t.Errorf("Expected a 400 pointing at smaa, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", path, `{"Expression": "price > 1"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a symbol, got %d", w.Code)
+	}
+
+	var rules []models.ExpressionRule
+	w = do("GET", path, "")
+	json.Unmarshal(w.Body.Bytes(), &rules)
+	if len(rules) != 1 || rules[0].Expression != rule.Expression {
+		t.Errorf("Expected the stored rule, got %+v", rules)
+	}
+
+	if w := do("DELETE", fmt.Sprintf("%s/%d", path, rule.ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on delete, got %d", w.Code)
+	}
+	if w := do("DELETE", fmt.Sprintf("%s/%d", path, rule.ID), ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 on second delete, got %d", w.Code)
+	}
+}
+
+func TestBacktestRule(t *testing.T) {
+	router, repos, _ := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	start := time.Date(2025, 3, 3, 14, 30, 0, 0, time.UTC)
+	for i, price := range []float64{100, 104, 99, 106, 101} {
+		repos.Prices.Create(&models.StockPriceRecord{Symbol: "AAPL", Price: decimal.NewFromFloat(price), Timestamp: start.Add(time.Duration(i) * time.Minute)})
+	}
+	repos.Prices.Create(&models.StockPriceRecord{Symbol: "MSFT", Price: decimal.NewFromInt(500), Timestamp: start})
+	repos.Bars.Upsert(models.Interval1d, []models.PriceBar{
+		{Symbol: "AAPL", Bucket: start.AddDate(0, 0, -1), Close: decimal.NewFromInt(90)},
+		{Symbol: "AAPL", Bucket: start.AddDate(0, 0, -2), Close: decimal.NewFromInt(110)},
+	})
+
+	var result struct {
+		Symbol    string
+		Prices    int
+		Fires     int
+		HeldPct   float64
+		FireTimes []alerting.BacktestFire
+	}
+	w := do("POST", "/rules/backtest", `{"Symbol": "AAPL", "From": "2025-03-03T00:00:00Z", "To": "2025-03-04T00:00:00Z",
+		"Rule": {"Kind": "THRESHOLD", "Threshold": 104}}`)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Symbol != "AAPL" || result.Prices != 5 || result.Fires != 2 || result.HeldPct != 40 {
+		t.Fatalf("Expected 2 threshold fires over 5 ticks, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do("POST", "/rules/backtest", `{"Symbol": "AAPL", "From": "2025-03-03T00:00:00Z", "To": "2025-03-04T00:00:00Z",
+		"Rule": {"Kind": "EXPRESSION", "Expression": "price > prev"}}`)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Fires != 2 || !result.FireTimes[1].Price.Equal(decimal.NewFromInt(106)) {
+		t.Errorf("Expected the expression to fire at 104 and 106, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do("POST", "/rules/backtest", `{"Symbol": "AAPL", "From": "2025-02-01T00:00:00Z", "To": "2025-03-03T00:00:00Z", "Interval": "1d",
+		"Rule": {"Kind": "STOP_LOSS", "Value": 10, "AvgCost": 100}}`)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Prices != 2 || result.Fires != 1 || !result.FireTimes[0].Price.Equal(decimal.NewFromInt(90)) {
+		t.Errorf("Expected the stop-loss to fire on the 90 close, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"From": "2025-03-03T00:00:00Z", "Rule": {"Kind": "THRESHOLD", "Threshold": 1}}`,
+		`{"Symbol": "AAPL", "From": "2025-03-04T00:00:00Z", "To": "2025-03-03T00:00:00Z", "Rule": {"Kind": "THRESHOLD", "Threshold": 1}}`,
+		`{"Symbol": "AAPL", "From": "2024-01-01T00:00:00Z", "To": "2025-03-03T00:00:00Z", "Rule": {"Kind": "THRESHOLD", "Threshold": 1}}`,
+		`{"Symbol": "AAPL", "From": "2025-03-03T00:00:00Z", "Interval": "1w", "Rule": {"Kind": "THRESHOLD", "Threshold": 1}}`,
+		`{"Symbol": "AAPL", "From": "2025-03-03T00:00:00Z", "Rule": {"Kind": "VOLUME"}}`,
+	} {
+		if w := do("POST", "/rules/backtest", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	w = do("POST", "/rules/backtest", `{"Symbol": "AAPL", "From": "2025-03-03T00:00:00Z", "To": "2025-03-04T00:00:00Z",
+		"Rule": {"Kind": "EXPRESSION", "Expression": "price > sma(300)"}}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"position":13`) {
+		t.Errorf("Expected a 400 pointing at the period, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAlertLifecycle(t *testing.T) {
+	router, repos, publisher := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	for _, price := range []float64{150, 155, 160} {
+		repos.Alerts.Create(&models.Alert{UserID: user.ID, StockSymbol: "AAPL", Price: decimal.NewFromFloat(price), Timestamp: time.Now()})
+	}
+	alerts, _ := repos.Alerts.ListByUser(user.ID)
+	path := fmt.Sprintf("/users/%d/alerts", user.ID)
+
+	var counts struct {
+		Unread   int
+		ByStatus map[models.AlertStatus]int
+	}
+	w := do("GET", path+"/counts", "")
+	json.Unmarshal(w.Body.Bytes(), &counts)
+	if w.Code != http.StatusOK || counts.Unread != 3 {
+		t.Fatalf("Expected 3 unread alerts, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var alert models.Alert
+	w = do("PUT", fmt.Sprintf("%s/%d", path, alerts[0].ID), `{"Status": "ACKNOWLEDGED"}`)
+	json.Unmarshal(w.Body.Bytes(), &alert)
+	if w.Code != http.StatusOK || alert.Status != models.AlertAcknowledged || alert.StatusChangedAt == nil {
+		t.Fatalf("Expected the alert to be acknowledged, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", fmt.Sprintf("%s/%d", path, alerts[0].ID), `{"Status": "READ"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 marking an acknowledged alert read, got %d", w.Code)
+	}
+	if w := do("PUT", fmt.Sprintf("%s/%d", path, alerts[1].ID), `{"Status": "SNOOZED"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 snoozing without SnoozedUntil, got %d", w.Code)
+	}
+	if w := do("PUT", fmt.Sprintf("%s/%d", path, alerts[1].ID), `{"Status": "NEW"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 moving back to NEW, got %d", w.Code)
+	}
+	if w := do("PUT", fmt.Sprintf("/users/%d/alerts/%d", user.ID+1, alerts[1].ID), `{"Status": "READ"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user's alert, got %d", w.Code)
+	}
+
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	w = do("PUT", fmt.Sprintf("%s/%d", path, alerts[1].ID), `{"Status": "SNOOZED", "SnoozedUntil": "`+until+`"}`)
+	json.Unmarshal(w.Body.Bytes(), &alert)
+	if w.Code != http.StatusOK || alert.SnoozedUntil == nil {
+		t.Fatalf("Expected the alert to be snoozed, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(publisher.changes) != 1 || publisher.changes[0].Op != events.OpReload {
+		t.Errorf("Expected a snooze to publish a reload, got %+v", publisher.changes)
+	}
+
+	var updated struct{ Updated int }
+	w = do("POST", path+"/transition", `{"All": true, "Status": "READ"}`)
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	if w.Code != http.StatusOK || updated.Updated != 1 {
+		t.Errorf("Expected only the new alert to be marked read, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do("POST", path+"/transition", fmt.Sprintf(`{"IDs": [%d, %d], "Status": "RESOLVED"}`, alerts[1].ID, alerts[2].ID))
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	if w.Code != http.StatusOK || updated.Updated != 2 {
+		t.Errorf("Expected two alerts to be resolved, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(publisher.changes) != 2 {
+		t.Errorf("Expected resolving a snoozed alert to publish a reload, got %+v", publisher.changes)
+	}
+	if w := do("POST", path+"/transition", `{"Status": "READ"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without IDs, got %d", w.Code)
+	}
+
+	var listed []models.Alert
+	w = do("GET", path+"?status=RESOLVED", "")
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if w.Code != http.StatusOK || len(listed) != 2 {
+		t.Errorf("Expected 2 resolved alerts, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", path+"?status=GONE", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown status, got %d", w.Code)
+	}
+	w = do("GET", path+"/counts", "")
+	json.Unmarshal(w.Body.Bytes(), &counts)
+	if counts.Unread != 0 || counts.ByStatus[models.AlertAcknowledged] != 1 || counts.ByStatus[models.AlertResolved] != 2 {
+		t.Errorf("Unexpected counts: %+v", counts)
+	}
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	router, repos, _ := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	path := fmt.Sprintf("/users/%d/preferences", user.ID)
+
+	var prefs models.NotificationPreferences
+	w := do("GET", path, "")
+	json.Unmarshal(w.Body.Bytes(), &prefs)
+	if w.Code != http.StatusOK || prefs.Timezone != "UTC" || prefs.Digest != models.DigestNone || len(prefs.Channels) != 0 {
+		t.Fatalf("Expected the default preferences, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do("PUT", path, `{"Channels": ["WEBHOOK"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a webhook without URL, got %d", w.Code)
+	}
+	if w := do("PUT", path, `{"Timezone": "Mars/Olympus"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown timezone, got %d", w.Code)
+	}
+	if w := do("PUT", "/users/999/preferences", `{}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown user, got %d", w.Code)
+	}
+
+	w = do("PUT", path, `{"Channels": ["EMAIL"], "Timezone": "Europe/Paris", "QuietStart": "22:00", "QuietEnd": "07:00",
+		"Digest": "WEEKLY", "DigestHour": 8, "DigestWeekday": 1}`)
+	json.Unmarshal(w.Body.Bytes(), &prefs)
+	if w.Code != http.StatusOK || prefs.UserID != user.ID || prefs.Timezone != "Europe/Paris" || prefs.Digest != models.DigestWeekly {
+		t.Fatalf("Expected the preferences to be saved, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do("GET", path, "")
+	json.Unmarshal(w.Body.Bytes(), &prefs)
+	if len(prefs.Channels) != 1 || prefs.Channels[0] != models.ChannelEmail || prefs.QuietStart != "22:00" {
+		t.Errorf("Expected the stored preferences, got %s", w.Body.String())
+	}
+
+	portfolio := models.Portfolio{UserID: user.ID}
+	repos.Portfolios.Create(&portfolio)
+	stock := models.Stock{PortfolioID: portfolio.ID, StockSymbol: "AAPL", ThresholdPrice: decimal.NewFromInt(150)}
+	repos.Stocks.Create(&stock)
+	channelsPath := fmt.Sprintf("/users/%d/rule-channels", user.ID)
+
+	body := fmt.Sprintf(`{"Kind": "THRESHOLD", "RuleID": %d, "Channels": ["WEBHOOK"]}`, stock.ID)
+	if w := do("PUT", channelsPath, body); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a webhook without URL, got %d", w.Code)
+	}
+	if w := do("PUT", channelsPath, `{"Kind": "THRESHOLD", "RuleID": 999, "Channels": []}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user's rule, got %d", w.Code)
+	}
+
+	var override models.RuleChannels
+	w = do("PUT", channelsPath, fmt.Sprintf(`{"Kind": "THRESHOLD", "RuleID": %d, "Channels": []}`, stock.ID))
+	json.Unmarshal(w.Body.Bytes(), &override)
+	if w.Code != http.StatusOK || override.UserID != user.ID {
+		t.Fatalf("Expected the override to be saved, got %d: %s", w.Code, w.Body.String())
+	}
+	var overrides []models.RuleChannels
+	w = do("GET", channelsPath, "")
+	json.Unmarshal(w.Body.Bytes(), &overrides)
+	if len(overrides) != 1 || overrides[0].RuleID != stock.ID {
+		t.Fatalf("Expected the stored override, got %s", w.Body.String())
+	}
+	if w := do("DELETE", fmt.Sprintf("%s/%d", channelsPath, overrides[0].ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on delete, got %d", w.Code)
+	}
+	if w := do("DELETE", fmt.Sprintf("%s/%d", channelsPath, overrides[0].ID), ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 on second delete, got %d", w.Code)
+	}
+}
+
+func TestMarketCalendar(t *testing.T) {
+	router := setupTestRouter(t)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var cal struct {
+		Code     string
+		Timezone string
+		Sessions []calendar.Session
+		Holidays []struct {
+			Date time.Time
+			Name string
+		}
+	}
+	w := get("/markets/XNYS/calendar?from=2025-12-22&to=2025-12-29")
+	json.Unmarshal(w.Body.Bytes(), &cal)
+	if w.Code != http.StatusOK || cal.Code != "XNYS" || cal.Timezone != "America/New_York" {
+		t.Fatalf("Expected the NYSE calendar, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(cal.Sessions) != 4 || !cal.Sessions[2].EarlyClose {
+		t.Errorf("Expected 4 sessions with an early close on Christmas Eve, got %+v", cal.Sessions)
+	}
+	if len(cal.Holidays) != 1 || cal.Holidays[0].Name != "Christmas Day" {
+		t.Errorf("Expected Christmas Day, got %+v", cal.Holidays)
+	}
+
+	w = get("/markets/crypto/calendar?from=2025-12-22&to=2025-12-29")
+	json.Unmarshal(w.Body.Bytes(), &cal)
+	if w.Code != http.StatusOK || cal.Code != "CRYPTO" || len(cal.Sessions) != 7 || len(cal.Holidays) != 0 {
+		t.Errorf("Expected crypto to trade every day of Christmas week, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := get("/markets/XTKS/calendar"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown exchange, got %d", w.Code)
+	}
+	if w := get("/markets/XNYS/calendar?from=2025-12-29&to=2025-12-22"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a reversed range, got %d", w.Code)
+	}
+	if w := get("/markets/XNYS/calendar?from=christmas"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed date, got %d", w.Code)
+	}
+}
+
+// Test the symbol catalog endpoints and that unknown symbols cannot be watched
+// Test that symbols are not all reported unknown while the catalog is empty
+func TestEmptySymbolCatalog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewGormRepositories(dbtest.Open(t))
+	router := gin.Default()
+	RegisterRoutes(router, NewHandler(repos, &recordingPublisher{}, symbols.NewCatalog(repos.Symbols, nil)))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	portfolio := models.Portfolio{UserID: user.ID}
+	repos.Portfolios.Create(&portfolio)
+
+	w := do("POST", fmt.Sprintf("/portfolio/%d/stocks", portfolio.ID), `{"StockSymbol": "AAPL", "Threshold": 150}`)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "catalog is empty") {
+		t.Errorf("Expected 503 naming the empty catalog, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/symbols/AAPL", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for a lookup, got %d", w.Code)
+	}
+}
+
+func TestSymbolCatalog(t *testing.T) {
+	router, repos, publisher := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var results []models.Symbol
+	w := do("GET", "/symbols/search?q=microsoft", "")
+	json.Unmarshal(w.Body.Bytes(), &results)
+	if w.Code != http.StatusOK || len(results) == 0 || results[0].Symbol != "MSFT" {
+		t.Fatalf("Expected MSFT to match by name, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do("GET", "/symbols/search?q=a&limit=3", "")
+	json.Unmarshal(w.Body.Bytes(), &results)
+	if len(results) != 3 || results[0].Symbol[0] != 'A' {
+		t.Errorf("Expected 3 symbol prefix matches first, got %+v", results)
+	}
+	if w := do("GET", "/symbols/search", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without q, got %d", w.Code)
+	}
+	if w := do("GET", "/symbols/search?q=a&limit=500", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a limit over the cap, got %d", w.Code)
+	}
+
+	var entry models.Symbol
+	w = do("GET", "/symbols/nvda", "")
+	json.Unmarshal(w.Body.Bytes(), &entry)
+	if w.Code != http.StatusOK || entry.Exchange != "XNAS" || entry.Currency != "USD" {
+		t.Errorf("Expected NVDA's metadata, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/symbols/APPL", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown symbol, got %d", w.Code)
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	portfolio := models.Portfolio{UserID: user.ID, Name: "Main", Kind: models.KindPortfolio}
+	repos.Portfolios.Create(&portfolio)
+
+	w = do("POST", fmt.Sprintf("/portfolio/%d/stocks", portfolio.ID), `{"StockSymbol": "APPL", "ThresholdPrice": 150}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown symbol") {
+		t.Errorf("Expected APPL to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(publisher.changes) != 0 {
+		t.Errorf("Expected no rule change for a rejected symbol, got %+v", publisher.changes)
+	}
+
+	var stock models.Stock
+	w = do("POST", fmt.Sprintf("/portfolio/%d/stocks", portfolio.ID), `{"StockSymbol": "aapl", "ThresholdPrice": 150}`)
+	json.Unmarshal(w.Body.Bytes(), &stock)
+	if w.Code != http.StatusOK || stock.StockSymbol != "AAPL" {
+		t.Errorf("Expected the symbol to be stored uppercased, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Crypto and FX pairs are watched like stocks
+	w = do("POST", fmt.Sprintf("/portfolio/%d/stocks", portfolio.ID), `{"StockSymbol": "btcusd", "ThresholdPrice": 100000.5}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected BTCUSD to be watched, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do("GET", "/symbols/ETHEUR", "")
+	json.Unmarshal(w.Body.Bytes(), &entry)
+	if w.Code != http.StatusOK || entry.Type != models.InstrumentCrypto || entry.Exchange != "CRYPTO" || entry.Currency != "EUR" {
+		t.Errorf("Expected ETHEUR as a crypto pair, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// Test recording, importing, applying and removing corporate actions
+func TestCorporateActions(t *testing.T) {
+	router, repos, publisher := setupTestRouterWithRepos(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(&user)
+	portfolio := models.Portfolio{UserID: user.ID, Name: "Main", Kind: models.KindPortfolio}
+	repos.Portfolios.Create(&portfolio)
+	do("POST", fmt.Sprintf("/portfolio/%d/stocks", portfolio.ID), `{"StockSymbol": "AAPL", "ThresholdPrice": 200}`)
+	do("POST", fmt.Sprintf("/portfolio/%d/transactions", portfolio.ID),
+		`{"Type": "BUY", "Symbol": "AAPL", "Quantity": 10, "Price": 400, "TradeDate": "2020-07-01T00:00:00Z"}`)
+	publisher.changes = nil
+
+	csv := "type,symbol,new_symbol,ratio,effective_date\nSPLIT,AAPL,,4:1,2020-08-31\nRENAME,AAPL,APLE,,2099-01-02\n"
+	w := do("POST", "/corporate-actions/import", csv)
+	var result struct {
+		Created int
+		Skipped int
+		Applied []models.CorporateAction
+	}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Created != 2 || len(result.Applied) != 1 || result.Applied[0].Type != models.ActionSplit {
+		t.Fatalf("Expected 2 actions recorded and the split applied, got %d: %s", w.Code, w.Body.String())
+	}
+	splitID := result.Applied[0].ID
+	if stocks, _ := repos.Stocks.ListBySymbol("AAPL"); !stocks[0].ThresholdPrice.Equal(decimal.NewFromInt(50)) {
+		t.Errorf("Expected the threshold split-adjusted to 50, got %s", stocks[0].ThresholdPrice)
+	}
+	if positions, _ := repos.Positions.ListByPortfolio(portfolio.ID); len(positions) != 1 || !positions[0].Quantity.Equal(decimal.NewFromInt(40)) || !positions[0].AvgCost.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected 40 shares at 100, got %+v", positions)
+	}
+	if len(publisher.changes) != 1 || publisher.changes[0].Op != events.OpReload {
+		t.Errorf("Expected a reload to be published, got %+v", publisher.changes)
+	}
+
+	w = do("POST", "/corporate-actions/import", csv)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Created != 0 || result.Skipped != 2 {
+		t.Errorf("Expected a second import to skip both actions, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/corporate-actions", `{"Type": "SPLIT", "Symbol": "AAPL", "Ratio": 4, "EffectiveDate": "2020-08-31T00:00:00Z"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a recorded action, got %d", w.Code)
+	}
+	if w := do("POST", "/corporate-actions", `{"Type": "SPLIT", "Symbol": "AAPL", "Ratio": 1, "EffectiveDate": "2021-08-31T00:00:00Z"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a ratio of 1, got %d", w.Code)
+	}
+	if w := do("POST", "/corporate-actions/import", "type,symbol\nSPLIT,AAPL\n"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed file, got %d", w.Code)
+	}
+
+	var pending []models.CorporateAction
+	w = do("GET", "/corporate-actions?pending=true", "")
+	json.Unmarshal(w.Body.Bytes(), &pending)
+	if len(pending) != 1 || pending[0].NewSymbol != "APLE" {
+		t.Fatalf("Expected the rename pending, got %s", w.Body.String())
+	}
+	var listed []models.CorporateAction
+	w = do("GET", "/corporate-actions?symbol=aple", "")
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if len(listed) != 1 {
+		t.Errorf("Expected the rename listed under its new symbol, got %s", w.Body.String())
+	}
+
+	if w := do("DELETE", fmt.Sprintf("/corporate-actions/%d", pending[0].ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected the pending rename removed, got %d", w.Code)
+	}
+	if w := do("DELETE", fmt.Sprintf("/corporate-actions/%d", splitID), ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an applied action, got %d", w.Code)
+	}
+
+	var action models.CorporateAction
+	w = do("POST", "/corporate-actions", `{"Type": "RENAME", "Symbol": "AAPL", "NewSymbol": "APLE", "EffectiveDate": "2021-01-04T00:00:00Z"}`)
+	json.Unmarshal(w.Body.Bytes(), &action)
+	if w.Code != http.StatusOK || action.AppliedAt == nil {
+		t.Fatalf("Expected the past rename applied right away, got %d: %s", w.Code, w.Body.String())
+	}
+	if stocks, _ := repos.Stocks.ListBySymbol("APLE"); len(stocks) != 1 {
+		t.Errorf("Expected the stock renamed, got %+v", stocks)
+	}
+}
@@ -5,14 +5,20 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
+	"stock-alerts/events"
+
 	"github.com/segmentio/kafka-go"
+	"github.com/shopspring/decimal"
 )
 
 var kafkaWriter *kafka.Writer
+var ruleWriter *kafka.Writer
+var quarantineWriter *kafka.Writer
 
-// InitKafkaProducer sets up the Kafka writer
+// InitKafkaProducer sets up the Kafka writers
 func InitKafkaProducer() {
 	broker := os.Getenv("KAFKA_BROKER")
 	if broker == "" {
@@ -21,26 +27,91 @@ func InitKafkaProducer() {
 
 	kafkaWriter = &kafka.Writer{
 		Addr:     kafka.TCP(broker),
-		Topic:    "stock_prices",
+		Topic:    events.TopicStockPrices,
+		Balancer: &kafka.Hash{}, // keep the prices of one symbol in order
+	}
+
+	// Rule changes are published from API requests, which must not wait for
+	// a batch to fill or for the broker
+	ruleWriter = &kafka.Writer{
+		Addr:         kafka.TCP(broker),
+		Topic:        events.TopicRuleChanges,
+		Balancer:     &kafka.Hash{}, // keep the changes of one stock in order
+		BatchTimeout: ruleBatchTimeout,
+		Async:        true,
+		Completion:   ruleChangesWritten,
+	}
+
+	quarantineWriter = &kafka.Writer{
+		Addr:     kafka.TCP(broker),
+		Topic:    events.TopicQuarantine,
 		Balancer: &kafka.LeastBytes{},
 	}
 }
 
 // PublishStockPrice sends stock data to Kafka
-func PublishStockPrice(symbol string, price float64) {
-	event := map[string]any{
-		"symbol": symbol,
-		"price":  price,
-		"time":   time.Now(),
-	}
+func PublishStockPrice(symbol string, price decimal.Decimal) {
+	event := events.StockPrice{Symbol: symbol, Price: price, Time: time.Now()}
 	data, _ := json.Marshal(event)
 
 	err := kafkaWriter.WriteMessages(context.Background(),
-		kafka.Message{Value: data},
+		kafka.Message{Key: []byte(symbol), Value: data},
 	)
 	if err != nil {
 		log.Println("❌ Kafka write failed:", err)
 	} else {
-		log.Printf("✅ Published to Kafka: %s %.2f\n", symbol, price)
+		log.Printf("✅ Published to Kafka: %s %s\n", symbol, price)
+	}
+}
+
+// QuarantinePrice sends a price that failed a data quality check to the
+// quarantine topic instead of the stock prices topic
+func QuarantinePrice(price events.QuarantinedPrice) {
+	data, _ := json.Marshal(price)
+
+	err := quarantineWriter.WriteMessages(context.Background(),
+		kafka.Message{Key: []byte(price.Symbol), Value: data},
+	)
+	if err != nil {
+		log.Println("❌ Kafka quarantine write failed:", err)
+	}
+}
+
+// ruleBatchTimeout bounds how long a rule change waits for others to share
+// its batch
+const ruleBatchTimeout = 5 * time.Millisecond
+
+// PublishRuleChange announces an alert rule change to the consumers. The write
+// happens in the background; ruleChangesWritten logs its outcome.
+func PublishRuleChange(change events.RuleChange) {
+	data, _ := json.Marshal(change)
+
+	err := ruleWriter.WriteMessages(context.Background(),
+		kafka.Message{Key: []byte(strconv.FormatUint(uint64(change.StockID), 10)), Value: data},
+	)
+	if err != nil {
+		log.Println("❌ Kafka rule change write failed:", err)
+	}
+}
+
+// ruleChangesWritten logs the outcome of a background rule change write
+func ruleChangesWritten(messages []kafka.Message, err error) {
+	if err != nil {
+		log.Printf("❌ Kafka rule change write failed for %d changes: %v\n", len(messages), err)
+		return
+	}
+	for _, m := range messages {
+		var change events.RuleChange
+		if json.Unmarshal(m.Value, &change) == nil {
+			log.Printf("✅ Published rule change: %s stock %d (%s)\n", change.Op, change.StockID, change.Symbol)
+		}
 	}
 }
+
+// RulePublisher publishes rule changes through the Kafka producer
+type RulePublisher struct{}
+
+// PublishRuleChange implements routes.RulePublisher
+func (RulePublisher) PublishRuleChange(change events.RuleChange) {
+	PublishRuleChange(change)
+}
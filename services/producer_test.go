@@ -5,6 +5,8 @@ import (
 	"os"
 	"testing"
 	"time"
+
+	"stock-alerts/events"
 )
 
 func TestInitKafkaProducer(t *testing.T) {
@@ -31,6 +33,23 @@ func TestInitKafkaProducerWithoutEnv(t *testing.T) {
 	}
 }
 
+func TestPublishRuleChangeDoesNotBlock(t *testing.T) {
+	// Nothing listens on this port, so a synchronous write would wait for the dial to fail
+	os.Setenv("KAFKA_BROKER", "127.0.0.1:1")
+	defer os.Unsetenv("KAFKA_BROKER")
+	InitKafkaProducer()
+	defer ruleWriter.Close()
+
+	if !ruleWriter.Async || ruleWriter.BatchTimeout != ruleBatchTimeout {
+		t.Errorf("Expected an async rule writer with a short batch timeout, got %+v", ruleWriter)
+	}
+	start := time.Now()
+	PublishRuleChange(events.RuleChange{Op: events.OpReload})
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected the publish to return at once, took %v", elapsed)
+	}
+}
+
 func TestStockEventSerialization(t *testing.T) {
 	// Test the data structure that PublishStockPrice creates
 	symbol := "AAPL"
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"stock-alerts/calendar"
+	"stock-alerts/events"
+	"stock-alerts/indicators"
+)
+
+// Spike detection settings
+const (
+	qualityWindow      = 30   // accepted prices of a symbol its volatility is measured over
+	qualityMinReturns  = 10   // price changes needed before spikes are looked for
+	spikeFloor         = 0.02 // moves within 2% are never spikes, however calm the symbol
+	spikeConfirmations = 3    // spikes in a row at one level that make it the symbol's new level
+	stalePolls         = 5    // polls in a row a day-dated quote may repeat before it is stale
+)
+
+// QualityConfig tunes the data quality checks on fetched prices
+type QualityConfig struct {
+	// SpikeSigma is how many standard deviations of a symbol's recent price
+	// changes a move may span before it is a spike
+	SpikeSigma float64
+}
+
+// QualityConfigFromEnv reads PRICE_SPIKE_SIGMA, 6 by default
+func QualityConfigFromEnv() QualityConfig {
+	cfg := QualityConfig{SpikeSigma: 6}
+	if v := os.Getenv("PRICE_SPIKE_SIGMA"); v != "" {
+		if sigma, err := strconv.ParseFloat(v, 64); err == nil && sigma > 0 {
+			cfg.SpikeSigma = sigma
+		} else {
+			log.Printf("⚠️  Ignoring invalid PRICE_SPIKE_SIGMA %q\n", v)
+		}
+	}
+	return cfg
+}
+
+// priceQuality counts the fetched quotes by outcome: "accepted" or the
+// quarantine reason. The API serves it at /debug/vars.
+var priceQuality = expvar.NewMap("price_quality")
+
+// PriceValidator checks quotes before they are published. It rejects prices
+// that are zero or negative, stale quotes, and spikes: moves beyond
+// SpikeSigma standard deviations of the symbol's recent log returns. A move
+// that holds for spikeConfirmations quotes in a row is taken as the symbol's
+// new level and accepted. It is not safe for concurrent use.
+//
+// A quote with a refresh time is stale when the provider has not refreshed it
+// since the last one. Equity quotes only carry their trading day, and a price
+// may rightly not move between polls, so they are stale once they repeat for
+// stalePolls polls, or when they are of an earlier day than the session open
+// at the poll.
+type PriceValidator struct {
+	cfg     QualityConfig
+	symbols map[string]*quoteHistory
+}
+
+// quoteHistory is what the validator knows of a symbol
+type quoteHistory struct {
+	prices  *indicators.Window // accepted prices, oldest first
+	last    Quote              // the last accepted quote
+	repeats int                // polls in a row the last quote came again
+	suspect []float64          // the spikes in a row, oldest first
+}
+
+// NewPriceValidator returns a validator with no history
+func NewPriceValidator(cfg QualityConfig) *PriceValidator {
+	return &PriceValidator{cfg: cfg, symbols: map[string]*quoteHistory{}}
+}
+
+// Check returns why a symbol's quote polled at now should be quarantined, one
+// of the events.Quarantine reasons with a detail, or "" when it passes
+func (v *PriceValidator) Check(symbol string, q Quote, now time.Time) (reason, detail string) {
+	if !q.Price.IsPositive() {
+		return events.QuarantineNonPositive, fmt.Sprintf("price %s", q.Price)
+	}
+	h, ok := v.symbols[symbol]
+	if !ok {
+		h = &quoteHistory{prices: indicators.NewWindow(qualityWindow)}
+		v.symbols[symbol] = h
+	}
+	if detail := h.stale(symbol, q, now); detail != "" {
+		return events.QuarantineStale, detail
+	}
+
+	price := q.Price.InexactFloat64()
+	if prices := h.prices.Prices(); len(prices) > qualityMinReturns {
+		limit := math.Max(v.cfg.SpikeSigma*volatility(prices), spikeFloor)
+		move := math.Log(price / prices[len(prices)-1])
+		if math.Abs(move) > limit {
+			if n := len(h.suspect); n > 0 && math.Abs(math.Log(price/h.suspect[n-1])) > limit {
+				h.suspect = nil // not the level of the previous spike
+			}
+			h.suspect = append(h.suspect, price)
+			if len(h.suspect) < spikeConfirmations {
+				return events.QuarantineSpike, fmt.Sprintf("%+.1f%% move, limit %.1f%%", move*100, limit*100)
+			}
+			// The level held, so the history before it no longer applies
+			h.prices = indicators.NewWindow(qualityWindow)
+			for _, p := range h.suspect[:len(h.suspect)-1] {
+				h.prices.Push(p)
+			}
+		}
+	}
+	h.suspect = nil
+	h.prices.Push(price)
+	h.last = q
+	return "", ""
+}
+
+// stale describes why q is stale, or returns "" when it is fresh
+func (h *quoteHistory) stale(symbol string, q Quote, now time.Time) string {
+	if q.Time.IsZero() {
+		return ""
+	}
+	if !q.Daily {
+		if q.Time.After(h.last.Time) {
+			return ""
+		}
+		return fmt.Sprintf("not refreshed since %s", h.last.Time.Format("2006-01-02 15:04:05"))
+	}
+
+	exchange := calendar.ForSymbol(symbol)
+	if session := exchange.TradingDate(now); exchange.IsOpen(now) && q.Time.Before(session) {
+		return fmt.Sprintf("quote of %s during the session of %s", q.Time.Format("2006-01-02"), session.Format("2006-01-02"))
+	}
+	if !q.Time.Equal(h.last.Time) || !q.Price.Equal(h.last.Price) {
+		h.repeats = 0
+		return ""
+	}
+	if h.repeats++; h.repeats < stalePolls {
+		return ""
+	}
+	return fmt.Sprintf("unchanged for %d polls", h.repeats)
+}
+
+// volatility is the standard deviation of the log returns of prices
+func volatility(prices []float64) float64 {
+	returns := make([]float64, 0, len(prices)-1)
+	mean := 0.0
+	for i := 1; i < len(prices); i++ {
+		r := math.Log(prices[i] / prices[i-1])
+		returns = append(returns, r)
+		mean += r
+	}
+	mean /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	return math.Sqrt(variance / float64(len(returns)))
+}
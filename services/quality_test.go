@@ -0,0 +1,133 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"stock-alerts/events"
+
+	"github.com/shopspring/decimal"
+)
+
+// feed passes prices alternating between 100 and 101 to the validator,
+// each with a newer time
+func feed(v *PriceValidator, symbol string, n int, at time.Time) time.Time {
+	for i := 0; i < n; i++ {
+		at = at.Add(time.Minute)
+		v.Check(symbol, Quote{Price: decimal.NewFromInt(int64(100 + i%2)), Time: at}, at)
+	}
+	return at
+}
+
+func TestValidatorRejectsNonPositivePrices(t *testing.T) {
+	v := NewPriceValidator(QualityConfig{SpikeSigma: 6})
+	for _, price := range []string{"0", "-1.5"} {
+		if reason, _ := v.Check("AAPL", Quote{Price: decimal.RequireFromString(price)}, time.Now()); reason != events.QuarantineNonPositive {
+			t.Errorf("Expected %s to be rejected, got %q", price, reason)
+		}
+	}
+	if reason, _ := v.Check("AAPL", Quote{Price: decimal.RequireFromString("0.0001")}, time.Now()); reason != "" {
+		t.Errorf("Expected a tiny positive price to pass, got %q", reason)
+	}
+}
+
+// Test that a rate is stale when it was not refreshed since the last one
+func TestValidatorDetectsStaleRates(t *testing.T) {
+	v := NewPriceValidator(QualityConfig{SpikeSigma: 6})
+	at := time.Date(2025, 3, 3, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		quote Quote
+		want  string
+	}{
+		{"first quote", Quote{Price: decimal.NewFromInt(100), Time: at}, ""},
+		{"same refresh", Quote{Price: decimal.NewFromInt(100), Time: at}, events.QuarantineStale},
+		{"new refresh at the same price", Quote{Price: decimal.NewFromInt(100), Time: at.Add(time.Minute)}, ""},
+		{"older refresh", Quote{Price: decimal.NewFromInt(101), Time: at}, events.QuarantineStale},
+		{"undated", Quote{Price: decimal.NewFromInt(101)}, ""},
+	}
+	for _, tt := range tests {
+		if reason, _ := v.Check("USDEUR", tt.quote, at.Add(2*time.Minute)); reason != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, reason)
+		}
+	}
+}
+
+// Test that an equity quote, dated by its trading day only, is stale after
+// repeating for stalePolls polls or when it is of an earlier session
+func TestValidatorDetectsStaleDailyQuotes(t *testing.T) {
+	v := NewPriceValidator(QualityConfig{SpikeSigma: 6})
+	day := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	open := day.Add(15 * time.Hour) // 10:00 in New York
+	quote := func(price int64, day time.Time) Quote {
+		return Quote{Price: decimal.NewFromInt(price), Time: day, Daily: true}
+	}
+
+	for i := 0; i < stalePolls; i++ {
+		if reason, _ := v.Check("AAPL", quote(100, day), open.Add(time.Duration(i)*time.Minute)); reason != "" {
+			t.Fatalf("Poll %d: expected an unchanged price to pass, got %q", i+1, reason)
+		}
+	}
+	if reason, detail := v.Check("AAPL", quote(100, day), open.Add(time.Hour)); reason != events.QuarantineStale {
+		t.Errorf("Expected the quote to be stale after %d repeats, got %q (%s)", stalePolls, reason, detail)
+	}
+	if reason, _ := v.Check("AAPL", quote(101, day), open.Add(time.Hour)); reason != "" {
+		t.Errorf("Expected a new price to pass, got %q", reason)
+	}
+
+	// The next day, yesterday's quote is stale once the session opens
+	if reason, _ := v.Check("AAPL", quote(102, day), open.Add(13*time.Hour)); reason != "" {
+		t.Errorf("Expected the last session's quote to pass overnight, got %q", reason)
+	}
+	if reason, _ := v.Check("AAPL", quote(102, day), open.AddDate(0, 0, 1)); reason != events.QuarantineStale {
+		t.Errorf("Expected the last session's quote to be stale in the next one, got %q", reason)
+	}
+	if reason, _ := v.Check("AAPL", quote(102, day.AddDate(0, 0, 1)), open.AddDate(0, 0, 1)); reason != "" {
+		t.Errorf("Expected the new session's quote to pass, got %q", reason)
+	}
+}
+
+func TestValidatorFlagsSpikes(t *testing.T) {
+	v := NewPriceValidator(QualityConfig{SpikeSigma: 6})
+	at := time.Date(2025, 3, 3, 15, 0, 0, 0, time.UTC)
+
+	// Without history even a 100x move passes
+	if reason, _ := v.Check("NEW", Quote{Price: decimal.NewFromInt(1), Time: at}, at); reason != "" {
+		t.Errorf("Expected the first quote to pass, got %q", reason)
+	}
+	if reason, _ := v.Check("NEW", Quote{Price: decimal.NewFromInt(100), Time: at.Add(time.Minute)}, at.Add(time.Minute)); reason != "" {
+		t.Errorf("Expected a move without history to pass, got %q", reason)
+	}
+
+	// Prices swinging by 1% allow moves up to 6 sigma, about 6%
+	at = feed(v, "AAPL", 20, at)
+	if reason, _ := v.Check("AAPL", Quote{Price: decimal.NewFromInt(105), Time: at.Add(time.Minute)}, at.Add(time.Minute)); reason != "" {
+		t.Errorf("Expected a 4%% move to pass, got %q", reason)
+	}
+	at = feed(v, "AAPL", 20, at.Add(time.Minute))
+	reason, detail := v.Check("AAPL", Quote{Price: decimal.NewFromInt(10000), Time: at.Add(time.Minute)}, at.Add(time.Minute))
+	if reason != events.QuarantineSpike || detail == "" {
+		t.Errorf("Expected a 100x move to be a spike, got %q (%s)", reason, detail)
+	}
+	// The spike is not the last price, so the next normal price passes
+	if reason, _ := v.Check("AAPL", Quote{Price: decimal.NewFromInt(100), Time: at.Add(2 * time.Minute)}, at.Add(2*time.Minute)); reason != "" {
+		t.Errorf("Expected prices back at the usual level to pass, got %q", reason)
+	}
+}
+
+// Test that a move holding for three quotes becomes the new level
+func TestValidatorAcceptsAConfirmedLevel(t *testing.T) {
+	v := NewPriceValidator(QualityConfig{SpikeSigma: 6})
+	at := feed(v, "AAPL", 20, time.Date(2025, 3, 3, 15, 0, 0, 0, time.UTC))
+
+	for i, want := range []string{events.QuarantineSpike, events.QuarantineSpike, ""} {
+		at = at.Add(time.Minute)
+		if reason, _ := v.Check("AAPL", Quote{Price: decimal.NewFromInt(int64(70 + i%2)), Time: at}, at); reason != want {
+			t.Errorf("Quote %d after the drop: expected %q, got %q", i+1, want, reason)
+		}
+	}
+	if reason, _ := v.Check("AAPL", Quote{Price: decimal.NewFromInt(70), Time: at.Add(time.Minute)}, at.Add(time.Minute)); reason != "" {
+		t.Errorf("Expected prices at the new level to pass, got %q", reason)
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"stock-alerts/fx"
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// Quote is a provider's price with the time the provider gives for it: the
+// latest trading day of an equity, the last refresh of a rate. Time is zero
+// when the provider gives none.
+type Quote struct {
+	Price decimal.Decimal
+	Time  time.Time
+	Daily bool // Time is only the trading day, not when the price was refreshed
+}
+
+// Quoter fetches the latest price of a symbol from a price provider
+type Quoter interface {
+	Quote(symbol string) (Quote, error)
+}
+
+// QuoteFunc adapts a function to a Quoter
+type QuoteFunc func(symbol string) (Quote, error)
+
+// Quote calls f
+func (f QuoteFunc) Quote(symbol string) (Quote, error) {
+	return f(symbol)
+}
+
+// Quoters are the provider adapters by instrument type
+type Quoters map[models.InstrumentType]Quoter
+
+// DefaultQuoters fetch equities and ETFs with Alpha Vantage's GLOBAL_QUOTE,
+// and FX and crypto pairs with its CURRENCY_EXCHANGE_RATE
+func DefaultQuoters() Quoters {
+	pairs := QuoteFunc(FetchPairRate)
+	return Quoters{
+		models.InstrumentEquity: QuoteFunc(FetchPrice),
+		models.InstrumentETF:    QuoteFunc(FetchPrice),
+		models.InstrumentFX:     pairs,
+		models.InstrumentCrypto: pairs,
+	}
+}
+
+// Quote fetches a symbol's price with the adapter of its type; types without
+// one of their own are priced as equities
+func (q Quoters) Quote(symbol string, typ models.InstrumentType) (Quote, error) {
+	quoter, ok := q[typ]
+	if !ok {
+		quoter, ok = q[models.InstrumentEquity]
+	}
+	if !ok {
+		return Quote{}, fmt.Errorf("no price provider for %s (%s)", symbol, typ)
+	}
+	return quoter.Quote(symbol)
+}
+
+// FetchPairRate fetches the rate of a pair symbol: the last three letters
+// are the quote currency and the rest the currency or coin priced in it
+func FetchPairRate(symbol string) (Quote, error) {
+	if len(symbol) < 6 || !fx.Valid(symbol[len(symbol)-3:]) {
+		return Quote{}, fmt.Errorf("%s is not a currency pair", symbol)
+	}
+	return FetchFXRate(symbol[:len(symbol)-3], symbol[len(symbol)-3:])
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"stock-alerts/instruments"
+	"stock-alerts/models"
+)
+
+func TestDefaultQuotersPickTheProviderFunction(t *testing.T) {
+	rates := map[string]string{"DOGEUSD": "0.2143", "EURGBP": "0.8512"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch q.Get("function") {
+		case "GLOBAL_QUOTE":
+			w.Write([]byte(`{"Global Quote": {"01. symbol": "` + q.Get("symbol") + `", "05. price": "187.4400", "07. latest trading day": "2025-03-03"}}`))
+		case "CURRENCY_EXCHANGE_RATE":
+			w.Write([]byte(`{"Realtime Currency Exchange Rate": {"5. Exchange Rate": "` + rates[q.Get("from_currency")+q.Get("to_currency")] +
+				`", "6. Last Refreshed": "2025-03-03 15:04:05", "7. Time Zone": "UTC"}}`))
+		}
+	}))
+	defer server.Close()
+	t.Setenv("ALPHA_VANTAGE_API_KEY", "test")
+	defer func(url string) { alphaVantageURL = url }(alphaVantageURL)
+	alphaVantageURL = server.URL
+
+	quotes := DefaultQuoters()
+	quote, err := quotes.Quote("AAPL", instruments.Classify("AAPL"))
+	if err != nil || quote.Price.String() != "187.44" || !quote.Time.Equal(time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected AAPL's global quote of its latest trading day, got %+v (%v)", quote, err)
+	}
+	for symbol, rate := range rates {
+		quote, err := quotes.Quote(symbol, instruments.Classify(symbol))
+		if err != nil || quote.Price.String() != rate || !quote.Time.Equal(time.Date(2025, 3, 3, 15, 4, 5, 0, time.UTC)) {
+			t.Errorf("Expected %s to be fetched as an exchange rate of %s, got %+v (%v)", symbol, rate, quote, err)
+		}
+	}
+	if _, err := quotes.Quote("AAPL", models.InstrumentFX); err == nil {
+		t.Errorf("Expected AAPL not to be fetched as a currency pair")
+	}
+}
@@ -7,39 +7,52 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"stock-alerts/db"
+	"sort"
+	"stock-alerts/alerting"
+	"stock-alerts/calendar"
+	"stock-alerts/events"
+	"stock-alerts/fx"
+	"stock-alerts/instruments"
 	"stock-alerts/models"
-	"strconv"
+	"stock-alerts/repository"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
+// alphaVantageURL is the Alpha Vantage API the prices are fetched from
+var alphaVantageURL = "https://www.alphavantage.co/query"
+
 type GlobalQuote struct {
-	Symbol string `json:"01. symbol"`
-	Price  string `json:"05. price"`
+	Symbol           string `json:"01. symbol"`
+	Price            string `json:"05. price"`
+	LatestTradingDay string `json:"07. latest trading day"`
 }
 
 type ApiResponse struct {
 	Quote GlobalQuote `json:"Global Quote"`
 }
 
-// FetchPrice calls Alpha Vantage API
-func FetchPrice(symbol string) (float64, error) {
+// FetchPrice calls Alpha Vantage API. The quote is parsed as the decimal it
+// is written as, never going through float64, and dated by its latest
+// trading day.
+func FetchPrice(symbol string) (Quote, error) {
 	apiKey := os.Getenv("ALPHA_VANTAGE_API_KEY")
 	if apiKey == "" {
-		return 0, fmt.Errorf("ALPHA_VANTAGE_API_KEY environment variable not set")
+		return Quote{}, fmt.Errorf("ALPHA_VANTAGE_API_KEY environment variable not set")
 	}
 
-	url := fmt.Sprintf("https://www.alphavantage.co/query?function=GLOBAL_QUOTE&symbol=%s&apikey=%s", symbol, apiKey)
+	url := fmt.Sprintf("%s?function=GLOBAL_QUOTE&symbol=%s&apikey=%s", alphaVantageURL, symbol, apiKey)
 
 	resp, err := http.Get(url)
 	if err != nil {
-		return 0, err
+		return Quote{}, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, err
+		return Quote{}, err
 	}
 
 	// Debug: print the API response
@@ -47,59 +60,266 @@ func FetchPrice(symbol string) (float64, error) {
 
 	var result ApiResponse
 	if err := json.Unmarshal(body, &result); err != nil {
-		return 0, fmt.Errorf("failed to unmarshal response: %v", err)
+		return Quote{}, fmt.Errorf("failed to unmarshal response: %v", err)
 	}
 
 	// Check if price is empty
 	if result.Quote.Price == "" {
-		return 0, fmt.Errorf("empty price returned for symbol %s - check if symbol is valid or API limit reached", symbol)
+		return Quote{}, fmt.Errorf("empty price returned for symbol %s - check if symbol is valid or API limit reached", symbol)
+	}
+
+	price, err := decimal.NewFromString(result.Quote.Price)
+	if err != nil {
+		return Quote{}, fmt.Errorf("failed to parse price '%s': %v", result.Quote.Price, err)
+	}
+	day, _ := time.Parse("2006-01-02", result.Quote.LatestTradingDay)
+	return Quote{Price: price, Time: day, Daily: true}, nil
+}
+
+type ExchangeRate struct {
+	From          string `json:"1. From_Currency Code"`
+	To            string `json:"3. To_Currency Code"`
+	Rate          string `json:"5. Exchange Rate"`
+	LastRefreshed string `json:"6. Last Refreshed"`
+	TimeZone      string `json:"7. Time Zone"`
+}
+
+type ExchangeRateResponse struct {
+	Rate ExchangeRate `json:"Realtime Currency Exchange Rate"`
+}
+
+// FetchFXRate calls Alpha Vantage for the price of one unit of from in to,
+// where either may be a physical or a digital currency
+func FetchFXRate(from, to string) (Quote, error) {
+	apiKey := os.Getenv("ALPHA_VANTAGE_API_KEY")
+	if apiKey == "" {
+		return Quote{}, fmt.Errorf("ALPHA_VANTAGE_API_KEY environment variable not set")
+	}
+
+	url := fmt.Sprintf("%s?function=CURRENCY_EXCHANGE_RATE&from_currency=%s&to_currency=%s&apikey=%s", alphaVantageURL, from, to, apiKey)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return Quote{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Quote{}, err
 	}
 
-	price, err := strconv.ParseFloat(result.Quote.Price, 64)
+	var result ExchangeRateResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return Quote{}, fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+	if result.Rate.Rate == "" {
+		return Quote{}, fmt.Errorf("empty rate returned for %s/%s - check the currencies or API limit", from, to)
+	}
+
+	rate, err := decimal.NewFromString(result.Rate.Rate)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse price '%s': %v", result.Quote.Price, err)
+		return Quote{}, fmt.Errorf("failed to parse rate '%s': %v", result.Rate.Rate, err)
 	}
-	return price, nil
+	loc, err := time.LoadLocation(result.Rate.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	refreshed, _ := time.ParseInLocation("2006-01-02 15:04:05", result.Rate.LastRefreshed, loc)
+	return Quote{Price: rate, Time: refreshed}, nil
+}
+
+// Fetcher polls prices for every watched stock while its exchange trades
+type Fetcher struct {
+	quotes     Quoters
+	quality    *PriceValidator
+	quarantine func(events.QuarantinedPrice)
+	publish    func(symbol string, price decimal.Decimal)
+	stocks     repository.StockRepo
+	portfolios repository.PortfolioRepo
+	alerts     repository.AlertRepo
+	positions  repository.PositionRepo
+	users      repository.UserRepo
+	alwaysOpen bool            // FETCH_OUTSIDE_SESSIONS=true ignores the market calendar
+	closed     map[string]bool // exchanges last seen closed, to log each change once
 }
 
-// StartFetcher runs a background loop
-func StartFetcher() {
+// NewFetcher wires the fetcher to its repositories
+func NewFetcher(repos repository.Repositories) *Fetcher {
+	return &Fetcher{
+		quotes:     DefaultQuoters(),
+		quality:    NewPriceValidator(QualityConfigFromEnv()),
+		quarantine: QuarantinePrice,
+		publish:    PublishStockPrice,
+		stocks:     repos.Stocks,
+		portfolios: repos.Portfolios,
+		alerts:     repos.Alerts,
+		positions:  repos.Positions,
+		users:      repos.Users,
+		alwaysOpen: os.Getenv("FETCH_OUTSIDE_SESSIONS") == "true",
+		closed:     map[string]bool{},
+	}
+}
+
+// Start runs a background loop
+func (f *Fetcher) Start() {
 	ticker := time.NewTicker(60 * time.Second) // every 1 min
 	go func() {
 		for {
 			<-ticker.C
-			checkStocks()
+			now := time.Now()
+			f.checkStocks(now)
+			f.checkRates(now)
 		}
 	}()
 }
 
-func checkStocks() {
-	var stocks []models.Stock
-	db.DB.Find(&stocks)
+func (f *Fetcher) checkStocks(now time.Time) {
+	stocks, err := f.stocks.List()
+	if err != nil {
+		log.Println("Error loading stocks:", err)
+		return
+	}
 
-	for _, stock := range stocks {
-		price, err := FetchPrice(stock.StockSymbol)
-		if err != nil {
-			log.Println("Error fetching price:", err)
+	// A symbol watched by several users is fetched and checked once a round
+	quotes := map[string]*Quote{}
+	for _, stock := range f.trading(stocks, now) {
+		quote, seen := quotes[stock.StockSymbol]
+		if !seen {
+			quote = f.quote(stock.StockSymbol, instruments.Classify(stock.StockSymbol), now)
+			quotes[stock.StockSymbol] = quote
+		}
+		if quote == nil {
 			continue
 		}
+		price := quote.Price
 
-		if price >= stock.ThresholdPrice {
+		if alerting.ThresholdReached(price, stock.ThresholdPrice) {
 			alert := models.Alert{
-				UserID:      getUserIDFromPortfolio(stock.PortfolioID),
+				UserID:      f.getUserIDFromPortfolio(stock.PortfolioID),
 				StockSymbol: stock.StockSymbol,
 				Price:       price,
 				Timestamp:   time.Now(),
 			}
-			db.DB.Create(&alert)
-			PublishStockPrice(stock.StockSymbol, price)
-			log.Printf("🚨 Alert created for %s at price %.2f\n", stock.StockSymbol, price)
+			if err := f.alerts.Create(&alert); err != nil {
+				log.Printf("❌ Failed to store alert for %s: %v\n", stock.StockSymbol, err)
+			}
+			f.publish(stock.StockSymbol, price)
+			log.Printf("🚨 Alert created for %s at price %s\n", stock.StockSymbol, price.StringFixed(2))
+		}
+	}
+}
+
+// checkRates publishes the FX rates that value the held positions in their
+// owners' base currencies. They go through the same pipeline as prices, the
+// pair symbol (e.g. GBPUSD) standing in for a ticker.
+func (f *Fetcher) checkRates(now time.Time) {
+	pairs, err := f.fxPairs(now)
+	if err != nil {
+		log.Println("Error loading FX pairs:", err)
+		return
+	}
+	for _, pair := range pairs {
+		if rate := f.quote(pair, models.InstrumentFX, now); rate != nil {
+			f.publish(pair, rate.Price)
 		}
 	}
 }
 
-func getUserIDFromPortfolio(portfolioID uint) uint {
-	var portfolio models.Portfolio
-	db.DB.First(&portfolio, portfolioID)
+// quote fetches a symbol's quote and runs it through the data quality
+// checks. It returns nil when the fetch fails or the quote is quarantined.
+func (f *Fetcher) quote(symbol string, typ models.InstrumentType, now time.Time) *Quote {
+	quote, err := f.quotes.Quote(symbol, typ)
+	if err != nil {
+		log.Println("Error fetching price:", err)
+		return nil
+	}
+	reason, detail := f.quality.Check(symbol, quote, now)
+	if reason == "" {
+		priceQuality.Add("accepted", 1)
+		return &quote
+	}
+	priceQuality.Add(reason, 1)
+	log.Printf("🧪 Quarantined %s at %s: %s (%s)\n", symbol, quote.Price, reason, detail)
+	f.quarantine(events.QuarantinedPrice{
+		StockPrice: events.StockPrice{Symbol: symbol, Price: quote.Price, Time: time.Now()},
+		Reason:     reason,
+		Detail:     detail,
+		QuoteTime:  quote.Time,
+	})
+	return nil
+}
+
+// fxPairs lists the pairs from the currencies of the positions whose exchange
+// trades at now to their owners' base currencies, sorted
+func (f *Fetcher) fxPairs(now time.Time) ([]string, error) {
+	positions, err := f.positions.List()
+	if err != nil {
+		return nil, err
+	}
+	bases := map[uint]string{} // by portfolio
+	seen := map[string]bool{}
+	for _, position := range positions {
+		if !f.alwaysOpen && !calendar.ForSymbol(position.Symbol).IsOpen(now) {
+			continue
+		}
+		base, ok := bases[position.PortfolioID]
+		if !ok {
+			base = f.baseCurrency(position.PortfolioID)
+			bases[position.PortfolioID] = base
+		}
+		for _, pair := range fx.Pairs([]string{position.Currency}, base) {
+			seen[pair] = true
+		}
+	}
+	pairs := make([]string, 0, len(seen))
+	for pair := range seen {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return pairs, nil
+}
+
+// baseCurrency is the base currency of a portfolio's owner
+func (f *Fetcher) baseCurrency(portfolioID uint) string {
+	user, err := f.users.FindByID(f.getUserIDFromPortfolio(portfolioID))
+	if err != nil {
+		return models.DefaultCurrency
+	}
+	return user.Base()
+}
+
+// trading keeps the stocks whose exchange is in session at now. Quotes do
+// not move outside sessions, so fetching them would only burn API quota.
+func (f *Fetcher) trading(stocks []models.Stock, now time.Time) []models.Stock {
+	if f.alwaysOpen {
+		return stocks
+	}
+	open := []models.Stock{}
+	exchanges := map[string]*calendar.Exchange{}
+	for _, stock := range stocks {
+		exchange := calendar.ForSymbol(stock.StockSymbol)
+		exchanges[exchange.Code] = exchange
+		if exchange.IsOpen(now) {
+			open = append(open, stock)
+		}
+	}
+	for code, exchange := range exchanges {
+		closed := !exchange.IsOpen(now)
+		if closed && !f.closed[code] {
+			log.Printf("💤 %s is closed, pausing its stocks until %s\n", code, exchange.NextOpen(now).Format(time.RFC3339))
+		} else if !closed && f.closed[code] {
+			log.Printf("🔔 %s is open, fetching its stocks\n", code)
+		}
+		f.closed[code] = closed
+	}
+	return open
+}
+
+func (f *Fetcher) getUserIDFromPortfolio(portfolioID uint) uint {
+	portfolio, err := f.portfolios.FindByID(portfolioID)
+	if err != nil {
+		return 0
+	}
 	return portfolio.UserID
 }
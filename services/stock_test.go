@@ -0,0 +1,184 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"stock-alerts/events"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestFetcherPausesOutsideSessions(t *testing.T) {
+	f := NewFetcher(repository.NewMemoryRepositories())
+	stocks := []models.Stock{{StockSymbol: "AAPL"}, {StockSymbol: "TSCO.LON"}}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want []string
+	}{
+		// 15:00 UTC is 10:00 in New York and 15:00 in London
+		{"both open", time.Date(2025, 3, 3, 15, 0, 0, 0, time.UTC), []string{"AAPL", "TSCO.LON"}},
+		// 17:00 UTC: London has closed at 16:30
+		{"London closed", time.Date(2025, 3, 3, 17, 0, 0, 0, time.UTC), []string{"AAPL"}},
+		{"weekend", time.Date(2025, 3, 8, 15, 0, 0, 0, time.UTC), []string{}},
+		{"US holiday", time.Date(2025, 7, 4, 15, 0, 0, 0, time.UTC), []string{"TSCO.LON"}},
+	}
+	for _, tt := range tests {
+		got := f.trading(stocks, tt.at)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected %v, got %+v", tt.name, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i].StockSymbol != tt.want[i] {
+				t.Errorf("%s: expected %v, got %+v", tt.name, tt.want, got)
+			}
+		}
+	}
+
+	f.alwaysOpen = true
+	if got := f.trading(stocks, time.Date(2025, 3, 8, 15, 0, 0, 0, time.UTC)); len(got) != 2 {
+		t.Errorf("Expected FETCH_OUTSIDE_SESSIONS to fetch everything, got %+v", got)
+	}
+}
+
+func TestFetcherFXPairs(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	f := NewFetcher(repos)
+
+	jane := models.User{Name: "Jane", Email: "jane@example.com", BaseCurrency: "EUR"}
+	repos.Users.Create(&jane)
+	john := models.User{Name: "John", Email: "john@example.com"}
+	repos.Users.Create(&john)
+	janes := models.Portfolio{UserID: jane.ID}
+	repos.Portfolios.Create(&janes)
+	johns := models.Portfolio{UserID: john.ID}
+	repos.Portfolios.Create(&johns)
+	repos.Positions.Upsert(&models.Position{PortfolioID: janes.ID, Symbol: "AAPL", Quantity: decimal.NewFromInt(1), Currency: "USD"})
+	repos.Positions.Upsert(&models.Position{PortfolioID: janes.ID, Symbol: "TSCO.LON", Quantity: decimal.NewFromInt(1), Currency: "GBX"})
+	repos.Positions.Upsert(&models.Position{PortfolioID: johns.ID, Symbol: "TSCO.LON", Quantity: decimal.NewFromInt(1), Currency: "GBX"})
+	repos.Positions.Upsert(&models.Position{PortfolioID: johns.ID, Symbol: "MSFT", Quantity: decimal.NewFromInt(1), Currency: "USD"})
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{"both open", time.Date(2025, 3, 3, 15, 0, 0, 0, time.UTC), "GBPEUR GBPUSD USDEUR"},
+		{"London closed", time.Date(2025, 3, 3, 17, 0, 0, 0, time.UTC), "USDEUR"},
+		{"weekend", time.Date(2025, 3, 8, 15, 0, 0, 0, time.UTC), ""},
+	}
+	for _, tt := range tests {
+		pairs, err := f.fxPairs(tt.at)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := strings.Join(pairs, " "); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestFetcherFollowsPairCalendars(t *testing.T) {
+	f := NewFetcher(repository.NewMemoryRepositories())
+	stocks := []models.Stock{{StockSymbol: "AAPL"}, {StockSymbol: "EURUSD"}, {StockSymbol: "BTCUSD"}}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		// 23:00 UTC on a Monday is 19:00 in New York
+		{"after the US close", time.Date(2025, 3, 3, 23, 0, 0, 0, time.UTC), "EURUSD BTCUSD"},
+		{"Saturday", time.Date(2025, 3, 8, 15, 0, 0, 0, time.UTC), "BTCUSD"},
+	}
+	for _, tt := range tests {
+		symbols := []string{}
+		for _, stock := range f.trading(stocks, tt.at) {
+			symbols = append(symbols, stock.StockSymbol)
+		}
+		if got := strings.Join(symbols, " "); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+// Test that a symbol is quoted once a round and that a bad quote is
+// quarantined instead of alerting
+func TestFetcherQuarantinesBadQuotes(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	f := NewFetcher(repos)
+	f.alwaysOpen = true
+
+	calls := map[string]int{}
+	f.quotes = Quoters{models.InstrumentEquity: QuoteFunc(func(symbol string) (Quote, error) {
+		calls[symbol]++
+		if symbol == "BAD" {
+			return Quote{Price: decimal.Zero}, nil
+		}
+		return Quote{Price: decimal.NewFromInt(100)}, nil
+	})}
+	var quarantined []events.QuarantinedPrice
+	f.quarantine = func(price events.QuarantinedPrice) { quarantined = append(quarantined, price) }
+
+	// Thresholds out of reach, so nothing is published
+	for _, symbol := range []string{"AAPL", "AAPL", "BAD"} {
+		repos.Stocks.Create(&models.Stock{StockSymbol: symbol, ThresholdPrice: decimal.NewFromInt(1000)})
+	}
+	repos.Stocks.Create(&models.Stock{StockSymbol: "BAD", ThresholdPrice: decimal.NewFromInt(-1)})
+	f.checkStocks(time.Now())
+
+	if calls["AAPL"] != 1 || calls["BAD"] != 1 {
+		t.Errorf("Expected one quote per symbol, got %v", calls)
+	}
+	if len(quarantined) != 1 || quarantined[0].Symbol != "BAD" || quarantined[0].Reason != events.QuarantineNonPositive {
+		t.Errorf("Expected the zero price to be quarantined once, got %+v", quarantined)
+	}
+	if alerts, _ := repos.Alerts.ListUnnotified(); len(alerts) != 0 {
+		t.Errorf("Expected no alert from a quarantined price, got %+v", alerts)
+	}
+}
+
+// Test that a jump is quarantined until it is confirmed, and that the quote
+// confirming it sets off threshold alerts
+func TestFetcherAlertsOnAConfirmedJump(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	f := NewFetcher(repos)
+	f.alwaysOpen = true
+	f.quality = NewPriceValidator(QualityConfig{SpikeSigma: 6})
+
+	price := decimal.NewFromInt(100)
+	f.quotes = Quoters{models.InstrumentEquity: QuoteFunc(func(string) (Quote, error) {
+		return Quote{Price: price}, nil
+	})}
+	var quarantined []events.QuarantinedPrice
+	f.quarantine = func(q events.QuarantinedPrice) { quarantined = append(quarantined, q) }
+	var published []string
+	f.publish = func(symbol string, price decimal.Decimal) { published = append(published, symbol+" "+price.String()) }
+	repos.Stocks.Create(&models.Stock{StockSymbol: "AAPL", ThresholdPrice: decimal.NewFromInt(150)})
+
+	now := time.Date(2025, 3, 3, 15, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		price = decimal.NewFromInt(int64(100 + i%2))
+		f.checkStocks(now.Add(time.Duration(i) * time.Minute))
+	}
+	price = decimal.NewFromInt(200)
+	for i := 1; i <= spikeConfirmations; i++ {
+		f.checkStocks(now.Add(time.Hour + time.Duration(i)*time.Minute))
+	}
+
+	if len(quarantined) != spikeConfirmations-1 {
+		t.Errorf("Expected the jump quarantined until confirmed, got %+v", quarantined)
+	}
+	if strings.Join(published, ",") != "AAPL 200" {
+		t.Errorf("Expected the confirming quote to be published, got %v", published)
+	}
+	if alerts, _ := repos.Alerts.ListUnnotified(); len(alerts) != 1 || !alerts[0].Price.Equal(decimal.NewFromInt(200)) {
+		t.Errorf("Expected one threshold alert at 200, got %+v", alerts)
+	}
+}
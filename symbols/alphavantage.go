@@ -0,0 +1,87 @@
+package symbols
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"stock-alerts/models"
+)
+
+// alphaVantage searches symbols with Alpha Vantage's SYMBOL_SEARCH, the
+// provider prices are fetched from
+type alphaVantage struct {
+	apiKey string
+	base   string
+	client *http.Client
+}
+
+// AlphaVantageFromEnv returns a provider using ALPHA_VANTAGE_API_KEY, or nil
+// when the key is not set
+func AlphaVantageFromEnv() Provider {
+	apiKey := os.Getenv("ALPHA_VANTAGE_API_KEY")
+	if apiKey == "" {
+		return nil
+	}
+	return &alphaVantage{
+		apiKey: apiKey,
+		base:   "https://www.alphavantage.co/query",
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type searchResponse struct {
+	Matches []struct {
+		Symbol   string `json:"1. symbol"`
+		Name     string `json:"2. name"`
+		Type     string `json:"3. type"`
+		Region   string `json:"4. region"`
+		Currency string `json:"8. currency"`
+	} `json:"bestMatches"`
+	Note string `json:"Note"`
+}
+
+// regions maps the search's regions to exchange codes. The search does not
+// say which US exchange lists a symbol, so US matches are left without one.
+var regions = map[string]string{
+	"United Kingdom": "XLON",
+}
+
+func (a *alphaVantage) Search(q string) ([]models.Symbol, error) {
+	query := url.Values{"function": {"SYMBOL_SEARCH"}, "keywords": {q}, "apikey": {a.apiKey}}
+	resp, err := a.client.Get(a.base + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("symbol search returned %s", resp.Status)
+	}
+
+	var result searchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+	if result.Matches == nil && result.Note != "" {
+		return nil, fmt.Errorf("symbol search refused: %s", result.Note)
+	}
+
+	matches := make([]models.Symbol, 0, len(result.Matches))
+	for _, m := range result.Matches {
+		if len(m.Symbol) > 10 {
+			continue // longer than a stock's symbol column allows
+		}
+		matches = append(matches, models.Symbol{
+			Symbol:   strings.ToUpper(m.Symbol),
+			Name:     m.Name,
+			Exchange: regions[m.Region],
+			Currency: m.Currency,
+			Type:     models.InstrumentType(m.Type),
+		})
+	}
+	return matches, nil
+}
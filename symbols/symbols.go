@@ -0,0 +1,181 @@
+// Package symbols is the catalog of instruments prices can be fetched for.
+// It is seeded from a listing bundled with the binary and grows with the
+// matches of the price provider's symbol search and the FX and crypto pairs
+// looked up.
+package symbols
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"stock-alerts/calendar"
+	"stock-alerts/instruments"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+)
+
+//go:embed listing.csv
+var listing []byte
+
+// ErrUnknownSymbol is returned for symbols neither the catalog nor the provider knows
+var ErrUnknownSymbol = errors.New("unknown symbol")
+
+// ErrEmptyCatalog is returned instead of ErrUnknownSymbol while the catalog
+// holds no symbols at all, as then no symbol can be checked
+var ErrEmptyCatalog = errors.New("the symbol catalog is empty")
+
+// Bundled parses the listing shipped with the binary
+func Bundled() ([]models.Symbol, error) {
+	return parse(bytes.NewReader(listing))
+}
+
+// parse reads a symbol,name,exchange,currency,type,sector CSV with a header row
+func parse(r io.Reader) ([]models.Symbol, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read symbol listing: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	entries := make([]models.Symbol, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		if len(row) != 6 {
+			return nil, fmt.Errorf("symbol listing line %d: expected 6 fields, got %d", i+2, len(row))
+		}
+		entries = append(entries, models.Symbol{
+			Symbol:   strings.ToUpper(row[0]),
+			Name:     row[1],
+			Exchange: row[2],
+			Currency: row[3],
+			Type:     models.InstrumentType(row[4]),
+			Sector:   row[5],
+		})
+	}
+	return entries, nil
+}
+
+// pairEntry returns the entry of an FX or crypto pair, which the symbol search
+// does not know: it trades on the pair calendars and is priced in its quote
+// currency
+func pairEntry(symbol string) models.Symbol {
+	_, quote, _ := instruments.Split(symbol)
+	return models.Symbol{
+		Symbol:   symbol,
+		Name:     instruments.Name(symbol),
+		Exchange: calendar.ForSymbol(symbol).Code,
+		Currency: quote,
+		Type:     instruments.Classify(symbol),
+	}
+}
+
+// Provider searches the symbols a price provider knows
+type Provider interface {
+	Search(q string) ([]models.Symbol, error)
+}
+
+// Catalog answers symbol lookups and searches from the database, asking the
+// provider, when there is one, about symbols it does not hold yet
+type Catalog struct {
+	repo     repository.SymbolRepo
+	provider Provider
+}
+
+// NewCatalog returns a catalog; provider may be nil to use local data only
+func NewCatalog(repo repository.SymbolRepo, provider Provider) *Catalog {
+	return &Catalog{repo: repo, provider: provider}
+}
+
+// Seed loads the bundled listing into an empty catalog
+func (c *Catalog) Seed() error {
+	count, err := c.repo.Count()
+	if err != nil || count > 0 {
+		return err
+	}
+	entries, err := Bundled()
+	if err != nil {
+		return err
+	}
+	if err := c.repo.Upsert(entries); err != nil {
+		return err
+	}
+	log.Printf("📇 Symbol catalog seeded with %d symbols\n", len(entries))
+	return nil
+}
+
+// Lookup returns a symbol's entry, ErrUnknownSymbol if nobody knows it or
+// ErrEmptyCatalog if the catalog was never seeded
+func (c *Catalog) Lookup(symbol string) (*models.Symbol, error) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	entry, err := c.repo.Find(symbol)
+	if err == nil {
+		return entry, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if instruments.Classify(symbol).Pair() {
+		entry := pairEntry(symbol)
+		if err := c.repo.Upsert([]models.Symbol{entry}); err != nil {
+			return nil, err
+		}
+		return &entry, nil
+	}
+	if c.provider == nil || symbol == "" {
+		return nil, c.unknown()
+	}
+
+	matches, err := c.provider.Search(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("symbol search failed: %w", err)
+	}
+	for _, match := range matches {
+		if match.Symbol == symbol {
+			if err := c.repo.Upsert([]models.Symbol{match}); err != nil {
+				return nil, err
+			}
+			return &match, nil
+		}
+	}
+	return nil, c.unknown()
+}
+
+// unknown tells an unknown symbol from a catalog without any
+func (c *Catalog) unknown() error {
+	count, err := c.repo.Count()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrEmptyCatalog
+	}
+	return ErrUnknownSymbol
+}
+
+// Search returns up to limit entries matching q. The provider is only asked
+// when the catalog has no match, and what it finds is kept.
+func (c *Catalog) Search(q string, limit int) ([]models.Symbol, error) {
+	q = strings.TrimSpace(q)
+	results, err := c.repo.Search(q, limit)
+	if err != nil || len(results) > 0 || c.provider == nil {
+		return results, err
+	}
+
+	matches, err := c.provider.Search(q)
+	if err != nil {
+		return nil, fmt.Errorf("symbol search failed: %w", err)
+	}
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	if err := c.repo.Upsert(matches); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
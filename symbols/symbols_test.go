@@ -0,0 +1,159 @@
+package symbols
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"stock-alerts/calendar"
+	"stock-alerts/models"
+	"stock-alerts/repository"
+)
+
+func TestBundledListing(t *testing.T) {
+	entries, err := Bundled()
+	if err != nil {
+		t.Fatalf("Bundled failed: %v", err)
+	}
+	if len(entries) < 100 {
+		t.Errorf("Expected at least 100 bundled symbols, got %d", len(entries))
+	}
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if seen[e.Symbol] {
+			t.Errorf("Expected %s to be listed once", e.Symbol)
+		}
+		seen[e.Symbol] = true
+		if len(e.Symbol) > 10 || e.Name == "" || len(e.Currency) != 3 {
+			t.Errorf("Expected a complete entry, got %+v", e)
+		}
+		if _, ok := calendar.Lookup(e.Exchange); !ok {
+			t.Errorf("Expected %s to be listed on a known exchange, got %q", e.Symbol, e.Exchange)
+		}
+	}
+}
+
+func TestParseRejectsShortRows(t *testing.T) {
+	_, err := parse(strings.NewReader("symbol,name,exchange,currency,type,sector\nAAPL,Apple Inc.\n"))
+	if err == nil {
+		t.Errorf("Expected an error for a short row")
+	}
+}
+
+type fakeProvider struct {
+	calls   int
+	matches []models.Symbol
+}
+
+func (f *fakeProvider) Search(q string) ([]models.Symbol, error) {
+	f.calls++
+	return f.matches, nil
+}
+
+func TestCatalogLookup(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	provider := &fakeProvider{matches: []models.Symbol{
+		{Symbol: "RKLB.TRT", Name: "Rocket Lab USA Inc", Currency: "CAD", Type: "Equity"},
+		{Symbol: "RKLB", Name: "Rocket Lab USA Inc", Currency: "USD", Type: "Equity"},
+	}}
+	catalog := NewCatalog(repos.Symbols, provider)
+	if err := catalog.Seed(); err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+
+	entry, err := catalog.Lookup("aapl")
+	if err != nil || entry.Name != "Apple Inc." || entry.Exchange != "XNAS" {
+		t.Errorf("Expected the bundled AAPL entry, got %+v (%v)", entry, err)
+	}
+	if provider.calls != 0 {
+		t.Errorf("Expected the provider not to be asked about a known symbol")
+	}
+
+	entry, err = catalog.Lookup("RKLB")
+	if err != nil || entry.Currency != "USD" {
+		t.Errorf("Expected the provider's RKLB match, got %+v (%v)", entry, err)
+	}
+	if _, err := repos.Symbols.Find("RKLB"); err != nil {
+		t.Errorf("Expected RKLB to be kept in the catalog, got %v", err)
+	}
+
+	if _, err := catalog.Lookup("APPL"); !errors.Is(err, ErrUnknownSymbol) {
+		t.Errorf("Expected ErrUnknownSymbol, got %v", err)
+	}
+	if _, err := NewCatalog(repos.Symbols, nil).Lookup("ZZZZ"); !errors.Is(err, ErrUnknownSymbol) {
+		t.Errorf("Expected ErrUnknownSymbol without a provider, got %v", err)
+	}
+	empty := NewCatalog(repository.NewMemoryRepositories().Symbols, provider)
+	if _, err := empty.Lookup("APPL"); !errors.Is(err, ErrEmptyCatalog) {
+		t.Errorf("Expected ErrEmptyCatalog before seeding, got %v", err)
+	}
+}
+
+func TestCatalogLookupPairs(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	provider := &fakeProvider{}
+	catalog := NewCatalog(repos.Symbols, provider)
+
+	entry, err := catalog.Lookup("dogeeur")
+	if err != nil || entry.Symbol != "DOGEEUR" || entry.Type != models.InstrumentCrypto || entry.Exchange != "CRYPTO" || entry.Currency != "EUR" || entry.Name != "Dogecoin / EUR" {
+		t.Errorf("Expected a crypto entry for DOGEEUR, got %+v (%v)", entry, err)
+	}
+	entry, err = catalog.Lookup("USDJPY")
+	if err != nil || entry.Type != models.InstrumentFX || entry.Exchange != "FX" || entry.Currency != "JPY" {
+		t.Errorf("Expected an FX entry for USDJPY, got %+v (%v)", entry, err)
+	}
+	if provider.calls != 0 {
+		t.Errorf("Expected pairs not to be searched for, got %d provider calls", provider.calls)
+	}
+	if _, err := repos.Symbols.Find("DOGEEUR"); err != nil {
+		t.Errorf("Expected DOGEEUR to be kept in the catalog, got %v", err)
+	}
+}
+
+func TestCatalogSearchFallsBackToProvider(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	provider := &fakeProvider{matches: []models.Symbol{{Symbol: "RKLB", Name: "Rocket Lab USA Inc", Currency: "USD"}}}
+	catalog := NewCatalog(repos.Symbols, provider)
+	catalog.Seed()
+
+	if results, _ := catalog.Search("apple", 5); len(results) != 1 || results[0].Symbol != "AAPL" || provider.calls != 0 {
+		t.Errorf("Expected AAPL from the catalog alone, got %+v after %d provider calls", results, provider.calls)
+	}
+	if results, _ := catalog.Search("rocket", 5); len(results) != 1 || provider.calls != 1 {
+		t.Errorf("Expected the provider's match, got %+v after %d provider calls", results, provider.calls)
+	}
+	if results, _ := catalog.Search("rocket", 5); len(results) != 1 || provider.calls != 1 {
+		t.Errorf("Expected the kept match without asking again, got %+v after %d provider calls", results, provider.calls)
+	}
+}
+
+func TestAlphaVantageSearch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("function") != "SYMBOL_SEARCH" || r.URL.Query().Get("keywords") != "tesco" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"bestMatches": [
+			{"1. symbol": "TSCO.LON", "2. name": "Tesco PLC", "3. type": "Equity", "4. region": "United Kingdom", "8. currency": "GBX"},
+			{"1. symbol": "TSCDF", "2. name": "Tesco PLC", "3. type": "Equity", "4. region": "United States", "8. currency": "USD"}
+		]}`))
+	}))
+	defer server.Close()
+
+	provider := &alphaVantage{apiKey: "test", base: server.URL, client: server.Client()}
+	matches, err := provider.Search("tesco")
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(matches) != 2 || matches[0].Exchange != "XLON" || matches[0].Currency != "GBX" || matches[1].Exchange != "" {
+		t.Errorf("Expected the two Tesco listings, got %+v", matches)
+	}
+}
+
+func TestAlphaVantageFromEnvNeedsKey(t *testing.T) {
+	t.Setenv("ALPHA_VANTAGE_API_KEY", "")
+	if AlphaVantageFromEnv() != nil {
+		t.Errorf("Expected no provider without an API key")
+	}
+}
@@ -0,0 +1,149 @@
+package timeseries
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"stock-alerts/models"
+	"stock-alerts/repository"
+)
+
+// Config controls partitioning, retention and rollups
+type Config struct {
+	// RetentionDays is how long raw ticks are kept; 0 keeps them forever
+	RetentionDays int
+	// PartitionsAhead is how many months of partitions exist beyond the current one
+	PartitionsAhead int
+	// Backfill is how far back the first rollup of an empty table looks
+	Backfill time.Duration
+	// Lookback is how far before the newest bucket each rollup starts again,
+	// so ticks that arrive late or symbols that trail the others are counted
+	Lookback time.Duration
+}
+
+// ConfigFromEnv reads PRICE_RETENTION_DAYS, defaulting to 90 days of raw
+// ticks, and ROLLUP_LOOKBACK, defaulting to an hour
+func ConfigFromEnv() Config {
+	cfg := Config{RetentionDays: 90, PartitionsAhead: 2, Backfill: 7 * 24 * time.Hour, Lookback: time.Hour}
+	if v := os.Getenv("PRICE_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Printf("⚠️  Ignoring invalid PRICE_RETENTION_DAYS %q\n", v)
+		} else {
+			cfg.RetentionDays = days
+		}
+	}
+	if v := os.Getenv("ROLLUP_LOOKBACK"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			cfg.Lookback = d
+		} else {
+			log.Printf("⚠️  Ignoring invalid ROLLUP_LOOKBACK %q\n", v)
+		}
+	}
+	return cfg
+}
+
+// Maintainer keeps partitions ahead of time, rolls raw ticks up into bars
+// and drops expired raw history
+type Maintainer struct {
+	prices repository.PriceRepo
+	bars   repository.BarRepo
+	cfg    Config
+}
+
+// NewMaintainer wires the maintainer to the price and bar repositories
+func NewMaintainer(prices repository.PriceRepo, bars repository.BarRepo, cfg Config) *Maintainer {
+	return &Maintainer{prices: prices, bars: bars, cfg: cfg}
+}
+
+// Start runs the maintenance in the background at the given period
+func (m *Maintainer) Start(every time.Duration) {
+	ticker := time.NewTicker(every)
+	go func() {
+		for {
+			if err := m.RunOnce(time.Now()); err != nil {
+				log.Println("❌ Price history maintenance failed:", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// RunOnce performs one maintenance pass as of now
+func (m *Maintainer) RunOnce(now time.Time) error {
+	if err := m.prices.EnsurePartitions(now, m.cfg.PartitionsAhead+1); err != nil {
+		return err
+	}
+
+	// Rollups run before retention so no tick is dropped before it is counted
+	if err := m.rollupTicks(now); err != nil {
+		return err
+	}
+	for i := 1; i < len(models.BarIntervals); i++ {
+		if err := m.rollupBars(models.BarIntervals[i-1], models.BarIntervals[i], now); err != nil {
+			return err
+		}
+	}
+
+	if m.cfg.RetentionDays > 0 {
+		cutoff := now.AddDate(0, 0, -m.cfg.RetentionDays)
+		if err := m.prices.DeleteBefore(cutoff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollupStart is where a rollup resumes: the bucket Lookback before the
+// newest one, as the buckets since may have been partial when they were
+// written, or the backfill horizon for an empty table. The newest bucket is
+// that of any symbol, so one that trails the others relies on the lookback.
+func (m *Maintainer) rollupStart(interval models.BarInterval, now time.Time) (time.Time, error) {
+	latest, err := m.bars.LatestBucket(interval)
+	if errors.Is(err, repository.ErrNotFound) {
+		return BucketOf(now.Add(-m.cfg.Backfill), interval), nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return BucketOf(latest.Add(-m.cfg.Lookback), interval), nil
+}
+
+func (m *Maintainer) rollupTicks(now time.Time) error {
+	start, err := m.rollupStart(models.Interval1m, now)
+	if err != nil {
+		return err
+	}
+
+	// Read the raw ticks a day at a time; days are whole minutes, so no bar
+	// straddles two reads
+	for from := start; from.Before(now); from = from.Add(24 * time.Hour) {
+		to := from.Add(24 * time.Hour)
+		if to.After(now) {
+			to = now
+		}
+		records, err := m.prices.ListBetween(from, to)
+		if err != nil {
+			return err
+		}
+		if err := m.bars.Upsert(models.Interval1m, Aggregate(records, models.Interval1m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Maintainer) rollupBars(source, target models.BarInterval, now time.Time) error {
+	start, err := m.rollupStart(target, now)
+	if err != nil {
+		return err
+	}
+	bars, err := m.bars.ListBetween(source, start, now)
+	if err != nil {
+		return err
+	}
+	return m.bars.Upsert(target, Merge(bars, target))
+}
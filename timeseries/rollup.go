@@ -0,0 +1,84 @@
+// Package timeseries maintains the price history: monthly partitions,
+// retention of raw ticks and the 1m/1h/1d OHLC rollups.
+package timeseries
+
+import (
+	"sort"
+	"time"
+
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// BucketOf returns the start of the UTC-aligned bucket holding t
+func BucketOf(t time.Time, interval models.BarInterval) time.Time {
+	return t.UTC().Truncate(interval.Duration())
+}
+
+// Aggregate folds raw ticks into bars of the given interval.
+// Ticks must be ordered by time; bars come back ordered by bucket and symbol.
+func Aggregate(records []models.StockPriceRecord, interval models.BarInterval) []models.PriceBar {
+	bars := make([]models.PriceBar, 0)
+	index := map[string]int{}
+	for _, record := range records {
+		bucket := BucketOf(record.Timestamp, interval)
+		key := record.Symbol + "|" + bucket.Format(time.RFC3339)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(bars)
+			bars = append(bars, models.PriceBar{
+				Symbol: record.Symbol,
+				Bucket: bucket,
+				Open:   record.Price,
+				High:   record.Price,
+				Low:    record.Price,
+				Close:  record.Price,
+				Count:  1,
+			})
+			continue
+		}
+		bar := &bars[i]
+		bar.High = decimal.Max(bar.High, record.Price)
+		bar.Low = decimal.Min(bar.Low, record.Price)
+		bar.Close = record.Price
+		bar.Count++
+	}
+	sortBars(bars)
+	return bars
+}
+
+// Merge folds bars into coarser bars of the given interval.
+// Bars must be ordered by bucket; the result is ordered by bucket and symbol.
+func Merge(bars []models.PriceBar, interval models.BarInterval) []models.PriceBar {
+	merged := make([]models.PriceBar, 0)
+	index := map[string]int{}
+	for _, bar := range bars {
+		bucket := BucketOf(bar.Bucket, interval)
+		key := bar.Symbol + "|" + bucket.Format(time.RFC3339)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			bar.ID = 0
+			bar.Bucket = bucket
+			merged = append(merged, bar)
+			continue
+		}
+		m := &merged[i]
+		m.High = decimal.Max(m.High, bar.High)
+		m.Low = decimal.Min(m.Low, bar.Low)
+		m.Close = bar.Close
+		m.Count += bar.Count
+	}
+	sortBars(merged)
+	return merged
+}
+
+func sortBars(bars []models.PriceBar) {
+	sort.SliceStable(bars, func(i, j int) bool {
+		if !bars[i].Bucket.Equal(bars[j].Bucket) {
+			return bars[i].Bucket.Before(bars[j].Bucket)
+		}
+		return bars[i].Symbol < bars[j].Symbol
+	})
+}
@@ -0,0 +1,140 @@
+package timeseries
+
+import (
+	"testing"
+	"time"
+
+	"stock-alerts/models"
+	"stock-alerts/repository"
+
+	"github.com/shopspring/decimal"
+)
+
+var base = time.Date(2025, 3, 10, 14, 0, 0, 0, time.UTC)
+
+func tick(symbol string, offset time.Duration, price float64) models.StockPriceRecord {
+	return models.StockPriceRecord{Symbol: symbol, Timestamp: base.Add(offset), Price: decimal.NewFromFloat(price)}
+}
+
+func TestAggregate(t *testing.T) {
+	records := []models.StockPriceRecord{
+		tick("AAPL", 5*time.Second, 100),
+		tick("TSLA", 10*time.Second, 200),
+		tick("AAPL", 20*time.Second, 105),
+		tick("AAPL", 40*time.Second, 95),
+		tick("AAPL", 50*time.Second, 101),
+		tick("AAPL", 70*time.Second, 110),
+	}
+
+	bars := Aggregate(records, models.Interval1m)
+	if len(bars) != 3 {
+		t.Fatalf("Expected 3 bars, got %d: %+v", len(bars), bars)
+	}
+
+	first := bars[0]
+	if first.Symbol != "AAPL" || !first.Bucket.Equal(base) {
+		t.Errorf("Expected first bar AAPL at %v, got %s at %v", base, first.Symbol, first.Bucket)
+	}
+	if !first.Open.Equal(decimal.NewFromInt(100)) || !first.High.Equal(decimal.NewFromInt(105)) || !first.Low.Equal(decimal.NewFromInt(95)) || !first.Close.Equal(decimal.NewFromInt(101)) || first.Count != 4 {
+		t.Errorf("Unexpected OHLC for first bar: %+v", first)
+	}
+	if bars[1].Symbol != "TSLA" || !bars[2].Open.Equal(decimal.NewFromInt(110)) {
+		t.Errorf("Unexpected bar order: %+v", bars)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	minutes := Aggregate([]models.StockPriceRecord{
+		tick("AAPL", 0, 100),
+		tick("AAPL", 30*time.Minute, 120),
+		tick("AAPL", 59*time.Minute, 90),
+		tick("AAPL", 61*time.Minute, 95),
+	}, models.Interval1m)
+
+	hours := Merge(minutes, models.Interval1h)
+	if len(hours) != 2 {
+		t.Fatalf("Expected 2 hourly bars, got %d", len(hours))
+	}
+	if !hours[0].Open.Equal(decimal.NewFromInt(100)) || !hours[0].High.Equal(decimal.NewFromInt(120)) || !hours[0].Low.Equal(decimal.NewFromInt(90)) || !hours[0].Close.Equal(decimal.NewFromInt(90)) || hours[0].Count != 3 {
+		t.Errorf("Unexpected hourly bar: %+v", hours[0])
+	}
+}
+
+func TestMaintainerRollsUpAndExpires(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	old := models.StockPriceRecord{Symbol: "AAPL", Timestamp: base.AddDate(0, 0, -40), Price: decimal.NewFromInt(1)}
+	repos.Prices.Create(&old)
+	for _, record := range []models.StockPriceRecord{
+		tick("AAPL", 0, 100),
+		tick("AAPL", 90*time.Second, 102),
+		tick("AAPL", 2*time.Hour, 104),
+	} {
+		repos.Prices.Create(&record)
+	}
+
+	m := NewMaintainer(repos.Prices, repos.Bars, Config{RetentionDays: 30, Backfill: 24 * time.Hour})
+	now := base.Add(3 * time.Hour)
+	if err := m.RunOnce(now); err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+
+	minutes, _ := repos.Bars.List(models.Interval1m, "AAPL", base, now)
+	if len(minutes) != 3 {
+		t.Errorf("Expected 3 minute bars, got %d", len(minutes))
+	}
+	days, _ := repos.Bars.List(models.Interval1d, "AAPL", base.Truncate(24*time.Hour), now)
+	if len(days) != 1 || days[0].Count != 3 || !days[0].High.Equal(decimal.NewFromInt(104)) {
+		t.Errorf("Expected one daily bar covering 3 ticks, got %+v", days)
+	}
+
+	// A later tick in the same hour updates the existing bars instead of duplicating them
+	late := tick("AAPL", 2*time.Hour+30*time.Second, 108)
+	repos.Prices.Create(&late)
+	m.RunOnce(now.Add(time.Minute))
+	hours, _ := repos.Bars.List(models.Interval1h, "AAPL", base, now.Add(time.Minute))
+	if len(hours) != 2 || !hours[1].Close.Equal(decimal.NewFromInt(108)) || hours[1].Count != 2 {
+		t.Errorf("Expected the second hourly bar to include the late tick, got %+v", hours)
+	}
+
+	remaining, _ := repos.Prices.ListBetween(time.Time{}, now.Add(time.Hour))
+	for _, record := range remaining {
+		if record.Timestamp.Before(now.AddDate(0, 0, -30)) {
+			t.Errorf("Expected expired tick at %v to be deleted", record.Timestamp)
+		}
+	}
+}
+
+// Test that ticks arriving after newer bars were written, and symbols trailing
+// the others, are rolled up on the next pass
+func TestMaintainerRollsUpLateTicks(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	first := tick("AAPL", 2*time.Hour, 100)
+	repos.Prices.Create(&first)
+
+	m := NewMaintainer(repos.Prices, repos.Bars, Config{Backfill: 24 * time.Hour, Lookback: time.Hour})
+	now := base.Add(2*time.Hour + 5*time.Minute)
+	if err := m.RunOnce(now); err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+
+	// AAPL was rolled up to 2:00; MSFT and a late AAPL tick arrive for 1:30
+	for _, record := range []models.StockPriceRecord{tick("MSFT", 90*time.Minute, 50), tick("AAPL", 90*time.Minute, 90)} {
+		repos.Prices.Create(&record)
+	}
+	if err := m.RunOnce(now.Add(time.Minute)); err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+
+	for _, interval := range []models.BarInterval{models.Interval1m, models.Interval1h} {
+		if bars, _ := repos.Bars.List(interval, "MSFT", base, now); len(bars) != 1 || !bars[0].Close.Equal(decimal.NewFromInt(50)) {
+			t.Errorf("Expected the trailing symbol in the %s bars, got %+v", interval, bars)
+		}
+	}
+	if minutes, _ := repos.Bars.List(models.Interval1m, "AAPL", base, now); len(minutes) != 2 {
+		t.Errorf("Expected the late AAPL tick to get a minute bar, got %+v", minutes)
+	}
+	days, _ := repos.Bars.List(models.Interval1d, "AAPL", base.Truncate(24*time.Hour), now)
+	if len(days) != 1 || days[0].Count != 2 || !days[0].Low.Equal(decimal.NewFromInt(90)) {
+		t.Errorf("Expected the daily bar to count the late tick, got %+v", days)
+	}
+}
@@ -0,0 +1,149 @@
+// Package valuation prices portfolio positions at the latest known prices.
+package valuation
+
+import (
+	"sort"
+	"time"
+
+	"stock-alerts/fx"
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// PositionValue is a position marked to market
+type PositionValue struct {
+	Symbol           string
+	Quantity         decimal.Decimal
+	AvgCost          decimal.Decimal
+	Currency         string
+	CostBasis        decimal.Decimal
+	Priced           bool // false when no price has been persisted for the symbol
+	Price            decimal.Decimal
+	PricedAt         time.Time
+	MarketValue      decimal.Decimal
+	UnrealizedPnL    decimal.Decimal
+	UnrealizedPnLPct decimal.Decimal
+	BaseMarketValue  decimal.Decimal // MarketValue in the base currency, once converted
+}
+
+// Totals sums the priced positions of one currency
+type Totals struct {
+	CostBasis        decimal.Decimal
+	MarketValue      decimal.Decimal
+	UnrealizedPnL    decimal.Decimal
+	UnrealizedPnLPct decimal.Decimal
+}
+
+// Valuation is a whole portfolio marked to market
+type Valuation struct {
+	PortfolioID uint
+	Positions   []PositionValue
+	// Totals are kept per currency; positions without a price are left out
+	// of them and listed in Unpriced instead
+	Totals   map[string]Totals
+	Unpriced []string
+	// Base sums the totals in one currency; it is set by Convert
+	Base *BaseTotals `json:",omitempty"`
+}
+
+// BaseTotals are the totals of every currency converted to a base currency
+type BaseTotals struct {
+	Currency string
+	Totals
+	// Unconverted lists the currencies without a rate, left out of the totals
+	Unconverted []string
+}
+
+// Value marks the positions of a portfolio to the given prices
+func Value(portfolioID uint, positions []models.Position, prices map[string]models.StockPriceRecord) Valuation {
+	v := Valuation{
+		PortfolioID: portfolioID,
+		Positions:   make([]PositionValue, 0, len(positions)),
+		Totals:      map[string]Totals{},
+		Unpriced:    []string{},
+	}
+	for _, position := range positions {
+		if position.Currency == "" {
+			position.Currency = models.DefaultCurrency
+		}
+		pv := PositionValue{
+			Symbol:    position.Symbol,
+			Quantity:  position.Quantity,
+			AvgCost:   position.AvgCost,
+			Currency:  position.Currency,
+			CostBasis: position.Quantity.Mul(position.AvgCost),
+		}
+		price, ok := prices[position.Symbol]
+		if !ok {
+			v.Positions = append(v.Positions, pv)
+			v.Unpriced = append(v.Unpriced, position.Symbol)
+			continue
+		}
+
+		pv.Priced = true
+		pv.Price = price.Price
+		pv.PricedAt = price.Timestamp
+		pv.MarketValue = position.Quantity.Mul(price.Price)
+		pv.UnrealizedPnL = pv.MarketValue.Sub(pv.CostBasis)
+		pv.UnrealizedPnLPct = Percent(pv.UnrealizedPnL, pv.CostBasis)
+		v.Positions = append(v.Positions, pv)
+
+		totals := v.Totals[position.Currency]
+		totals.CostBasis = totals.CostBasis.Add(pv.CostBasis)
+		totals.MarketValue = totals.MarketValue.Add(pv.MarketValue)
+		totals.UnrealizedPnL = totals.UnrealizedPnL.Add(pv.UnrealizedPnL)
+		v.Totals[position.Currency] = totals
+	}
+	for currency, totals := range v.Totals {
+		totals.UnrealizedPnLPct = Percent(totals.UnrealizedPnL, totals.CostBasis)
+		v.Totals[currency] = totals
+	}
+	return v
+}
+
+// Convert sums the totals in the base currency at the given rates. Cost
+// basis is converted at today's rate too, so the P&L leaves out currency
+// moves since purchase.
+func (v *Valuation) Convert(base string, rates fx.Rates) {
+	v.Base = &BaseTotals{Currency: base, Unconverted: []string{}}
+	currencies := make([]string, 0, len(v.Totals))
+	for currency := range v.Totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		rate, ok := rates.Rate(currency, base)
+		if !ok {
+			v.Base.Unconverted = append(v.Base.Unconverted, currency)
+			continue
+		}
+		totals := v.Totals[currency]
+		v.Base.CostBasis = v.Base.CostBasis.Add(totals.CostBasis.Mul(rate))
+		v.Base.MarketValue = v.Base.MarketValue.Add(totals.MarketValue.Mul(rate))
+		v.Base.UnrealizedPnL = v.Base.UnrealizedPnL.Add(totals.UnrealizedPnL.Mul(rate))
+	}
+	v.Base.UnrealizedPnLPct = Percent(v.Base.UnrealizedPnL, v.Base.CostBasis)
+
+	for i, p := range v.Positions {
+		if rate, ok := rates.Rate(p.Currency, base); ok && p.Priced {
+			v.Positions[i].BaseMarketValue = p.MarketValue.Mul(rate)
+		}
+	}
+}
+
+// Converted reports whether every priced position could be converted to the
+// base currency
+func (v Valuation) Converted() bool {
+	return v.Base != nil && len(v.Base.Unconverted) == 0
+}
+
+// Percent returns part as a percentage of whole, or zero when whole is zero
+func Percent(part, whole decimal.Decimal) decimal.Decimal {
+	if whole.IsZero() {
+		return decimal.Zero
+	}
+	return part.Mul(hundred).Div(whole)
+}
+
+var hundred = decimal.NewFromInt(100)
@@ -0,0 +1,75 @@
+package valuation
+
+import (
+	"testing"
+	"time"
+
+	"stock-alerts/fx"
+	"stock-alerts/models"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestValue(t *testing.T) {
+	now := time.Now()
+	positions := []models.Position{
+		{Symbol: "AAPL", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(100), Currency: "USD"},
+		{Symbol: "MSFT", Quantity: decimal.NewFromInt(2), AvgCost: decimal.NewFromInt(300), Currency: "USD"},
+		{Symbol: "SAP", Quantity: decimal.NewFromInt(1), AvgCost: decimal.NewFromInt(150), Currency: "EUR"},
+		{Symbol: "NVDA", Quantity: decimal.NewFromInt(1), AvgCost: decimal.NewFromInt(500), Currency: "USD"},
+	}
+	prices := map[string]models.StockPriceRecord{
+		"AAPL": {Symbol: "AAPL", Price: decimal.NewFromInt(110), Timestamp: now},
+		"MSFT": {Symbol: "MSFT", Price: decimal.NewFromInt(270), Timestamp: now},
+		"SAP":  {Symbol: "SAP", Price: decimal.NewFromInt(165), Timestamp: now},
+	}
+
+	v := Value(7, positions, prices)
+
+	aapl := v.Positions[0]
+	if !aapl.Priced || !aapl.MarketValue.Equal(decimal.NewFromInt(1100)) || !aapl.UnrealizedPnL.Equal(decimal.NewFromInt(100)) || !aapl.UnrealizedPnLPct.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Unexpected AAPL valuation: %+v", aapl)
+	}
+	if v.Positions[3].Priced || len(v.Unpriced) != 1 || v.Unpriced[0] != "NVDA" {
+		t.Errorf("Expected NVDA to be unpriced, got %+v / %v", v.Positions[3], v.Unpriced)
+	}
+
+	usd := v.Totals["USD"]
+	if !usd.CostBasis.Equal(decimal.NewFromInt(1600)) || !usd.MarketValue.Equal(decimal.NewFromInt(1640)) || !usd.UnrealizedPnL.Equal(decimal.NewFromInt(40)) {
+		t.Errorf("Unexpected USD totals: %+v", usd)
+	}
+	if !usd.UnrealizedPnLPct.Equal(decimal.RequireFromString("2.5")) {
+		t.Errorf("Expected USD P&L of 2.5%%, got %s", usd.UnrealizedPnLPct)
+	}
+	if eur := v.Totals["EUR"]; !eur.UnrealizedPnL.Equal(decimal.NewFromInt(15)) {
+		t.Errorf("Expected EUR totals kept apart, got %+v", eur)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	now := time.Now()
+	positions := []models.Position{
+		{Symbol: "AAPL", Quantity: decimal.NewFromInt(10), AvgCost: decimal.NewFromInt(100), Currency: "USD"},
+		{Symbol: "TSCO.LON", Quantity: decimal.NewFromInt(1000), AvgCost: decimal.NewFromInt(250), Currency: "GBX"},
+		{Symbol: "7203.T", Quantity: decimal.NewFromInt(100), AvgCost: decimal.NewFromInt(2500), Currency: "JPY"},
+	}
+	prices := map[string]models.StockPriceRecord{
+		"AAPL":     {Symbol: "AAPL", Price: decimal.NewFromInt(110), Timestamp: now},
+		"TSCO.LON": {Symbol: "TSCO.LON", Price: decimal.NewFromInt(300), Timestamp: now},
+		"7203.T":   {Symbol: "7203.T", Price: decimal.NewFromInt(2600), Timestamp: now},
+	}
+
+	v := Value(7, positions, prices)
+	v.Convert("USD", fx.Rates{"GBPUSD": decimal.RequireFromString("1.25")})
+
+	if v.Base.Currency != "USD" || len(v.Base.Unconverted) != 1 || v.Base.Unconverted[0] != "JPY" || v.Converted() {
+		t.Errorf("Expected JPY left unconverted, got %+v", v.Base)
+	}
+	// 1100 USD plus 3000 GBP (300000 pence) at 1.25
+	if !v.Base.MarketValue.Equal(decimal.NewFromInt(4850)) || !v.Base.CostBasis.Equal(decimal.NewFromInt(4125)) {
+		t.Errorf("Expected 4850 USD of 4125 cost, got %+v", v.Base.Totals)
+	}
+	if !v.Positions[1].BaseMarketValue.Equal(decimal.NewFromInt(3750)) || !v.Positions[2].BaseMarketValue.IsZero() {
+		t.Errorf("Expected Tesco at 3750 USD and Toyota unconverted, got %+v", v.Positions)
+	}
+}